@@ -63,6 +63,7 @@ Remove blockchain and state databases`,
 			dbGetSlotsCmd,
 			dbDumpFreezerIndex,
 			ancientInspectCmd,
+			dbVerifyAncientsCmd,
 		},
 	}
 	dbInspectCmd = cli.Command{
@@ -84,7 +85,7 @@ Remove blockchain and state databases`,
 	dbStatCmd = cli.Command{
 		Action: utils.MigrateFlags(dbStats),
 		Name:   "stats",
-		Usage:  "Print leveldb statistics",
+		Usage:  "Print database statistics",
 		Flags: []cli.Flag{
 			utils.DataDirFlag,
 			utils.SyncModeFlag,
@@ -98,7 +99,7 @@ Remove blockchain and state databases`,
 	dbCompactCmd = cli.Command{
 		Action: utils.MigrateFlags(dbCompact),
 		Name:   "compact",
-		Usage:  "Compact leveldb database. WARNING: May take a very long time",
+		Usage:  "Compact database. WARNING: May take a very long time",
 		Flags: []cli.Flag{
 			utils.DataDirFlag,
 			utils.SyncModeFlag,
@@ -196,6 +197,47 @@ WARNING: This is a low-level operation which may cause database corruption!`,
 		},
 		Description: "This command displays information about the freezer index.",
 	}
+	ancientBackupFlag = cli.StringFlag{
+		Name:  "backup",
+		Usage: "Chain database directory of a backup of the same chain to restore the corrupted items from",
+	}
+	ancientNetworkFlag = cli.BoolFlag{
+		Name:  "network",
+		Usage: "Download the corrupted bodies and receipts left again from the network on the next start",
+	}
+	ancientChecksumsFlag = cli.BoolFlag{
+		Name:  "checksums",
+		Usage: "Add checksums to the ancient tables created without them, once no corrupted items are left",
+	}
+	dbVerifyAncientsCmd = cli.Command{
+		Action: utils.MigrateFlags(verifyAncients),
+		Name:   "verify-ancients",
+		Usage:  "Verify the integrity of the ancient store and repair the corrupted items",
+		Flags: []cli.Flag{
+			utils.DataDirFlag,
+			utils.AncientFlag,
+			utils.SyncModeFlag,
+			utils.MainnetFlag,
+			utils.RopstenFlag,
+			utils.RinkebyFlag,
+			utils.GoerliFlag,
+			utils.YoloV3Flag,
+			ancientBackupFlag,
+			ancientNetworkFlag,
+			ancientChecksumsFlag,
+		},
+		Description: `This command reads back every item of the ancient tables and reports the
+ranges failing their checksum or decompression. Tables created before checksums
+were introduced can only be checked for decompression failures, --checksums
+adds the checksums to them once no corrupted items are left.
+
+With --backup, the corrupted items are restored in place from a backup of the
+chain database of the same chain, its ancient store being expected in the
+ancient folder. With --network, the corrupted bodies and receipts left are
+downloaded again from the peers on the next start of the node, checked against
+the headers of their blocks and restored in place. Corrupted headers, hashes
+and total difficulties can only be restored from a backup.`,
+	}
 	ancientInspectCmd = cli.Command{
 		Action: utils.MigrateFlags(ancientInspect),
 		Name:   "inspect-reserved-oldest-blocks",
@@ -308,7 +350,12 @@ func ancientInspect(ctx *cli.Context) error {
 	return rawdb.AncientInspect(db)
 }
 
-func showLeveldbStats(db ethdb.Stater) {
+func showDBStats(db ethdb.Stater) {
+	// Pebble reports all its statistics in a single table
+	if stats, err := db.Stat("pebble.metrics"); err == nil {
+		fmt.Println(stats)
+		return
+	}
 	if stats, err := db.Stat("leveldb.stats"); err != nil {
 		log.Warn("Failed to read database stats", "error", err)
 	} else {
@@ -328,7 +375,7 @@ func dbStats(ctx *cli.Context) error {
 	db := utils.MakeChainDatabase(ctx, stack, true, false)
 	defer db.Close()
 
-	showLeveldbStats(db)
+	showDBStats(db)
 	return nil
 }
 
@@ -340,7 +387,7 @@ func dbCompact(ctx *cli.Context) error {
 	defer db.Close()
 
 	log.Info("Stats before compaction")
-	showLeveldbStats(db)
+	showDBStats(db)
 
 	log.Info("Triggering compaction")
 	if err := db.Compact(nil, nil); err != nil {
@@ -348,7 +395,7 @@ func dbCompact(ctx *cli.Context) error {
 		return err
 	}
 	log.Info("Stats after compaction")
-	showLeveldbStats(db)
+	showDBStats(db)
 	return nil
 }
 
@@ -527,3 +574,57 @@ func freezerInspect(ctx *cli.Context) error {
 	}
 	return nil
 }
+
+func verifyAncients(ctx *cli.Context) error {
+	stack, config := makeConfigNode(ctx)
+	defer stack.Close()
+
+	db := utils.MakeChainDatabase(ctx, stack, false, true)
+	ranges, err := rawdb.VerifyAncients(db)
+	if err != nil {
+		db.Close()
+		return err
+	}
+	if len(ranges) > 0 && ctx.GlobalIsSet(ancientBackupFlag.Name) {
+		path := ctx.GlobalString(ancientBackupFlag.Name)
+		log.Info("Opening backup chain database", "location", path)
+		backup, err := rawdb.NewKeyValueStoreWithFreezer(stack.Config().DBEngine, path, 16, utils.MakeDatabaseHandles(), filepath.Join(path, "ancient"), "", true, true, false, false)
+		if err != nil {
+			db.Close()
+			return err
+		}
+		ranges = rawdb.RepairAncients(db, backup, ranges)
+		backup.Close()
+	}
+	if len(ranges) > 0 && ctx.GlobalBool(ancientNetworkFlag.Name) {
+		var scheduled []rawdb.CorruptedRange
+		for _, r := range ranges {
+			if r.NetworkRepairable() {
+				scheduled = append(scheduled, r)
+			}
+		}
+		rawdb.WriteAncientRepairRanges(db, scheduled)
+		log.Info("Scheduled corrupted ancient items for download", "ranges", len(scheduled))
+	}
+	db.Close()
+
+	if len(ranges) == 0 {
+		fmt.Println("No corrupted ancient items")
+		if !ctx.GlobalBool(ancientChecksumsFlag.Name) {
+			return nil
+		}
+		path := config.Eth.DatabaseFreezer
+		switch {
+		case path == "":
+			path = filepath.Join(stack.ResolvePath("chaindata"), "ancient")
+		case !filepath.IsAbs(path):
+			path = config.Node.ResolvePath(path)
+		}
+		return rawdb.AddAncientChecksums(path)
+	}
+	fmt.Println("Corrupted ancient items:")
+	for _, r := range ranges {
+		fmt.Printf("  %v\n", r)
+	}
+	return fmt.Errorf("%d corrupted ancient ranges", len(ranges))
+}
@@ -65,6 +65,8 @@ var (
 		utils.BootnodesFlag,
 		utils.DataDirFlag,
 		utils.AncientFlag,
+		utils.DBEngineFlag,
+		utils.AncientZstdFlag,
 		utils.MinFreeDiskSpaceFlag,
 		utils.KeyStoreDirFlag,
 		utils.ExternalSignerFlag,
@@ -72,8 +74,10 @@ var (
 		utils.DirectBroadcastFlag,
 		utils.DisableSnapProtocolFlag,
 		utils.DiffSyncFlag,
+		utils.DiffSyncVerifyFlag,
 		utils.PipeCommitFlag,
 		utils.RangeLimitFlag,
+		utils.PendingStateFlag,
 		utils.USBFlag,
 		utils.SmartCardDaemonPathFlag,
 		utils.OverrideBerlinFlag,
@@ -97,11 +101,23 @@ var (
 		utils.TxPoolGlobalQueueFlag,
 		utils.TxPoolLifetimeFlag,
 		utils.TxPoolReannounceTimeFlag,
+		utils.TxPoolPrivateLifetimeFlag,
+		utils.TxPoolRulesFlag,
+		utils.TxPoolPrivatePeersFlag,
 		utils.SyncModeFlag,
 		utils.ExitWhenSyncedFlag,
 		utils.GCModeFlag,
 		utils.SnapshotFlag,
 		utils.TxLookupLimitFlag,
+		utils.HistoryBlocksFlag,
+		utils.StatePruningFlag,
+		utils.StatePruningRateFlag,
+		utils.StatePruningIntervalFlag,
+		utils.StateRegenFlag,
+		utils.StateRegenDepthFlag,
+		utils.StateRegenCacheFlag,
+		utils.ParallelTxFlag,
+		utils.ParallelTxWorkersFlag,
 		utils.LightServeFlag,
 		utils.LightIngressFlag,
 		utils.LightEgressFlag,
@@ -139,6 +155,7 @@ var (
 		utils.MinerRecommitIntervalFlag,
 		utils.MinerDelayLeftoverFlag,
 		utils.MinerNoVerfiyFlag,
+		utils.MinerBundlesFlag,
 		utils.NATFlag,
 		utils.NoDiscoverFlag,
 		utils.DiscoveryV5Flag,
@@ -161,6 +178,8 @@ var (
 		utils.GpoBlocksFlag,
 		utils.GpoPercentileFlag,
 		utils.GpoMaxGasPriceFlag,
+		utils.GpoModeFlag,
+		utils.GpoConfidenceFlag,
 		utils.EWASMInterpreterFlag,
 		utils.EVMInterpreterFlag,
 		utils.MinerNotifyFullFlag,
@@ -252,6 +271,8 @@ func init() {
 		utils.ShowDeprecated,
 		// See snapshot.go
 		snapshotCommand,
+		// See parliacmd.go
+		verifyParliaCommand,
 	}
 	sort.Sort(cli.CommandsByName(app.Commands))
 
@@ -0,0 +1,194 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of go-ethereum.
+//
+// go-ethereum is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-ethereum is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-ethereum. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"gopkg.in/urfave/cli.v1"
+
+	"github.com/ethereum/go-ethereum/cmd/utils"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/parlia"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/ethdb/memorydb"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+var (
+	verifyFromFlag = cli.Uint64Flag{
+		Name:  "from",
+		Usage: "Number of the first block to verify",
+		Value: 1,
+	}
+	verifyToFlag = cli.Uint64Flag{
+		Name:  "to",
+		Usage: "Number of the last block to verify (default = head)",
+	}
+	verifyParliaCommand = cli.Command{
+		Action:   utils.MigrateFlags(verifyParlia),
+		Name:     "verify-parlia",
+		Usage:    "Re-verify the Parlia consensus of stored blocks",
+		Category: "BLOCKCHAIN COMMANDS",
+		Flags: []cli.Flag{
+			utils.DataDirFlag,
+			utils.AncientFlag,
+			utils.CacheFlag,
+			verifyFromFlag,
+			verifyToFlag,
+		},
+		Description: `
+geth verify-parlia --from <number> --to <number>
+walks the canonical blocks of the local database within the given range and
+re-verifies them against the Parlia consensus rules, without syncing anything
+from the network. The validator snapshots are rebuilt from the stored
+checkpoints and every header is checked for its seal, difficulty, timestamp
+back-off and the other cascading fields.
+
+If the state of a block's parent is available, the block is re-executed as
+well, including the system transactions issued by Finalize (validator set
+checks at epochs, slashing and reward distribution), and the gas used, bloom,
+receipt root and state root are compared with the header.
+
+All divergences are reported, the command fails if any was found.
+`,
+	}
+)
+
+func verifyParlia(ctx *cli.Context) error {
+	stack, _ := makeConfigNode(ctx)
+	defer stack.Close()
+
+	// The database is opened read-only, the snapshot checkpoints rebuilt by the
+	// engine are only kept in memory
+	chaindb := utils.MakeChainDatabase(ctx, stack, true, false)
+	defer chaindb.Close()
+
+	genesisHash := rawdb.ReadCanonicalHash(chaindb, 0)
+	if genesisHash == (common.Hash{}) {
+		return errors.New("no genesis block found in the database")
+	}
+	config := rawdb.ReadChainConfig(chaindb, genesisHash)
+	if config == nil || config.Parlia == nil {
+		return errors.New("database does not contain a Parlia chain")
+	}
+	engine := parlia.New(config, newOverlayDatabase(chaindb), nil, genesisHash)
+	hc, err := core.NewHeaderChain(chaindb, config, engine, func() bool { return false })
+	if err != nil {
+		return err
+	}
+	head := rawdb.ReadHeadBlock(chaindb)
+	if head == nil {
+		return errors.New("no head block found in the database")
+	}
+	from, to := ctx.Uint64(verifyFromFlag.Name), head.NumberU64()
+	if ctx.IsSet(verifyToFlag.Name) {
+		to = ctx.Uint64(verifyToFlag.Name)
+	}
+	if from == 0 || from > to || to > head.NumberU64() {
+		return fmt.Errorf("invalid block range %d-%d, head is %d", from, to, head.NumberU64())
+	}
+	log.Info("Verifying Parlia blocks", "from", from, "to", to)
+
+	var (
+		sdb         = state.NewDatabase(chaindb)
+		statedb     *state.StateDB // State after the last executed block
+		executed    int
+		divergences int
+		start       = time.Now()
+		logged      = time.Now()
+	)
+	for number := from; number <= to; number++ {
+		hash := rawdb.ReadCanonicalHash(chaindb, number)
+		block := rawdb.ReadBlock(chaindb, hash, number)
+		if block == nil {
+			return fmt.Errorf("block #%d not found", number)
+		}
+		// Continue on the state of the previous block if it was verified, open
+		// the state of the parent otherwise, if available
+		if statedb == nil {
+			if parent := hc.GetHeader(block.ParentHash(), number-1); parent != nil {
+				statedb, _ = state.New(parent.Root, sdb, nil)
+			}
+		}
+		if statedb != nil {
+			executed++
+		}
+		if err := engine.ReplayBlock(hc, block, statedb); err != nil {
+			log.Error("Parlia divergence", "number", number, "hash", hash, "err", err)
+			divergences++
+			statedb = nil
+		}
+		if time.Since(logged) > 8*time.Second {
+			log.Info("Verifying Parlia blocks", "number", number, "executed", executed, "divergences", divergences, "elapsed", common.PrettyDuration(time.Since(start)))
+			logged = time.Now()
+		}
+	}
+	log.Info("Verified Parlia blocks", "from", from, "to", to, "executed", executed, "divergences", divergences, "elapsed", common.PrettyDuration(time.Since(start)))
+	if divergences > 0 {
+		return fmt.Errorf("found %d divergences", divergences)
+	}
+	return nil
+}
+
+// overlayDatabase serves reads from a read-only database, keeping any writes in
+// memory on top of it, so they are visible to later reads of the same process.
+type overlayDatabase struct {
+	ethdb.Database
+	mem ethdb.KeyValueStore
+}
+
+func newOverlayDatabase(db ethdb.Database) *overlayDatabase {
+	return &overlayDatabase{Database: db, mem: memorydb.New()}
+}
+
+// Has retrieves if a key is present in the memory overlay or the database.
+func (db *overlayDatabase) Has(key []byte) (bool, error) {
+	if ok, _ := db.mem.Has(key); ok {
+		return true, nil
+	}
+	return db.Database.Has(key)
+}
+
+// Get retrieves the given key from the memory overlay or the database.
+func (db *overlayDatabase) Get(key []byte) ([]byte, error) {
+	if blob, err := db.mem.Get(key); err == nil {
+		return blob, nil
+	}
+	return db.Database.Get(key)
+}
+
+// Put inserts the given value into the memory overlay.
+func (db *overlayDatabase) Put(key []byte, value []byte) error {
+	return db.mem.Put(key, value)
+}
+
+// Delete removes the key from the memory overlay. Keys of the database are
+// left untouched.
+func (db *overlayDatabase) Delete(key []byte) error {
+	return db.mem.Delete(key)
+}
+
+// NewBatch creates a write-only batch writing into the memory overlay.
+func (db *overlayDatabase) NewBatch() ethdb.Batch {
+	return db.mem.NewBatch()
+}
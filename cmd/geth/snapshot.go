@@ -33,6 +33,7 @@ import (
 	"github.com/ethereum/go-ethereum/core/state"
 	"github.com/ethereum/go-ethereum/core/state/pruner"
 	"github.com/ethereum/go-ethereum/core/state/snapshot"
+	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/ethdb"
 	"github.com/ethereum/go-ethereum/log"
@@ -174,10 +175,65 @@ verification. The default checking target is the HEAD state. It's basically iden
 to traverse-state, but the check granularity is smaller. 
 
 It's also usable without snapshot enabled.
+`,
+			},
+			{
+				Name:      "export",
+				Usage:     "Export the state of the snapshot into a portable state archive",
+				ArgsUsage: "<file>",
+				Action:    utils.MigrateFlags(exportSnapshot),
+				Category:  "MISCELLANEOUS COMMANDS",
+				Flags: []cli.Flag{
+					utils.DataDirFlag,
+					utils.AncientFlag,
+					utils.RopstenFlag,
+					utils.RinkebyFlag,
+					utils.GoerliFlag,
+					snapshotRootFlag,
+				},
+				Description: `
+geth snapshot export [--root <state-root>] <file>
+will stream the accounts, storages and contract codes of the specified state
+out of the snapshot into a state archive, along with the block the state belongs
+to. The archive is split into compressed and checksummed chunks, every range of
+accounts and storage slots carrying the proof of its boundaries against the
+state root.
+
+The state has to be one of the layers of the snapshot, within the recent 128
+blocks. The default exporting target is the HEAD state.
+`,
+			},
+			{
+				Name:      "import",
+				Usage:     "Import the state of a portable state archive",
+				ArgsUsage: "<file>",
+				Action:    utils.MigrateFlags(importSnapshot),
+				Category:  "MISCELLANEOUS COMMANDS",
+				Flags: []cli.Flag{
+					utils.DataDirFlag,
+					utils.AncientFlag,
+					utils.RopstenFlag,
+					utils.RinkebyFlag,
+					utils.GoerliFlag,
+				},
+				Description: `
+geth snapshot import <file>
+will verify every chunk of a state archive against the state root it carries,
+write the flat state as the snapshot of the database and regenerate the state
+tries out of it. The block the state belongs to becomes the head of the chain,
+the node syncs on from it on the next start.
+
+The database has to be initialized with the genesis block of the chain and must
+not hold any other block. An interrupted import is wiped when importing again.
 `,
 			},
 		},
 	}
+
+	snapshotRootFlag = cli.StringFlag{
+		Name:  "root",
+		Usage: "State root of the state to export (default = HEAD state)",
+	}
 )
 
 func accessDb(ctx *cli.Context, stack *node.Node) (ethdb.Database, error) {
@@ -616,3 +672,104 @@ func parseRoot(input string) (common.Hash, error) {
 	}
 	return h, nil
 }
+
+// exportSnapshot streams the state with the given root out of the snapshot into
+// a state archive.
+func exportSnapshot(ctx *cli.Context) error {
+	if ctx.NArg() != 1 {
+		log.Error("Missing archive file argument")
+		return errors.New("missing archive file")
+	}
+	stack, _ := makeConfigNode(ctx)
+	defer stack.Close()
+
+	chaindb := utils.MakeChainDatabase(ctx, stack, true, false)
+	headBlock := rawdb.ReadHeadBlock(chaindb)
+	if headBlock == nil {
+		log.Error("Failed to load head block")
+		return errors.New("no head block")
+	}
+	triedb := trie.NewDatabase(chaindb)
+	snaptree, err := snapshot.New(chaindb, triedb, 256, 128, headBlock.Root(), false, false, false)
+	if err != nil {
+		log.Error("Failed to open snapshot tree", "err", err)
+		return err
+	}
+	// Find the block of the requested state among the recent ones
+	header := headBlock.Header()
+	if ctx.GlobalIsSet(snapshotRootFlag.Name) {
+		root, err := parseRoot(ctx.GlobalString(snapshotRootFlag.Name))
+		if err != nil {
+			log.Error("Failed to resolve state root", "err", err)
+			return err
+		}
+		for i := 0; header != nil && header.Root != root && i < 128; i++ {
+			header = rawdb.ReadHeader(chaindb, header.ParentHash, header.Number.Uint64()-1)
+		}
+		if header == nil || header.Root != root {
+			log.Error("State root not found in the recent blocks", "root", root)
+			return errors.New("unknown state root")
+		}
+	}
+	var (
+		hash   = header.Hash()
+		number = header.Number.Uint64()
+		pivot  = &snapshot.ArchivePivot{
+			Header: header,
+			Body:   rawdb.ReadBody(chaindb, hash, number),
+			TD:     rawdb.ReadTd(chaindb, hash, number),
+		}
+	)
+	if pivot.Body == nil || pivot.TD == nil {
+		log.Error("Failed to load block of the state", "number", number, "hash", hash)
+		return errors.New("missing block")
+	}
+	for _, receipt := range rawdb.ReadRawReceipts(chaindb, hash, number) {
+		pivot.Receipts = append(pivot.Receipts, (*types.ReceiptForStorage)(receipt))
+	}
+	if len(pivot.Receipts) != len(pivot.Body.Transactions) {
+		log.Error("Failed to load receipts of the block of the state", "number", number, "hash", hash)
+		return errors.New("missing receipts")
+	}
+	file, err := os.Create(ctx.Args().First())
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	log.Info("Exporting state snapshot", "number", number, "hash", hash, "root", header.Root)
+	err = snapshot.ExportArchive(file, snaptree, triedb, chaindb, pivot)
+	if err != nil {
+		log.Error("Failed to export state snapshot", "err", err)
+		return err
+	}
+	return file.Sync()
+}
+
+// importSnapshot reads a state archive into the database and regenerates the
+// state tries out of it.
+func importSnapshot(ctx *cli.Context) error {
+	if ctx.NArg() != 1 {
+		log.Error("Missing archive file argument")
+		return errors.New("missing archive file")
+	}
+	stack, _ := makeConfigNode(ctx)
+	defer stack.Close()
+
+	chaindb := utils.MakeChainDatabase(ctx, stack, false, false)
+	defer chaindb.Close()
+
+	file, err := os.Open(ctx.Args().First())
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	header, err := snapshot.ImportArchive(file, chaindb)
+	if err != nil {
+		log.Error("Failed to import state snapshot", "err", err)
+		return err
+	}
+	log.Info("Imported state archive", "number", header.Number, "hash", header.Hash, "root", header.Root)
+	return nil
+}
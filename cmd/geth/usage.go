@@ -36,12 +36,15 @@ var AppHelpFlagGroups = []flags.FlagGroup{
 			configFileFlag,
 			utils.DataDirFlag,
 			utils.AncientFlag,
+			utils.DBEngineFlag,
+			utils.AncientZstdFlag,
 			utils.MinFreeDiskSpaceFlag,
 			utils.KeyStoreDirFlag,
 			utils.NoUSBFlag,
 			utils.DirectBroadcastFlag,
 			utils.DisableSnapProtocolFlag,
 			utils.RangeLimitFlag,
+			utils.PendingStateFlag,
 			utils.SmartCardDaemonPathFlag,
 			utils.NetworkIdFlag,
 			utils.MainnetFlag,
@@ -53,6 +56,15 @@ var AppHelpFlagGroups = []flags.FlagGroup{
 			utils.ExitWhenSyncedFlag,
 			utils.GCModeFlag,
 			utils.TxLookupLimitFlag,
+			utils.HistoryBlocksFlag,
+			utils.StatePruningFlag,
+			utils.StatePruningRateFlag,
+			utils.StatePruningIntervalFlag,
+			utils.StateRegenFlag,
+			utils.StateRegenDepthFlag,
+			utils.StateRegenCacheFlag,
+			utils.ParallelTxFlag,
+			utils.ParallelTxWorkersFlag,
 			utils.EthStatsURLFlag,
 			utils.IdentityFlag,
 			utils.LightKDFFlag,
@@ -111,6 +123,9 @@ var AppHelpFlagGroups = []flags.FlagGroup{
 			utils.TxPoolGlobalQueueFlag,
 			utils.TxPoolLifetimeFlag,
 			utils.TxPoolReannounceTimeFlag,
+			utils.TxPoolPrivateLifetimeFlag,
+			utils.TxPoolRulesFlag,
+			utils.TxPoolPrivatePeersFlag,
 		},
 	},
 	{
@@ -195,6 +210,7 @@ var AppHelpFlagGroups = []flags.FlagGroup{
 			utils.MinerRecommitIntervalFlag,
 			utils.MinerDelayLeftoverFlag,
 			utils.MinerNoVerfiyFlag,
+			utils.MinerBundlesFlag,
 		},
 	},
 	{
@@ -203,6 +219,8 @@ var AppHelpFlagGroups = []flags.FlagGroup{
 			utils.GpoBlocksFlag,
 			utils.GpoPercentileFlag,
 			utils.GpoMaxGasPriceFlag,
+			utils.GpoModeFlag,
+			utils.GpoConfidenceFlag,
 		},
 	},
 	{
@@ -127,18 +127,36 @@ var (
 		Usage: "Enable diffy sync, Please note that enable diffsync will improve the syncing speed, " +
 			"but will degrade the security to light client level",
 	}
+	DiffSyncVerifyFlag = cli.IntFlag{
+		Name:  "diffsync.verify",
+		Usage: "Number of peers asked to attest the diff layer of each new head, peers attesting another one than they sent are dropped (0 = disabled)",
+		Value: ethconfig.Defaults.DiffSyncVerifyPeers,
+	}
 	PipeCommitFlag = cli.BoolFlag{
 		Name:  "pipecommit",
 		Usage: "Enable MPT pipeline commit, it will improve syncing performance. It is an experimental feature(default is false), diffsync will be disable if pipeline commit is enabled",
 	}
+	PendingStateFlag = cli.BoolFlag{
+		Name:  "pendingstate",
+		Usage: "Enable the incremental pending state simulator, re-executing only new pool transactions (bot namespace)",
+	}
 	RangeLimitFlag = cli.BoolFlag{
 		Name:  "rangelimit",
 		Usage: "Enable 5000 blocks limit for range query",
 	}
+	DBEngineFlag = cli.StringFlag{
+		Name:  "db.engine",
+		Usage: "Backing database implementation to use ('leveldb' or 'pebble', default = engine of the existing database or leveldb)",
+		Value: "",
+	}
 	AncientFlag = DirectoryFlag{
 		Name:  "datadir.ancient",
 		Usage: "Data directory for ancient chain segments (default = inside chaindata)",
 	}
+	AncientZstdFlag = cli.BoolFlag{
+		Name:  "db.ancient.zstd",
+		Usage: "Compress new ancient bodies and receipts tables with zstd instead of snappy (existing tables are kept)",
+	}
 	DiffFlag = DirectoryFlag{
 		Name:  "datadir.diff",
 		Usage: "Data directory for difflayer segments (default = inside chaindata)",
@@ -246,6 +264,48 @@ var (
 		Usage: "Number of recent blocks to maintain transactions index for (default = about one year, 0 = entire chain)",
 		Value: ethconfig.Defaults.TxLookupLimit,
 	}
+	HistoryBlocksFlag = cli.Uint64Flag{
+		Name:  "history.blocks",
+		Usage: "Number of recent blocks to keep in the ancient store, older ones are pruned in the background (0 = entire chain)",
+		Value: ethconfig.Defaults.HistoryBlocks,
+	}
+	StatePruningFlag = cli.BoolFlag{
+		Name:  "pruning.online",
+		Usage: "Garbage collect stale state trie nodes in the background while running (requires snapshots)",
+	}
+	StatePruningRateFlag = cli.IntFlag{
+		Name:  "pruning.online.rate",
+		Usage: "Maximum number of trie nodes deleted per second by the online state pruner (0 = unlimited)",
+		Value: ethconfig.Defaults.StatePruningRate,
+	}
+	StatePruningIntervalFlag = cli.DurationFlag{
+		Name:  "pruning.online.interval",
+		Usage: "Pause between two online state pruning cycles",
+		Value: ethconfig.Defaults.StatePruningInterval,
+	}
+	StateRegenFlag = cli.BoolFlag{
+		Name:  "state.regen",
+		Usage: "Regenerate the historical states missing from the database on demand (e.g. after pruning)",
+	}
+	StateRegenDepthFlag = cli.Uint64Flag{
+		Name:  "state.regen.depth",
+		Usage: "Maximum number of blocks replayed to regenerate a historical state",
+		Value: ethconfig.Defaults.StateRegenDepth,
+	}
+	StateRegenCacheFlag = cli.IntFlag{
+		Name:  "state.regen.cache",
+		Usage: "Megabytes of memory allocated to the regenerated historical states",
+		Value: ethconfig.Defaults.StateRegenCache,
+	}
+	ParallelTxFlag = cli.BoolFlag{
+		Name:  "parallel.tx",
+		Usage: "Execute the transactions of imported blocks optimistically in parallel",
+	}
+	ParallelTxWorkersFlag = cli.IntFlag{
+		Name:  "parallel.tx.workers",
+		Usage: "Number of workers executing transactions in parallel",
+		Value: ethconfig.Defaults.ParallelTxWorkers,
+	}
 	LightKDFFlag = cli.BoolFlag{
 		Name:  "lightkdf",
 		Usage: "Reduce key-derivation RAM & CPU usage at some expense of KDF strength",
@@ -408,6 +468,20 @@ var (
 		Usage: "Duration for announcing local pending transactions again (default = 10 years, minimum = 1 minute)",
 		Value: ethconfig.Defaults.TxPool.ReannounceTime,
 	}
+	TxPoolPrivateLifetimeFlag = cli.Uint64Flag{
+		Name:  "txpool.privatelifetime",
+		Usage: "Number of blocks private transactions are kept in the pool before being dropped",
+		Value: ethconfig.Defaults.TxPool.PrivateLifetime,
+	}
+	TxPoolRulesFlag = cli.StringFlag{
+		Name:  "txpool.rules",
+		Usage: "JSON file of the content rules applied to remote transactions (reloadable via admin_reloadTxPoolRules)",
+	}
+	TxPoolPrivatePeersFlag = cli.StringFlag{
+		Name:  "txpool.privatepeers",
+		Usage: "Comma separated enode IDs of the trusted peers private transactions are relayed to",
+		Value: "",
+	}
 	// Performance tuning settings
 	CacheFlag = cli.IntFlag{
 		Name:  "cache",
@@ -513,6 +587,10 @@ var (
 		Name:  "miner.noverify",
 		Usage: "Disable remote sealing verification",
 	}
+	MinerBundlesFlag = cli.BoolFlag{
+		Name:  "miner.bundles",
+		Usage: "Place the bundles submitted via miner_sendBundle at the top of mined blocks",
+	}
 	// Account settings
 	UnlockedAccountFlag = cli.StringFlag{
 
@@ -734,6 +812,16 @@ var (
 		Usage: "Maximum gas price will be recommended by gpo",
 		Value: ethconfig.Defaults.GPO.MaxPrice.Int64(),
 	}
+	GpoModeFlag = cli.StringFlag{
+		Name:  "gpo.mode",
+		Usage: `Strategy of the suggested gas price ("percentile", "pool" or "congestion")`,
+		Value: gasprice.ModePercentile,
+	}
+	GpoConfidenceFlag = cli.IntFlag{
+		Name:  "gpo.confidence",
+		Usage: "Confidence in percent of landing in the next block targeted by the pool and congestion strategies",
+		Value: gasprice.DefaultConfidence,
+	}
 
 	// Metrics flags
 	MetricsEnabledFlag = cli.BoolFlag{
@@ -1298,6 +1386,16 @@ func SetNodeConfig(ctx *cli.Context, cfg *node.Config) {
 		cfg.ExternalSigner = ctx.GlobalString(ExternalSignerFlag.Name)
 	}
 
+	if ctx.GlobalIsSet(DBEngineFlag.Name) {
+		engine := ctx.GlobalString(DBEngineFlag.Name)
+		if engine != rawdb.DBLeveldb && engine != rawdb.DBPebble {
+			Fatalf("Invalid choice for db.engine '%s', allowed 'leveldb' or 'pebble'", engine)
+		}
+		cfg.DBEngine = engine
+	}
+	if ctx.GlobalIsSet(AncientZstdFlag.Name) {
+		cfg.AncientZstd = ctx.GlobalBool(AncientZstdFlag.Name)
+	}
 	if ctx.GlobalIsSet(KeyStoreDirFlag.Name) {
 		cfg.KeyStoreDir = ctx.GlobalString(KeyStoreDirFlag.Name)
 	}
@@ -1387,6 +1485,12 @@ func setGPO(ctx *cli.Context, cfg *gasprice.Config, light bool) {
 	if ctx.GlobalIsSet(GpoMaxGasPriceFlag.Name) {
 		cfg.MaxPrice = big.NewInt(ctx.GlobalInt64(GpoMaxGasPriceFlag.Name))
 	}
+	if ctx.GlobalIsSet(GpoModeFlag.Name) {
+		cfg.Mode = ctx.GlobalString(GpoModeFlag.Name)
+	}
+	if ctx.GlobalIsSet(GpoConfidenceFlag.Name) {
+		cfg.Confidence = ctx.GlobalInt(GpoConfidenceFlag.Name)
+	}
 }
 
 func setTxPool(ctx *cli.Context, cfg *core.TxPoolConfig) {
@@ -1433,6 +1537,12 @@ func setTxPool(ctx *cli.Context, cfg *core.TxPoolConfig) {
 	if ctx.GlobalIsSet(TxPoolReannounceTimeFlag.Name) {
 		cfg.ReannounceTime = ctx.GlobalDuration(TxPoolReannounceTimeFlag.Name)
 	}
+	if ctx.GlobalIsSet(TxPoolPrivateLifetimeFlag.Name) {
+		cfg.PrivateLifetime = ctx.GlobalUint64(TxPoolPrivateLifetimeFlag.Name)
+	}
+	if ctx.GlobalIsSet(TxPoolRulesFlag.Name) {
+		cfg.Rules = ctx.GlobalString(TxPoolRulesFlag.Name)
+	}
 }
 
 func setEthash(ctx *cli.Context, cfg *ethconfig.Config) {
@@ -1488,6 +1598,9 @@ func setMiner(ctx *cli.Context, cfg *miner.Config) {
 	if ctx.GlobalIsSet(MinerNoVerfiyFlag.Name) {
 		cfg.Noverify = ctx.GlobalBool(MinerNoVerfiyFlag.Name)
 	}
+	if ctx.GlobalBool(MinerBundlesFlag.Name) {
+		cfg.Ordering = miner.NewBundleOrdering()
+	}
 }
 
 func setWhitelist(ctx *cli.Context, cfg *ethconfig.Config) {
@@ -1567,6 +1680,13 @@ func SetEthConfig(ctx *cli.Context, stack *node.Node, cfg *ethconfig.Config) {
 	if ctx.GlobalIsSet(LightServeFlag.Name) && ctx.GlobalUint64(TxLookupLimitFlag.Name) != 0 {
 		log.Warn("LES server cannot serve old transaction status and cannot connect below les/4 protocol version if transaction lookup index is limited")
 	}
+	if ctx.GlobalString(GCModeFlag.Name) == "archive" && ctx.GlobalUint64(HistoryBlocksFlag.Name) != 0 {
+		ctx.GlobalSet(HistoryBlocksFlag.Name, "0")
+		log.Warn("Disable block history pruning for archive node")
+	}
+	if ctx.GlobalString(GCModeFlag.Name) == "archive" && ctx.GlobalBool(StatePruningFlag.Name) {
+		Fatalf("Online state pruning (--%s) is not supported in archive mode", StatePruningFlag.Name)
+	}
 	var ks *keystore.KeyStore
 	if keystores := stack.AccountManager().Backends(keystore.KeyStoreType); len(keystores) > 0 {
 		ks = keystores[0].(*keystore.KeyStore)
@@ -1636,12 +1756,21 @@ func SetEthConfig(ctx *cli.Context, stack *node.Node, cfg *ethconfig.Config) {
 	if ctx.GlobalIsSet(DiffSyncFlag.Name) {
 		cfg.DiffSync = ctx.GlobalBool(DiffSyncFlag.Name)
 	}
+	if ctx.GlobalIsSet(DiffSyncVerifyFlag.Name) {
+		cfg.DiffSyncVerifyPeers = ctx.GlobalInt(DiffSyncVerifyFlag.Name)
+	}
 	if ctx.GlobalIsSet(PipeCommitFlag.Name) {
 		cfg.PipeCommit = ctx.GlobalBool(PipeCommitFlag.Name)
 	}
 	if ctx.GlobalIsSet(RangeLimitFlag.Name) {
 		cfg.RangeLimit = ctx.GlobalBool(RangeLimitFlag.Name)
 	}
+	if ctx.GlobalIsSet(PendingStateFlag.Name) {
+		cfg.PendingState = ctx.GlobalBool(PendingStateFlag.Name)
+	}
+	if ctx.GlobalIsSet(TxPoolPrivatePeersFlag.Name) {
+		cfg.PrivateTxPeers = SplitAndTrim(ctx.GlobalString(TxPoolPrivatePeersFlag.Name))
+	}
 	// Read the value from the flag no matter if it's set or not.
 	cfg.Preimages = ctx.GlobalBool(CachePreimagesFlag.Name)
 	if cfg.NoPruning && !cfg.Preimages {
@@ -1651,6 +1780,36 @@ func SetEthConfig(ctx *cli.Context, stack *node.Node, cfg *ethconfig.Config) {
 	if ctx.GlobalIsSet(TxLookupLimitFlag.Name) {
 		cfg.TxLookupLimit = ctx.GlobalUint64(TxLookupLimitFlag.Name)
 	}
+	if ctx.GlobalIsSet(HistoryBlocksFlag.Name) {
+		cfg.HistoryBlocks = ctx.GlobalUint64(HistoryBlocksFlag.Name)
+	}
+	if ctx.GlobalIsSet(StatePruningFlag.Name) {
+		cfg.StatePruning = ctx.GlobalBool(StatePruningFlag.Name)
+	}
+	if ctx.GlobalIsSet(StatePruningRateFlag.Name) {
+		cfg.StatePruningRate = ctx.GlobalInt(StatePruningRateFlag.Name)
+	}
+	if ctx.GlobalIsSet(StatePruningIntervalFlag.Name) {
+		cfg.StatePruningInterval = ctx.GlobalDuration(StatePruningIntervalFlag.Name)
+	}
+	if ctx.GlobalIsSet(StateRegenFlag.Name) {
+		cfg.StateRegen = ctx.GlobalBool(StateRegenFlag.Name)
+	}
+	if ctx.GlobalIsSet(StateRegenDepthFlag.Name) {
+		cfg.StateRegenDepth = ctx.GlobalUint64(StateRegenDepthFlag.Name)
+	}
+	if ctx.GlobalIsSet(StateRegenCacheFlag.Name) {
+		cfg.StateRegenCache = ctx.GlobalInt(StateRegenCacheFlag.Name)
+	}
+	if ctx.GlobalIsSet(ParallelTxFlag.Name) {
+		cfg.ParallelTx = ctx.GlobalBool(ParallelTxFlag.Name)
+	}
+	if ctx.GlobalIsSet(ParallelTxWorkersFlag.Name) {
+		cfg.ParallelTxWorkers = ctx.GlobalInt(ParallelTxWorkersFlag.Name)
+	}
+	if ctx.GlobalIsSet(BloomFilterSizeFlag.Name) {
+		cfg.StatePruningBloomSize = ctx.GlobalUint64(BloomFilterSizeFlag.Name)
+	}
 	if ctx.GlobalIsSet(CacheFlag.Name) || ctx.GlobalIsSet(CacheTrieFlag.Name) {
 		cfg.TrieCleanCache = ctx.GlobalInt(CacheFlag.Name) * ctx.GlobalInt(CacheTrieFlag.Name) / 100
 	}
@@ -17,12 +17,39 @@
 package parlia
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/consensus"
+	"github.com/ethereum/go-ethereum/core/systemcontracts"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/rpc"
 )
 
+const (
+	maxScheduleCount       = 1024  // Maximum number of heights returned by a schedule query
+	maxValidatorStatsRange = 10000 // Maximum number of blocks scanned by a stats query
+)
+
+var (
+	// errInvalidScheduleCount is returned if a schedule is requested for zero or
+	// too many heights.
+	errInvalidScheduleCount = fmt.Errorf("schedule count must be between 1 and %d", maxScheduleCount)
+
+	// errScheduleTooFar is returned if a schedule is requested for heights more
+	// than an epoch past the chain head, which can't be predicted meaningfully.
+	errScheduleTooFar = errors.New("schedule start beyond one epoch past the head")
+
+	// errInvalidStatsRange is returned if the validator stats are requested for an
+	// empty, genesis including or too large block range.
+	errInvalidStatsRange = fmt.Errorf("stats range must be within 1 and %d blocks, excluding genesis", maxValidatorStatsRange)
+)
+
 // API is a user facing RPC API to allow query snapshot and validators
 type API struct {
 	chain  consensus.ChainHeaderReader
@@ -86,3 +113,220 @@ func (api *API) GetValidatorsAtHash(hash common.Hash) ([]common.Address, error)
 	}
 	return snap.validators(), nil
 }
+
+// ScheduleCandidate is a validator allowed to propose the block at a given height.
+type ScheduleCandidate struct {
+	Validator   common.Address `json:"validator"`
+	Difficulty  *hexutil.Big   `json:"difficulty"`  // Difficulty of the block if proposed by the validator
+	BackOffTime uint64         `json:"backOffTime"` // Delay in seconds applied to out-of-turn validators
+	Timestamp   uint64         `json:"timestamp"`   // Earliest timestamp of the block if proposed by the validator
+}
+
+// ScheduleEntry is the expected proposal of the block at a given height.
+type ScheduleEntry struct {
+	Number     uint64               `json:"number"`
+	InTurn     common.Address       `json:"inTurn"`     // Validator whose turn it is to propose
+	Proposer   common.Address       `json:"proposer"`   // Expected proposer, the in-turn one unless it signed recently
+	Difficulty *hexutil.Big         `json:"difficulty"` // Difficulty of the expected proposal
+	Timestamp  uint64               `json:"timestamp"`  // Earliest timestamp of the expected proposal
+	Candidates []*ScheduleCandidate `json:"candidates"` // Validators allowed to propose, earliest first
+}
+
+// GetSchedule retrieves the expected proposers of count blocks starting at the
+// given height. Heights beyond the chain head are predicted from the snapshot
+// of the head, assuming every block is sealed by its earliest candidate at its
+// earliest timestamp. Validator set changes not yet visible in the chain are not
+// accounted for, hence predictions are limited to one epoch past the head and
+// the schedule is cut short at that height.
+func (api *API) GetSchedule(fromBlock rpc.BlockNumber, count hexutil.Uint64) ([]*ScheduleEntry, error) {
+	if count == 0 || count > maxScheduleCount {
+		return nil, errInvalidScheduleCount
+	}
+	head := api.chain.CurrentHeader()
+	from := head.Number.Uint64() + 1
+	if fromBlock >= 0 {
+		from = uint64(fromBlock.Int64())
+	}
+	if from == 0 {
+		return nil, errors.New("genesis block has no proposer")
+	}
+	last := head.Number.Uint64() + 1 + api.parlia.config.Epoch
+	if from > last {
+		return nil, errScheduleTooFar
+	}
+	if from+uint64(count)-1 > last {
+		count = hexutil.Uint64(last - from + 1)
+	}
+	var (
+		snap       *Snapshot
+		parentTime uint64
+		entries    = make([]*ScheduleEntry, 0, count)
+	)
+	// Start from the parent of the first height or the head, whichever is lower
+	number := from
+	if number > head.Number.Uint64()+1 {
+		number = head.Number.Uint64() + 1
+	}
+	for ; number < from+uint64(count); number++ {
+		// Use the real chain as long as it reaches, simulate the blocks beyond
+		if number <= head.Number.Uint64()+1 {
+			parent := api.chain.GetHeaderByNumber(number - 1)
+			if parent == nil {
+				return nil, errUnknownBlock
+			}
+			s, err := api.parlia.snapshot(api.chain, parent.Number.Uint64(), parent.Hash(), nil)
+			if err != nil {
+				return nil, err
+			}
+			snap, parentTime = s, parent.Time
+		}
+		entry := api.schedule(snap, parentTime)
+		if number >= from {
+			entries = append(entries, entry)
+		}
+		snap, parentTime = snap.copy(), entry.Timestamp
+		if limit := uint64(len(snap.Validators)/2 + 1); number >= limit {
+			delete(snap.Recents, number-limit)
+		}
+		snap.Recents[number] = entry.Proposer
+		snap.Number, snap.Hash = number, common.Hash{}
+	}
+	return entries, nil
+}
+
+// schedule computes the proposal candidates of the block following the snapshot.
+func (api *API) schedule(snap *Snapshot, parentTime uint64) *ScheduleEntry {
+	var (
+		number     = snap.Number + 1
+		validators = snap.validators()
+		entry      = &ScheduleEntry{
+			Number: number,
+			InTurn: snap.supposeValidator(),
+		}
+	)
+	// Validators which signed recently may not propose, the oldest of them is
+	// released by the block itself
+	recents := make(map[common.Address]bool)
+	limit := uint64(len(validators)/2 + 1)
+	for seen, val := range snap.Recents {
+		if number < limit || seen > number-limit {
+			recents[val] = true
+		}
+	}
+	ramanujan := api.parlia.chainConfig.IsRamanujan(new(big.Int).SetUint64(number))
+	for _, val := range validators {
+		if recents[val] {
+			continue
+		}
+		candidate := &ScheduleCandidate{
+			Validator:  val,
+			Difficulty: (*hexutil.Big)(CalcDifficulty(snap, val)),
+		}
+		if ramanujan {
+			candidate.BackOffTime = backOffTime(snap, val)
+		}
+		candidate.Timestamp = parentTime + api.parlia.config.Period + candidate.BackOffTime
+		entry.Candidates = append(entry.Candidates, candidate)
+	}
+	sort.SliceStable(entry.Candidates, func(i, j int) bool {
+		if entry.Candidates[i].Timestamp != entry.Candidates[j].Timestamp {
+			return entry.Candidates[i].Timestamp < entry.Candidates[j].Timestamp
+		}
+		return entry.Candidates[i].Difficulty.ToInt().Cmp(entry.Candidates[j].Difficulty.ToInt()) > 0
+	})
+	if len(entry.Candidates) > 0 {
+		first := entry.Candidates[0]
+		entry.Proposer, entry.Difficulty, entry.Timestamp = first.Validator, first.Difficulty, first.Timestamp
+	}
+	return entry
+}
+
+// ValidatorStats is the sealing activity of a validator over a block range.
+type ValidatorStats struct {
+	Signed  uint64 `json:"signed"`  // Blocks sealed by the validator
+	InTurn  uint64 `json:"inTurn"`  // Blocks sealed by the validator in its turn
+	Missed  uint64 `json:"missed"`  // Blocks sealed by another validator in its turn
+	Slashed uint64 `json:"slashed"` // Slash calls observed against the validator
+}
+
+// ValidatorStatsResult is the sealing activity of all validators over a block range.
+type ValidatorStatsResult struct {
+	From       uint64                             `json:"from"`
+	To         uint64                             `json:"to"`
+	Validators map[common.Address]*ValidatorStats `json:"validators"`
+}
+
+// GetValidatorStats retrieves the blocks signed and missed by every validator
+// within the given block range, along with the slash system transactions
+// included against them. The end of the range defaults to the chain head.
+func (api *API) GetValidatorStats(fromBlock rpc.BlockNumber, toBlock *rpc.BlockNumber) (*ValidatorStatsResult, error) {
+	head := api.chain.CurrentHeader().Number.Uint64()
+	from, to := head, head
+	if fromBlock >= 0 {
+		from = uint64(fromBlock.Int64())
+	}
+	if toBlock != nil && *toBlock >= 0 {
+		to = uint64(toBlock.Int64())
+	}
+	if from == 0 || to < from || to-from >= maxValidatorStatsRange {
+		return nil, errInvalidStatsRange
+	}
+	result := &ValidatorStatsResult{
+		From:       from,
+		To:         to,
+		Validators: make(map[common.Address]*ValidatorStats),
+	}
+	stats := func(val common.Address) *ValidatorStats {
+		if result.Validators[val] == nil {
+			result.Validators[val] = new(ValidatorStats)
+		}
+		return result.Validators[val]
+	}
+	// Slash calls are only visible in the block bodies
+	reader, _ := api.chain.(consensus.ChainReader)
+	slash := api.parlia.slashABI.Methods["slash"]
+
+	for number := from; number <= to; number++ {
+		header := api.chain.GetHeaderByNumber(number)
+		if header == nil {
+			return nil, errUnknownBlock
+		}
+		snap, err := api.parlia.snapshot(api.chain, number-1, header.ParentHash, nil)
+		if err != nil {
+			return nil, err
+		}
+		stats(header.Coinbase).Signed++
+		if inturn := snap.supposeValidator(); inturn == header.Coinbase {
+			stats(header.Coinbase).InTurn++
+		} else {
+			stats(inturn).Missed++
+		}
+		if reader == nil {
+			continue
+		}
+		block := reader.GetBlock(header.Hash(), number)
+		if block == nil {
+			return nil, errUnknownBlock
+		}
+		for _, tx := range block.Transactions() {
+			if tx.To() == nil || *tx.To() != common.HexToAddress(systemcontracts.SlashContract) {
+				continue
+			}
+			if system, _ := api.parlia.IsSystemTransaction(tx, header); !system {
+				continue
+			}
+			data := tx.Data()
+			if len(data) < 4 || !bytes.Equal(data[:4], slash.ID) {
+				continue
+			}
+			args, err := slash.Inputs.Unpack(data[4:])
+			if err != nil || len(args) != 1 {
+				continue
+			}
+			if val, ok := args[0].(common.Address); ok {
+				stats(val).Slashed++
+			}
+		}
+	}
+	return result, nil
+}
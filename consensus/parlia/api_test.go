@@ -0,0 +1,166 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package parlia
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rpc"
+	lru "github.com/hashicorp/golang-lru"
+)
+
+// testScheduleChain is a header chain backing the schedule API in tests.
+type testScheduleChain struct {
+	headers []*types.Header // Headers indexed by number
+}
+
+func newTestScheduleChain(length int) *testScheduleChain {
+	chain := new(testScheduleChain)
+	for i := 0; i < length; i++ {
+		header := &types.Header{Number: big.NewInt(int64(i)), Time: uint64(1000 + 3*i)}
+		if i > 0 {
+			header.ParentHash = chain.headers[i-1].Hash()
+		}
+		chain.headers = append(chain.headers, header)
+	}
+	return chain
+}
+
+func (c *testScheduleChain) Config() *params.ChainConfig { return params.BSCChainConfig }
+func (c *testScheduleChain) CurrentHeader() *types.Header {
+	return c.headers[len(c.headers)-1]
+}
+func (c *testScheduleChain) GetHeader(hash common.Hash, number uint64) *types.Header {
+	if header := c.GetHeaderByNumber(number); header != nil && header.Hash() == hash {
+		return header
+	}
+	return nil
+}
+func (c *testScheduleChain) GetHeaderByNumber(number uint64) *types.Header {
+	if number < uint64(len(c.headers)) {
+		return c.headers[number]
+	}
+	return nil
+}
+func (c *testScheduleChain) GetHeaderByHash(hash common.Hash) *types.Header {
+	for _, header := range c.headers {
+		if header.Hash() == hash {
+			return header
+		}
+	}
+	return nil
+}
+func (c *testScheduleChain) GetHighestVerifiedHeader() *types.Header {
+	return c.CurrentHeader()
+}
+
+func TestSchedule(t *testing.T) {
+	validators := []common.Address{{1}, {2}, {3}, {4}, {5}}
+	api := &API{parlia: &Parlia{chainConfig: params.BSCChainConfig, config: params.BSCChainConfig.Parlia}}
+
+	// The in-turn validator proposes if it didn't sign recently
+	snap := newSnapshot(params.BSCChainConfig.Parlia, nil, 99, common.Hash{}, validators, nil)
+	entry := api.schedule(snap, 1000)
+	if entry.Number != 100 || entry.InTurn != validators[0] || entry.Proposer != validators[0] {
+		t.Fatalf("in-turn entry mismatch: have number %d, in-turn %x, proposer %x", entry.Number, entry.InTurn, entry.Proposer)
+	}
+	if entry.Difficulty.ToInt().Cmp(diffInTurn) != 0 || entry.Timestamp != 1003 {
+		t.Errorf("in-turn proposal mismatch: have difficulty %v, timestamp %d", entry.Difficulty, entry.Timestamp)
+	}
+	if len(entry.Candidates) != len(validators) {
+		t.Errorf("candidate count mismatch: have %d, want %d", len(entry.Candidates), len(validators))
+	}
+	// Recent signers are skipped, the earliest out-of-turn validator takes over
+	snap.Recents[97] = validators[2]
+	snap.Recents[98] = validators[1]
+	snap.Recents[99] = validators[0]
+
+	entry = api.schedule(snap, 1000)
+	if len(entry.Candidates) != 3 {
+		t.Fatalf("candidate count mismatch: have %d, want 3", len(entry.Candidates))
+	}
+	var (
+		want  common.Address
+		delay uint64
+	)
+	for _, val := range validators[2:] {
+		if d := backOffTime(snap, val); want == (common.Address{}) || d < delay {
+			want, delay = val, d
+		}
+	}
+	if entry.Proposer != want || entry.Timestamp != 1003+delay || entry.Difficulty.ToInt().Cmp(diffNoTurn) != 0 {
+		t.Errorf("out-of-turn proposal mismatch: have %x at %d, want %x at %d", entry.Proposer, entry.Timestamp, want, 1003+delay)
+	}
+	for i := 1; i < len(entry.Candidates); i++ {
+		if entry.Candidates[i-1].Timestamp > entry.Candidates[i].Timestamp {
+			t.Errorf("candidates not ordered by timestamp")
+		}
+	}
+}
+
+// Tests that the schedule API predicts the proposers past the head and refuses
+// or cuts short the heights beyond one epoch.
+func TestGetSchedule(t *testing.T) {
+	var (
+		validators = []common.Address{{1}, {2}, {3}, {4}, {5}}
+		chain      = newTestScheduleChain(3)
+		head       = chain.CurrentHeader()
+		config     = &params.ParliaConfig{Period: 3, Epoch: 10}
+		snaps, _   = lru.NewARC(inMemorySnapshots)
+	)
+	snaps.Add(head.Hash(), newSnapshot(config, nil, head.Number.Uint64(), head.Hash(), validators, nil))
+	api := &API{
+		chain:  chain,
+		parlia: &Parlia{chainConfig: params.BSCChainConfig, config: config, recentSnaps: snaps},
+	}
+	// Every validator proposes in turn as long as it didn't sign recently
+	entries, err := api.GetSchedule(rpc.PendingBlockNumber, 4)
+	if err != nil {
+		t.Fatalf("failed to retrieve schedule: %v", err)
+	}
+	if len(entries) != 4 {
+		t.Fatalf("entry count mismatch: have %d, want %d", len(entries), 4)
+	}
+	for i, entry := range entries {
+		number := head.Number.Uint64() + 1 + uint64(i)
+		if entry.Number != number || entry.Proposer != entry.InTurn {
+			t.Errorf("entry %d: mismatch: have number %d, proposer %x, in-turn %x", i, entry.Number, entry.Proposer, entry.InTurn)
+		}
+		if want := head.Time + config.Period*uint64(i+1); entry.Timestamp != want {
+			t.Errorf("entry %d: timestamp mismatch: have %d, want %d", i, entry.Timestamp, want)
+		}
+	}
+	// Schedules reaching past one epoch from the head are cut short
+	last := head.Number.Uint64() + 1 + config.Epoch
+	if entries, err = api.GetSchedule(rpc.BlockNumber(last-1), 5); err != nil || len(entries) != 2 || entries[1].Number != last {
+		t.Errorf("clamped schedule mismatch: have %d entries, err %v", len(entries), err)
+	}
+	// Invalid ranges are rejected
+	if _, err := api.GetSchedule(rpc.BlockNumber(last+1), 1); err != errScheduleTooFar {
+		t.Errorf("far schedule error mismatch: have %v, want %v", err, errScheduleTooFar)
+	}
+	for _, count := range []hexutil.Uint64{0, maxScheduleCount + 1} {
+		if _, err := api.GetSchedule(rpc.PendingBlockNumber, count); err != errInvalidScheduleCount {
+			t.Errorf("count %d: error mismatch: have %v, want %v", count, err, errInvalidScheduleCount)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package parlia
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/systemcontracts"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/trie"
+)
+
+// replayChain is the chain reader used while replaying a block. It carries the
+// state of the parent, which may not be available in the database.
+type replayChain struct {
+	consensus.ChainHeaderReader
+	parentHash  common.Hash
+	parentState *state.StateDB
+}
+
+// callOnState executes a read-only call against the state of the given block,
+// it backs the system contract queries of an engine running without a node.
+func (p *Parlia) callOnState(chain consensus.ChainHeaderReader, blockHash common.Hash, number uint64, to common.Address, data []byte) ([]byte, error) {
+	header := chain.GetHeader(blockHash, number)
+	if header == nil {
+		return nil, errUnknownBlock
+	}
+	var statedb *state.StateDB
+	if rc, ok := chain.(*replayChain); ok && rc.parentState != nil && rc.parentHash == blockHash {
+		statedb = rc.parentState.Copy()
+	} else {
+		var err error
+		if statedb, err = state.New(header.Root, state.NewDatabase(p.db), nil); err != nil {
+			return nil, err
+		}
+	}
+	msg := p.getSystemMessage(common.Address{}, to, data, common.Big0)
+	context := core.NewEVMBlockContext(header, chainContext{Chain: chain, parlia: p}, nil)
+	vmenv := vm.NewEVM(context, vm.TxContext{Origin: msg.From(), GasPrice: big.NewInt(0)}, statedb, p.chainConfig, vm.Config{})
+
+	ret, _, err := vmenv.StaticCall(vm.AccountRef(msg.From()), *msg.To(), msg.Data(), msg.Gas())
+	return ret, err
+}
+
+// ReplayBlock re-verifies a stored block against the consensus rules. The seal
+// and the cascading header fields are always checked. If the state of the parent
+// is given, the block is re-executed on top of it, including the system
+// transactions issued by Finalize, and the results are checked against the
+// header. The state is modified in place.
+func (p *Parlia) ReplayBlock(chain consensus.ChainHeaderReader, block *types.Block, statedb *state.StateDB) error {
+	header := block.Header()
+	if err := p.verifyHeader(chain, header, nil); err != nil {
+		return fmt.Errorf("invalid header: %w", err)
+	}
+	if err := p.VerifyUncles(nil, block); err != nil {
+		return err
+	}
+	if statedb == nil {
+		return nil
+	}
+	rc := &replayChain{ChainHeaderReader: chain, parentHash: header.ParentHash}
+	if header.Number.Uint64()%p.config.Epoch == 0 {
+		// The validator set is checked against the parent state at epochs
+		rc.parentState = statedb.Copy()
+	}
+	var (
+		cx        = chainContext{Chain: rc, parlia: p}
+		usedGas   = new(uint64)
+		gp        = new(core.GasPool).AddGas(header.GasLimit)
+		txs       = make([]*types.Transaction, 0, len(block.Transactions()))
+		systemTxs = make([]*types.Transaction, 0, 2)
+		receipts  = make([]*types.Receipt, 0, len(block.Transactions()))
+	)
+	// Handle upgrade build-in system contract code
+	systemcontracts.UpgradeBuildInSystemContract(p.chainConfig, header.Number, statedb)
+
+	for i, tx := range block.Transactions() {
+		if isSystemTx, err := p.IsSystemTransaction(tx, header); err != nil {
+			return fmt.Errorf("tx %d [%v]: %w", i, tx.Hash().Hex(), err)
+		} else if isSystemTx {
+			systemTxs = append(systemTxs, tx)
+			continue
+		}
+		statedb.Prepare(tx.Hash(), block.Hash(), i)
+		receipt, err := core.ApplyTransaction(p.chainConfig, cx, nil, gp, statedb, header, tx, usedGas, vm.Config{})
+		if err != nil {
+			return fmt.Errorf("could not apply tx %d [%v]: %w", i, tx.Hash().Hex(), err)
+		}
+		receipt.Bloom = types.CreateBloom(types.Receipts{receipt})
+		txs = append(txs, tx)
+		receipts = append(receipts, receipt)
+	}
+	if err := p.Finalize(rc, header, statedb, &txs, block.Uncles(), &receipts, &systemTxs, usedGas); err != nil {
+		return fmt.Errorf("finalize failed: %w", err)
+	}
+	// Validate the results against the header, same as the block validator
+	if *usedGas != header.GasUsed {
+		return fmt.Errorf("invalid gas used (remote: %d local: %d)", header.GasUsed, *usedGas)
+	}
+	if bloom := types.CreateBloom(receipts); bloom != header.Bloom {
+		return fmt.Errorf("invalid bloom (remote: %x  local: %x)", header.Bloom, bloom)
+	}
+	if hash := types.DeriveSha(types.Receipts(receipts), trie.NewStackTrie(nil)); hash != header.ReceiptHash {
+		return fmt.Errorf("invalid receipt root hash (remote: %x local: %x)", header.ReceiptHash, hash)
+	}
+	if root := statedb.IntermediateRoot(p.chainConfig.IsEIP158(header.Number)); root != header.Root {
+		return fmt.Errorf("invalid merkle root (remote: %x local: %x)", header.Root, root)
+	}
+	return nil
+}
@@ -0,0 +1,198 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package parlia
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/trie"
+)
+
+var (
+	replayValKey, _    = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+	replaySenderKey, _ = crypto.HexToECDSA("8a1f9a8f95be41cd7ccb6168179afb4504aefe388d1e14474d32c45c72ce7b7a")
+	replayContract     = common.Address{0xcc}
+)
+
+// sealReplayHeader signs the header with the given key.
+func sealReplayHeader(t *testing.T, header *types.Header, config *params.ChainConfig, key *ecdsa.PrivateKey) {
+	t.Helper()
+
+	sig, err := crypto.Sign(SealHash(header, config.ChainID).Bytes(), key)
+	if err != nil {
+		t.Fatalf("failed to seal header: %v", err)
+	}
+	copy(header.Extra[len(header.Extra)-extraSeal:], sig)
+}
+
+// Tests that stored blocks are re-verified and re-executed against the consensus
+// rules, and that divergences of the seal and the state are reported.
+func TestReplayBlock(t *testing.T) {
+	var (
+		db     = rawdb.NewMemoryDatabase()
+		val    = crypto.PubkeyToAddress(replayValKey.PublicKey)
+		sender = crypto.PubkeyToAddress(replaySenderKey.PublicKey)
+		config = *params.BSCChainConfig
+	)
+	config.Parlia = &params.ParliaConfig{Period: 3, Epoch: 200}
+
+	// The contract returns 42 on any call
+	extra := make([]byte, extraVanity+common.AddressLength+extraSeal)
+	copy(extra[extraVanity:], val.Bytes())
+	genesis := (&core.Genesis{
+		Config:    &config,
+		ExtraData: extra,
+		GasLimit:  30000000,
+		Timestamp: uint64(time.Now().Unix()) - 60,
+		Alloc: core.GenesisAlloc{
+			sender:         {Balance: big.NewInt(params.Ether)},
+			replayContract: {Code: common.FromHex("602a60005260206000f3"), Balance: common.Big0},
+		},
+	}).MustCommit(db)
+
+	engine := New(&config, db, nil, genesis.Hash())
+	hc, err := core.NewHeaderChain(db, &config, engine, func() bool { return false })
+	if err != nil {
+		t.Fatalf("failed to create header chain: %v", err)
+	}
+	newHeader := func(parent *types.Header) *types.Header {
+		return &types.Header{
+			ParentHash: parent.Hash(),
+			UncleHash:  types.EmptyUncleHash,
+			Coinbase:   val,
+			Root:       parent.Root,
+			TxHash:     types.EmptyRootHash,
+			Difficulty: new(big.Int).Set(diffInTurn),
+			Number:     new(big.Int).Add(parent.Number, common.Big1),
+			GasLimit:   parent.GasLimit,
+			Time:       parent.Time + config.Parlia.Period,
+			Extra:      make([]byte, extraVanity+extraSeal),
+		}
+	}
+	// Block 1 is empty, it is only verified against the consensus rules
+	header1 := newHeader(genesis.Header())
+	header1.ReceiptHash = types.EmptyRootHash
+	sealReplayHeader(t, header1, &config, replayValKey)
+	block1 := types.NewBlockWithHeader(header1)
+	rawdb.WriteHeader(db, header1)
+	rawdb.WriteCanonicalHash(db, header1.Hash(), 1)
+
+	if err := engine.ReplayBlock(hc, block1, nil); err != nil {
+		t.Fatalf("failed to verify block 1: %v", err)
+	}
+	// Block 2 transfers funds, its results are computed on a copy of the state
+	parentState, err := state.New(header1.Root, state.NewDatabase(db), nil)
+	if err != nil {
+		t.Fatalf("failed to open parent state: %v", err)
+	}
+	tx, _ := types.SignTx(types.NewTransaction(0, common.Address{0xde, 0xad}, big.NewInt(1000), params.TxGas, common.Big0, nil), types.LatestSigner(&config), replaySenderKey)
+
+	header2 := newHeader(header1)
+	var (
+		statedb = parentState.Copy()
+		gp      = new(core.GasPool).AddGas(header2.GasLimit)
+		usedGas = new(uint64)
+	)
+	statedb.Prepare(tx.Hash(), common.Hash{}, 0)
+	receipt, err := core.ApplyTransaction(&config, chainContext{Chain: hc, parlia: engine}, &val, gp, statedb, header2, tx, usedGas, vm.Config{})
+	if err != nil {
+		t.Fatalf("failed to apply transaction: %v", err)
+	}
+	header2.GasUsed = *usedGas
+	header2.Bloom = types.CreateBloom(types.Receipts{receipt})
+	header2.Root = statedb.IntermediateRoot(true)
+	block2 := types.NewBlock(header2, []*types.Transaction{tx}, nil, []*types.Receipt{receipt}, trie.NewStackTrie(nil))
+	header2 = block2.Header()
+	sealReplayHeader(t, header2, &config, replayValKey)
+	block2 = block2.WithSeal(header2)
+
+	if err := engine.ReplayBlock(hc, block2, parentState.Copy()); err != nil {
+		t.Fatalf("failed to replay block 2: %v", err)
+	}
+	// A diverging parent state is reported
+	tampered := parentState.Copy()
+	tampered.AddBalance(common.Address{0xff}, common.Big1)
+	if err := engine.ReplayBlock(hc, block2, tampered); err == nil {
+		t.Errorf("block replayed on a diverging state")
+	}
+	// A block sealed by an unauthorized key is refused before execution
+	forged := block2.Header()
+	sealReplayHeader(t, forged, &config, replaySenderKey)
+	if err := engine.ReplayBlock(hc, block2.WithSeal(forged), parentState.Copy()); !errors.Is(err, errCoinBaseMisMatch) {
+		t.Errorf("forged seal: have %v, want %v", err, errCoinBaseMisMatch)
+	}
+}
+
+// Tests that system contract queries are served from the state in the database,
+// or from the parent state carried by the replay chain.
+func TestCallOnState(t *testing.T) {
+	var (
+		db     = rawdb.NewMemoryDatabase()
+		config = *params.BSCChainConfig
+	)
+	config.Parlia = &params.ParliaConfig{Period: 3, Epoch: 200}
+
+	genesis := (&core.Genesis{
+		Config:    &config,
+		ExtraData: make([]byte, extraVanity+extraSeal),
+		GasLimit:  30000000,
+		Alloc: core.GenesisAlloc{
+			replayContract: {Code: common.FromHex("602a60005260206000f3"), Balance: common.Big0},
+		},
+	}).MustCommit(db)
+
+	engine := New(&config, db, nil, genesis.Hash())
+	hc, err := core.NewHeaderChain(db, &config, engine, func() bool { return false })
+	if err != nil {
+		t.Fatalf("failed to create header chain: %v", err)
+	}
+	ret, err := engine.callOnState(hc, genesis.Hash(), 0, replayContract, nil)
+	if err != nil {
+		t.Fatalf("failed to call contract: %v", err)
+	}
+	if want := common.LeftPadBytes([]byte{42}, 32); !bytes.Equal(ret, want) {
+		t.Errorf("result mismatch: have %x, want %x", ret, want)
+	}
+	// The parent state of a replay takes precedence over the database
+	override, _ := state.New(genesis.Root(), state.NewDatabase(db), nil)
+	override.SetCode(replayContract, common.FromHex("600760005260206000f3"))
+	rc := &replayChain{ChainHeaderReader: hc, parentHash: genesis.Hash(), parentState: override}
+
+	ret, err = engine.callOnState(rc, genesis.Hash(), 0, replayContract, nil)
+	if err != nil {
+		t.Fatalf("failed to call contract on the parent state: %v", err)
+	}
+	if want := common.LeftPadBytes([]byte{7}, 32); !bytes.Equal(ret, want) {
+		t.Errorf("result mismatch: have %x, want %x", ret, want)
+	}
+	if _, err := engine.callOnState(hc, common.Hash{0x01}, 1, replayContract, nil); err != errUnknownBlock {
+		t.Errorf("unknown block: have %v, want %v", err, errUnknownBlock)
+	}
+}
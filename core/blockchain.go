@@ -77,6 +77,8 @@ var (
 	blockReorgDropMeter     = metrics.NewRegisteredMeter("chain/reorg/drop", nil)
 	blockReorgInvalidatedTx = metrics.NewRegisteredMeter("chain/reorg/invalidTx", nil)
 
+	diffLayerDisputeMeter = metrics.NewRegisteredMeter("chain/difflayer/disputed", nil)
+
 	errInsertionInterrupted        = errors.New("insertion is interrupted")
 	errStateRootVerificationFailed = errors.New("state root verification failed")
 )
@@ -195,6 +197,14 @@ type BlockChain struct {
 	txLookupLimit uint64
 	triesInMemory uint64
 
+	// historyBlocks is the number of recent blocks retained in the ancient
+	// store, 0 means the history is not pruned.
+	historyBlocks uint64
+	prunedLock    sync.RWMutex
+	prunedRanges  []PrunedRange // Most recent ranges deleted by the history pruner
+
+	statePruner StatePruner // Online state pruner notified of trie commits, nil if disabled
+
 	hc            *HeaderChain
 	rmLogsFeed    event.Feed
 	chainFeed     event.Feed
@@ -234,6 +244,7 @@ type BlockChain struct {
 	diffHashToPeers       map[common.Hash]map[string]struct{}              // map[diffHash]map[pid]
 	diffNumToBlockHashes  map[uint64]map[common.Hash]struct{}              // map[number]map[blockHash]
 	diffPeersToDiffHashes map[string]map[common.Hash]struct{}              // map[pid]map[diffHash]
+	diffDisputeFeed       event.Feed                                       // Feed of the diff layers found not to match their block
 
 	quit          chan struct{}  // blockchain quit channel
 	wg            sync.WaitGroup // chain processing wait group for shutting down
@@ -247,6 +258,8 @@ type BlockChain struct {
 	vmConfig   vm.Config
 	pipeCommit bool
 
+	parallelTxWorkers int // Number of workers executing transactions in parallel, sequential if not above one
+
 	shouldPreserve  func(*types.Block) bool        // Function used to determine whether should preserve the given block.
 	terminateInsert func(common.Hash, uint64) bool // Testing hook used to terminate ancient receipt chain insertion.
 }
@@ -453,6 +466,10 @@ func NewBlockChain(db ethdb.Database, cacheConfig *CacheConfig, chainConfig *par
 		bc.wg.Add(1)
 		go bc.maintainTxIndex(txIndexBlock)
 	}
+	if bc.historyBlocks > 0 {
+		bc.wg.Add(1)
+		go bc.maintainHistory()
+	}
 	// If periodic cache journal is required, spin it up.
 	if bc.cacheConfig.TrieCleanRejournal > 0 {
 		if bc.cacheConfig.TrieCleanRejournal < time.Minute {
@@ -468,8 +485,10 @@ func NewBlockChain(db ethdb.Database, cacheConfig *CacheConfig, chainConfig *par
 	}
 	// Need persist and prune diff layer
 	if bc.db.DiffStore() != nil {
+		bc.wg.Add(1)
 		go bc.trustedDiffLayerLoop()
 	}
+	bc.wg.Add(1)
 	go bc.untrustedDiffLayerPruneLoop()
 	if bc.pipeCommit {
 		// check current block and rewind invalid one
@@ -816,6 +835,15 @@ func (bc *BlockChain) Snapshots() *snapshot.Tree {
 	return bc.snaps
 }
 
+// SetStatePruner registers the online state pruner to be notified whenever a
+// state trie is committed to disk.
+func (bc *BlockChain) SetStatePruner(pruner StatePruner) {
+	bc.commitLock.Lock()
+	defer bc.commitLock.Unlock()
+
+	bc.statePruner = pruner
+}
+
 // CurrentFastBlock retrieves the current fast-sync head block of the canonical
 // chain. The block is retrieved from the blockchain's internal cache.
 func (bc *BlockChain) CurrentFastBlock() *types.Block {
@@ -1764,6 +1792,9 @@ func (bc *BlockChain) writeBlockWithState(block *types.Block, receipts []*types.
 							}
 							// Flush an entire trie and restart the counters
 							triedb.Commit(header.Root, true, nil)
+							if bc.statePruner != nil {
+								bc.statePruner.Committed(header.Root, chosen)
+							}
 							lastWrite = chosen
 							bc.gcproc = 0
 						}
@@ -2578,7 +2609,6 @@ func (bc *BlockChain) rewindInvalidHeaderBlockLoop() {
 
 func (bc *BlockChain) trustedDiffLayerLoop() {
 	recheck := time.NewTicker(diffLayerFreezerRecheckInterval)
-	bc.wg.Add(1)
 	defer func() {
 		bc.wg.Done()
 		recheck.Stop()
@@ -2682,6 +2712,20 @@ func (bc *BlockChain) GetUnTrustedDiffLayer(blockHash common.Hash, pid string) *
 	return nil
 }
 
+// GetUnTrustedDiffHash retrieves the hash of the untrusted diff layer of a block
+// received from the given peer, if any.
+func (bc *BlockChain) GetUnTrustedDiffHash(blockHash common.Hash, pid string) (common.Hash, bool) {
+	bc.diffMux.RLock()
+	defer bc.diffMux.RUnlock()
+
+	for diffHash := range bc.diffPeersToDiffHashes[pid] {
+		if bc.diffHashToBlockHash[diffHash] == blockHash {
+			return diffHash, true
+		}
+	}
+	return common.Hash{}, false
+}
+
 func (bc *BlockChain) removeDiffLayers(diffHash common.Hash) {
 	bc.diffMux.Lock()
 	defer bc.diffMux.Unlock()
@@ -2709,9 +2753,32 @@ func (bc *BlockChain) removeDiffLayers(diffHash common.Hash) {
 	}
 }
 
+// DisputeDiffLayer discards an untrusted diff layer which doesn't lead to the
+// state root of its block, along with all the others received from the same
+// peers, and notifies the subscribers so the peers which sent it can be
+// penalised. It must only be called for diff layers found to be wrong, not for
+// local failures to apply them.
+func (bc *BlockChain) DisputeDiffLayer(diffHash common.Hash) {
+	bc.diffMux.RLock()
+	blockHash, exist := bc.diffHashToBlockHash[diffHash]
+	pids := make([]string, 0, len(bc.diffHashToPeers[diffHash]))
+	for pid := range bc.diffHashToPeers[diffHash] {
+		pids = append(pids, pid)
+	}
+	bc.diffMux.RUnlock()
+
+	if !exist {
+		return
+	}
+	diffLayerDisputeMeter.Mark(1)
+	log.Warn("Disputed untrusted diff layer", "hash", blockHash, "diff", diffHash, "peers", len(pids))
+
+	bc.removeDiffLayers(diffHash)
+	bc.diffDisputeFeed.Send(DiffLayerDisputeEvent{BlockHash: blockHash, DiffHash: diffHash, Peers: pids})
+}
+
 func (bc *BlockChain) untrustedDiffLayerPruneLoop() {
 	recheck := time.NewTicker(diffLayerPruneRecheckInterval)
-	bc.wg.Add(1)
 	defer func() {
 		bc.wg.Done()
 		recheck.Stop()
@@ -3082,6 +3149,11 @@ func (bc *BlockChain) SubscribeLogsEvent(ch chan<- []*types.Log) event.Subscript
 	return bc.scope.Track(bc.logsFeed.Subscribe(ch))
 }
 
+// SubscribeDiffLayerDisputeEvent registers a subscription of DiffLayerDisputeEvent.
+func (bc *BlockChain) SubscribeDiffLayerDisputeEvent(ch chan<- DiffLayerDisputeEvent) event.Subscription {
+	return bc.scope.Track(bc.diffDisputeFeed.Subscribe(ch))
+}
+
 // SubscribeBlockProcessingEvent registers a subscription of bool where true means
 // block processing has started while false means it has stopped.
 func (bc *BlockChain) SubscribeBlockProcessingEvent(ch chan<- bool) event.Subscription {
@@ -3099,6 +3171,13 @@ func EnablePipelineCommit(bc *BlockChain) *BlockChain {
 	return bc
 }
 
+func EnableParallelTxExecution(workers int) BlockChainOption {
+	return func(chain *BlockChain) *BlockChain {
+		chain.parallelTxWorkers = workers
+		return chain
+	}
+}
+
 func EnablePersistDiff(limit uint64) BlockChainOption {
 	return func(chain *BlockChain) *BlockChain {
 		chain.diffLayerFreezerBlockLimit = limit
@@ -340,11 +340,25 @@ func TestProcessDiffLayer(t *testing.T) {
 
 	lightBackend.Chain().HandleDiffLayer(diff, "testpid", true)
 
+	disputes := make(chan DiffLayerDisputeEvent, 1)
+	sub := lightBackend.chain.SubscribeDiffLayerDisputeEvent(disputes)
+	defer sub.Unsubscribe()
+
 	_, err := lightBackend.chain.insertChain([]*types.Block{nextBlock}, true)
 	if err != nil {
 		t.Errorf("failed to process block %v", err)
 	}
 
+	// the peer sending the bad diff should be reported
+	select {
+	case ev := <-disputes:
+		if ev.BlockHash != nextBlock.Hash() || len(ev.Peers) != 1 || ev.Peers[0] != "testpid" {
+			t.Errorf("unexpected dispute event: %+v", ev)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("diff layer dispute not reported")
+	}
+
 	// the diff cache should be cleared
 	if len(lightBackend.chain.diffPeersToDiffHashes) != 0 {
 		t.Errorf("the size of diffPeersToDiffHashes should be 0, but get %d", len(lightBackend.chain.diffPeersToDiffHashes))
@@ -0,0 +1,145 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+)
+
+// maxPrunedRanges is the number of most recent pruned block ranges remembered
+// for reporting.
+const maxPrunedRanges = 128
+
+var (
+	historyTailGauge   = metrics.NewRegisteredGauge("chain/history/tail", nil)
+	historyPrunedMeter = metrics.NewRegisteredMeter("chain/history/pruned", nil)
+)
+
+// PrunedRange is a range of blocks deleted from the ancient store by the
+// online history pruner, both ends inclusive.
+type PrunedRange struct {
+	From uint64    `json:"from"`
+	To   uint64    `json:"to"`
+	Time time.Time `json:"time"`
+}
+
+// EnableHistoryPruning makes the blockchain keep only the given number of
+// recent blocks, deleting older ones from the ancient store in the background.
+func EnableHistoryPruning(blocks uint64) BlockChainOption {
+	return func(chain *BlockChain) *BlockChain {
+		chain.historyBlocks = blocks
+		return chain
+	}
+}
+
+// HistoryBlocks returns the number of recent blocks retained by the chain, or
+// zero if the history is not pruned.
+func (bc *BlockChain) HistoryBlocks() uint64 {
+	return bc.historyBlocks
+}
+
+// HistoryTail returns the first block still available in the ancient store.
+func (bc *BlockChain) HistoryTail() uint64 {
+	return bc.db.AncientOffSet()
+}
+
+// PrunedRanges returns the most recent block ranges pruned since startup.
+func (bc *BlockChain) PrunedRanges() []PrunedRange {
+	bc.prunedLock.RLock()
+	defer bc.prunedLock.RUnlock()
+
+	return append([]PrunedRange(nil), bc.prunedRanges...)
+}
+
+// pruneHistory deletes the blocks below the retained window from the tail of
+// the ancient store. Blocks are removed in whole data files, so the tail may
+// lag a bit behind the window.
+func (bc *BlockChain) pruneHistory(head uint64, done chan struct{}) {
+	defer func() { done <- struct{}{} }()
+
+	if head < bc.historyBlocks {
+		return
+	}
+	target := head - bc.historyBlocks + 1
+	from := bc.db.AncientOffSet()
+	if target <= from {
+		return
+	}
+	start := time.Now()
+	if err := bc.db.TruncateTail(target); err != nil {
+		log.Error("Failed to prune ancient blocks", "target", target, "err", err)
+		return
+	}
+	to := bc.db.AncientOffSet()
+	historyTailGauge.Update(int64(to))
+	if to <= from {
+		return
+	}
+	historyPrunedMeter.Mark(int64(to - from))
+
+	bc.prunedLock.Lock()
+	bc.prunedRanges = append(bc.prunedRanges, PrunedRange{From: from, To: to - 1, Time: time.Now()})
+	if len(bc.prunedRanges) > maxPrunedRanges {
+		bc.prunedRanges = bc.prunedRanges[len(bc.prunedRanges)-maxPrunedRanges:]
+	}
+	bc.prunedLock.Unlock()
+
+	log.Info("Pruned ancient blocks", "from", from, "to", to-1, "elapsed", common.PrettyDuration(time.Since(start)))
+}
+
+// maintainHistory is responsible for the deletion of the blocks falling out
+// of the retained window as the chain head advances.
+//
+// User can use flag `history.blocks` to specify the number of recent blocks
+// to keep, the blocks below are deleted from the ancient store.
+func (bc *BlockChain) maintainHistory() {
+	defer bc.wg.Done()
+
+	historyTailGauge.Update(int64(bc.db.AncientOffSet()))
+
+	var (
+		done   chan struct{}                  // Non-nil if background pruning routine is active.
+		headCh = make(chan ChainHeadEvent, 1) // Buffered to avoid locking up the event feed
+	)
+	sub := bc.SubscribeChainHeadEvent(headCh)
+	if sub == nil {
+		return
+	}
+	defer sub.Unsubscribe()
+
+	for {
+		select {
+		case head := <-headCh:
+			if done == nil {
+				done = make(chan struct{})
+				go bc.pruneHistory(head.Block.NumberU64(), done)
+			}
+		case <-done:
+			done = nil
+		case <-bc.quit:
+			if done != nil {
+				log.Info("Waiting background history pruner to exit")
+				<-done
+			}
+			return
+		}
+	}
+}
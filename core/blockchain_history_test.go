@@ -0,0 +1,193 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"errors"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// prunedTailDatabase is a freezer backed database deleting the ancient blocks
+// below the requested tail exactly, without the data file granularity of the
+// freezer tables, which only drop files of 2GB.
+type prunedTailDatabase struct {
+	ethdb.Database
+	tail uint64
+}
+
+func (db *prunedTailDatabase) HasAncient(kind string, number uint64) (bool, error) {
+	if number < db.tail {
+		return false, nil
+	}
+	return db.Database.HasAncient(kind, number)
+}
+
+func (db *prunedTailDatabase) Ancient(kind string, number uint64) ([]byte, error) {
+	if number < db.tail {
+		return nil, errors.New("pruned")
+	}
+	return db.Database.Ancient(kind, number)
+}
+
+func (db *prunedTailDatabase) ItemAmountInAncient() (uint64, error) {
+	frozen, err := db.Database.Ancients()
+	if err != nil {
+		return 0, err
+	}
+	return frozen - db.AncientOffSet(), nil
+}
+
+func (db *prunedTailDatabase) AncientOffSet() uint64 {
+	if offset := db.Database.AncientOffSet(); offset > db.tail {
+		return offset
+	}
+	return db.tail
+}
+
+func (db *prunedTailDatabase) TruncateTail(tail uint64) error {
+	if tail > db.tail {
+		db.tail = tail
+	}
+	return nil
+}
+
+// Tests that the chain stays readable and can be extended and reopened after the
+// oldest ancient blocks were pruned.
+func TestHistoryPruning(t *testing.T) {
+	var (
+		gendb   = rawdb.NewMemoryDatabase()
+		key, _  = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+		address = crypto.PubkeyToAddress(key.PublicKey)
+		gspec   = &Genesis{Config: params.TestChainConfig, Alloc: GenesisAlloc{address: {Balance: big.NewInt(1000000000)}}}
+		genesis = gspec.MustCommit(gendb)
+		signer  = types.LatestSigner(gspec.Config)
+	)
+	generator := func(i int, block *BlockGen) {
+		tx, err := types.SignTx(types.NewTransaction(block.TxNonce(address), common.Address{0x00}, big.NewInt(1000), params.TxGas, nil, nil), signer, key)
+		if err != nil {
+			panic(err)
+		}
+		block.AddTx(tx)
+	}
+	blocks, receipts := GenerateChain(gspec.Config, genesis, ethash.NewFaker(), gendb, 128, generator)
+	blocks2, receipts2 := GenerateChain(gspec.Config, blocks[len(blocks)-1], ethash.NewFaker(), gendb, 10, generator)
+
+	frdir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("failed to create temp freezer dir: %v", err)
+	}
+	defer os.RemoveAll(frdir)
+	ancientDb, err := rawdb.NewDatabaseWithFreezer(rawdb.NewMemoryDatabase(), frdir, "", false, false, false)
+	if err != nil {
+		t.Fatalf("failed to create temp freezer db: %v", err)
+	}
+	defer ancientDb.Close()
+
+	db := &prunedTailDatabase{Database: ancientDb}
+	gspec.MustCommit(db)
+
+	insert := func(chain *BlockChain, blocks []*types.Block, receipts []types.Receipts, ancientLimit uint64) {
+		t.Helper()
+
+		headers := make([]*types.Header, len(blocks))
+		for i, block := range blocks {
+			headers[i] = block.Header()
+		}
+		if n, err := chain.InsertHeaderChain(headers, 0); err != nil {
+			t.Fatalf("failed to insert header %d: %v", n, err)
+		}
+		if n, err := chain.InsertReceiptChain(blocks, receipts, ancientLimit); err != nil {
+			t.Fatalf("failed to insert block %d: %v", n, err)
+		}
+	}
+	prune := func(chain *BlockChain, head uint64) {
+		t.Helper()
+
+		done := make(chan struct{}, 1)
+		chain.pruneHistory(head, done)
+		<-done
+	}
+	check := func(chain *BlockChain, tail uint64, blocks []*types.Block) {
+		t.Helper()
+
+		if have := chain.HistoryTail(); have != tail {
+			t.Fatalf("history tail mismatch: have %d, want %d", have, tail)
+		}
+		if chain.GetBlockByNumber(0) == nil {
+			t.Fatalf("genesis block pruned")
+		}
+		for _, block := range blocks {
+			number := block.NumberU64()
+			if number < tail {
+				if chain.GetBlockByNumber(number) != nil {
+					t.Fatalf("block %d not pruned", number)
+				}
+				continue
+			}
+			if have := chain.GetBlockByNumber(number); have == nil || have.Hash() != block.Hash() {
+				t.Fatalf("block %d mismatch: have %v, want %x", number, have, block.Hash())
+			}
+			if have := chain.GetReceiptsByHash(block.Hash()); len(have) != 1 || have[0].TxHash != block.Transactions()[0].Hash() {
+				t.Fatalf("block %d receipts mismatch: have %v", number, have)
+			}
+		}
+	}
+	// Import all blocks into the ancient store and prune all but the last 32
+	chain, err := NewBlockChain(db, nil, params.TestChainConfig, ethash.NewFaker(), vm.Config{}, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to create tester chain: %v", err)
+	}
+	insert(chain, blocks, receipts, 128)
+
+	chain.historyBlocks = 32
+	prune(chain, 128)
+	check(chain, 97, blocks)
+	if ranges := chain.PrunedRanges(); len(ranges) != 1 || ranges[0].From != 0 || ranges[0].To != 96 {
+		t.Fatalf("pruned ranges mismatch: have %+v", ranges)
+	}
+	chain.Stop()
+
+	// Reopen the chain, extend it past the ancient store and prune further
+	chain, err = NewBlockChain(db, nil, params.TestChainConfig, ethash.NewFaker(), vm.Config{}, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to reopen pruned chain: %v", err)
+	}
+	defer chain.Stop()
+
+	chain.historyBlocks = 32
+	if have := chain.CurrentFastBlock().NumberU64(); have != 128 {
+		t.Fatalf("head mismatch after reopen: have %d, want %d", have, 128)
+	}
+	insert(chain, blocks2, receipts2, 0)
+	if have := chain.CurrentFastBlock().NumberU64(); have != 138 {
+		t.Fatalf("head mismatch after extension: have %d, want %d", have, 138)
+	}
+	prune(chain, 138)
+	check(chain, 107, append(blocks, blocks2...))
+}
@@ -44,3 +44,11 @@ type ChainSideEvent struct {
 }
 
 type ChainHeadEvent struct{ Block *types.Block }
+
+// DiffLayerDisputeEvent is posted when an untrusted diff layer is found not to
+// lead to the state root of its block.
+type DiffLayerDisputeEvent struct {
+	BlockHash common.Hash
+	DiffHash  common.Hash
+	Peers     []string // Peers which sent the diff layer
+}
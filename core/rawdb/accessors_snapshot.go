@@ -216,3 +216,27 @@ func DeleteSnapshotSyncStatus(db ethdb.KeyValueWriter) {
 		log.Crit("Failed to remove snapshot sync status", "err", err)
 	}
 }
+
+// ReadSnapshotImportRoot retrieves the root of the state archive whose import
+// was started but not completed.
+func ReadSnapshotImportRoot(db ethdb.KeyValueReader) common.Hash {
+	data, _ := db.Get(snapshotImportKey)
+	if len(data) != common.HashLength {
+		return common.Hash{}
+	}
+	return common.BytesToHash(data)
+}
+
+// WriteSnapshotImportRoot stores the root of the state archive being imported.
+func WriteSnapshotImportRoot(db ethdb.KeyValueWriter, root common.Hash) {
+	if err := db.Put(snapshotImportKey, root[:]); err != nil {
+		log.Crit("Failed to store snapshot import root", "err", err)
+	}
+}
+
+// DeleteSnapshotImportRoot deletes the root of the state archive being imported.
+func DeleteSnapshotImportRoot(db ethdb.KeyValueWriter) {
+	if err := db.Delete(snapshotImportKey); err != nil {
+		log.Crit("Failed to remove snapshot import root", "err", err)
+	}
+}
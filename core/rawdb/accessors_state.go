@@ -94,3 +94,24 @@ func DeleteTrieNode(db ethdb.KeyValueWriter, hash common.Hash) {
 		log.Crit("Failed to delete trie node", "err", err)
 	}
 }
+
+// ReadStatePruneCursor retrieves the last key swept by the online state pruner,
+// or nil if no pruning is in progress.
+func ReadStatePruneCursor(db ethdb.KeyValueReader) []byte {
+	data, _ := db.Get(statePruneCursorKey)
+	return data
+}
+
+// WriteStatePruneCursor stores the last key swept by the online state pruner.
+func WriteStatePruneCursor(db ethdb.KeyValueWriter, cursor []byte) {
+	if err := db.Put(statePruneCursorKey, cursor); err != nil {
+		log.Crit("Failed to store state prune cursor", "err", err)
+	}
+}
+
+// DeleteStatePruneCursor deletes the online state pruner cursor.
+func DeleteStatePruneCursor(db ethdb.KeyValueWriter) {
+	if err := db.Delete(statePruneCursorKey); err != nil {
+		log.Crit("Failed to delete state prune cursor", "err", err)
+	}
+}
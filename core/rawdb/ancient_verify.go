@@ -0,0 +1,246 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package rawdb
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// The kinds of ancient items which can be repaired from the network.
+const (
+	AncientBodies   = freezerBodiesTable
+	AncientReceipts = freezerReceiptTable
+)
+
+// CorruptedRange is a range of unreadable items of an ancient table, both ends
+// inclusive.
+type CorruptedRange struct {
+	Kind string // Name of the ancient table
+	From uint64 // First corrupted block
+	To   uint64 // Last corrupted block
+	Err  error  `rlp:"-"` // Error of the first corrupted item
+}
+
+// String implements fmt.Stringer.
+func (r CorruptedRange) String() string {
+	return fmt.Sprintf("%s #%d-#%d: %v", r.Kind, r.From, r.To, r.Err)
+}
+
+// NetworkRepairable reports whether the items of the range can be downloaded
+// again from the network. Bodies and receipts are checked against the headers
+// of their blocks, so those have to be intact.
+func (r CorruptedRange) NetworkRepairable() bool {
+	return r.Kind == AncientBodies || r.Kind == AncientReceipts
+}
+
+// RepairAncientBody overwrites the corrupted ancient body of a block with a copy
+// downloaded from the network.
+func RepairAncientBody(db ethdb.AncientStore, number uint64, body *types.Body) error {
+	blob, err := rlp.EncodeToBytes(body)
+	if err != nil {
+		return err
+	}
+	return db.RepairAncient(freezerBodiesTable, number, blob)
+}
+
+// RepairAncientReceipts overwrites the corrupted ancient receipts of a block with
+// a copy downloaded from the network.
+func RepairAncientReceipts(db ethdb.AncientStore, number uint64, receipts types.Receipts) error {
+	storageReceipts := make([]*types.ReceiptForStorage, len(receipts))
+	for i, receipt := range receipts {
+		storageReceipts[i] = (*types.ReceiptForStorage)(receipt)
+	}
+	blob, err := rlp.EncodeToBytes(storageReceipts)
+	if err != nil {
+		return err
+	}
+	return db.RepairAncient(freezerReceiptTable, number, blob)
+}
+
+// ReadAncientRepairRanges retrieves the corrupted ancient ranges scheduled to be
+// repaired from the network.
+func ReadAncientRepairRanges(db ethdb.KeyValueReader) []CorruptedRange {
+	data, _ := db.Get(ancientRepairKey)
+	if len(data) == 0 {
+		return nil
+	}
+	var ranges []CorruptedRange
+	if err := rlp.DecodeBytes(data, &ranges); err != nil {
+		log.Error("Invalid ancient repair ranges", "err", err)
+		return nil
+	}
+	return ranges
+}
+
+// WriteAncientRepairRanges stores the corrupted ancient ranges to be repaired
+// from the network, deleting the entry if none are left.
+func WriteAncientRepairRanges(db ethdb.KeyValueWriter, ranges []CorruptedRange) {
+	if len(ranges) == 0 {
+		if err := db.Delete(ancientRepairKey); err != nil {
+			log.Crit("Failed to delete ancient repair ranges", "err", err)
+		}
+		return
+	}
+	data, err := rlp.EncodeToBytes(ranges)
+	if err != nil {
+		log.Crit("Failed to encode ancient repair ranges", "err", err)
+	}
+	if err := db.Put(ancientRepairKey, data); err != nil {
+		log.Crit("Failed to store ancient repair ranges", "err", err)
+	}
+}
+
+// ancientKinds returns the names of the ancient tables in a stable order.
+func ancientKinds() []string {
+	kinds := make([]string, 0, len(FreezerNoSnappy))
+	for kind := range FreezerNoSnappy {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	return kinds
+}
+
+// VerifyAncients reads back every item of all the ancient tables and returns
+// the ranges failing their checksum or decompression. Tables created before
+// checksums were introduced only detect the corruptions breaking decompression.
+func VerifyAncients(db ethdb.AncientReader) ([]CorruptedRange, error) {
+	frozen, err := db.Ancients()
+	if err != nil {
+		return nil, err
+	}
+	var (
+		ranges []CorruptedRange
+		first  = db.AncientOffSet()
+		start  = time.Now()
+		logged = time.Now()
+	)
+	for _, kind := range ancientKinds() {
+		for number := first; number < frozen; number++ {
+			if _, err := db.Ancient(kind, number); err != nil {
+				if last := len(ranges) - 1; last >= 0 && ranges[last].Kind == kind && ranges[last].To+1 == number {
+					ranges[last].To = number
+				} else {
+					log.Warn("Found corrupted ancient item", "kind", kind, "number", number, "err", err)
+					ranges = append(ranges, CorruptedRange{Kind: kind, From: number, To: number, Err: err})
+				}
+			}
+			if time.Since(logged) > 8*time.Second {
+				log.Info("Verifying ancient store", "kind", kind, "number", number, "last", frozen-1, "corrupted", len(ranges), "elapsed", common.PrettyDuration(time.Since(start)))
+				logged = time.Now()
+			}
+		}
+	}
+	log.Info("Verified ancient store", "first", first, "last", frozen-1, "corrupted", len(ranges), "elapsed", common.PrettyDuration(time.Since(start)))
+	return ranges, nil
+}
+
+// RepairAncients restores the corrupted ancient items from a backup of the
+// ancient store and returns the ranges which couldn't be repaired. The blocks
+// of the backup are checked against the hashes of the repaired store first.
+func RepairAncients(db ethdb.AncientStore, backup ethdb.AncientReader, ranges []CorruptedRange) []CorruptedRange {
+	var (
+		failed   []CorruptedRange
+		repaired int
+	)
+	// fail records an item which couldn't be repaired, merging it into the
+	// last failed range if contiguous
+	fail := func(kind string, number uint64, err error) {
+		if last := len(failed) - 1; last >= 0 && failed[last].Kind == kind && failed[last].To+1 == number {
+			failed[last].To = number
+			return
+		}
+		failed = append(failed, CorruptedRange{Kind: kind, From: number, To: number, Err: err})
+	}
+	for _, r := range ranges {
+		for number := r.From; number <= r.To; number++ {
+			if err := repairAncient(db, backup, r.Kind, number); err != nil {
+				log.Warn("Failed to repair ancient item", "kind", r.Kind, "number", number, "err", err)
+				fail(r.Kind, number, err)
+				continue
+			}
+			repaired++
+		}
+	}
+	log.Info("Repaired ancient store from backup", "items", repaired, "failed", len(failed))
+	return failed
+}
+
+// repairAncient restores a single ancient item from the backup.
+func repairAncient(db ethdb.AncientStore, backup ethdb.AncientReader, kind string, number uint64) error {
+	// Make sure the backup holds the same block, using either the stored hash
+	// or the hash of the stored header, whichever is intact
+	hash, err := backup.Ancient(freezerHashTable, number)
+	if err != nil {
+		return fmt.Errorf("backup hash unavailable: %v", err)
+	}
+	if stored, err := db.Ancient(freezerHashTable, number); err == nil {
+		if !bytes.Equal(stored, hash) {
+			return fmt.Errorf("backup hash mismatch: have %x, want %x", hash, stored)
+		}
+	} else if header, err := db.Ancient(freezerHeaderTable, number); err == nil {
+		if stored := crypto.Keccak256(header); !bytes.Equal(stored, hash) {
+			return fmt.Errorf("backup hash mismatch: have %x, want %x", hash, stored)
+		}
+	} else {
+		return fmt.Errorf("block hash unavailable: %v", err)
+	}
+	item, err := backup.Ancient(kind, number)
+	if err != nil {
+		return fmt.Errorf("backup item unavailable: %v", err)
+	}
+	if err := db.RepairAncient(kind, number, item); err != nil {
+		return err
+	}
+	// Read the item back, tables without checksums might still be unreadable
+	_, err = db.Ancient(kind, number)
+	return err
+}
+
+// AddAncientChecksums converts the ancient tables created before checksums were
+// introduced into checksummed ones. The items are read back in the process, so
+// the conversion fails on the corruptions breaking the decompression, which
+// have to be repaired first. The ancient store must not be in use.
+func AddAncientChecksums(datadir string) error {
+	for _, kind := range ancientKinds() {
+		noSnappy := FreezerNoSnappy[kind]
+		table, err := newTable(datadir, kind, metrics.NilMeter{}, metrics.NilMeter{}, metrics.NilGauge{}, freezerTableCompression(datadir, kind, noSnappy, false), true)
+		if err != nil {
+			return err
+		}
+		if !table.checksum {
+			log.Info("Adding checksums to ancient table", "table", kind, "items", atomic.LoadUint64(&table.items)-uint64(table.itemOffset))
+			err = table.addChecksums()
+		}
+		table.Close()
+		if err != nil {
+			return fmt.Errorf("table %s: %v", kind, err)
+		}
+	}
+	return nil
+}
@@ -22,6 +22,7 @@ import (
 	"fmt"
 	"math/big"
 	"os"
+	"path/filepath"
 	"sync/atomic"
 	"time"
 
@@ -134,6 +135,16 @@ func (db *nofreezedb) TruncateAncients(items uint64) error {
 	return errNotSupported
 }
 
+// TruncateTail returns an error as we don't have a backing chain freezer.
+func (db *nofreezedb) TruncateTail(tail uint64) error {
+	return errNotSupported
+}
+
+// RepairAncient returns an error as we don't have a backing chain freezer.
+func (db *nofreezedb) RepairAncient(kind string, number uint64, item []byte) error {
+	return errNotSupported
+}
+
 // Sync returns an error as we don't have a backing chain freezer.
 func (db *nofreezedb) Sync() error {
 	return errNotSupported
@@ -189,7 +200,7 @@ func WriteOffSetOfLastAncientFreezer(db ethdb.KeyValueWriter, offset uint64) {
 // NewFreezerDb only create a freezer without statedb.
 func NewFreezerDb(db ethdb.KeyValueStore, frz, namespace string, readonly bool, newOffSet uint64) (*freezer, error) {
 	// Create the idle freezer instance, this operation should be atomic to avoid mismatch between offset and acientDB.
-	frdb, err := newFreezer(frz, namespace, readonly)
+	frdb, err := newFreezer(frz, namespace, readonly, false)
 	if err != nil {
 		return nil, err
 	}
@@ -202,8 +213,15 @@ func NewFreezerDb(db ethdb.KeyValueStore, frz, namespace string, readonly bool,
 // value data store with a freezer moving immutable chain segments into cold
 // storage.
 func NewDatabaseWithFreezer(db ethdb.KeyValueStore, freezer string, namespace string, readonly, disableFreeze, isLastOffset bool) (ethdb.Database, error) {
+	return newDatabaseWithFreezer(db, freezer, namespace, readonly, disableFreeze, isLastOffset, false)
+}
+
+// newDatabaseWithFreezer creates a high level database on top of a given key-
+// value data store with a freezer, optionally compressing the new ancient bodies
+// and receipts tables with zstd.
+func newDatabaseWithFreezer(db ethdb.KeyValueStore, freezer string, namespace string, readonly, disableFreeze, isLastOffset, zstd bool) (ethdb.Database, error) {
 	// Create the idle freezer instance
-	frdb, err := newFreezer(freezer, namespace, readonly)
+	frdb, err := newFreezer(freezer, namespace, readonly, zstd)
 	if err != nil {
 		return nil, err
 	}
@@ -245,9 +263,10 @@ func NewDatabaseWithFreezer(db ethdb.KeyValueStore, freezer string, namespace st
 	// validate in this method. If, however, the genesis hash is not nil, compare
 	// it to the freezer content.
 	// Only to check the followings when offset equal to 0, otherwise the block number
-	// in ancientdb did not start with 0, no genesis block in ancientdb as well.
+	// in ancientdb did not start with 0, no genesis block in ancientdb as well. The
+	// same applies if the tail of the ancientdb was pruned.
 
-	if kvgenesis, _ := db.Get(headerHashKey(0)); offset == 0 && len(kvgenesis) > 0 {
+	if kvgenesis, _ := db.Get(headerHashKey(0)); frdb.AncientOffSet() == 0 && len(kvgenesis) > 0 {
 		if frozen, _ := frdb.Ancients(); frozen > 0 {
 			// If the freezer already contains something, ensure that the genesis blocks
 			// match, otherwise we might mix up freezers across chains and destroy both
@@ -338,6 +357,89 @@ func NewLevelDBDatabaseWithFreezer(file string, cache int, handles int, freezer
 	return frdb, nil
 }
 
+const (
+	// DBLeveldb is the identifier of the LevelDB storage engine.
+	DBLeveldb = "leveldb"
+
+	// DBPebble is the identifier of the Pebble storage engine.
+	DBPebble = "pebble"
+)
+
+// PreexistingDatabase checks the given data directory whether a database is
+// already instantiated at that location, and if so, returns the type of the
+// database engine. An empty string is returned if there's no database.
+func PreexistingDatabase(path string) string {
+	if _, err := os.Stat(filepath.Join(path, "CURRENT")); err != nil {
+		return "" // No pre-existing db
+	}
+	// Pebble keeps its options in OPTIONS-xxx files, leveldb has none
+	if matches, err := filepath.Glob(filepath.Join(path, "OPTIONS*")); err == nil && len(matches) > 0 {
+		return DBPebble
+	}
+	return DBLeveldb
+}
+
+// NewKeyValueStore opens a persistent key-value database with the given storage
+// engine, creating it if it doesn't exist yet. If no engine is specified, the
+// one of the existing database is used, defaulting to leveldb for new ones.
+//
+// The engine is recorded in the database metadata, opening a database with an
+// engine different from the one it was created with is refused.
+func NewKeyValueStore(engine string, file string, cache int, handles int, namespace string, readonly bool) (ethdb.KeyValueStore, error) {
+	existing := PreexistingDatabase(file)
+	if engine == "" {
+		engine = existing
+		if engine == "" {
+			engine = DBLeveldb
+		}
+	}
+	if existing != "" && existing != engine {
+		return nil, fmt.Errorf("database %s was created with engine %s, not %s", file, existing, engine)
+	}
+	var (
+		kvdb ethdb.KeyValueStore
+		err  error
+	)
+	switch engine {
+	case DBLeveldb:
+		log.Info("Using leveldb as the backing database")
+		kvdb, err = leveldb.New(file, cache, handles, namespace, readonly)
+	case DBPebble:
+		log.Info("Using pebble as the backing database")
+		kvdb, err = newPebbleDBDatabase(file, cache, handles, namespace, readonly)
+	default:
+		return nil, fmt.Errorf("unknown database engine %q", engine)
+	}
+	if err != nil {
+		return nil, err
+	}
+	switch stored := ReadDatabaseEngine(kvdb); {
+	case stored == "" && !readonly:
+		WriteDatabaseEngine(kvdb, engine)
+	case stored != "" && stored != engine:
+		kvdb.Close()
+		return nil, fmt.Errorf("database %s was created with engine %s, not %s", file, stored, engine)
+	}
+	return kvdb, nil
+}
+
+// NewKeyValueStoreWithFreezer creates a persistent key-value database with the
+// given storage engine and a freezer moving immutable chain segments into cold
+// storage. If ancientZstd is set, new ancient bodies and receipts tables are
+// compressed with zstd instead of snappy.
+func NewKeyValueStoreWithFreezer(engine string, file string, cache int, handles int, freezer string, namespace string, readonly, disableFreeze, isLastOffset, ancientZstd bool) (ethdb.Database, error) {
+	kvdb, err := NewKeyValueStore(engine, file, cache, handles, namespace, readonly)
+	if err != nil {
+		return nil, err
+	}
+	frdb, err := newDatabaseWithFreezer(kvdb, freezer, namespace, readonly, disableFreeze, isLastOffset, ancientZstd)
+	if err != nil {
+		kvdb.Close()
+		return nil, err
+	}
+	return frdb, nil
+}
+
 type counter uint64
 
 func (c counter) String() string {
@@ -368,7 +470,7 @@ func (s *stat) Count() string {
 	return s.count.String()
 }
 func AncientInspect(db ethdb.Database) error {
-	offset := counter(ReadOffSetOfCurrentAncientFreezer(db))
+	offset := counter(db.AncientOffSet())
 	// Get number of ancient rows inside the freezer.
 	ancients := counter(0)
 	if count, err := db.ItemAmountInAncient(); err != nil {
@@ -498,9 +600,9 @@ func InspectDatabase(db ethdb.Database, keyPrefix, keyStart []byte) error {
 		default:
 			var accounted bool
 			for _, meta := range [][]byte{
-				databaseVersionKey, headHeaderKey, headBlockKey, headFastBlockKey, lastPivotKey,
+				databaseVersionKey, databaseEngineKey, headHeaderKey, headBlockKey, headFastBlockKey, lastPivotKey,
 				fastTrieProgressKey, snapshotDisabledKey, snapshotRootKey, snapshotJournalKey,
-				snapshotGeneratorKey, snapshotRecoveryKey, txIndexTailKey, fastTxLookupLimitKey,
+				snapshotGeneratorKey, snapshotRecoveryKey, txIndexTailKey, fastTxLookupLimitKey, statePruneCursorKey,
 				uncleanShutdownKey, badBlockKey,
 			} {
 				if bytes.Equal(key, meta) {
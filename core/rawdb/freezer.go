@@ -76,6 +76,7 @@ type freezer struct {
 	// so take advantage of that (https://golang.org/pkg/sync/atomic/#pkg-note-BUG).
 	frozen    uint64 // Number of blocks already frozen
 	threshold uint64 // Number of recent blocks not to freeze (params.FullImmutabilityThreshold apart from tests)
+	tail      uint64 // Number of items deleted from the tail of the tables
 
 	readonly     bool
 	tables       map[string]*freezerTable // Data tables for storing everything
@@ -90,8 +91,9 @@ type freezer struct {
 }
 
 // newFreezer creates a chain freezer that moves ancient chain data into
-// append-only flat file containers.
-func newFreezer(datadir string, namespace string, readonly bool) (*freezer, error) {
+// append-only flat file containers. New tables are checksummed, and the ones
+// configured in FreezerZstd are compressed with zstd if requested.
+func newFreezer(datadir string, namespace string, readonly, zstd bool) (*freezer, error) {
 	// Create the initial freezer object
 	var (
 		readMeter  = metrics.NewRegisteredMeter(namespace+"ancient/read", nil)
@@ -121,7 +123,7 @@ func newFreezer(datadir string, namespace string, readonly bool) (*freezer, erro
 		quit:         make(chan struct{}),
 	}
 	for name, disableSnappy := range FreezerNoSnappy {
-		table, err := newTable(datadir, name, readMeter, writeMeter, sizeGauge, disableSnappy)
+		table, err := newTable(datadir, name, readMeter, writeMeter, sizeGauge, freezerTableCompression(datadir, name, disableSnappy, zstd), true)
 		if err != nil {
 			for _, table := range freezer.tables {
 				table.Close()
@@ -142,6 +144,24 @@ func newFreezer(datadir string, namespace string, readonly bool) (*freezer, erro
 	return freezer, nil
 }
 
+// freezerTableCompression returns the compression of an ancient table. Existing
+// tables keep the compression they were created with.
+func freezerTableCompression(datadir, name string, disableSnappy, zstd bool) freezerCompression {
+	switch {
+	case disableSnappy:
+		return compressionNone
+	case freezerTableExists(datadir, name, compressionZstd):
+		return compressionZstd
+	case !zstd || !FreezerZstd[name]:
+		return compressionSnappy
+	case freezerTableExists(datadir, name, compressionSnappy):
+		log.Warn("Ancient table already compressed with snappy, not switching to zstd", "table", name)
+		return compressionSnappy
+	default:
+		return compressionZstd
+	}
+}
+
 // Close terminates the chain freezer, unmapping all the data files.
 func (f *freezer) Close() error {
 	var errs []error
@@ -186,12 +206,13 @@ func (f *freezer) Ancients() (uint64, error) {
 
 // ItemAmountInAncient returns the actual length of current ancientDB.
 func (f *freezer) ItemAmountInAncient() (uint64, error) {
-	return atomic.LoadUint64(&f.frozen) - atomic.LoadUint64(&f.offset), nil
+	return atomic.LoadUint64(&f.frozen) - f.AncientOffSet(), nil
 }
 
-// AncientOffSet returns the offset of current ancientDB.
+// AncientOffSet returns the offset of current ancientDB, including the blocks
+// deleted from the tail.
 func (f *freezer) AncientOffSet() uint64 {
-	return atomic.LoadUint64(&f.offset)
+	return atomic.LoadUint64(&f.offset) + atomic.LoadUint64(&f.tail)
 }
 
 // AncientSize returns the ancient size of the specified category.
@@ -269,6 +290,49 @@ func (f *freezer) TruncateAncients(items uint64) error {
 	return nil
 }
 
+// TruncateTail discards the ancient data below the provided block number. The
+// tables are only truncated on data file boundaries, so a few more blocks than
+// requested might be retained, AncientOffSet reports the actual first block.
+func (f *freezer) TruncateTail(tail uint64) error {
+	if f.readonly {
+		return errReadOnly
+	}
+	if f.AncientOffSet() >= tail {
+		return nil
+	}
+	for _, table := range f.tables {
+		if err := table.truncateTail(tail - f.offset); err != nil {
+			return err
+		}
+	}
+	atomic.StoreUint64(&f.tail, f.tableTail())
+	return nil
+}
+
+// RepairAncient overwrites a corrupted ancient item in place with a copy of the
+// original. The copy has to encode to the size of the stored item.
+func (f *freezer) RepairAncient(kind string, number uint64, item []byte) error {
+	if f.readonly {
+		return errReadOnly
+	}
+	if table := f.tables[kind]; table != nil {
+		return table.repairItem(number-f.offset, item)
+	}
+	return errUnknownTable
+}
+
+// tableTail returns the number of items deleted from the tail of the freezer,
+// which is the highest of all the tables.
+func (f *freezer) tableTail() uint64 {
+	var tail uint64
+	for _, table := range f.tables {
+		if offset := uint64(atomic.LoadUint32(&table.itemOffset)); offset > tail {
+			tail = offset
+		}
+	}
+	return tail
+}
+
 // Sync flushes all data tables to disk.
 func (f *freezer) Sync() error {
 	var errs []error
@@ -492,5 +556,6 @@ func (f *freezer) repair() error {
 		}
 	}
 	atomic.StoreUint64(&f.frozen, min)
+	atomic.StoreUint64(&f.tail, f.tableTail())
 	return nil
 }
@@ -0,0 +1,108 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package rawdb
+
+import (
+	"sync"
+
+	"github.com/golang/snappy"
+	"github.com/klauspost/compress/zstd"
+)
+
+// freezerCompression is the algorithm compressing the items of a freezer table.
+// A table keeps the compression it was created with.
+type freezerCompression uint8
+
+const (
+	compressionNone   freezerCompression = iota // Items are stored as is
+	compressionSnappy                           // Items are compressed with snappy
+	compressionZstd                             // Items are compressed with zstd
+)
+
+// freezerCompressions lists all the supported compressions.
+var freezerCompressions = []freezerCompression{compressionNone, compressionSnappy, compressionZstd}
+
+var (
+	zstdOnce    sync.Once
+	zstdEncoder *zstd.Encoder
+	zstdDecoder *zstd.Decoder
+)
+
+// zstdCodec returns the shared zstd encoder and decoder, which are created on
+// first use. Both are safe for concurrent use through EncodeAll and DecodeAll.
+func zstdCodec() (*zstd.Encoder, *zstd.Decoder) {
+	zstdOnce.Do(func() {
+		// Errors are only returned for invalid options
+		zstdEncoder, _ = zstd.NewWriter(nil)
+		zstdDecoder, _ = zstd.NewReader(nil)
+	})
+	return zstdEncoder, zstdDecoder
+}
+
+// String implements fmt.Stringer.
+func (c freezerCompression) String() string {
+	switch c {
+	case compressionNone:
+		return "none"
+	case compressionSnappy:
+		return "snappy"
+	case compressionZstd:
+		return "zstd"
+	default:
+		return "unknown"
+	}
+}
+
+// prefix returns the letter starting the file extensions of the tables using
+// the compression. The raw and snappy ones are inherited from the original
+// freezer format.
+func (c freezerCompression) prefix() string {
+	switch c {
+	case compressionNone:
+		return "r"
+	case compressionZstd:
+		return "z"
+	default:
+		return "c"
+	}
+}
+
+// encode compresses the given item.
+func (c freezerCompression) encode(blob []byte) []byte {
+	switch c {
+	case compressionSnappy:
+		return snappy.Encode(nil, blob)
+	case compressionZstd:
+		encoder, _ := zstdCodec()
+		return encoder.EncodeAll(blob, nil)
+	default:
+		return blob
+	}
+}
+
+// decode decompresses the given item.
+func (c freezerCompression) decode(blob []byte) ([]byte, error) {
+	switch c {
+	case compressionSnappy:
+		return snappy.Decode(nil, blob)
+	case compressionZstd:
+		_, decoder := zstdCodec()
+		return decoder.DecodeAll(blob, nil)
+	default:
+		return blob, nil
+	}
+}
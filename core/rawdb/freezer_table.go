@@ -17,19 +17,22 @@
 package rawdb
 
 import (
+	"bufio"
 	"encoding/binary"
 	"errors"
 	"fmt"
+	"hash/crc32"
 	"io"
+	"math"
 	"os"
 	"path/filepath"
+	"sort"
 	"sync"
 	"sync/atomic"
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/log"
 	"github.com/ethereum/go-ethereum/metrics"
-	"github.com/golang/snappy"
 )
 
 var (
@@ -41,24 +44,48 @@ var (
 	// freezer table.
 	errOutOfBounds = errors.New("out of bounds")
 
+	// errTruncateBelowTail is returned if the table is truncated to a number of
+	// items which were already deleted from the tail.
+	errTruncateBelowTail = errors.New("truncation below table tail")
+
 	// errNotSupported is returned if the database doesn't support the required operation.
 	errNotSupported = errors.New("this operation is not supported")
+
+	// errChecksumMismatch is returned if the item read from the freezer table
+	// doesn't match the checksum stored in the index.
+	errChecksumMismatch = errors.New("checksum mismatch")
+
+	// errRepairSizeMismatch is returned if the replacement of an item doesn't
+	// have the size of the stored one.
+	errRepairSizeMismatch = errors.New("replacement size mismatch")
 )
 
+// crc32cTable is the table of the Castagnoli polynomial used to checksum the
+// freezer items.
+var crc32cTable = crc32.MakeTable(crc32.Castagnoli)
+
 // indexEntry contains the number/id of the file that the data resides in, aswell as the
 // offset within the file to the end of the data
 // In serialized form, the filenum is stored as uint16.
 type indexEntry struct {
-	filenum uint32 // stored as uint16 ( 2 bytes)
-	offset  uint32 // stored as uint32 ( 4 bytes)
+	filenum  uint32 // stored as uint16 ( 2 bytes)
+	offset   uint32 // stored as uint32 ( 4 bytes)
+	checksum uint32 // stored as uint32 ( 4 bytes), CRC32C of the stored item, only in checksummed tables
 }
 
-const indexEntrySize = 6
+const (
+	indexEntrySize         = 6  // Size of the entries of the legacy index
+	checksumIndexEntrySize = 10 // Size of the entries of the checksummed index
+)
 
-// unmarshallBinary deserializes binary b into the rawIndex entry.
+// unmarshallBinary deserializes binary b into the rawIndex entry. The checksum
+// is only read from entries of checksummed indexes.
 func (i *indexEntry) unmarshalBinary(b []byte) error {
 	i.filenum = uint32(binary.BigEndian.Uint16(b[:2]))
 	i.offset = binary.BigEndian.Uint32(b[2:6])
+	if len(b) >= checksumIndexEntrySize {
+		i.checksum = binary.BigEndian.Uint32(b[6:10])
+	}
 	return nil
 }
 
@@ -70,19 +97,32 @@ func (i *indexEntry) marshallBinary() []byte {
 	return b
 }
 
+// marshallBinaryWithChecksum serializes the rawIndex entry along with the item
+// checksum into binary.
+func (i *indexEntry) marshallBinaryWithChecksum() []byte {
+	b := make([]byte, checksumIndexEntrySize)
+	binary.BigEndian.PutUint16(b[:2], uint16(i.filenum))
+	binary.BigEndian.PutUint32(b[2:6], i.offset)
+	binary.BigEndian.PutUint32(b[6:10], i.checksum)
+	return b
+}
+
 // freezerTable represents a single chained data table within the freezer (e.g. blocks).
-// It consists of a data file (snappy encoded arbitrary data blobs) and an indexEntry
-// file (uncompressed 64 bit indices into the data file).
+// It consists of a data file (snappy or zstd encoded arbitrary data blobs) and an
+// indexEntry file (uncompressed indices into the data file, optionally carrying
+// the checksums of the items).
 type freezerTable struct {
 	// WARNING: The `items` field is accessed atomically. On 32 bit platforms, only
 	// 64-bit aligned fields can be atomic. The struct is guaranteed to be so aligned,
 	// so take advantage of that (https://golang.org/pkg/sync/atomic/#pkg-note-BUG).
 	items uint64 // Number of items stored in the table (including items removed from tail)
 
-	noCompression bool   // if true, disables snappy compression. Note: does not work retroactively
-	maxFileSize   uint32 // Max file size for data-files
-	name          string
-	path          string
+	compression freezerCompression // Compression of the items. Note: does not work retroactively
+	checksum    bool               // Whether the index carries the checksums of the items
+	entrySize   int64              // Size of the index entries, depending on the checksums
+	maxFileSize uint32             // Max file size for data-files
+	name        string
+	path        string
 
 	head   *os.File            // File descriptor for the data head of the table
 	files  map[uint32]*os.File // open files
@@ -105,12 +145,37 @@ type freezerTable struct {
 
 // NewFreezerTable opens the given path as a freezer table.
 func NewFreezerTable(path, name string, disableSnappy bool) (*freezerTable, error) {
-	return newTable(path, name, metrics.NilMeter{}, metrics.NilMeter{}, metrics.NilGauge{}, disableSnappy)
+	compression := compressionSnappy
+	if disableSnappy {
+		compression = compressionNone
+	} else if freezerTableExists(path, name, compressionZstd) {
+		compression = compressionZstd
+	}
+	return newTable(path, name, metrics.NilMeter{}, metrics.NilMeter{}, metrics.NilGauge{}, compression, true)
 }
 
 // newTable opens a freezer table with default settings - 2G files
-func newTable(path string, name string, readMeter metrics.Meter, writeMeter metrics.Meter, sizeGauge metrics.Gauge, disableSnappy bool) (*freezerTable, error) {
-	return newCustomTable(path, name, readMeter, writeMeter, sizeGauge, 2*1000*1000*1000, disableSnappy)
+func newTable(path string, name string, readMeter metrics.Meter, writeMeter metrics.Meter, sizeGauge metrics.Gauge, compression freezerCompression, checksum bool) (*freezerTable, error) {
+	return newFreezerTable(path, name, readMeter, writeMeter, sizeGauge, 2*1000*1000*1000, compression, checksum)
+}
+
+// freezerIndexName returns the file name of the index of a freezer table.
+func freezerIndexName(name string, compression freezerCompression, checksum bool) string {
+	if checksum {
+		return fmt.Sprintf("%s.%ssidx", name, compression.prefix())
+	}
+	return fmt.Sprintf("%s.%sidx", name, compression.prefix())
+}
+
+// freezerTableExists reports whether the index of a freezer table with the
+// given compression exists, in any format.
+func freezerTableExists(path, name string, compression freezerCompression) bool {
+	for _, checksum := range []bool{false, true} {
+		if _, err := os.Stat(filepath.Join(path, freezerIndexName(name, compression, checksum))); err == nil {
+			return true
+		}
+	}
+	return false
 }
 
 // openFreezerFileForAppend opens a freezer table file and seeks to the end
@@ -151,38 +216,52 @@ func truncateFreezerFile(file *os.File, size int64) error {
 	return nil
 }
 
-// newCustomTable opens a freezer table, creating the data and index files if they are
+// newCustomTable opens a freezer table with either snappy or no compression. New
+// tables are created without checksums.
+func newCustomTable(path string, name string, readMeter metrics.Meter, writeMeter metrics.Meter, sizeGauge metrics.Gauge, maxFilesize uint32, noCompression bool) (*freezerTable, error) {
+	compression := compressionSnappy
+	if noCompression {
+		compression = compressionNone
+	}
+	return newFreezerTable(path, name, readMeter, writeMeter, sizeGauge, maxFilesize, compression, false)
+}
+
+// newFreezerTable opens a freezer table, creating the data and index files if they are
 // non existent. Both files are truncated to the shortest common length to ensure
 // they don't go out of sync.
-func newCustomTable(path string, name string, readMeter metrics.Meter, writeMeter metrics.Meter, sizeGauge metrics.Gauge, maxFilesize uint32, noCompression bool) (*freezerTable, error) {
+//
+// The checksum flag only applies to new tables, existing ones keep the format
+// of their index.
+func newFreezerTable(path string, name string, readMeter metrics.Meter, writeMeter metrics.Meter, sizeGauge metrics.Gauge, maxFilesize uint32, compression freezerCompression, checksum bool) (*freezerTable, error) {
 	// Ensure the containing directory exists and open the indexEntry file
 	if err := os.MkdirAll(path, 0755); err != nil {
 		return nil, err
 	}
-	var idxName string
-	if noCompression {
-		// Raw idx
-		idxName = fmt.Sprintf("%s.ridx", name)
-	} else {
-		// Compressed idx
-		idxName = fmt.Sprintf("%s.cidx", name)
+	if _, err := os.Stat(filepath.Join(path, freezerIndexName(name, compression, !checksum))); err == nil {
+		checksum = !checksum
 	}
-	offsets, err := openFreezerFileForAppend(filepath.Join(path, idxName))
+	offsets, err := openFreezerFileForAppend(filepath.Join(path, freezerIndexName(name, compression, checksum)))
 	if err != nil {
 		return nil, err
 	}
+	entrySize := int64(indexEntrySize)
+	if checksum {
+		entrySize = checksumIndexEntrySize
+	}
 	// Create the table and repair any past inconsistency
 	tab := &freezerTable{
-		index:         offsets,
-		files:         make(map[uint32]*os.File),
-		readMeter:     readMeter,
-		writeMeter:    writeMeter,
-		sizeGauge:     sizeGauge,
-		name:          name,
-		path:          path,
-		logger:        log.New("database", path, "table", name),
-		noCompression: noCompression,
-		maxFileSize:   maxFilesize,
+		index:       offsets,
+		files:       make(map[uint32]*os.File),
+		readMeter:   readMeter,
+		writeMeter:  writeMeter,
+		sizeGauge:   sizeGauge,
+		name:        name,
+		path:        path,
+		logger:      log.New("database", path, "table", name),
+		compression: compression,
+		checksum:    checksum,
+		entrySize:   entrySize,
+		maxFileSize: maxFilesize,
 	}
 	if err := tab.repair(); err != nil {
 		tab.Close()
@@ -203,7 +282,7 @@ func newCustomTable(path string, name string, readMeter metrics.Meter, writeMete
 // be in sync with each other after a potential crash / data loss.
 func (t *freezerTable) repair() error {
 	// Create a temporary offset buffer to init files with and read indexEntry into
-	buffer := make([]byte, indexEntrySize)
+	buffer := make([]byte, t.entrySize)
 
 	// If we've just created the files, initialize the index with the 0 indexEntry
 	stat, err := t.index.Stat()
@@ -215,8 +294,8 @@ func (t *freezerTable) repair() error {
 			return err
 		}
 	}
-	// Ensure the index is a multiple of indexEntrySize bytes
-	if overflow := stat.Size() % indexEntrySize; overflow != 0 {
+	// Ensure the index is a multiple of the entry size
+	if overflow := stat.Size() % t.entrySize; overflow != 0 {
 		truncateFreezerFile(t.index, stat.Size()-overflow) // New file can't trigger this path
 	}
 	// Retrieve the file sizes and prepare for truncation
@@ -240,7 +319,7 @@ func (t *freezerTable) repair() error {
 	t.tailId = firstIndex.filenum
 	t.itemOffset = firstIndex.offset
 
-	t.index.ReadAt(buffer, offsetsSize-indexEntrySize)
+	t.index.ReadAt(buffer, offsetsSize-t.entrySize)
 	lastIndex.unmarshalBinary(buffer)
 	t.head, err = t.openFile(lastIndex.filenum, openFreezerFileForAppend)
 	if err != nil {
@@ -266,11 +345,11 @@ func (t *freezerTable) repair() error {
 		// Truncate the index to point within the head file
 		if contentExp > contentSize {
 			t.logger.Warn("Truncating dangling indexes", "indexed", common.StorageSize(contentExp), "stored", common.StorageSize(contentSize))
-			if err := truncateFreezerFile(t.index, offsetsSize-indexEntrySize); err != nil {
+			if err := truncateFreezerFile(t.index, offsetsSize-t.entrySize); err != nil {
 				return err
 			}
-			offsetsSize -= indexEntrySize
-			t.index.ReadAt(buffer, offsetsSize-indexEntrySize)
+			offsetsSize -= t.entrySize
+			t.index.ReadAt(buffer, offsetsSize-t.entrySize)
 			var newLastIndex indexEntry
 			newLastIndex.unmarshalBinary(buffer)
 			// We might have slipped back into an earlier head-file here
@@ -299,7 +378,7 @@ func (t *freezerTable) repair() error {
 		return err
 	}
 	// Update the item and byte counters and return
-	t.items = uint64(t.itemOffset) + uint64(offsetsSize/indexEntrySize-1) // last indexEntry points to the end of the data file
+	t.items = uint64(t.itemOffset) + uint64(offsetsSize/t.entrySize-1) // last indexEntry points to the end of the data file
 	t.headBytes = uint32(contentSize)
 	t.headId = lastIndex.filenum
 
@@ -350,12 +429,18 @@ func (t *freezerTable) truncate(items uint64) error {
 		log = t.logger.Warn // Only loud warn if we delete multiple items
 	}
 	log("Truncating freezer table", "items", existing, "limit", items)
-	if err := truncateFreezerFile(t.index, int64(items+1)*indexEntrySize); err != nil {
+
+	// Items deleted from the tail are not present in the index anymore
+	if items < uint64(t.itemOffset) {
+		return errTruncateBelowTail
+	}
+	indexed := items - uint64(t.itemOffset)
+	if err := truncateFreezerFile(t.index, int64(indexed+1)*t.entrySize); err != nil {
 		return err
 	}
 	// Calculate the new expected size of the data file and truncate it
-	buffer := make([]byte, indexEntrySize)
-	if _, err := t.index.ReadAt(buffer, int64(items*indexEntrySize)); err != nil {
+	buffer := make([]byte, t.entrySize)
+	if _, err := t.index.ReadAt(buffer, int64(indexed)*t.entrySize); err != nil {
 		return err
 	}
 	var expected indexEntry
@@ -393,6 +478,111 @@ func (t *freezerTable) truncate(items uint64) error {
 	return nil
 }
 
+// truncateTail discards the oldest data below the provided threshold number.
+// As items are never split across data files, only the data files holding
+// nothing but items below the threshold are deleted, so the table might keep
+// a few more items than requested. The head data file is never deleted.
+func (t *freezerTable) truncateTail(items uint64) error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	// Never delete the last item, it pins the head data file
+	if head := atomic.LoadUint64(&t.items); items >= head {
+		if head == 0 {
+			return nil
+		}
+		items = head - 1
+	}
+	if items <= uint64(t.itemOffset) {
+		return nil
+	}
+	// Find the data file holding the new tail item, nothing to do if it's the
+	// current tail file
+	buffer := make([]byte, t.entrySize)
+	readEntry := func(pos uint64) (indexEntry, error) {
+		var entry indexEntry
+		if _, err := t.index.ReadAt(buffer, int64(pos)*t.entrySize); err != nil {
+			return entry, err
+		}
+		entry.unmarshalBinary(buffer)
+		return entry, nil
+	}
+	last := items - uint64(t.itemOffset) + 1
+	target, err := readEntry(last)
+	if err != nil {
+		return err
+	}
+	if target.filenum == t.tailId {
+		return nil
+	}
+	// Find the first item stored in the new tail file. Data files are written
+	// in order, so the file numbers in the index are monotonic.
+	first := uint64(sort.Search(int(last), func(i int) bool {
+		if i == 0 {
+			return false
+		}
+		entry, err := readEntry(uint64(i))
+		return err != nil || entry.filenum >= target.filenum
+	}))
+	oldSize, err := t.sizeNolock()
+	if err != nil {
+		return err
+	}
+	// Write out the new index into a temporary file and swap it in. The first
+	// entry carries the new tail file and the number of deleted items.
+	tail := indexEntry{
+		filenum: target.filenum,
+		offset:  t.itemOffset + uint32(first-1),
+	}
+	name := t.index.Name()
+	tmp, err := os.OpenFile(name+".tmp", os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(t.marshallEntry(&tail)); err != nil {
+		tmp.Close()
+		return err
+	}
+	if _, err := io.Copy(tmp, io.NewSectionReader(t.index, int64(first)*t.entrySize, math.MaxInt64)); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(name+".tmp", name); err != nil {
+		return err
+	}
+	t.index.Close()
+	if t.index, err = openFreezerFileForAppend(name); err != nil {
+		return err
+	}
+	// The index doesn't reference the old files anymore, delete them
+	for num := t.tailId; num < target.filenum; num++ {
+		if f, exist := t.files[num]; exist {
+			delete(t.files, num)
+			f.Close()
+			os.Remove(f.Name())
+		}
+	}
+	t.logger.Debug("Truncated freezer table tail", "items", first-1, "tail", tail.offset, "file", tail.filenum)
+	t.tailId = tail.filenum
+	atomic.StoreUint32(&t.itemOffset, tail.offset)
+
+	// Retrieve the new size and update the total size counter
+	newSize, err := t.sizeNolock()
+	if err != nil {
+		return err
+	}
+	t.sizeGauge.Dec(int64(oldSize - newSize))
+
+	return nil
+}
+
 // Close closes all opened files.
 func (t *freezerTable) Close() error {
 	t.lock.Lock()
@@ -421,12 +611,7 @@ func (t *freezerTable) Close() error {
 func (t *freezerTable) openFile(num uint32, opener func(string) (*os.File, error)) (f *os.File, err error) {
 	var exist bool
 	if f, exist = t.files[num]; !exist {
-		var name string
-		if t.noCompression {
-			name = fmt.Sprintf("%s.%04d.rdat", t.name, num)
-		} else {
-			name = fmt.Sprintf("%s.%04d.cdat", t.name, num)
-		}
+		name := fmt.Sprintf("%s.%04d.%sdat", t.name, num, t.compression.prefix())
 		f, err = opener(filepath.Join(t.path, name))
 		if err != nil {
 			return nil, err
@@ -466,9 +651,8 @@ func (t *freezerTable) releaseFilesAfter(num uint32, remove bool) {
 // fsync before irreversibly deleting data from the database.
 func (t *freezerTable) Append(item uint64, blob []byte) error {
 	// Encode the blob before the lock portion
-	if !t.noCompression {
-		blob = snappy.Encode(nil, blob)
-	}
+	blob = t.compression.encode(blob)
+
 	// Read lock prevents competition with truncate
 	retry, err := t.append(item, blob, false)
 	if err != nil {
@@ -536,30 +720,41 @@ func (t *freezerTable) append(item uint64, encodedBlob []byte, wlock bool) (bool
 		filenum: atomic.LoadUint32(&t.headId),
 		offset:  newOffset,
 	}
+	if t.checksum {
+		idx.checksum = crc32.Checksum(encodedBlob, crc32cTable)
+	}
 	// Write indexEntry
-	t.index.Write(idx.marshallBinary())
+	t.index.Write(t.marshallEntry(&idx))
 
-	t.writeMeter.Mark(int64(bLen + indexEntrySize))
-	t.sizeGauge.Inc(int64(bLen + indexEntrySize))
+	t.writeMeter.Mark(int64(bLen) + t.entrySize)
+	t.sizeGauge.Inc(int64(bLen) + t.entrySize)
 
 	atomic.AddUint64(&t.items, 1)
 	return false, nil
 }
 
+// marshallEntry serializes an index entry in the format of the table index.
+func (t *freezerTable) marshallEntry(entry *indexEntry) []byte {
+	if t.checksum {
+		return entry.marshallBinaryWithChecksum()
+	}
+	return entry.marshallBinary()
+}
+
 // getBounds returns the indexes for the item
-// returns start, end, filenumber and error
-func (t *freezerTable) getBounds(item uint64) (uint32, uint32, uint32, error) {
-	buffer := make([]byte, indexEntrySize)
+// returns the start offset, the index entry of the end and error
+func (t *freezerTable) getBounds(item uint64) (uint32, indexEntry, error) {
+	buffer := make([]byte, t.entrySize)
 	var startIdx, endIdx indexEntry
 	// Read second index
-	if _, err := t.index.ReadAt(buffer, int64((item+1)*indexEntrySize)); err != nil {
-		return 0, 0, 0, err
+	if _, err := t.index.ReadAt(buffer, int64(item+1)*t.entrySize); err != nil {
+		return 0, endIdx, err
 	}
 	endIdx.unmarshalBinary(buffer)
 	// Read first index (unless it's the very first item)
 	if item != 0 {
-		if _, err := t.index.ReadAt(buffer, int64(item*indexEntrySize)); err != nil {
-			return 0, 0, 0, err
+		if _, err := t.index.ReadAt(buffer, int64(item)*t.entrySize); err != nil {
+			return 0, endIdx, err
 		}
 		startIdx.unmarshalBinary(buffer)
 	} else {
@@ -568,15 +763,15 @@ func (t *freezerTable) getBounds(item uint64) (uint32, uint32, uint32, error) {
 		// only support deletion by files, so that the assumption is held).
 		// This means we can use the first item metadata to carry information about
 		// the 'global' offset, for the deletion-case
-		return 0, endIdx.offset, endIdx.filenum, nil
+		return 0, endIdx, nil
 	}
 	if startIdx.filenum != endIdx.filenum {
 		// If a piece of data 'crosses' a data-file,
 		// it's actually in one piece on the second data-file.
 		// We return a zero-indexEntry for the second file as start
-		return 0, endIdx.offset, endIdx.filenum, nil
+		return 0, endIdx, nil
 	}
-	return startIdx.offset, endIdx.offset, endIdx.filenum, nil
+	return startIdx.offset, endIdx, nil
 }
 
 // Retrieve looks up the data offset of an item with the given number and retrieves
@@ -586,15 +781,12 @@ func (t *freezerTable) Retrieve(item uint64) ([]byte, error) {
 	if err != nil {
 		return nil, err
 	}
-	if t.noCompression {
-		return blob, nil
-	}
-	return snappy.Decode(nil, blob)
+	return t.compression.decode(blob)
 }
 
 // retrieve looks up the data offset of an item with the given number and retrieves
-// the raw binary blob from the data file. OBS! This method does not decode
-// compressed data.
+// the raw binary blob from the data file, verifying its checksum if the index
+// carries any. OBS! This method does not decode compressed data.
 func (t *freezerTable) retrieve(item uint64) ([]byte, error) {
 	t.lock.RLock()
 	defer t.lock.RUnlock()
@@ -609,27 +801,178 @@ func (t *freezerTable) retrieve(item uint64) ([]byte, error) {
 	if uint64(t.itemOffset) > item {
 		return nil, errOutOfBounds
 	}
-	startOffset, endOffset, filenum, err := t.getBounds(item - uint64(t.itemOffset))
+	startOffset, end, err := t.getBounds(item - uint64(t.itemOffset))
 	if err != nil {
 		return nil, err
 	}
-	dataFile, exist := t.files[filenum]
+	dataFile, exist := t.files[end.filenum]
 	if !exist {
-		return nil, fmt.Errorf("missing data file %d", filenum)
+		return nil, fmt.Errorf("missing data file %d", end.filenum)
 	}
 	// Retrieve the data itself, decompress and return
-	blob := make([]byte, endOffset-startOffset)
+	blob := make([]byte, end.offset-startOffset)
 	if _, err := dataFile.ReadAt(blob, int64(startOffset)); err != nil {
 		return nil, err
 	}
-	t.readMeter.Mark(int64(len(blob) + 2*indexEntrySize))
+	t.readMeter.Mark(int64(len(blob)) + 2*t.entrySize)
+
+	if t.checksum && crc32.Checksum(blob, crc32cTable) != end.checksum {
+		return nil, fmt.Errorf("%w: item %d", errChecksumMismatch, item)
+	}
 	return blob, nil
 }
 
+// repairItem overwrites a stored item in place with the given blob, restoring
+// an item corrupted on disk from a copy. The replacement must have the exact
+// size of the stored item once encoded, the index checksum is updated as well.
+func (t *freezerTable) repairItem(item uint64, blob []byte) error {
+	encoded := t.compression.encode(blob)
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if t.index == nil || t.head == nil {
+		return errClosed
+	}
+	if atomic.LoadUint64(&t.items) <= item || uint64(t.itemOffset) > item {
+		return errOutOfBounds
+	}
+	pos := item - uint64(t.itemOffset)
+	startOffset, end, err := t.getBounds(pos)
+	if err != nil {
+		return err
+	}
+	if uint32(len(encoded)) != end.offset-startOffset {
+		return fmt.Errorf("%w: item %d has %d bytes, replacement %d", errRepairSizeMismatch, item, end.offset-startOffset, len(encoded))
+	}
+	dataFile, exist := t.files[end.filenum]
+	if !exist {
+		return fmt.Errorf("missing data file %d", end.filenum)
+	}
+	// Data files other than the head are opened read only, write through a
+	// separate descriptor
+	file, err := os.OpenFile(dataFile.Name(), os.O_RDWR, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := file.WriteAt(encoded, int64(startOffset)); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	if !t.checksum {
+		return nil
+	}
+	end.checksum = crc32.Checksum(encoded, crc32cTable)
+	if _, err := t.index.WriteAt(t.marshallEntry(&end), int64(pos+1)*t.entrySize); err != nil {
+		return err
+	}
+	return t.index.Sync()
+}
+
+// addChecksums converts a table created before checksums were introduced into
+// a checksummed one, computing the checksums of the items stored on disk. The
+// items are decoded first, so a corruption breaking the decompression aborts the
+// conversion instead of being sealed with a valid checksum.
+//
+// The checksummed index is swapped in before the legacy one is deleted. Should
+// the process be interrupted in between, the legacy index is kept on the next
+// startup and the conversion can be run again.
+func (t *freezerTable) addChecksums() error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if t.index == nil || t.head == nil {
+		return errClosed
+	}
+	if t.checksum {
+		return nil
+	}
+	var (
+		legacy  = t.index.Name()
+		name    = filepath.Join(t.path, freezerIndexName(t.name, t.compression, true))
+		entries = atomic.LoadUint64(&t.items) - uint64(t.itemOffset) + 1
+		buffer  = make([]byte, indexEntrySize)
+	)
+	tmp, err := os.OpenFile(name+".tmp", os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	var (
+		writer = bufio.NewWriter(tmp)
+		prev   indexEntry
+	)
+	for pos := uint64(0); pos < entries; pos++ {
+		var entry indexEntry
+		if _, err := t.index.ReadAt(buffer, int64(pos*indexEntrySize)); err != nil {
+			tmp.Close()
+			return err
+		}
+		entry.unmarshalBinary(buffer)
+
+		// The first entry only carries the tail, checksum the following items
+		if pos > 0 {
+			start := prev.offset
+			if pos == 1 || prev.filenum != entry.filenum {
+				start = 0
+			}
+			dataFile, exist := t.files[entry.filenum]
+			if !exist {
+				tmp.Close()
+				return fmt.Errorf("missing data file %d", entry.filenum)
+			}
+			blob := make([]byte, entry.offset-start)
+			if _, err := dataFile.ReadAt(blob, int64(start)); err != nil {
+				tmp.Close()
+				return err
+			}
+			if _, err := t.compression.decode(blob); err != nil {
+				tmp.Close()
+				return fmt.Errorf("item %d: %v", uint64(t.itemOffset)+pos-1, err)
+			}
+			entry.checksum = crc32.Checksum(blob, crc32cTable)
+		}
+		if _, err := writer.Write(entry.marshallBinaryWithChecksum()); err != nil {
+			tmp.Close()
+			return err
+		}
+		prev = entry
+	}
+	if err := writer.Flush(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(name+".tmp", name); err != nil {
+		return err
+	}
+	index, err := openFreezerFileForAppend(name)
+	if err != nil {
+		return err
+	}
+	t.index.Close()
+	t.index, t.checksum, t.entrySize = index, true, checksumIndexEntrySize
+
+	t.logger.Info("Added checksums to freezer table", "items", entries-1)
+	return os.Remove(legacy)
+}
+
 // has returns an indicator whether the specified number data
 // exists in the freezer table.
 func (t *freezerTable) has(number uint64) bool {
-	return atomic.LoadUint64(&t.items) > number
+	return atomic.LoadUint64(&t.items) > number && uint64(atomic.LoadUint32(&t.itemOffset)) <= number
 }
 
 // size returns the total data size in the freezer table.
@@ -663,18 +1006,26 @@ func (t *freezerTable) Sync() error {
 // DumpIndex is a debug print utility function, mainly for testing. It can also
 // be used to analyse a live freezer table index.
 func (t *freezerTable) DumpIndex(start, stop int64) {
-	buf := make([]byte, indexEntrySize)
-
-	fmt.Printf("| number | fileno | offset |\n")
-	fmt.Printf("|--------|--------|--------|\n")
+	buf := make([]byte, t.entrySize)
 
+	if t.checksum {
+		fmt.Printf("| number | fileno | offset | checksum |\n")
+		fmt.Printf("|--------|--------|--------|----------|\n")
+	} else {
+		fmt.Printf("| number | fileno | offset |\n")
+		fmt.Printf("|--------|--------|--------|\n")
+	}
 	for i := uint64(start); ; i++ {
-		if _, err := t.index.ReadAt(buf, int64(i*indexEntrySize)); err != nil {
+		if _, err := t.index.ReadAt(buf, int64(i)*t.entrySize); err != nil {
 			break
 		}
 		var entry indexEntry
 		entry.unmarshalBinary(buf)
-		fmt.Printf("|  %03d   |  %03d   |  %03d   | \n", i, entry.filenum, entry.offset)
+		if t.checksum {
+			fmt.Printf("|  %03d   |  %03d   |  %03d   | %08x | \n", i, entry.filenum, entry.offset, entry.checksum)
+		} else {
+			fmt.Printf("|  %03d   |  %03d   |  %03d   | \n", i, entry.filenum, entry.offset)
+		}
 		if stop > 0 && i >= uint64(stop) {
 			break
 		}
@@ -18,6 +18,7 @@ package rawdb
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"math/rand"
 	"os"
@@ -638,3 +639,205 @@ func TestOffset(t *testing.T) {
 // However, all 'normal' failure modes arising due to failing to sync() or save a file should be
 // handled already, and the case described above can only (?) happen if an external process/user
 // deletes files from the filesystem.
+
+// TestFreezerTruncateTail tests that the oldest items can be deleted from a
+// table, and the deletion is preserved across a reopen.
+func TestFreezerTruncateTail(t *testing.T) {
+	t.Parallel()
+	rm, wm, sg := metrics.NewMeter(), metrics.NewMeter(), metrics.NewGauge()
+	fname := fmt.Sprintf("truncate-tail-%d", rand.Uint64())
+
+	// Write 7 x 20 bytes, splitting out into four files
+	f, err := newCustomTable(os.TempDir(), fname, rm, wm, sg, 40, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for x := 0; x < 7; x++ {
+		f.Append(uint64(x), getChunk(20, x))
+	}
+	checkRetrieve := func(f *freezerTable, tail, head int) {
+		t.Helper()
+		for x := 0; x < head; x++ {
+			got, err := f.Retrieve(uint64(x))
+			if x < tail {
+				if err == nil || f.has(uint64(x)) {
+					t.Fatalf("item %d not deleted", x)
+				}
+				continue
+			}
+			if err != nil {
+				t.Fatalf("failed to retrieve item %d: %v", x, err)
+			}
+			if exp := getChunk(20, x); !bytes.Equal(got, exp) {
+				t.Fatalf("item %d: have %x, want %x", x, got, exp)
+			}
+		}
+	}
+	// Deleting item 3 only deletes the first file, item 2 shares the file
+	if err := f.truncateTail(3); err != nil {
+		t.Fatal(err)
+	}
+	if f.itemOffset != 2 || f.tailId != 1 {
+		t.Fatalf("tail mismatch: have offset %d file %d, want offset 2 file 1", f.itemOffset, f.tailId)
+	}
+	if _, err := os.Stat(filepath.Join(os.TempDir(), fmt.Sprintf("%s.0000.rdat", fname))); !os.IsNotExist(err) {
+		t.Fatalf("tail file not removed: %v", err)
+	}
+	checkRetrieve(f, 2, 7)
+
+	// Deleting beyond the head keeps the head file
+	if err := f.truncateTail(100); err != nil {
+		t.Fatal(err)
+	}
+	if f.itemOffset != 6 || f.tailId != 3 {
+		t.Fatalf("tail mismatch: have offset %d file %d, want offset 6 file 3", f.itemOffset, f.tailId)
+	}
+	checkRetrieve(f, 6, 7)
+	f.Close()
+
+	// Reopen the table, the tail should be preserved and appending still work
+	f, err = newCustomTable(os.TempDir(), fname, rm, wm, sg, 40, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	if f.itemOffset != 6 || f.items != 7 {
+		t.Fatalf("reopened table mismatch: have offset %d items %d, want offset 6 items 7", f.itemOffset, f.items)
+	}
+	if err := f.Append(7, getChunk(20, 7)); err != nil {
+		t.Fatal(err)
+	}
+	checkRetrieve(f, 6, 8)
+
+	// Truncating the head has to account for the deleted items
+	if err := f.truncate(7); err != nil {
+		t.Fatal(err)
+	}
+	checkRetrieve(f, 6, 7)
+	if err := f.truncate(5); err != errTruncateBelowTail {
+		t.Fatalf("truncation below tail: have %v, want %v", err, errTruncateBelowTail)
+	}
+}
+
+// TestFreezerChecksum tests that corrupted items are detected through the index
+// checksums and can be restored in place.
+func TestFreezerChecksum(t *testing.T) {
+	t.Parallel()
+	rm, wm, sg := metrics.NewMeter(), metrics.NewMeter(), metrics.NewGauge()
+	fname := fmt.Sprintf("checksum-%d", rand.Uint64())
+
+	// Write 7 x 20 bytes, splitting out into four files
+	f, err := newFreezerTable(os.TempDir(), fname, rm, wm, sg, 40, compressionNone, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for x := 0; x < 7; x++ {
+		f.Append(uint64(x), getChunk(20, x))
+	}
+	f.Close()
+
+	// Flip a byte of item 3, the second one of the second file
+	p := filepath.Join(os.TempDir(), fmt.Sprintf("%s.0001.rdat", fname))
+	file, err := os.OpenFile(p, os.O_RDWR, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.WriteAt([]byte{0xff}, 25)
+	file.Close()
+
+	// Reopen the table without requesting checksums, the index format is kept
+	f, err = newCustomTable(os.TempDir(), fname, rm, wm, sg, 40, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	if !f.checksum {
+		t.Fatal("checksummed index not detected")
+	}
+	if _, err := f.Retrieve(3); !errors.Is(err, errChecksumMismatch) {
+		t.Fatalf("corruption not detected: %v", err)
+	}
+	for _, x := range []uint64{2, 4} {
+		if _, err := f.Retrieve(x); err != nil {
+			t.Fatalf("failed to retrieve item %d: %v", x, err)
+		}
+	}
+	// Restore the item, replacements of a different size are rejected
+	if err := f.repairItem(3, getChunk(21, 3)); !errors.Is(err, errRepairSizeMismatch) {
+		t.Fatalf("oversized replacement accepted: %v", err)
+	}
+	if err := f.repairItem(3, getChunk(20, 3)); err != nil {
+		t.Fatal(err)
+	}
+	got, err := f.Retrieve(3)
+	if err != nil {
+		t.Fatalf("failed to retrieve repaired item: %v", err)
+	}
+	if exp := getChunk(20, 3); !bytes.Equal(got, exp) {
+		t.Fatalf("repaired item: have %x, want %x", got, exp)
+	}
+}
+
+// TestFreezerAddChecksums tests that checksums can be added to a table created
+// without them, keeping its items and detecting later corruptions.
+func TestFreezerAddChecksums(t *testing.T) {
+	t.Parallel()
+	rm, wm, sg := metrics.NewMeter(), metrics.NewMeter(), metrics.NewGauge()
+	fname := fmt.Sprintf("addchecksums-%d", rand.Uint64())
+
+	// Write 7 x 20 bytes into a legacy table, splitting out into four files
+	f, err := newCustomTable(os.TempDir(), fname, rm, wm, sg, 40, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for x := 0; x < 7; x++ {
+		f.Append(uint64(x), getChunk(20, x))
+	}
+	if f.checksum {
+		t.Fatal("legacy table created with checksums")
+	}
+	if err := f.addChecksums(); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	// Reopen the table, the checksummed index should be picked up
+	f, err = newCustomTable(os.TempDir(), fname, rm, wm, sg, 40, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !f.checksum {
+		t.Fatal("checksummed index not detected")
+	}
+	for x := 0; x < 7; x++ {
+		got, err := f.Retrieve(uint64(x))
+		if err != nil {
+			t.Fatalf("failed to retrieve item %d: %v", x, err)
+		}
+		if exp := getChunk(20, x); !bytes.Equal(got, exp) {
+			t.Fatalf("item %d: have %x, want %x", x, got, exp)
+		}
+	}
+	f.Close()
+
+	// Flip a byte of item 3, the second one of the second file
+	p := filepath.Join(os.TempDir(), fmt.Sprintf("%s.0001.rdat", fname))
+	file, err := os.OpenFile(p, os.O_RDWR, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.WriteAt([]byte{0xff}, 25)
+	file.Close()
+
+	f, err = newCustomTable(os.TempDir(), fname, rm, wm, sg, 40, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	if _, err := f.Retrieve(3); !errors.Is(err, errChecksumMismatch) {
+		t.Fatalf("corruption not detected: %v", err)
+	}
+}
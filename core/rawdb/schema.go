@@ -30,6 +30,9 @@ var (
 	// databaseVersionKey tracks the current database version.
 	databaseVersionKey = []byte("DatabaseVersion")
 
+	// databaseEngineKey tracks the storage engine the database was created with.
+	databaseEngineKey = []byte("DatabaseEngine")
+
 	// headHeaderKey tracks the latest known header's hash.
 	headHeaderKey = []byte("LastHeader")
 
@@ -63,12 +66,21 @@ var (
 	// snapshotSyncStatusKey tracks the snapshot sync status across restarts.
 	snapshotSyncStatusKey = []byte("SnapshotSyncStatus")
 
+	// snapshotImportKey tracks the state archive being imported across restarts.
+	snapshotImportKey = []byte("SnapshotImport")
+
 	// txIndexTailKey tracks the oldest block whose transactions have been indexed.
 	txIndexTailKey = []byte("TransactionIndexTail")
 
 	// fastTxLookupLimitKey tracks the transaction lookup limit during fast sync.
 	fastTxLookupLimitKey = []byte("FastTransactionLookupLimit")
 
+	// statePruneCursorKey tracks the progress of the online state pruner across restarts.
+	statePruneCursorKey = []byte("StatePruneCursor")
+
+	// ancientRepairKey tracks the corrupted ancient ranges to be repaired from the network.
+	ancientRepairKey = []byte("AncientRepair")
+
 	//offSet of new updated ancientDB.
 	offSetOfCurrentAncientFreezer = []byte("offSetOfCurrentAncientFreezer")
 
@@ -136,6 +148,14 @@ var FreezerNoSnappy = map[string]bool{
 	freezerDifficultyTable: true,
 }
 
+// FreezerZstd configures the ancient-tables compressed with zstd instead of snappy
+// when enabled. Bodies and receipts make up most of the ancient store. The setting
+// only applies to new tables, existing ones keep their compression.
+var FreezerZstd = map[string]bool{
+	freezerBodiesTable:  true,
+	freezerReceiptTable: true,
+}
+
 // LegacyTxLookupEntry is the legacy TxLookupEntry definition with some unnecessary
 // fields.
 type LegacyTxLookupEntry struct {
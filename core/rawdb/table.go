@@ -73,7 +73,8 @@ func (t *table) ItemAmountInAncient() (uint64, error) {
 	return t.db.ItemAmountInAncient()
 }
 
-// AncientOffSet returns the offset of current ancientDB.
+// AncientOffSet is a noop passthrough that just forwards the request to the
+// underlying database.
 func (t *table) AncientOffSet() uint64 {
 	return t.db.AncientOffSet()
 }
@@ -96,6 +97,18 @@ func (t *table) TruncateAncients(items uint64) error {
 	return t.db.TruncateAncients(items)
 }
 
+// TruncateTail is a noop passthrough that just forwards the request to the underlying
+// database.
+func (t *table) TruncateTail(tail uint64) error {
+	return t.db.TruncateTail(tail)
+}
+
+// RepairAncient is a noop passthrough that just forwards the request to the
+// underlying database.
+func (t *table) RepairAncient(kind string, number uint64, item []byte) error {
+	return t.db.RepairAncient(kind, number, item)
+}
+
 // Sync is a noop passthrough that just forwards the request to the underlying
 // database.
 func (t *table) Sync() error {
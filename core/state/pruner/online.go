@@ -0,0 +1,496 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package pruner
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state/snapshot"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+	"github.com/ethereum/go-ethereum/trie"
+	"golang.org/x/time/rate"
+)
+
+const (
+	// onlinePrunerMinBloomSize is the minimal size in megabytes of the bloom
+	// filter tracking the live state.
+	onlinePrunerMinBloomSize = 256
+
+	// onlinePrunerFlushBloomRatio is the size ratio between the bloom filter of
+	// the live state and the one of the nodes flushed while pruning.
+	onlinePrunerFlushBloomRatio = 8
+)
+
+var (
+	onlineMarkedGauge   = metrics.NewRegisteredGauge("state/prune/online/marked", nil)
+	onlineProgressGauge = metrics.NewRegisteredGauge("state/prune/online/progress", nil)
+	onlineDeletedMeter  = metrics.NewRegisteredMeter("state/prune/online/deleted", nil)
+	onlineSizeMeter     = metrics.NewRegisteredMeter("state/prune/online/size", nil)
+	onlineCyclesCounter = metrics.NewRegisteredCounter("state/prune/online/cycles", nil)
+	onlineFailuresMeter = metrics.NewRegisteredMeter("state/prune/online/failures", nil)
+)
+
+var (
+	// errOnlinePrunerAbort is returned if the pruner is stopped in the middle of a cycle.
+	errOnlinePrunerAbort = errors.New("online pruner aborted")
+
+	// errOnlinePrunerBloomSize is returned if the bloom filter of the live state
+	// is configured below the minimal size.
+	errOnlinePrunerBloomSize = fmt.Errorf("online pruner bloom filter smaller than %dMB", onlinePrunerMinBloomSize)
+
+	// errOnlinePrunerRate is returned if the deletion rate is negative.
+	errOnlinePrunerRate = errors.New("negative online pruner rate")
+
+	// errOnlinePrunerInterval is returned if the pause between two cycles is
+	// not positive.
+	errOnlinePrunerInterval = errors.New("non-positive online pruner interval")
+)
+
+// The phases an online pruning cycle goes through.
+const (
+	OnlinePhaseIdle     = "idle"     // Waiting for the next cycle
+	OnlinePhaseWaiting  = "waiting"  // Waiting for a state to be flushed to disk
+	OnlinePhaseMarking  = "marking"  // Collecting the live state into the bloom filter
+	OnlinePhaseSweeping = "sweeping" // Deleting the nodes missing from the live state
+)
+
+// OnlinePrunerConfig contains the settings of the online state pruner.
+type OnlinePrunerConfig struct {
+	BloomSize uint64        // Megabytes of memory allocated to the bloom filter of the live state
+	Rate      int           // Maximum number of trie nodes deleted per second
+	Interval  time.Duration // Pause between two pruning cycles
+}
+
+// OnlinePrunerChain defines the subset of the blockchain the online state
+// pruner needs to locate the snapshot disk layer in the chain.
+type OnlinePrunerChain interface {
+	// CurrentHeader retrieves the current head header of the canonical chain.
+	CurrentHeader() *types.Header
+
+	// GetHeaderByNumber retrieves a block header from the canonical chain.
+	GetHeaderByNumber(number uint64) *types.Header
+}
+
+// OnlinePruneStatus is the progress report of the online state pruner.
+type OnlinePruneStatus struct {
+	Phase       string        `json:"phase"`
+	Cycles      uint64        `json:"cycles"`      // Number of completed cycles since startup
+	Root        common.Hash   `json:"root"`        // State root used as the live set of the current cycle
+	Marked      uint64        `json:"marked"`      // Number of live state entries marked in the current cycle
+	Deleted     uint64        `json:"deleted"`     // Number of trie nodes deleted in the current cycle
+	DeletedSize uint64        `json:"deletedSize"` // Size of the trie nodes deleted in the current cycle
+	Cursor      hexutil.Bytes `json:"cursor"`      // Last key swept in the current cycle
+	LastError   string        `json:"lastError,omitempty"`
+}
+
+// OnlinePruner is an in-process state garbage collector running alongside the
+// blockchain. It works in cycles, each made up of two phases:
+//
+// - mark: once the snapshot disk layer moved past the head at the beginning of
+//   the cycle, the tries of the disk layer are regenerated from the snapshot
+//   and collected in a bloom filter. Being the bottom of the snapshot tree,
+//   every more recent state is built on top of it.
+// - sweep: the database is iterated and all the trie nodes missing from the
+//   bloom filter are deleted, at a limited rate.
+//
+// Since the blockchain keeps on running, every node flushed by the trie
+// database since the beginning of the cycle is tracked in a second filter and
+// protected from the sweeping as well. The sweeping position is persisted, so
+// an interrupted cycle resumes where it left off after a restart.
+//
+// Note the pruner relies on the trie database being the only writer of trie
+// nodes, it only starts once the blockchain commits a state, which doesn't
+// happen while the node is still snap or fast syncing.
+type OnlinePruner struct {
+	db       ethdb.Database
+	snaptree *snapshot.Tree
+	chain    OnlinePrunerChain
+	config   OnlinePrunerConfig
+
+	live    *stateBloom // Trie nodes and codes of the marked state, immutable while sweeping
+	flushed *stateBloom // Trie nodes flushed to disk since the beginning of the cycle
+	lock    sync.Mutex  // Lock protecting the flushed filter against concurrent sweeping
+
+	commitCh chan committedState // Channel to deliver the states committed to disk
+	status   OnlinePruneStatus
+	statusMu sync.RWMutex
+
+	quit chan struct{}
+	wg   sync.WaitGroup
+}
+
+// committedState is a state whose trie was entirely flushed to disk.
+type committedState struct {
+	root   common.Hash
+	number uint64
+}
+
+// NewOnlinePruner creates an online state pruner operating on the given database.
+// The trie database is used to track the nodes flushed to disk while pruning.
+func NewOnlinePruner(db ethdb.Database, triedb *trie.Database, snaptree *snapshot.Tree, chain OnlinePrunerChain, config OnlinePrunerConfig) (*OnlinePruner, error) {
+	if config.BloomSize < onlinePrunerMinBloomSize {
+		return nil, errOnlinePrunerBloomSize
+	}
+	if config.Rate < 0 {
+		return nil, errOnlinePrunerRate
+	}
+	if config.Interval <= 0 {
+		return nil, errOnlinePrunerInterval
+	}
+	p := &OnlinePruner{
+		db:       db,
+		snaptree: snaptree,
+		chain:    chain,
+		config:   config,
+		commitCh: make(chan committedState, 1),
+		status:   OnlinePruneStatus{Phase: OnlinePhaseIdle},
+		quit:     make(chan struct{}),
+	}
+	triedb.SetFlushHook(p.markFlushed)
+	return p, nil
+}
+
+// Start launches the background pruning loop.
+func (p *OnlinePruner) Start() {
+	p.wg.Add(1)
+	go p.loop()
+}
+
+// Stop terminates the background pruning loop, the progress of the current
+// cycle is kept and resumed on the next startup.
+func (p *OnlinePruner) Stop() {
+	close(p.quit)
+	p.wg.Wait()
+}
+
+// Committed notifies the pruner that the trie of the state at the given block
+// has been entirely flushed to disk.
+func (p *OnlinePruner) Committed(root common.Hash, number uint64) {
+	select {
+	case p.commitCh <- committedState{root: root, number: number}:
+	default:
+	}
+}
+
+// Status returns the progress of the current pruning cycle.
+func (p *OnlinePruner) Status() OnlinePruneStatus {
+	p.statusMu.RLock()
+	defer p.statusMu.RUnlock()
+
+	status := p.status
+	status.Cursor = common.CopyBytes(p.status.Cursor)
+	return status
+}
+
+// updateStatus applies the given change to the pruning status.
+func (p *OnlinePruner) updateStatus(update func(status *OnlinePruneStatus)) {
+	p.statusMu.Lock()
+	defer p.statusMu.Unlock()
+
+	update(&p.status)
+}
+
+// markFlushed is the flush hook of the trie database, it protects the nodes
+// written to disk from being deleted by the current cycle.
+func (p *OnlinePruner) markFlushed(hash common.Hash) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if p.flushed != nil {
+		p.flushed.Put(hash.Bytes(), nil)
+	}
+}
+
+// loop runs the pruning cycles until the pruner is stopped.
+func (p *OnlinePruner) loop() {
+	defer p.wg.Done()
+
+	for {
+		err := p.prune()
+		if err == errOnlinePrunerAbort {
+			return
+		}
+		if err != nil {
+			log.Error("Online state pruning failed", "err", err)
+			onlineFailuresMeter.Mark(1)
+			p.updateStatus(func(status *OnlinePruneStatus) { status.LastError = err.Error() })
+		}
+		p.updateStatus(func(status *OnlinePruneStatus) { status.Phase = OnlinePhaseIdle })
+
+		select {
+		case <-time.After(p.config.Interval):
+		case <-p.quit:
+			return
+		}
+	}
+}
+
+// prune runs a full pruning cycle.
+func (p *OnlinePruner) prune() error {
+	// Start tracking the flushed nodes before picking the live state. Any node
+	// written from now on is protected, so that only the nodes flushed before
+	// need to be reachable from the live state.
+	live, err := newStateBloomWithSize(p.config.BloomSize)
+	if err != nil {
+		return err
+	}
+	flushed, err := newStateBloomWithSize(p.config.BloomSize / onlinePrunerFlushBloomRatio)
+	if err != nil {
+		return err
+	}
+	p.lock.Lock()
+	p.live, p.flushed = live, flushed
+	p.lock.Unlock()
+
+	defer func() {
+		p.lock.Lock()
+		p.live, p.flushed = nil, nil
+		p.lock.Unlock()
+	}()
+	// Wait for the snapshot disk layer to move past the head at the beginning
+	// of the cycle, woken up by the states flushed by the blockchain. Every node
+	// of a more recent state is either part of the disk layer or flushed during
+	// the cycle, everything else isn't reachable anymore.
+	head := p.chain.CurrentHeader().Number.Uint64()
+	p.updateStatus(func(status *OnlinePruneStatus) {
+		*status = OnlinePruneStatus{Phase: OnlinePhaseWaiting, Cycles: status.Cycles, LastError: status.LastError}
+	})
+	var root common.Hash
+	for root == (common.Hash{}) {
+		select {
+		case committed := <-p.commitCh:
+			if committed.number > head {
+				root = p.liveRoot(head)
+			}
+		case <-p.quit:
+			return errOnlinePrunerAbort
+		}
+	}
+	// Regenerate the live state from the snapshot disk layer and collect it,
+	// along with the genesis state, into the bloom filter
+	log.Info("Marking live state for online pruning", "root", root)
+	p.updateStatus(func(status *OnlinePruneStatus) {
+		status.Phase, status.Root = OnlinePhaseMarking, root
+	})
+	start := time.Now()
+	if err := snapshot.GenerateTrie(p.snaptree, root, p.db, &liveMarker{pruner: p}); err != nil {
+		return err
+	}
+	if err := extractGenesis(p.db, p.live); err != nil {
+		return err
+	}
+	select {
+	case <-p.quit:
+		return errOnlinePrunerAbort
+	default:
+	}
+	log.Info("Marked live state for online pruning", "root", root, "elapsed", common.PrettyDuration(time.Since(start)))
+
+	// Sweep the database from the last position onwards
+	p.updateStatus(func(status *OnlinePruneStatus) { status.Phase = OnlinePhaseSweeping })
+	if err := p.sweep(); err != nil {
+		return err
+	}
+	onlineCyclesCounter.Inc(1)
+	p.updateStatus(func(status *OnlinePruneStatus) { status.Cycles++ })
+	return nil
+}
+
+// liveRoot returns the root of the snapshot disk layer if it belongs to a block
+// above the given number, or an empty hash if the disk layer is older.
+func (p *OnlinePruner) liveRoot(number uint64) common.Hash {
+	root := p.snaptree.DiskRoot()
+	for n := p.chain.CurrentHeader().Number.Uint64(); n > number; n-- {
+		header := p.chain.GetHeaderByNumber(n)
+		if header == nil {
+			break
+		}
+		if header.Root == root {
+			return root
+		}
+	}
+	return common.Hash{}
+}
+
+// liveMarker collects the trie nodes and contract codes regenerated from the
+// snapshot into the live state filter. It's written to concurrently by the
+// storage trie generators.
+//
+// Note the regeneration can't be interrupted, so a stop request is only served
+// once the live state is fully marked.
+type liveMarker struct {
+	pruner *OnlinePruner
+	marked uint64
+}
+
+// Put implements the KeyValueWriter interface, collecting the key into the
+// live state filter.
+func (m *liveMarker) Put(key []byte, value []byte) error {
+	if err := m.pruner.live.Put(key, nil); err != nil {
+		return err
+	}
+	if marked := atomic.AddUint64(&m.marked, 1); marked%10000 == 0 {
+		onlineMarkedGauge.Update(int64(marked))
+		m.pruner.updateStatus(func(status *OnlinePruneStatus) { status.Marked = marked })
+	}
+	return nil
+}
+
+// Delete implements the KeyValueWriter interface, it's not supported.
+func (m *liveMarker) Delete(key []byte) error { panic("not supported") }
+
+// sweep iterates the database from the persisted cursor and deletes the trie
+// nodes which are neither part of the live state nor flushed during the cycle.
+func (p *OnlinePruner) sweep() error {
+	var (
+		count  uint64
+		size   uint64
+		start  = time.Now()
+		logged = time.Now()
+		cursor = rawdb.ReadStatePruneCursor(p.db)
+
+		keys  [][]byte
+		sizes []int
+	)
+	// Delete the nodes in batches, each at most as large as the rate limit
+	limiter, limit := rate.NewLimiter(rate.Inf, 0), ethdb.IdealBatchSize/common.HashLength
+	if p.config.Rate > 0 {
+		limiter = rate.NewLimiter(rate.Limit(p.config.Rate), p.config.Rate)
+		if p.config.Rate < limit {
+			limit = p.config.Rate
+		}
+	}
+	if cursor != nil {
+		log.Info("Resuming online state pruning", "cursor", hexutil.Bytes(cursor))
+	}
+	// flush deletes the collected nodes, unless they were flushed to disk in
+	// the meantime, and persists the cursor. The lock is held until the batch
+	// is written, so no node can be flushed between the check and the deletion.
+	flush := func(last []byte) error {
+		p.lock.Lock()
+		defer p.lock.Unlock()
+
+		var (
+			batch   = p.db.NewBatch()
+			deleted int
+		)
+		for i, key := range keys {
+			if ok, _ := p.flushed.Contain(key); ok {
+				continue
+			}
+			batch.Delete(key)
+			deleted++
+			size += uint64(sizes[i])
+			onlineSizeMeter.Mark(int64(sizes[i]))
+		}
+		rawdb.WriteStatePruneCursor(batch, last)
+		if err := batch.Write(); err != nil {
+			return err
+		}
+		count += uint64(deleted)
+		onlineDeletedMeter.Mark(int64(deleted))
+		onlineProgressGauge.Update(int64(binary.BigEndian.Uint16(last)) * 1000 / 65536)
+		p.updateStatus(func(status *OnlinePruneStatus) {
+			status.Deleted, status.DeletedSize, status.Cursor = count, size, common.CopyBytes(last)
+		})
+		keys, sizes = keys[:0], sizes[:0]
+		return nil
+	}
+	iter := p.db.NewIterator(nil, cursor)
+	defer func() { iter.Release() }()
+
+	for iter.Next() {
+		key := iter.Key()
+		if len(key) != common.HashLength {
+			continue
+		}
+		if ok, _ := p.live.Contain(key); ok {
+			continue
+		}
+		if ok, _ := p.flushed.Contain(key); ok {
+			continue
+		}
+		keys = append(keys, common.CopyBytes(key))
+		sizes = append(sizes, len(key)+len(iter.Value()))
+		if len(keys) < limit {
+			continue
+		}
+		// Enough nodes collected, wait for the rate limit and delete them
+		if err := p.wait(limiter, len(keys)); err != nil {
+			return err
+		}
+		last := common.CopyBytes(key)
+		if err := flush(last); err != nil {
+			return err
+		}
+		if time.Since(logged) > 8*time.Second {
+			log.Info("Pruning state data online", "nodes", count, "size", common.StorageSize(size), "elapsed", common.PrettyDuration(time.Since(start)))
+			logged = time.Now()
+		}
+		// Recreate the iterator after every batch commit in order
+		// to allow the underlying compactor to delete the entries.
+		iter.Release()
+		iter = p.db.NewIterator(nil, last)
+	}
+	if err := iter.Error(); err != nil {
+		return err
+	}
+	if len(keys) > 0 {
+		if err := flush(keys[len(keys)-1]); err != nil {
+			return err
+		}
+	}
+	rawdb.DeleteStatePruneCursor(p.db)
+	log.Info("Pruned state data online", "nodes", count, "size", common.StorageSize(size), "elapsed", common.PrettyDuration(time.Since(start)))
+	return nil
+}
+
+// wait blocks until the rate limiter permits deleting the given number of
+// nodes, or the pruner is stopped.
+func (p *OnlinePruner) wait(limiter *rate.Limiter, n int) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go func() {
+		select {
+		case <-p.quit:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	if err := limiter.WaitN(ctx, n); err != nil {
+		select {
+		case <-p.quit:
+			return errOnlinePrunerAbort
+		default:
+			return err
+		}
+	}
+	return nil
+}
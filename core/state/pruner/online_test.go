@@ -0,0 +1,262 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package pruner
+
+import (
+	"math/big"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/state/snapshot"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/trie"
+)
+
+// testPrunerChain is a canonical chain of headers only carrying state roots.
+type testPrunerChain struct {
+	headers []*types.Header
+	lock    sync.Mutex
+}
+
+func (c *testPrunerChain) extend(root common.Hash) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.headers = append(c.headers, &types.Header{Number: big.NewInt(int64(len(c.headers))), Root: root})
+}
+
+func (c *testPrunerChain) CurrentHeader() *types.Header {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.headers[len(c.headers)-1]
+}
+
+func (c *testPrunerChain) GetHeaderByNumber(number uint64) *types.Header {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if number >= uint64(len(c.headers)) {
+		return nil
+	}
+	return c.headers[number]
+}
+
+// commitTestState applies the given modifications on top of the parent state
+// and flushes the resulting tries to disk.
+func commitTestState(sdb state.Database, parent common.Hash, modify func(statedb *state.StateDB)) (common.Hash, error) {
+	statedb, err := state.New(parent, sdb, nil)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	modify(statedb)
+
+	statedb.Finalise(false)
+	statedb.AccountsIntermediateRoot()
+	root, _, err := statedb.Commit(nil)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	return root, sdb.TrieDB().Commit(root, false, nil)
+}
+
+// collectTestNodes gathers the hashes of all the trie nodes of the given state.
+func collectTestNodes(t *testing.T, db ethdb.Database, root common.Hash, nodes map[common.Hash]struct{}) {
+	t.Helper()
+
+	var (
+		triedb = trie.NewDatabase(db)
+		walk   func(root common.Hash, storage bool)
+	)
+	walk = func(root common.Hash, storage bool) {
+		tr, err := trie.NewSecure(root, triedb)
+		if err != nil {
+			t.Fatalf("failed to open trie %x: %v", root, err)
+		}
+		it := tr.NodeIterator(nil)
+		for it.Next(true) {
+			if hash := it.Hash(); hash != (common.Hash{}) {
+				nodes[hash] = struct{}{}
+			}
+			if it.Leaf() && !storage {
+				var acc state.Account
+				if err := rlp.DecodeBytes(it.LeafBlob(), &acc); err != nil {
+					t.Fatalf("failed to decode account: %v", err)
+				}
+				if acc.Root != emptyRoot {
+					walk(acc.Root, true)
+				}
+			}
+		}
+		if it.Error() != nil {
+			t.Fatalf("failed to iterate trie %x: %v", root, it.Error())
+		}
+	}
+	walk(root, false)
+}
+
+// Tests that the online pruner deletes the trie nodes unreachable from the
+// snapshot disk layer, while keeping the live ones and the ones flushed by the
+// blockchain during the pruning cycle.
+func TestOnlinePruning(t *testing.T) {
+	var (
+		db    = rawdb.NewMemoryDatabase()
+		sdb   = state.NewDatabase(db)
+		chain = new(testPrunerChain)
+	)
+	// Create the genesis state and a state on top with a bunch of contracts
+	genesis, err := commitTestState(sdb, common.Hash{}, func(statedb *state.StateDB) {
+		statedb.AddBalance(common.Address{0xff}, big.NewInt(1))
+	})
+	if err != nil {
+		t.Fatalf("failed to create genesis state: %v", err)
+	}
+	block := types.NewBlockWithHeader(&types.Header{Number: common.Big0, Root: genesis})
+	rawdb.WriteBlock(db, block)
+	rawdb.WriteCanonicalHash(db, block.Hash(), 0)
+	chain.extend(genesis)
+
+	parent, err := commitTestState(sdb, genesis, func(statedb *state.StateDB) {
+		for i := 1; i <= 200; i++ {
+			addr := common.BigToAddress(big.NewInt(int64(i)))
+			statedb.AddBalance(addr, big.NewInt(int64(i)))
+			if i%10 == 0 {
+				statedb.SetCode(addr, []byte{byte(i)})
+				for j := 0; j < 3; j++ {
+					statedb.SetState(addr, common.Hash{byte(j)}, common.Hash{byte(i)})
+				}
+			}
+		}
+	})
+	if err != nil {
+		t.Fatalf("failed to create parent state: %v", err)
+	}
+	chain.extend(parent)
+
+	// Modify some accounts and storage slots, leaving the old nodes unreachable,
+	// and use the modified state as the snapshot disk layer
+	root, err := commitTestState(sdb, parent, func(statedb *state.StateDB) {
+		for i := 1; i <= 40; i++ {
+			addr := common.BigToAddress(big.NewInt(int64(i)))
+			statedb.AddBalance(addr, big.NewInt(1000))
+			if i%10 == 0 {
+				statedb.SetState(addr, common.Hash{0}, common.Hash{})
+			}
+		}
+	})
+	if err != nil {
+		t.Fatalf("failed to create live state: %v", err)
+	}
+	snaps, err := snapshot.New(db, sdb.TrieDB(), 16, 128, root, false, true, false)
+	if err != nil {
+		t.Fatalf("failed to create snapshot tree: %v", err)
+	}
+	stale := make(map[common.Hash]struct{})
+	collectTestNodes(t, db, parent, stale)
+
+	// Invalid configs are refused
+	for i, config := range []OnlinePrunerConfig{
+		{BloomSize: onlinePrunerMinBloomSize - 1, Interval: time.Hour},
+		{BloomSize: onlinePrunerMinBloomSize, Rate: -1, Interval: time.Hour},
+		{BloomSize: onlinePrunerMinBloomSize},
+	} {
+		if _, err := NewOnlinePruner(db, sdb.TrieDB(), snaps, chain, config); err == nil {
+			t.Errorf("invalid config %d accepted", i)
+		}
+	}
+	pruner, err := NewOnlinePruner(db, sdb.TrieDB(), snaps, chain, OnlinePrunerConfig{BloomSize: onlinePrunerMinBloomSize, Rate: 20, Interval: time.Hour})
+	if err != nil {
+		t.Fatalf("failed to create online pruner: %v", err)
+	}
+	errc := make(chan error, 1)
+	go func() { errc <- pruner.prune() }()
+
+	for pruner.Status().Phase != OnlinePhaseWaiting {
+		time.Sleep(10 * time.Millisecond)
+	}
+	// Move the chain to the disk layer and keep on committing states while the
+	// cycle is running, partially reverting to the stale state
+	chain.extend(root)
+	pruner.Committed(root, 2)
+
+	var (
+		wg      sync.WaitGroup
+		commits []common.Hash
+	)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		parent := root
+		for n := 1; n <= 5; n++ {
+			child, err := commitTestState(sdb, parent, func(statedb *state.StateDB) {
+				for i := 8*n - 7; i <= 8*n; i++ {
+					statedb.SubBalance(common.BigToAddress(big.NewInt(int64(i))), big.NewInt(1000))
+				}
+				statedb.AddBalance(common.BigToAddress(big.NewInt(int64(1000+n))), big.NewInt(1))
+			})
+			if err != nil {
+				t.Errorf("failed to commit state %d: %v", n, err)
+				return
+			}
+			commits = append(commits, child)
+			parent = child
+			time.Sleep(50 * time.Millisecond)
+		}
+	}()
+	select {
+	case err := <-errc:
+		if err != nil {
+			t.Fatalf("failed to prune state: %v", err)
+		}
+	case <-time.After(time.Minute):
+		t.Fatalf("pruning cycle timed out")
+	}
+	wg.Wait()
+
+	// Every node of the genesis, of the disk layer and of the states committed
+	// during the cycle must have survived, the remaining stale ones deleted
+	live := make(map[common.Hash]struct{})
+	for _, root := range append([]common.Hash{genesis, root}, commits...) {
+		collectTestNodes(t, db, root, live)
+	}
+	var deleted int
+	for hash := range stale {
+		if _, ok := live[hash]; ok {
+			continue
+		}
+		if ok, _ := db.Has(hash.Bytes()); ok {
+			t.Errorf("stale node %x not deleted", hash)
+		}
+		deleted++
+	}
+	if deleted == 0 {
+		t.Fatalf("no stale nodes to delete")
+	}
+	if status := pruner.Status(); status.Cycles != 1 || status.Deleted < uint64(deleted) || status.Root != root {
+		t.Errorf("status mismatch: have %+v, want root %x and at least %d deletions", status, root, deleted)
+	}
+	if cursor := rawdb.ReadStatePruneCursor(db); cursor != nil {
+		t.Errorf("sweep cursor left behind: %x", cursor)
+	}
+}
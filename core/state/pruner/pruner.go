@@ -294,8 +294,10 @@ func (p *BlockPruner) backUpOldDb(name string, cache, handles int, namespace str
 	}
 	log.Info("the oldOffSet is ", "oldOffSet", oldOffSet)
 
-	// Get the start BlockNumber for pruning.
-	startBlockNumber := oldOffSet + itemsOfAncient - p.BlockAmountReserved
+	// Get the start BlockNumber for pruning. The first block in the old ancientDB
+	// might be above the offset if its tail was pruned online.
+	firstBlockNumber := chainDb.AncientOffSet()
+	startBlockNumber := firstBlockNumber + itemsOfAncient - p.BlockAmountReserved
 	log.Info("new offset/new startBlockNumber is ", "new offset", startBlockNumber)
 
 	// Create new ancientdb backup and record the new and last version of offset in kvDB as well.
@@ -326,7 +328,7 @@ func (p *BlockPruner) backUpOldDb(name string, cache, handles int, namespace str
 
 	start := time.Now()
 	// All ancient data after and including startBlockNumber should write into new ancientDB ancient_back.
-	for blockNumber := startBlockNumber; blockNumber < itemsOfAncient+oldOffSet; blockNumber++ {
+	for blockNumber := startBlockNumber; blockNumber < itemsOfAncient+firstBlockNumber; blockNumber++ {
 		blockHash := rawdb.ReadCanonicalHash(chainDb, blockNumber)
 		block := rawdb.ReadBlock(chainDb, blockHash, blockNumber)
 		receipts := rawdb.ReadRawReceipts(chainDb, blockHash, blockNumber)
@@ -0,0 +1,695 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package snapshot
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/ethdb/memorydb"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/trie"
+	"github.com/golang/snappy"
+	lru "github.com/hashicorp/golang-lru"
+)
+
+const (
+	// archiveVersion is the version of the state archive format.
+	archiveVersion = 1
+
+	// archiveChunkSize is the soft limit of the items carried by a single
+	// chunk of a state archive.
+	archiveChunkSize = 256 * 1024
+
+	// archiveFrameLimit is the maximum size of a single compressed frame,
+	// protecting the importer from allocating garbage lengths.
+	archiveFrameLimit = 64 * 1024 * 1024
+
+	// archiveCodeCache is the number of code hashes the exporter remembers
+	// to avoid writing the same contract code over and over.
+	archiveCodeCache = 64 * 1024
+)
+
+// archiveMagic starts every state archive.
+var archiveMagic = []byte("GETHSNAP")
+
+// Chunk kinds of a state archive.
+const (
+	archiveAccounts uint8 = iota // Range of slim accounts of the account trie
+	archiveStorage               // Range of slots of a storage trie
+	archiveCode                  // Batch of contract codes
+	archiveEnd                   // Marker of a complete archive
+)
+
+var (
+	// errArchiveCorrupted is returned if a frame of a state archive fails its
+	// checksum or cannot be decoded.
+	errArchiveCorrupted = errors.New("state archive corrupted")
+
+	// errArchiveTruncated is returned if a state archive ends before all the
+	// state was delivered.
+	errArchiveTruncated = errors.New("state archive truncated")
+
+	// crc32cTable is the table checksumming the archive frames.
+	crc32cTable = crc32.MakeTable(crc32.Castagnoli)
+)
+
+// ArchiveHeader is the first frame of a state archive, identifying the state
+// carried by it.
+type ArchiveHeader struct {
+	Version uint64      // Version of the archive format
+	Root    common.Hash // State root of the exported state
+	Number  uint64      // Number of the block the state belongs to
+	Hash    common.Hash // Hash of the block the state belongs to
+}
+
+// ArchivePivot is the block a state archive belongs to. It follows the archive
+// header, so the importing node has a head block to start syncing from.
+type ArchivePivot struct {
+	Header   *types.Header
+	Body     *types.Body
+	Receipts []*types.ReceiptForStorage
+	TD       *big.Int
+}
+
+// verify checks that the pivot block matches the archive header and that its
+// body and receipts match the block header.
+func (p *ArchivePivot) verify(header *ArchiveHeader) error {
+	if p.Header == nil || p.Body == nil || p.TD == nil {
+		return fmt.Errorf("%w: incomplete pivot block", errArchiveCorrupted)
+	}
+	if hash := p.Header.Hash(); hash != header.Hash || p.Header.Number.Uint64() != header.Number || p.Header.Root != header.Root {
+		return fmt.Errorf("%w: pivot block %d [%x] doesn't match the state", errArchiveCorrupted, p.Header.Number, hash)
+	}
+	if hash := types.DeriveSha(types.Transactions(p.Body.Transactions), trie.NewStackTrie(nil)); hash != p.Header.TxHash {
+		return fmt.Errorf("%w: pivot transaction root mismatch: have %x, want %x", errArchiveCorrupted, hash, p.Header.TxHash)
+	}
+	if hash := types.CalcUncleHash(p.Body.Uncles); hash != p.Header.UncleHash {
+		return fmt.Errorf("%w: pivot uncle hash mismatch: have %x, want %x", errArchiveCorrupted, hash, p.Header.UncleHash)
+	}
+	if len(p.Receipts) != len(p.Body.Transactions) {
+		return fmt.Errorf("%w: pivot receipt count mismatch: have %d, want %d", errArchiveCorrupted, len(p.Receipts), len(p.Body.Transactions))
+	}
+	if hash := types.DeriveSha(p.receipts(), trie.NewStackTrie(nil)); hash != p.Header.ReceiptHash {
+		return fmt.Errorf("%w: pivot receipt root mismatch: have %x, want %x", errArchiveCorrupted, hash, p.Header.ReceiptHash)
+	}
+	return nil
+}
+
+// receipts converts the stored receipts of the pivot block, restoring their
+// types from the transactions as the storage encoding drops them.
+func (p *ArchivePivot) receipts() types.Receipts {
+	receipts := make(types.Receipts, len(p.Receipts))
+	for i, receipt := range p.Receipts {
+		receipts[i] = (*types.Receipt)(receipt)
+		receipts[i].Type = p.Body.Transactions[i].Type()
+	}
+	return receipts
+}
+
+// archiveChunk is a contiguous range of trie leaves, along with the proof of
+// its boundaries, or a batch of contract codes.
+type archiveChunk struct {
+	Kind    uint8
+	Account common.Hash   // Owner of the storage range, empty for the others
+	Origin  common.Hash   // First key the range covers
+	Keys    []common.Hash // Hashes of the leaves, or of the codes
+	Vals    [][]byte      // Slim accounts, slots or codes
+	Proof   [][]byte      // Trie nodes proving the range boundaries
+}
+
+// archiveWriter frames the items of a state archive.
+type archiveWriter struct {
+	w     *bufio.Writer
+	frame [8]byte
+}
+
+// write encodes, compresses and checksums a single item as the next frame.
+func (aw *archiveWriter) write(item interface{}) error {
+	blob, err := rlp.EncodeToBytes(item)
+	if err != nil {
+		return err
+	}
+	blob = snappy.Encode(nil, blob)
+
+	binary.BigEndian.PutUint32(aw.frame[:4], uint32(len(blob)))
+	binary.BigEndian.PutUint32(aw.frame[4:], crc32.Checksum(blob, crc32cTable))
+	if _, err := aw.w.Write(aw.frame[:]); err != nil {
+		return err
+	}
+	_, err = aw.w.Write(blob)
+	return err
+}
+
+// archiveReader reads back the frames of a state archive.
+type archiveReader struct {
+	r     *bufio.Reader
+	frame [8]byte
+}
+
+// read decodes the next frame into the given item.
+func (ar *archiveReader) read(item interface{}) error {
+	if _, err := io.ReadFull(ar.r, ar.frame[:]); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return errArchiveTruncated
+		}
+		return err
+	}
+	size := binary.BigEndian.Uint32(ar.frame[:4])
+	if size > archiveFrameLimit {
+		return fmt.Errorf("%w: frame too large (%d bytes)", errArchiveCorrupted, size)
+	}
+	blob := make([]byte, size)
+	if _, err := io.ReadFull(ar.r, blob); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return errArchiveTruncated
+		}
+		return err
+	}
+	if crc32.Checksum(blob, crc32cTable) != binary.BigEndian.Uint32(ar.frame[4:]) {
+		return fmt.Errorf("%w: checksum mismatch", errArchiveCorrupted)
+	}
+	blob, err := snappy.Decode(nil, blob)
+	if err != nil {
+		return fmt.Errorf("%w: %v", errArchiveCorrupted, err)
+	}
+	if err := rlp.DecodeBytes(blob, item); err != nil {
+		return fmt.Errorf("%w: %v", errArchiveCorrupted, err)
+	}
+	return nil
+}
+
+// proveRange proves the first and last keys of a range in the given trie and
+// returns the collected trie nodes.
+func proveRange(tr *trie.Trie, origin common.Hash, keys []common.Hash) ([][]byte, error) {
+	proof := memorydb.New()
+	if err := tr.Prove(origin[:], 0, proof); err != nil {
+		return nil, err
+	}
+	if len(keys) > 0 {
+		if err := tr.Prove(keys[len(keys)-1][:], 0, proof); err != nil {
+			return nil, err
+		}
+	}
+	var nodes [][]byte
+	it := proof.NewIterator(nil, nil)
+	for it.Next() {
+		nodes = append(nodes, common.CopyBytes(it.Value()))
+	}
+	it.Release()
+	return nodes, nil
+}
+
+// verifyRange checks a chunk against the root of the trie it was taken from and
+// reports whether the trie holds more leaves after it.
+func verifyRange(root common.Hash, chunk *archiveChunk, vals [][]byte) (bool, error) {
+	proof := memorydb.New()
+	for _, node := range chunk.Proof {
+		proof.Put(crypto.Keccak256(node), node)
+	}
+	keys := make([][]byte, len(chunk.Keys))
+	for i := range chunk.Keys {
+		keys[i] = chunk.Keys[i][:]
+	}
+	var last []byte
+	if len(keys) > 0 {
+		last = keys[len(keys)-1]
+	}
+	return trie.VerifyRangeProof(root, chunk.Origin[:], last, keys, vals, proof)
+}
+
+// ExportArchive streams the state of the given pivot block out of the snapshot
+// tree into a state archive, along with the block itself. Every range of accounts
+// and storage slots is written along with the proof of its boundaries, so the
+// importer can verify each chunk against the state root on its own. The trie
+// nodes of the state have to be available in the trie database.
+func ExportArchive(w io.Writer, snaptree *Tree, triedb *trie.Database, codedb ethdb.KeyValueReader, pivot *ArchivePivot) error {
+	header := ArchiveHeader{
+		Version: archiveVersion,
+		Root:    pivot.Header.Root,
+		Number:  pivot.Header.Number.Uint64(),
+		Hash:    pivot.Header.Hash(),
+	}
+	accTrie, err := trie.New(header.Root, triedb)
+	if err != nil {
+		return err
+	}
+	acctIt, err := snaptree.AccountIterator(header.Root, common.Hash{})
+	if err != nil {
+		return err // The required snapshot might not exist.
+	}
+	defer acctIt.Release()
+
+	codes, _ := lru.New(archiveCodeCache)
+	if _, err := w.Write(archiveMagic); err != nil {
+		return err
+	}
+	aw := &archiveWriter{w: bufio.NewWriter(w)}
+	if err := aw.write(&header); err != nil {
+		return err
+	}
+	if err := aw.write(pivot); err != nil {
+		return err
+	}
+	var (
+		origin   common.Hash
+		accounts uint64
+		slots    uint64
+		start    = time.Now()
+		logged   = time.Now()
+	)
+	for done := false; !done; {
+		// Collect the next range of accounts
+		chunk := &archiveChunk{Kind: archiveAccounts, Origin: origin}
+		size := 0
+		for size < archiveChunkSize {
+			if !acctIt.Next() {
+				done = true
+				break
+			}
+			chunk.Keys = append(chunk.Keys, acctIt.Hash())
+			chunk.Vals = append(chunk.Vals, common.CopyBytes(acctIt.Account()))
+			size += common.HashLength + len(acctIt.Account())
+		}
+		if err := acctIt.Error(); err != nil {
+			return err
+		}
+		if chunk.Proof, err = proveRange(accTrie, origin, chunk.Keys); err != nil {
+			return err
+		}
+		if err := aw.write(chunk); err != nil {
+			return err
+		}
+		accounts += uint64(len(chunk.Keys))
+
+		// Export the storages and codes referenced by the range
+		code := &archiveChunk{Kind: archiveCode}
+		size = 0
+		for i, hash := range chunk.Keys {
+			account, err := FullAccount(chunk.Vals[i])
+			if err != nil {
+				return err
+			}
+			if root := common.BytesToHash(account.Root); root != emptyRoot {
+				n, err := exportStorage(aw, snaptree, triedb, header.Root, hash, root)
+				if err != nil {
+					return err
+				}
+				slots += n
+			}
+			if codeHash := common.BytesToHash(account.CodeHash); codeHash != emptyCode {
+				if codes.Contains(codeHash) {
+					continue
+				}
+				blob := rawdb.ReadCode(codedb, codeHash)
+				if len(blob) == 0 {
+					return fmt.Errorf("missing code %x of account %x", codeHash, hash)
+				}
+				codes.Add(codeHash, nil)
+				code.Keys = append(code.Keys, codeHash)
+				code.Vals = append(code.Vals, blob)
+				size += len(blob)
+			}
+			if size >= archiveChunkSize {
+				if err := aw.write(code); err != nil {
+					return err
+				}
+				code = &archiveChunk{Kind: archiveCode}
+				size = 0
+			}
+		}
+		if len(code.Keys) > 0 {
+			if err := aw.write(code); err != nil {
+				return err
+			}
+		}
+		if len(chunk.Keys) > 0 {
+			origin = common.BytesToHash(increaseKey(common.CopyBytes(chunk.Keys[len(chunk.Keys)-1][:])))
+		}
+		if time.Since(logged) > 8*time.Second {
+			log.Info("Exporting state archive", "at", origin, "accounts", accounts, "slots", slots, "elapsed", common.PrettyDuration(time.Since(start)))
+			logged = time.Now()
+		}
+	}
+	if err := aw.write(&archiveChunk{Kind: archiveEnd}); err != nil {
+		return err
+	}
+	if err := aw.w.Flush(); err != nil {
+		return err
+	}
+	log.Info("Exported state archive", "root", header.Root, "accounts", accounts, "slots", slots, "elapsed", common.PrettyDuration(time.Since(start)))
+	return nil
+}
+
+// exportStorage writes the storage of a single account as a sequence of storage
+// chunks and returns the number of slots written.
+func exportStorage(aw *archiveWriter, snaptree *Tree, triedb *trie.Database, root common.Hash, account common.Hash, storageRoot common.Hash) (uint64, error) {
+	storeTrie, err := trie.New(storageRoot, triedb)
+	if err != nil {
+		return 0, err
+	}
+	storageIt, err := snaptree.StorageIterator(root, account, common.Hash{})
+	if err != nil {
+		return 0, err
+	}
+	defer storageIt.Release()
+
+	var (
+		origin common.Hash
+		slots  uint64
+	)
+	for done := false; !done; {
+		chunk := &archiveChunk{Kind: archiveStorage, Account: account, Origin: origin}
+		size := 0
+		for size < archiveChunkSize {
+			if !storageIt.Next() {
+				done = true
+				break
+			}
+			chunk.Keys = append(chunk.Keys, storageIt.Hash())
+			chunk.Vals = append(chunk.Vals, common.CopyBytes(storageIt.Slot()))
+			size += common.HashLength + len(storageIt.Slot())
+		}
+		if err := storageIt.Error(); err != nil {
+			return 0, err
+		}
+		if chunk.Proof, err = proveRange(storeTrie, origin, chunk.Keys); err != nil {
+			return 0, err
+		}
+		if err := aw.write(chunk); err != nil {
+			return 0, err
+		}
+		slots += uint64(len(chunk.Keys))
+		if len(chunk.Keys) > 0 {
+			origin = common.BytesToHash(increaseKey(common.CopyBytes(chunk.Keys[len(chunk.Keys)-1][:])))
+		}
+	}
+	return slots, nil
+}
+
+// archiveImport tracks the progress of a state archive import.
+type archiveImport struct {
+	db       ethdb.KeyValueStore
+	header   *ArchiveHeader
+	origin   common.Hash                  // Next account expected
+	done     bool                         // Whether all accounts were delivered
+	storages map[common.Hash]*storageTask // Storages not yet fully delivered
+	codes    map[common.Hash]struct{}     // Codes not yet delivered
+
+	accounts uint64
+	slots    uint64
+}
+
+// storageTask is a storage trie partially delivered by a state archive.
+type storageTask struct {
+	root   common.Hash // Root of the storage trie
+	origin common.Hash // Next slot expected
+}
+
+// ImportArchive reads a state archive into the given database and regenerates
+// the tries of the state out of it. Every chunk is verified against the state
+// root announced in the archive header before being written. Once the tries are
+// complete, the state is marked as the snapshot of the database and the pivot
+// block carried by the archive becomes the head of the chain, the chain below it
+// is not part of the archive.
+//
+// The database has to be initialized with the genesis block of the chain and
+// hold no other blocks. The import is marked as started before writing anything,
+// the partial snapshot of a failed or interrupted import is wiped on failure or
+// on the next attempt. The trie nodes regenerated by a failed import are left
+// unreferenced.
+func ImportArchive(r io.Reader, db ethdb.Database) (*ArchiveHeader, error) {
+	if root := rawdb.ReadSnapshotImportRoot(db); root != (common.Hash{}) {
+		log.Warn("Wiping interrupted state archive import", "root", root)
+		if err := wipeArchiveImport(db); err != nil {
+			return nil, err
+		}
+	}
+	if root := rawdb.ReadSnapshotRoot(db); root != (common.Hash{}) {
+		return nil, fmt.Errorf("database already holds snapshot %x", root)
+	}
+	genesis := rawdb.ReadCanonicalHash(db, 0)
+	if genesis == (common.Hash{}) {
+		return nil, errors.New("database not initialized with a genesis block")
+	}
+	if head := rawdb.ReadHeadHeaderHash(db); head != genesis {
+		return nil, fmt.Errorf("database already holds chain head %x", head)
+	}
+	br := bufio.NewReader(r)
+	magic := make([]byte, len(archiveMagic))
+	if _, err := io.ReadFull(br, magic); err != nil || !bytes.Equal(magic, archiveMagic) {
+		return nil, errors.New("not a state archive")
+	}
+	ar := &archiveReader{r: br}
+	header := new(ArchiveHeader)
+	if err := ar.read(header); err != nil {
+		return nil, err
+	}
+	if header.Version != archiveVersion {
+		return nil, fmt.Errorf("unsupported state archive version %d", header.Version)
+	}
+	pivot := new(ArchivePivot)
+	if err := ar.read(pivot); err != nil {
+		return nil, err
+	}
+	if err := pivot.verify(header); err != nil {
+		return nil, err
+	}
+	log.Info("Importing state archive", "number", header.Number, "hash", header.Hash, "root", header.Root)
+
+	rawdb.WriteSnapshotImportRoot(db, header.Root)
+	if err := importArchive(ar, db, header, pivot); err != nil {
+		if err := wipeArchiveImport(db); err != nil {
+			log.Error("Failed to wipe state archive import", "err", err)
+		}
+		return nil, err
+	}
+	return header, nil
+}
+
+// importArchive reads the state chunks of an archive into the database,
+// regenerates the tries out of them and commits the pivot block.
+func importArchive(ar *archiveReader, db ethdb.Database, header *ArchiveHeader, pivot *ArchivePivot) error {
+	imp := &archiveImport{
+		db:       db,
+		header:   header,
+		storages: make(map[common.Hash]*storageTask),
+		codes:    make(map[common.Hash]struct{}),
+	}
+	var (
+		start  = time.Now()
+		logged = time.Now()
+	)
+	for {
+		chunk := new(archiveChunk)
+		if err := ar.read(chunk); err != nil {
+			return err
+		}
+		if len(chunk.Keys) != len(chunk.Vals) {
+			return fmt.Errorf("%w: %d keys with %d values", errArchiveCorrupted, len(chunk.Keys), len(chunk.Vals))
+		}
+		var err error
+		switch chunk.Kind {
+		case archiveAccounts:
+			err = imp.importAccounts(chunk)
+		case archiveStorage:
+			err = imp.importStorage(chunk)
+		case archiveCode:
+			err = imp.importCode(chunk)
+		case archiveEnd:
+			err = imp.finish()
+		default:
+			err = fmt.Errorf("%w: unknown chunk kind %d", errArchiveCorrupted, chunk.Kind)
+		}
+		if err != nil {
+			return err
+		}
+		if chunk.Kind == archiveEnd {
+			break
+		}
+		if time.Since(logged) > 8*time.Second {
+			log.Info("Importing state archive", "at", imp.origin, "accounts", imp.accounts, "slots", imp.slots, "elapsed", common.PrettyDuration(time.Since(start)))
+			logged = time.Now()
+		}
+	}
+	log.Info("Imported state snapshot", "accounts", imp.accounts, "slots", imp.slots, "elapsed", common.PrettyDuration(time.Since(start)))
+
+	// All the flat state is in place, regenerate the tries out of it
+	dl := &diskLayer{diskdb: db, root: header.Root}
+	acctIt := dl.AccountIterator(common.Hash{})
+	defer acctIt.Release()
+
+	err := generateTrie(acctIt, func(accountHash common.Hash) (StorageIterator, error) {
+		storageIt, _ := dl.StorageIterator(accountHash, common.Hash{})
+		return storageIt, nil
+	}, header.Root, nil, db)
+	if err != nil {
+		return err
+	}
+	log.Info("Regenerated state tries", "root", header.Root, "elapsed", common.PrettyDuration(time.Since(start)))
+
+	// Commit the pivot block as the head of the chain along with the snapshot
+	block := types.NewBlockWithHeader(pivot.Header).WithBody(pivot.Body.Transactions, pivot.Body.Uncles)
+	batch := db.NewBatch()
+	rawdb.WriteBlock(batch, block)
+	rawdb.WriteReceipts(batch, header.Hash, header.Number, pivot.receipts())
+	rawdb.WriteTd(batch, header.Hash, header.Number, pivot.TD)
+	rawdb.WriteTxLookupEntriesByBlock(batch, block)
+	rawdb.WriteCanonicalHash(batch, header.Hash, header.Number)
+	rawdb.WriteHeadHeaderHash(batch, header.Hash)
+	rawdb.WriteHeadFastBlockHash(batch, header.Hash)
+	rawdb.WriteHeadBlockHash(batch, header.Hash)
+	rawdb.WriteSnapshotRoot(batch, header.Root)
+	journalProgress(batch, nil, nil)
+	rawdb.DeleteSnapshotImportRoot(batch)
+	if err := batch.Write(); err != nil {
+		return err
+	}
+	log.Info("Committed state archive pivot block", "number", header.Number, "hash", header.Hash)
+	return nil
+}
+
+// wipeArchiveImport deletes the flat state written by a failed or interrupted
+// state archive import, along with its marker.
+func wipeArchiveImport(db ethdb.KeyValueStore) error {
+	if err := wipeContent(db); err != nil {
+		return err
+	}
+	rawdb.DeleteSnapshotImportRoot(db)
+	return nil
+}
+
+// importAccounts verifies and writes a range of accounts, scheduling the
+// storages and codes they reference.
+func (imp *archiveImport) importAccounts(chunk *archiveChunk) error {
+	if imp.done {
+		return fmt.Errorf("%w: accounts after the last range", errArchiveCorrupted)
+	}
+	if chunk.Origin != imp.origin {
+		return fmt.Errorf("%w: account range at %x, want %x", errArchiveCorrupted, chunk.Origin, imp.origin)
+	}
+	// The proven values are the trie leaves, convert the slim accounts
+	accounts := make([]Account, len(chunk.Vals))
+	vals := make([][]byte, len(chunk.Vals))
+	for i, val := range chunk.Vals {
+		account, err := FullAccount(val)
+		if err != nil {
+			return fmt.Errorf("%w: %v", errArchiveCorrupted, err)
+		}
+		if vals[i], err = rlp.EncodeToBytes(account); err != nil {
+			return err
+		}
+		accounts[i] = account
+	}
+	cont, err := verifyRange(imp.header.Root, chunk, vals)
+	if err != nil {
+		return fmt.Errorf("invalid account range at %x: %v", chunk.Origin, err)
+	}
+	batch := imp.db.NewBatch()
+	for i, hash := range chunk.Keys {
+		account := accounts[i]
+		root, codeHash := common.BytesToHash(account.Root), common.BytesToHash(account.CodeHash)
+		rawdb.WriteAccountSnapshot(batch, hash, SlimAccountRLP(account.Nonce, account.Balance, root, account.CodeHash))
+
+		if root != emptyRoot {
+			imp.storages[hash] = &storageTask{root: root}
+		}
+		if codeHash != emptyCode && len(rawdb.ReadCode(imp.db, codeHash)) == 0 {
+			imp.codes[codeHash] = struct{}{}
+		}
+	}
+	if err := batch.Write(); err != nil {
+		return err
+	}
+	imp.accounts += uint64(len(chunk.Keys))
+	if !cont {
+		imp.done = true
+	} else {
+		imp.origin = common.BytesToHash(increaseKey(common.CopyBytes(chunk.Keys[len(chunk.Keys)-1][:])))
+	}
+	return nil
+}
+
+// importStorage verifies and writes a range of slots of a scheduled storage.
+func (imp *archiveImport) importStorage(chunk *archiveChunk) error {
+	task := imp.storages[chunk.Account]
+	if task == nil {
+		return fmt.Errorf("%w: unexpected storage of %x", errArchiveCorrupted, chunk.Account)
+	}
+	if chunk.Origin != task.origin {
+		return fmt.Errorf("%w: storage range of %x at %x, want %x", errArchiveCorrupted, chunk.Account, chunk.Origin, task.origin)
+	}
+	cont, err := verifyRange(task.root, chunk, chunk.Vals)
+	if err != nil {
+		return fmt.Errorf("invalid storage range of %x at %x: %v", chunk.Account, chunk.Origin, err)
+	}
+	batch := imp.db.NewBatch()
+	for i, hash := range chunk.Keys {
+		rawdb.WriteStorageSnapshot(batch, chunk.Account, hash, chunk.Vals[i])
+	}
+	if err := batch.Write(); err != nil {
+		return err
+	}
+	imp.slots += uint64(len(chunk.Keys))
+	if !cont {
+		delete(imp.storages, chunk.Account)
+	} else {
+		task.origin = common.BytesToHash(increaseKey(common.CopyBytes(chunk.Keys[len(chunk.Keys)-1][:])))
+	}
+	return nil
+}
+
+// importCode verifies and writes a batch of contract codes.
+func (imp *archiveImport) importCode(chunk *archiveChunk) error {
+	batch := imp.db.NewBatch()
+	for i, hash := range chunk.Keys {
+		if have := crypto.Keccak256Hash(chunk.Vals[i]); have != hash {
+			return fmt.Errorf("%w: code hash mismatch: have %x, want %x", errArchiveCorrupted, have, hash)
+		}
+		rawdb.WriteCode(batch, hash, chunk.Vals[i])
+		delete(imp.codes, hash)
+	}
+	return batch.Write()
+}
+
+// finish checks that the whole state was delivered once the end of the archive
+// is reached.
+func (imp *archiveImport) finish() error {
+	if !imp.done {
+		return fmt.Errorf("%w: accounts missing from %x", errArchiveTruncated, imp.origin)
+	}
+	if len(imp.storages) > 0 {
+		return fmt.Errorf("%w: %d storages incomplete", errArchiveTruncated, len(imp.storages))
+	}
+	if len(imp.codes) > 0 {
+		return fmt.Errorf("%w: %d codes missing", errArchiveTruncated, len(imp.codes))
+	}
+	return nil
+}
@@ -0,0 +1,238 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package snapshot
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/trie"
+)
+
+// Tests that a state exported into an archive can be imported back, with its
+// tries regenerated, and that corrupted or truncated archives are rejected.
+func TestArchiveExportImport(t *testing.T) {
+	var (
+		helper = newHelper()
+		code   = []byte{0x60, 0x00, 0x60, 0x00, 0xf3}
+		stRoot = helper.makeStorageTrie([]string{"key-1", "key-2", "key-3"}, []string{"val-1", "val-2", "val-3"})
+	)
+	rawdb.WriteCode(helper.diskdb, crypto.Keccak256Hash(code), code)
+	for i := 0; i < 100; i++ {
+		acc := &Account{Balance: big.NewInt(int64(i)), Root: emptyRoot.Bytes(), CodeHash: emptyCode.Bytes()}
+		if i%10 == 0 {
+			acc.Root = stRoot
+			acc.CodeHash = crypto.Keccak256(code)
+		}
+		helper.addTrieAccount(fmt.Sprintf("acc-%d", i), acc)
+	}
+	root, snap := helper.Generate()
+	select {
+	case <-snap.genPending:
+	case <-time.After(3 * time.Second):
+		t.Fatalf("Snapshot generation failed")
+	}
+	stop := make(chan *generatorStats)
+	snap.genAbort <- stop
+	<-stop
+
+	snaps := &Tree{layers: map[common.Hash]snapshot{root: snap}}
+	pivot := &ArchivePivot{
+		Header: &types.Header{
+			Number:      big.NewInt(1),
+			Root:        root,
+			TxHash:      types.EmptyRootHash,
+			UncleHash:   types.EmptyUncleHash,
+			ReceiptHash: types.EmptyRootHash,
+			Difficulty:  big.NewInt(2),
+		},
+		Body: new(types.Body),
+		TD:   big.NewInt(3),
+	}
+	var archive bytes.Buffer
+	if err := ExportArchive(&archive, snaps, helper.triedb, helper.diskdb, pivot); err != nil {
+		t.Fatalf("Failed to export archive: %v", err)
+	}
+	// Import the archive into an empty database and check the regenerated state
+	db := newArchiveTestDatabase()
+	header, err := ImportArchive(bytes.NewReader(archive.Bytes()), db)
+	if err != nil {
+		t.Fatalf("Failed to import archive: %v", err)
+	}
+	hash := pivot.Header.Hash()
+	if header.Root != root || header.Number != 1 || header.Hash != hash {
+		t.Fatalf("Header mismatch: have %x/%d/%x, want %x/%d/%x", header.Root, header.Number, header.Hash, root, 1, hash)
+	}
+	if have := rawdb.ReadSnapshotRoot(db); have != root {
+		t.Fatalf("Snapshot root mismatch: have %x, want %x", have, root)
+	}
+	if have := rawdb.ReadSnapshotImportRoot(db); have != (common.Hash{}) {
+		t.Fatalf("Import marker left: %x", have)
+	}
+	if !bytes.Equal(rawdb.ReadCode(db, crypto.Keccak256Hash(code)), code) {
+		t.Fatalf("Contract code missing")
+	}
+	// The pivot block should be the head of the chain
+	if have := rawdb.ReadHeadBlockHash(db); have != hash {
+		t.Fatalf("Head block mismatch: have %x, want %x", have, hash)
+	}
+	if have := rawdb.ReadHeadHeaderHash(db); have != hash {
+		t.Fatalf("Head header mismatch: have %x, want %x", have, hash)
+	}
+	if have := rawdb.ReadCanonicalHash(db, 1); have != hash {
+		t.Fatalf("Canonical hash mismatch: have %x, want %x", have, hash)
+	}
+	if td := rawdb.ReadTd(db, hash, 1); td == nil || td.Cmp(pivot.TD) != 0 {
+		t.Fatalf("Total difficulty mismatch: have %v, want %v", td, pivot.TD)
+	}
+	accTrie, err := trie.New(root, trie.NewDatabase(db))
+	if err != nil {
+		t.Fatalf("Failed to open the regenerated trie: %v", err)
+	}
+	it := trie.NewIterator(accTrie.NodeIterator(nil))
+	accounts := 0
+	for it.Next() {
+		accounts++
+	}
+	if it.Err != nil || accounts != 100 {
+		t.Fatalf("Regenerated trie mismatch: %d accounts, err %v", accounts, it.Err)
+	}
+	// Importing over an existing snapshot is refused
+	if _, err := ImportArchive(bytes.NewReader(archive.Bytes()), db); err == nil {
+		t.Fatalf("Imported over an existing snapshot")
+	}
+	// Corrupted and truncated archives are rejected, leaving no partial state
+	corrupted := common.CopyBytes(archive.Bytes())
+	corrupted[len(corrupted)/2] ^= 0xff
+	db = newArchiveTestDatabase()
+	if _, err := ImportArchive(bytes.NewReader(corrupted), db); !errors.Is(err, errArchiveCorrupted) {
+		t.Fatalf("Corrupted archive error mismatch: have %v, want %v", err, errArchiveCorrupted)
+	}
+	checkArchiveWiped(t, db)
+
+	truncated := archive.Bytes()[:archive.Len()-16]
+	db = newArchiveTestDatabase()
+	if _, err := ImportArchive(bytes.NewReader(truncated), db); !errors.Is(err, errArchiveTruncated) {
+		t.Fatalf("Truncated archive error mismatch: have %v, want %v", err, errArchiveTruncated)
+	}
+	checkArchiveWiped(t, db)
+
+	// An interrupted import is wiped before importing again
+	db = newArchiveTestDatabase()
+	stray := crypto.Keccak256Hash([]byte("stray"))
+	rawdb.WriteSnapshotImportRoot(db, root)
+	rawdb.WriteAccountSnapshot(db, stray, SlimAccountRLP(1, big.NewInt(1), emptyRoot, emptyCode.Bytes()))
+	if _, err := ImportArchive(bytes.NewReader(archive.Bytes()), db); err != nil {
+		t.Fatalf("Failed to import archive after an interrupted import: %v", err)
+	}
+	if data := rawdb.ReadAccountSnapshot(db, stray); len(data) != 0 {
+		t.Fatalf("Account of the interrupted import left")
+	}
+}
+
+// Tests that a pivot block with typed transactions is accepted, even though the
+// stored receipts lose their types.
+func TestArchiveTypedPivot(t *testing.T) {
+	helper := newHelper()
+	for i := 0; i < 10; i++ {
+		helper.addTrieAccount(fmt.Sprintf("acc-%d", i), &Account{Balance: big.NewInt(int64(i)), Root: emptyRoot.Bytes(), CodeHash: emptyCode.Bytes()})
+	}
+	root, snap := helper.Generate()
+	select {
+	case <-snap.genPending:
+	case <-time.After(3 * time.Second):
+		t.Fatalf("Snapshot generation failed")
+	}
+	stop := make(chan *generatorStats)
+	snap.genAbort <- stop
+	<-stop
+
+	txs := types.Transactions{
+		types.NewTransaction(0, common.Address{0x01}, big.NewInt(1), 21000, big.NewInt(1), nil),
+		types.NewTx(&types.AccessListTx{ChainID: big.NewInt(1), Nonce: 1, To: &common.Address{0x01}, Gas: 21000, GasPrice: big.NewInt(1)}),
+	}
+	receipts := types.Receipts{
+		{Type: types.LegacyTxType, Status: types.ReceiptStatusSuccessful, CumulativeGasUsed: 21000, Logs: []*types.Log{}},
+		{Type: types.AccessListTxType, Status: types.ReceiptStatusSuccessful, CumulativeGasUsed: 42000, Logs: []*types.Log{}},
+	}
+	pivot := &ArchivePivot{
+		Header: &types.Header{
+			Number:      big.NewInt(1),
+			Root:        root,
+			TxHash:      types.DeriveSha(txs, trie.NewStackTrie(nil)),
+			UncleHash:   types.EmptyUncleHash,
+			ReceiptHash: types.DeriveSha(receipts, trie.NewStackTrie(nil)),
+			Difficulty:  big.NewInt(2),
+		},
+		Body: &types.Body{Transactions: txs},
+		TD:   big.NewInt(3),
+	}
+	for _, receipt := range receipts {
+		pivot.Receipts = append(pivot.Receipts, (*types.ReceiptForStorage)(receipt))
+	}
+	snaps := &Tree{layers: map[common.Hash]snapshot{root: snap}}
+
+	var archive bytes.Buffer
+	if err := ExportArchive(&archive, snaps, helper.triedb, helper.diskdb, pivot); err != nil {
+		t.Fatalf("Failed to export archive: %v", err)
+	}
+	db := newArchiveTestDatabase()
+	if _, err := ImportArchive(bytes.NewReader(archive.Bytes()), db); err != nil {
+		t.Fatalf("Failed to import archive: %v", err)
+	}
+	if have := len(rawdb.ReadRawReceipts(db, pivot.Header.Hash(), 1)); have != len(receipts) {
+		t.Fatalf("Receipt count mismatch: have %d, want %d", have, len(receipts))
+	}
+}
+
+// newArchiveTestDatabase creates a database initialized with a genesis block.
+func newArchiveTestDatabase() ethdb.Database {
+	db := rawdb.NewMemoryDatabase()
+	genesis := &types.Header{Number: big.NewInt(0), Difficulty: big.NewInt(1)}
+	rawdb.WriteHeader(db, genesis)
+	rawdb.WriteCanonicalHash(db, genesis.Hash(), 0)
+	rawdb.WriteHeadHeaderHash(db, genesis.Hash())
+	rawdb.WriteHeadBlockHash(db, genesis.Hash())
+	return db
+}
+
+// checkArchiveWiped checks that a failed import left neither flat state nor
+// markers behind.
+func checkArchiveWiped(t *testing.T, db ethdb.Database) {
+	t.Helper()
+
+	if root := rawdb.ReadSnapshotImportRoot(db); root != (common.Hash{}) {
+		t.Fatalf("Import marker left: %x", root)
+	}
+	if root := rawdb.ReadSnapshotRoot(db); root != (common.Hash{}) {
+		t.Fatalf("Snapshot root written: %x", root)
+	}
+	it := db.NewIterator(rawdb.SnapshotAccountPrefix, nil)
+	defer it.Release()
+	if it.Next() {
+		t.Fatalf("Accounts of the failed import left")
+	}
+}
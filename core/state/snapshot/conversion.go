@@ -73,9 +73,18 @@ func GenerateTrie(snaptree *Tree, root common.Hash, src ethdb.Database, dst ethd
 	}
 	defer acctIt.Release()
 
+	return generateTrie(acctIt, func(accountHash common.Hash) (StorageIterator, error) {
+		return snaptree.StorageIterator(root, accountHash, common.Hash{})
+	}, root, src, dst)
+}
+
+// generateTrie regenerates the whole state (account trie + all storage tries)
+// from the given account iterator and the storage iterators it opens. If the
+// source and destination databases differ, the contract codes are migrated too.
+func generateTrie(acctIt AccountIterator, openStorage func(accountHash common.Hash) (StorageIterator, error), root common.Hash, src ethdb.Database, dst ethdb.KeyValueWriter) error {
 	got, err := generateTrieRoot(dst, acctIt, common.Hash{}, stackTrieGenerate, func(dst ethdb.KeyValueWriter, accountHash, codeHash common.Hash, stat *generateStats) (common.Hash, error) {
 		// Migrate the code first, commit the contract code into the tmp db.
-		if codeHash != emptyCode {
+		if codeHash != emptyCode && src != nil {
 			code := rawdb.ReadCode(src, codeHash)
 			if len(code) == 0 {
 				return common.Hash{}, errors.New("failed to read contract code")
@@ -83,7 +92,7 @@ func GenerateTrie(snaptree *Tree, root common.Hash, src ethdb.Database, dst ethd
 			rawdb.WriteCode(dst, codeHash, code)
 		}
 		// Then migrate all storage trie nodes into the tmp db.
-		storageIt, err := snaptree.StorageIterator(root, accountHash, common.Hash{})
+		storageIt, err := openStorage(accountHash)
 		if err != nil {
 			return common.Hash{}, err
 		}
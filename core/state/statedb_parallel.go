@@ -0,0 +1,260 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package state
+
+import (
+	"bytes"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// accountWrite is the final value of an account modified by a transaction.
+type accountWrite struct {
+	created  bool // Account was (re)created, dropping its previous storage
+	wiped    bool // Account was destructed or (re)created
+	suicided bool // Account self destructed
+
+	balance  *big.Int
+	nonce    uint64
+	code     []byte
+	codeHash common.Hash
+
+	changed bool                        // Account fields were modified, not only storage
+	slots   map[common.Hash]common.Hash // Storage slots modified
+}
+
+// StateAccess records the accounts and storage slots read by the EVM while
+// executing a single transaction, along with the values it wrote. It is used
+// to validate transactions executed speculatively against a stale state and
+// to replay their effects onto the canonical one.
+type StateAccess struct {
+	accounts map[common.Address]struct{}
+	slots    map[common.Address]map[common.Hash]struct{}
+	writes   map[common.Address]*accountWrite
+}
+
+// NewStateAccess creates an empty access record.
+func NewStateAccess() *StateAccess {
+	return &StateAccess{
+		accounts: make(map[common.Address]struct{}),
+		slots:    make(map[common.Address]map[common.Hash]struct{}),
+		writes:   make(map[common.Address]*accountWrite),
+	}
+}
+
+// readAccount marks the fields of an account as read.
+func (a *StateAccess) readAccount(addr common.Address) {
+	a.accounts[addr] = struct{}{}
+}
+
+// readSlot marks a storage slot of an account as read.
+func (a *StateAccess) readSlot(addr common.Address, key common.Hash) {
+	slots, ok := a.slots[addr]
+	if !ok {
+		slots = make(map[common.Hash]struct{})
+		a.slots[addr] = slots
+	}
+	slots[key] = struct{}{}
+}
+
+// recordWrites gathers the modifications of the current transaction out of
+// the journal. It must be called before the journal is cleared and before any
+// destructed object is discarded.
+func (a *StateAccess) recordWrites(s *StateDB, deleteEmptyObjects bool) {
+	write := func(addr common.Address) *accountWrite {
+		w, ok := a.writes[addr]
+		if !ok {
+			w = &accountWrite{slots: make(map[common.Hash]common.Hash)}
+			a.writes[addr] = w
+		}
+		return w
+	}
+	for _, entry := range s.journal.entries {
+		switch change := entry.(type) {
+		case createObjectChange:
+			w := write(*change.account)
+			w.created, w.wiped, w.changed = true, true, true
+		case resetObjectChange:
+			w := write(change.prev.address)
+			w.created, w.wiped, w.changed = true, true, true
+		case suicideChange:
+			w := write(*change.account)
+			w.wiped, w.changed = true, true
+		case balanceChange:
+			write(*change.account).changed = true
+		case nonceChange:
+			write(*change.account).changed = true
+		case codeChange:
+			write(*change.account).changed = true
+		case storageChange:
+			write(*change.account).slots[change.key] = common.Hash{}
+		case touchChange:
+			write(*change.account)
+		}
+	}
+	for addr, w := range a.writes {
+		obj, exist := s.stateObjects[addr]
+		if !exist {
+			delete(a.writes, addr)
+			continue
+		}
+		if obj.suicided {
+			w.suicided = true
+		}
+		if obj.suicided || (deleteEmptyObjects && obj.empty()) {
+			w.wiped, w.changed = true, true
+		}
+		w.balance = new(big.Int).Set(obj.Balance())
+		w.nonce = obj.Nonce()
+		w.codeHash = common.BytesToHash(obj.CodeHash())
+		if w.changed {
+			w.code = obj.Code(s.db)
+		}
+		for key := range w.slots {
+			if value, dirty := obj.dirtyStorage[key]; dirty {
+				w.slots[key] = value
+			} else {
+				// The slot was dropped by a recreation of the account
+				delete(w.slots, key)
+			}
+		}
+		if !w.changed && len(w.slots) == 0 {
+			// Touching a non-empty account has no effect
+			delete(a.writes, addr)
+		}
+	}
+}
+
+// Conflicts reports whether the transaction read any account or storage slot
+// modified by the given write set.
+func (a *StateAccess) Conflicts(ws *WriteSet) bool {
+	for addr := range a.accounts {
+		if _, ok := ws.accounts[addr]; ok {
+			return true
+		}
+	}
+	for addr, slots := range a.slots {
+		if _, ok := ws.wiped[addr]; ok {
+			return true
+		}
+		written, ok := ws.slots[addr]
+		if !ok {
+			continue
+		}
+		for key := range slots {
+			if _, ok := written[key]; ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// WriteSet accumulates the accounts and storage slots modified by a sequence
+// of transactions.
+type WriteSet struct {
+	accounts map[common.Address]struct{}
+	wiped    map[common.Address]struct{}
+	slots    map[common.Address]map[common.Hash]struct{}
+}
+
+// NewWriteSet creates an empty write set.
+func NewWriteSet() *WriteSet {
+	return &WriteSet{
+		accounts: make(map[common.Address]struct{}),
+		wiped:    make(map[common.Address]struct{}),
+		slots:    make(map[common.Address]map[common.Hash]struct{}),
+	}
+}
+
+// Add merges the modifications of a transaction into the write set.
+func (ws *WriteSet) Add(a *StateAccess) {
+	for addr, w := range a.writes {
+		// Storage writes alone leave the account fields untouched
+		if w.changed {
+			ws.accounts[addr] = struct{}{}
+		}
+		if w.wiped {
+			ws.wiped[addr] = struct{}{}
+		}
+		if len(w.slots) == 0 {
+			continue
+		}
+		slots, ok := ws.slots[addr]
+		if !ok {
+			slots = make(map[common.Hash]struct{})
+			ws.slots[addr] = slots
+		}
+		for key := range w.slots {
+			slots[key] = struct{}{}
+		}
+	}
+}
+
+// RecordAccess starts recording the state accessed by the EVM into the given
+// record, or stops recording if it is nil. The modifications are gathered on
+// each Finalise.
+func (s *StateDB) RecordAccess(a *StateAccess) {
+	s.access = a
+}
+
+// ApplyAccess replays the modifications recorded while executing a transaction
+// on top of base onto the state. The transaction must not conflict with any of
+// the modifications made to the state since base, in which case the outcome is
+// identical to executing it on the state directly.
+//
+// Balances are applied as deltas, as they are the only fields which might be
+// modified without being read first (e.g. fee payments) and thus might diverge
+// between base and the state without causing a conflict.
+func (s *StateDB) ApplyAccess(a *StateAccess, base *StateDB) {
+	for addr, w := range a.writes {
+		var (
+			_, read = a.accounts[addr]
+			balance = new(big.Int).Set(base.GetBalance(addr))
+			nonce   = base.GetNonce(addr)
+			hash    = base.GetCodeHash(addr)
+		)
+		if w.created && read {
+			// Recreate the account explicitly only if its previous state was
+			// looked at, blind creations (e.g. transfers) are implicit below
+			s.CreateAccount(addr)
+			nonce, hash = 0, common.Hash{}
+		}
+		switch delta := new(big.Int).Sub(w.balance, balance); delta.Sign() {
+		case 1:
+			s.AddBalance(addr, delta)
+		case -1:
+			s.SubBalance(addr, delta.Neg(delta))
+		default:
+			// Touch the account, so it's deleted the same way if empty
+			s.AddBalance(addr, delta)
+		}
+		if w.nonce != nonce {
+			s.SetNonce(addr, w.nonce)
+		}
+		if w.codeHash != hash && !(hash == (common.Hash{}) && bytes.Equal(w.codeHash[:], emptyCodeHash)) {
+			s.SetCode(addr, w.code)
+		}
+		for key, value := range w.slots {
+			s.SetState(addr, key, value)
+		}
+		if w.suicided {
+			s.Suicide(addr)
+		}
+	}
+}
@@ -48,6 +48,10 @@ const (
 	farDiffLayerTimeout    = 2
 )
 
+// errInvalidDiffLayer is returned by the light processing if the diff layer is
+// wrong, as opposed to the local state failing to apply it.
+var errInvalidDiffLayer = errors.New("invalid diff layer")
+
 // StateProcessor is a basic Processor, which takes care of transitioning
 // state from one point to another.
 //
@@ -108,6 +112,7 @@ func (p *LightStateProcessor) Process(block *types.Block, statedb *state.StateDB
 		if diffLayer != nil {
 			if err := diffLayer.Receipts.DeriveFields(p.bc.chainConfig, block.Hash(), block.NumberU64(), block.Transactions()); err != nil {
 				log.Error("Failed to derive block receipts fields", "hash", block.Hash(), "number", block.NumberU64(), "err", err)
+				p.bc.DisputeDiffLayer(diffLayer.DiffHash)
 				// fallback to full process
 				return p.StateProcessor.Process(block, statedb, cfg)
 			}
@@ -118,7 +123,12 @@ func (p *LightStateProcessor) Process(block *types.Block, statedb *state.StateDB
 				return statedb, receipts, logs, gasUsed, nil
 			}
 			log.Error("do light process err at block", "num", block.NumberU64(), "err", err)
-			p.bc.removeDiffLayers(diffLayer.DiffHash)
+			// only penalise the peers if the diff layer itself is wrong
+			if errors.Is(err, errInvalidDiffLayer) {
+				p.bc.DisputeDiffLayer(diffLayer.DiffHash)
+			} else {
+				p.bc.removeDiffLayers(diffLayer.DiffHash)
+			}
 			// prepare new statedb
 			statedb.StopPrefetcher()
 			parent := p.bc.GetHeader(block.ParentHash(), block.NumberU64()-1)
@@ -146,7 +156,7 @@ func (p *LightStateProcessor) LightProcess(diffLayer *types.DiffLayer, block *ty
 
 	snapDestructs, snapAccounts, snapStorage, err := statedb.DiffLayerToSnap(diffLayer)
 	if err != nil {
-		return nil, nil, 0, err
+		return nil, nil, 0, fmt.Errorf("%w: %v", errInvalidDiffLayer, err)
 	}
 
 	for _, c := range diffLayer.Codes {
@@ -157,7 +167,9 @@ func (p *LightStateProcessor) LightProcess(diffLayer *types.DiffLayer, block *ty
 		return nil, nil, 0, err
 	}
 	for des := range snapDestructs {
-		stateTrie.TryDelete(des[:])
+		if err := stateTrie.TryDelete(des[:]); err != nil {
+			return nil, nil, 0, err
+		}
 	}
 	threads := gopool.Threads(len(snapAccounts))
 
@@ -191,7 +203,7 @@ func (p *LightStateProcessor) LightProcess(diffLayer *types.DiffLayer, block *ty
 				addrHash := crypto.Keccak256Hash(diffAccount[:])
 				latestAccount, err := snapshot.FullAccount(blob)
 				if err != nil {
-					errChan <- err
+					errChan <- fmt.Errorf("%w: %v", errInvalidDiffLayer, err)
 					return
 				}
 
@@ -243,7 +255,7 @@ func (p *LightStateProcessor) LightProcess(diffLayer *types.DiffLayer, block *ty
 					!bytes.Equal(latestAccount.CodeHash, types.EmptyCodeHash) {
 					if code, exist := fullDiffCode[codeHash]; exist {
 						if crypto.Keccak256Hash(code) != codeHash {
-							errChan <- fmt.Errorf("code and code hash mismatch, account %s", diffAccount.String())
+							errChan <- fmt.Errorf("%w: code and code hash mismatch, account %s", errInvalidDiffLayer, diffAccount.String())
 							return
 						}
 						diffMux.Lock()
@@ -252,7 +264,7 @@ func (p *LightStateProcessor) LightProcess(diffLayer *types.DiffLayer, block *ty
 					} else {
 						rawCode := rawdb.ReadCode(p.bc.db, codeHash)
 						if len(rawCode) == 0 {
-							errChan <- fmt.Errorf("missing code, account %s", diffAccount.String())
+							errChan <- fmt.Errorf("%w: missing code, account %s", errInvalidDiffLayer, diffAccount.String())
 							return
 						}
 					}
@@ -271,21 +283,25 @@ func (p *LightStateProcessor) LightProcess(diffLayer *types.DiffLayer, block *ty
 					snapMux.RUnlock()
 
 					if !exist {
-						errChan <- errors.New("missing storage change in difflayer")
+						errChan <- fmt.Errorf("%w: missing storage change", errInvalidDiffLayer)
 						return
 					}
 					for k, v := range storageChange {
 						if len(v) != 0 {
-							accountTrie.TryUpdate([]byte(k), v)
+							err = accountTrie.TryUpdate([]byte(k), v)
 						} else {
-							accountTrie.TryDelete([]byte(k))
+							err = accountTrie.TryDelete([]byte(k))
+						}
+						if err != nil {
+							errChan <- err
+							return
 						}
 					}
 
 					// check storage root
 					accountRootHash := accountTrie.Hash()
 					if latestRoot != accountRootHash {
-						errChan <- errors.New("account storage root mismatch")
+						errChan <- fmt.Errorf("%w: account storage root mismatch", errInvalidDiffLayer)
 						return
 					}
 					diffMux.Lock()
@@ -339,7 +355,11 @@ func (p *LightStateProcessor) LightProcess(diffLayer *types.DiffLayer, block *ty
 	// Do validate in advance so that we can fall back to full process
 	if err := p.bc.validator.ValidateState(block, statedb, diffLayer.Receipts, gasUsed); err != nil {
 		log.Error("validate state failed during diff sync", "error", err)
-		return nil, nil, 0, err
+		// a state which failed to load doesn't tell anything about the diff layer
+		if dbErr := statedb.Error(); dbErr != nil {
+			return nil, nil, 0, dbErr
+		}
+		return nil, nil, 0, fmt.Errorf("%w: %v", errInvalidDiffLayer, err)
 	}
 
 	// remove redundant storage change
@@ -407,6 +427,7 @@ func (p *StateProcessor) Process(block *types.Block, statedb *state.StateDB, cfg
 
 	// usually do have two tx, one for validator set contract, another for system reward contract.
 	systemTxs := make([]*types.Transaction, 0, 2)
+	txIndexes := make([]int, 0, txNum)
 	for i, tx := range block.Transactions() {
 		if isPoSA {
 			if isSystemTx, err := posa.IsSystemTransaction(tx, block.Header()); err != nil {
@@ -417,21 +438,30 @@ func (p *StateProcessor) Process(block *types.Block, statedb *state.StateDB, cfg
 				continue
 			}
 		}
-
-		msg, err := tx.AsMessage(signer)
-		if err != nil {
+		commonTxs = append(commonTxs, tx)
+		txIndexes = append(txIndexes, i)
+	}
+	if p.parallelExecution(header, cfg, len(commonTxs)) {
+		var err error
+		if receipts, err = p.applyTransactionsParallel(block, commonTxs, txIndexes, statedb, signer, gp, usedGas, vmenv, cfg, bloomProcessors); err != nil {
 			bloomProcessors.Close()
 			return statedb, nil, nil, 0, err
 		}
-		statedb.Prepare(tx.Hash(), block.Hash(), i)
-		receipt, err := applyTransaction(msg, p.config, p.bc, nil, gp, statedb, header, tx, usedGas, vmenv, bloomProcessors)
-		if err != nil {
-			bloomProcessors.Close()
-			return statedb, nil, nil, 0, fmt.Errorf("could not apply tx %d [%v]: %w", i, tx.Hash().Hex(), err)
+	} else {
+		for j, tx := range commonTxs {
+			msg, err := tx.AsMessage(signer)
+			if err != nil {
+				bloomProcessors.Close()
+				return statedb, nil, nil, 0, err
+			}
+			statedb.Prepare(tx.Hash(), block.Hash(), txIndexes[j])
+			receipt, err := applyTransaction(msg, p.config, p.bc, nil, gp, statedb, header, tx, usedGas, vmenv, bloomProcessors)
+			if err != nil {
+				bloomProcessors.Close()
+				return statedb, nil, nil, 0, fmt.Errorf("could not apply tx %d [%v]: %w", txIndexes[j], tx.Hash().Hex(), err)
+			}
+			receipts = append(receipts, receipt)
 		}
-
-		commonTxs = append(commonTxs, tx)
-		receipts = append(receipts, receipt)
 	}
 	bloomProcessors.Close()
 
@@ -467,9 +497,13 @@ func applyTransaction(msg types.Message, config *params.ChainConfig, bc ChainCon
 	}
 	*usedGas += result.UsedGas
 
-	// Create a new receipt for the transaction, storing the intermediate root and gas used
-	// by the tx.
-	receipt := &types.Receipt{Type: tx.Type(), PostState: root, CumulativeGasUsed: *usedGas}
+	return newReceipt(msg, header, tx, result, root, statedb, *usedGas, receiptProcessors...), nil
+}
+
+// newReceipt creates the receipt of a transaction already applied to the state,
+// storing the intermediate root and the gas used by the tx.
+func newReceipt(msg types.Message, header *types.Header, tx *types.Transaction, result *ExecutionResult, root []byte, statedb *state.StateDB, usedGas uint64, receiptProcessors ...ReceiptProcessor) *types.Receipt {
+	receipt := &types.Receipt{Type: tx.Type(), PostState: root, CumulativeGasUsed: usedGas}
 	if result.Failed() {
 		receipt.Status = types.ReceiptStatusFailed
 	} else {
@@ -480,7 +514,7 @@ func applyTransaction(msg types.Message, config *params.ChainConfig, bc ChainCon
 
 	// If the transaction created a contract, store the creation address in the receipt.
 	if msg.To() == nil {
-		receipt.ContractAddress = crypto.CreateAddress(evm.TxContext.Origin, tx.Nonce())
+		receipt.ContractAddress = crypto.CreateAddress(msg.From(), tx.Nonce())
 	}
 
 	// Set the receipt logs and create the bloom filter.
@@ -491,7 +525,7 @@ func applyTransaction(msg types.Message, config *params.ChainConfig, bc ChainCon
 	for _, receiptProcessor := range receiptProcessors {
 		receiptProcessor.Apply(receipt)
 	}
-	return receipt, err
+	return receipt
 }
 
 // ApplyTransaction attempts to apply a transaction to the given state database
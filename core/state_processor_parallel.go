@@ -0,0 +1,171 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/metrics"
+)
+
+// parallelTxMinimum is the minimum number of transactions in a block for them
+// to be worth executing in parallel.
+const parallelTxMinimum = 8
+
+var (
+	parallelMergedMeter     = metrics.NewRegisteredMeter("chain/parallel/merged", nil)
+	parallelReexecutedMeter = metrics.NewRegisteredMeter("chain/parallel/reexecuted", nil)
+)
+
+// speculativeTx is a transaction executed on top of the state at the start of
+// the block, ignoring all the transactions preceding it.
+type speculativeTx struct {
+	index   int // Index of the transaction in the block
+	tx      *types.Transaction
+	msg     types.Message
+	statedb *state.StateDB // Copy of the state made by the worker, dropped once merged
+	access  *state.StateAccess
+
+	result *ExecutionResult
+	err    error
+	done   chan struct{} // Closed when the execution finishes
+}
+
+// parallelExecution reports whether the given number of transactions should be
+// executed in parallel. Only post-Byzantium blocks are supported, as older ones
+// need the intermediate state root of every transaction.
+func (p *StateProcessor) parallelExecution(header *types.Header, cfg vm.Config, txs int) bool {
+	return p.bc.parallelTxWorkers > 1 && txs >= parallelTxMinimum && p.config.IsByzantium(header.Number) && !cfg.Debug
+}
+
+// applyTransactionsParallel executes the transactions optimistically in
+// parallel, each on its own copy of the state at the start of the block, and
+// merges their effects into the state in order. Transactions which read any
+// account or storage slot modified by a preceding one are re-executed on the
+// merged state, so the receipts and the resulting state are identical to
+// executing them sequentially.
+func (p *StateProcessor) applyTransactionsParallel(block *types.Block, txs []*types.Transaction, indexes []int, statedb *state.StateDB, signer types.Signer, gp *GasPool, usedGas *uint64, vmenv *vm.EVM, cfg vm.Config, receiptProcessors ...ReceiptProcessor) ([]*types.Receipt, error) {
+	var (
+		header = block.Header()
+		base   = statedb.Copy() // Read only, shared by the workers
+		parent = statedb.Copy() // Private to the merge loop, resolves the values replaced
+		specs  = make([]*speculativeTx, len(txs))
+		tasks  = make(chan *speculativeTx, len(txs))
+		abort  = make(chan struct{})
+	)
+	for i, tx := range txs {
+		msg, err := tx.AsMessage(signer)
+		if err != nil {
+			return nil, err
+		}
+		specs[i] = &speculativeTx{
+			index:  indexes[i],
+			tx:     tx,
+			msg:    msg,
+			access: state.NewStateAccess(),
+			done:   make(chan struct{}),
+		}
+		tasks <- specs[i]
+	}
+	close(tasks)
+	defer close(abort)
+
+	workers := p.bc.parallelTxWorkers
+	if workers > len(txs) {
+		workers = len(txs)
+	}
+	for i := 0; i < workers; i++ {
+		go p.speculate(block, cfg, base, tasks, abort)
+	}
+	// Merge the transactions in order, validating them against the state
+	// modified by all the preceding ones
+	var (
+		receipts = make([]*types.Receipt, 0, len(txs))
+		written  = state.NewWriteSet()
+	)
+	for _, spec := range specs {
+		<-spec.done
+
+		statedb.Prepare(spec.tx.Hash(), block.Hash(), spec.index)
+		if spec.err == nil && gp.Gas() >= spec.msg.Gas() && !spec.access.Conflicts(written) {
+			statedb.ApplyAccess(spec.access, parent)
+			for _, log := range spec.statedb.GetLogs(spec.tx.Hash()) {
+				statedb.AddLog(log)
+			}
+			for hash, preimage := range spec.statedb.Preimages() {
+				statedb.AddPreimage(hash, preimage)
+			}
+			spec.statedb = nil
+			statedb.Finalise(true)
+
+			gp.SubGas(spec.result.UsedGas)
+			*usedGas += spec.result.UsedGas
+
+			receipts = append(receipts, newReceipt(spec.msg, header, spec.tx, spec.result, nil, statedb, *usedGas, receiptProcessors...))
+			written.Add(spec.access)
+			parallelMergedMeter.Mark(1)
+			continue
+		}
+		// The speculative execution is stale, apply the transaction on the
+		// merged state, recording its modifications for the ones after
+		spec.statedb = nil
+		access := state.NewStateAccess()
+		statedb.RecordAccess(access)
+		receipt, err := applyTransaction(spec.msg, p.config, p.bc, nil, gp, statedb, header, spec.tx, usedGas, vmenv, receiptProcessors...)
+		statedb.RecordAccess(nil)
+		if err != nil {
+			return nil, fmt.Errorf("could not apply tx %d [%v]: %w", spec.index, spec.tx.Hash().Hex(), err)
+		}
+		receipts = append(receipts, receipt)
+		written.Add(access)
+		parallelReexecutedMeter.Mark(1)
+	}
+	return receipts, nil
+}
+
+// speculate executes transactions from the task queue until the queue is drained
+// or the execution is aborted. Every transaction gets its own copy of the base
+// state, made by the worker right before executing it.
+func (p *StateProcessor) speculate(block *types.Block, cfg vm.Config, base *state.StateDB, tasks <-chan *speculativeTx, abort <-chan struct{}) {
+	// The block context caches block hashes, so it can't be shared
+	header := block.Header()
+	evm := vm.NewEVM(NewEVMBlockContext(header, p.bc, nil), vm.TxContext{}, nil, p.config, cfg)
+	defer func() {
+		vm.EVMInterpreterPool.Put(evm.Interpreter())
+		vm.EvmPool.Put(evm)
+	}()
+	for spec := range tasks {
+		select {
+		case <-abort:
+			return
+		default:
+		}
+		spec.statedb = base.Copy()
+		spec.statedb.Prepare(spec.tx.Hash(), block.Hash(), spec.index)
+		spec.statedb.RecordAccess(spec.access)
+
+		evm.Reset(NewEVMTxContext(spec.msg), spec.statedb)
+		spec.result, spec.err = ApplyMessage(evm, spec.msg, new(GasPool).AddGas(header.GasLimit))
+		if spec.err == nil {
+			spec.statedb.Finalise(true)
+		}
+		close(spec.done)
+	}
+}
@@ -0,0 +1,189 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"crypto/ecdsa"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// Tests that blocks executed in parallel, with both independent and conflicting
+// transactions, yield the same receipts and state as sequential execution.
+func TestParallelTxExecution(t *testing.T) {
+	var (
+		signer  = types.HomesteadSigner{}
+		keys    = make([]*ecdsa.PrivateKey, 4)
+		alloc   = GenesisAlloc{}
+		counter = common.Address{0xc0}
+		db      = rawdb.NewMemoryDatabase()
+		gendb   = rawdb.NewMemoryDatabase()
+	)
+	for i := range keys {
+		keys[i], _ = crypto.GenerateKey()
+		alloc[crypto.PubkeyToAddress(keys[i].PublicKey)] = GenesisAccount{Balance: big.NewInt(params.Ether)}
+	}
+	// PUSH1 0 SLOAD PUSH1 1 ADD PUSH1 0 SSTORE STOP
+	alloc[counter] = GenesisAccount{Balance: common.Big0, Code: common.FromHex("0x60005460010160005500")}
+
+	gspec := &Genesis{Config: params.TestChainConfig, Alloc: alloc}
+	genesis := gspec.MustCommit(db)
+	gspec.MustCommit(gendb)
+
+	blocks, receipts := GenerateChain(gspec.Config, genesis, ethash.NewFaker(), gendb, 8, func(i int, block *BlockGen) {
+		for j, key := range keys {
+			from := crypto.PubkeyToAddress(key.PublicKey)
+			txs := []*types.Transaction{
+				// Independent transfer to a fresh account
+				types.NewTransaction(block.TxNonce(from), common.Address{0xaa, byte(i), byte(j)}, big.NewInt(1000), params.TxGas, big.NewInt(1), nil),
+				// Transfer to the next sender, conflicting with its transactions
+				types.NewTransaction(block.TxNonce(from)+1, crypto.PubkeyToAddress(keys[(j+1)%len(keys)].PublicKey), big.NewInt(1000), params.TxGas, big.NewInt(1), nil),
+				// Contract call, conflicting on the counter slot
+				types.NewTransaction(block.TxNonce(from)+2, counter, common.Big0, 100000, big.NewInt(1), nil),
+				// Contract creation, deploying an empty contract
+				types.NewContractCreation(block.TxNonce(from)+3, common.Big0, 100000, big.NewInt(1), common.FromHex("0x60006000f3")),
+			}
+			for _, tx := range txs {
+				signed, err := types.SignTx(tx, signer, key)
+				if err != nil {
+					t.Fatalf("failed to sign tx: %v", err)
+				}
+				block.AddTx(signed)
+			}
+		}
+	})
+	chain, err := NewBlockChain(db, nil, gspec.Config, ethash.NewFaker(), vm.Config{}, nil, nil, EnableParallelTxExecution(4))
+	if err != nil {
+		t.Fatalf("failed to create chain: %v", err)
+	}
+	defer chain.Stop()
+
+	// Block validation checks the state root and the receipts
+	if n, err := chain.InsertChain(blocks); err != nil {
+		t.Fatalf("block %d: failed to insert parallel executed chain: %v", n, err)
+	}
+	for i, block := range blocks {
+		have := chain.GetReceiptsByHash(block.Hash())
+		if len(have) != len(receipts[i]) {
+			t.Fatalf("block %d: receipt count mismatch: have %d, want %d", i, len(have), len(receipts[i]))
+		}
+		for j, receipt := range have {
+			want := receipts[i][j]
+			if receipt.Status != want.Status || receipt.CumulativeGasUsed != want.CumulativeGasUsed || receipt.ContractAddress != want.ContractAddress || len(receipt.Logs) != len(want.Logs) {
+				t.Fatalf("block %d, tx %d: receipt mismatch: have %+v, want %+v", i, j, receipt, want)
+			}
+		}
+	}
+	statedb, err := chain.State()
+	if err != nil {
+		t.Fatalf("failed to retrieve head state: %v", err)
+	}
+	if have, want := statedb.GetState(counter, common.Hash{}), common.BigToHash(big.NewInt(int64(len(blocks)*len(keys)))); have != want {
+		t.Fatalf("counter mismatch: have %x, want %x", have, want)
+	}
+}
+
+// Tests that parallel execution on top of a state with uncommitted changes and
+// no snapshot yields the same receipts and state as sequential execution.
+func TestParallelTxExecutionDirtyState(t *testing.T) {
+	var (
+		signer  = types.HomesteadSigner{}
+		keys    = make([]*ecdsa.PrivateKey, 4)
+		alloc   = GenesisAlloc{}
+		counter = common.Address{0xc0}
+		db      = rawdb.NewMemoryDatabase()
+		gendb   = rawdb.NewMemoryDatabase()
+	)
+	for i := range keys {
+		keys[i], _ = crypto.GenerateKey()
+		alloc[crypto.PubkeyToAddress(keys[i].PublicKey)] = GenesisAccount{Balance: big.NewInt(params.Ether)}
+		alloc[common.Address{0xaa, byte(i)}] = GenesisAccount{Balance: big.NewInt(1)}
+	}
+	// PUSH1 0 SLOAD PUSH1 1 ADD PUSH1 0 SSTORE STOP
+	alloc[counter] = GenesisAccount{Balance: common.Big0, Code: common.FromHex("0x60005460010160005500")}
+
+	gspec := &Genesis{Config: params.TestChainConfig, Alloc: alloc}
+	genesis := gspec.MustCommit(db)
+	gspec.MustCommit(gendb)
+
+	blocks, _ := GenerateChain(gspec.Config, genesis, ethash.NewFaker(), gendb, 1, func(i int, block *BlockGen) {
+		for j, key := range keys {
+			from := crypto.PubkeyToAddress(key.PublicKey)
+			txs := []*types.Transaction{
+				types.NewTransaction(block.TxNonce(from), common.Address{0xaa, byte(j)}, big.NewInt(1000), params.TxGas, big.NewInt(1), nil),
+				types.NewTransaction(block.TxNonce(from)+1, crypto.PubkeyToAddress(keys[(j+1)%len(keys)].PublicKey), big.NewInt(1000), params.TxGas, big.NewInt(1), nil),
+				types.NewTransaction(block.TxNonce(from)+2, counter, common.Big0, 100000, big.NewInt(1), nil),
+			}
+			for _, tx := range txs {
+				signed, err := types.SignTx(tx, signer, key)
+				if err != nil {
+					t.Fatalf("failed to sign tx: %v", err)
+				}
+				block.AddTx(signed)
+			}
+		}
+	})
+	cacheConfig := &CacheConfig{TrieCleanLimit: 256, TrieDirtyLimit: 256, TrieTimeLimit: 5 * time.Minute, TriesInMemory: 128}
+	chain, err := NewBlockChain(db, cacheConfig, gspec.Config, ethash.NewFaker(), vm.Config{}, nil, nil, EnableParallelTxExecution(4))
+	if err != nil {
+		t.Fatalf("failed to create chain: %v", err)
+	}
+	defer chain.Stop()
+
+	// Modify the senders and the counter without committing, so the workers
+	// start from dirty objects while the rest is resolved from the trie
+	process := func(workers int) (common.Hash, types.Receipts) {
+		statedb, err := state.New(genesis.Root(), state.NewDatabase(db), nil)
+		if err != nil {
+			t.Fatalf("failed to create state: %v", err)
+		}
+		for _, key := range keys {
+			statedb.AddBalance(crypto.PubkeyToAddress(key.PublicKey), big.NewInt(1))
+		}
+		statedb.SetState(counter, common.Hash{}, common.BigToHash(big.NewInt(10)))
+
+		chain.parallelTxWorkers = workers
+		_, receipts, _, _, err := chain.processor.Process(blocks[0], statedb, vm.Config{})
+		if err != nil {
+			t.Fatalf("failed to process block with %d workers: %v", workers, err)
+		}
+		return statedb.IntermediateRoot(true), receipts
+	}
+	wantRoot, wantReceipts := process(0)
+	for i := 0; i < 8; i++ {
+		haveRoot, haveReceipts := process(4)
+		if haveRoot != wantRoot {
+			t.Fatalf("run %d: state root mismatch: have %x, want %x", i, haveRoot, wantRoot)
+		}
+		for j, receipt := range haveReceipts {
+			want := wantReceipts[j]
+			if receipt.Status != want.Status || receipt.CumulativeGasUsed != want.CumulativeGasUsed {
+				t.Fatalf("run %d, tx %d: receipt mismatch: have %+v, want %+v", i, j, receipt, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,195 @@
+package core
+
+import (
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	lru "github.com/hashicorp/golang-lru"
+)
+
+const (
+	// txMetaCacheSize is the number of transactions the provenance is retained
+	// for. Entries outlive the transactions in the pool, so the metadata is still
+	// available after a transaction was replaced, included or dropped.
+	txMetaCacheSize = 65536
+
+	// txMetaAnnounceCacheSize is the number of announced but not yet delivered
+	// transactions the announcing peers are retained for. Announcements are kept
+	// apart so hashes that never arrive can't evict the provenance of delivered
+	// transactions.
+	txMetaAnnounceCacheSize = 16384
+
+	// txMetaMaxPeers is the maximum number of announcing and delivering peers
+	// tracked per transaction.
+	txMetaMaxPeers = 16
+)
+
+// TxSource describes how the body of a transaction first reached the node.
+type TxSource string
+
+const (
+	TxSourceUnknown      TxSource = ""             // Not yet classified
+	TxSourceLocal        TxSource = "local"        // Submitted locally via RPC or the journal
+	TxSourceRemote       TxSource = "remote"       // Added as remote without peer information
+	TxSourceBroadcast    TxSource = "broadcast"    // Pushed unsolicited by a peer
+	TxSourceAnnouncement TxSource = "announcement" // Announced by hash and fetched explicitly
+)
+
+// TxPeerEvent is a single announcement or delivery of a transaction by a peer.
+type TxPeerEvent struct {
+	Peer string    `json:"peer"`
+	Time time.Time `json:"time"`
+}
+
+// TxMeta is the provenance of a transaction: when it was first seen by the node
+// and by which peers it was announced or delivered.
+type TxMeta struct {
+	Hash        common.Hash   `json:"hash"`
+	FirstSeen   time.Time     `json:"firstSeen"`
+	Source      TxSource      `json:"source"`
+	AnnouncedBy []TxPeerEvent `json:"announcedBy,omitempty"`
+	DeliveredBy []TxPeerEvent `json:"deliveredBy,omitempty"`
+	Replaces    *common.Hash  `json:"replaces,omitempty"`
+	ReplacedBy  *common.Hash  `json:"replacedBy,omitempty"`
+}
+
+// copy returns a deep copy of the metadata, safe to hand out to callers.
+func (m *TxMeta) copy() *TxMeta {
+	cpy := *m
+	cpy.AnnouncedBy = append([]TxPeerEvent(nil), m.AnnouncedBy...)
+	cpy.DeliveredBy = append([]TxPeerEvent(nil), m.DeliveredBy...)
+	return &cpy
+}
+
+// seen lowers the first seen timestamp if the given time is earlier.
+func (m *TxMeta) seen(t time.Time) {
+	if m.FirstSeen.IsZero() || t.Before(m.FirstSeen) {
+		m.FirstSeen = t
+	}
+}
+
+// txMetaTracker retains the provenance of recently seen transactions.
+type txMetaTracker struct {
+	cache     *lru.Cache // Transaction hash -> *TxMeta of arrived transactions
+	announces *lru.Cache // Transaction hash -> *TxMeta of announced-only transactions
+	lock      sync.Mutex // Serializes the read-modify-write of entries
+}
+
+func newTxMetaTracker(size int) *txMetaTracker {
+	cache, _ := lru.New(size)
+	announces, _ := lru.New(txMetaAnnounceCacheSize)
+	return &txMetaTracker{cache: cache, announces: announces}
+}
+
+// entry retrieves the metadata of an arrived transaction, creating it if
+// missing. A new entry takes over the announcements seen before the arrival.
+//
+// Note, this method assumes the tracker lock is held!
+func (t *txMetaTracker) entry(hash common.Hash) *TxMeta {
+	if meta, ok := t.cache.Get(hash); ok {
+		return meta.(*TxMeta)
+	}
+	meta := &TxMeta{Hash: hash}
+	if announced, ok := t.announces.Peek(hash); ok {
+		meta = announced.(*TxMeta)
+		t.announces.Remove(hash)
+	}
+	t.cache.Add(hash, meta)
+	return meta
+}
+
+// announced records that a peer announced a batch of transaction hashes. Hashes
+// not delivered yet are only tracked in the announcement cache.
+func (t *txMetaTracker) announced(peer string, hashes []common.Hash, time time.Time) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	for _, hash := range hashes {
+		var meta *TxMeta
+		if cached, ok := t.cache.Get(hash); ok {
+			meta = cached.(*TxMeta)
+		} else if cached, ok := t.announces.Get(hash); ok {
+			meta = cached.(*TxMeta)
+		} else {
+			meta = &TxMeta{Hash: hash}
+			t.announces.Add(hash, meta)
+		}
+		meta.seen(time)
+		meta.AnnouncedBy = appendPeerEvent(meta.AnnouncedBy, peer, time)
+	}
+}
+
+// delivered records that a peer delivered a batch of transactions, either as a
+// reply to an explicit request (direct) or as an unsolicited broadcast.
+func (t *txMetaTracker) delivered(peer string, txs []*types.Transaction, direct bool, time time.Time) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	for _, tx := range txs {
+		meta := t.entry(tx.Hash())
+		meta.seen(time)
+		if meta.Source == TxSourceUnknown {
+			if direct {
+				meta.Source = TxSourceAnnouncement
+			} else {
+				meta.Source = TxSourceBroadcast
+			}
+		}
+		meta.DeliveredBy = appendPeerEvent(meta.DeliveredBy, peer, time)
+	}
+}
+
+// accepted records that a transaction was accepted into the pool.
+func (t *txMetaTracker) accepted(tx *types.Transaction, local bool) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	meta := t.entry(tx.Hash())
+	meta.seen(tx.Time())
+	if meta.Source == TxSourceUnknown {
+		if local {
+			meta.Source = TxSourceLocal
+		} else {
+			meta.Source = TxSourceRemote
+		}
+	}
+}
+
+// replaced links a transaction to the one replacing it in the pool, so the
+// provenance of both stays discoverable.
+func (t *txMetaTracker) replaced(old, tx *types.Transaction) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	oldHash, newHash := old.Hash(), tx.Hash()
+	t.entry(oldHash).ReplacedBy = &newHash
+	t.entry(newHash).Replaces = &oldHash
+}
+
+// get retrieves a copy of the metadata of an arrived transaction, or nil if
+// unknown or only announced so far.
+func (t *txMetaTracker) get(hash common.Hash) *TxMeta {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if meta, ok := t.cache.Peek(hash); ok {
+		return meta.(*TxMeta).copy()
+	}
+	return nil
+}
+
+// appendPeerEvent adds a peer event to the list, unless the peer is already
+// tracked or the list is full.
+func appendPeerEvent(events []TxPeerEvent, peer string, time time.Time) []TxPeerEvent {
+	if len(events) >= txMetaMaxPeers {
+		return events
+	}
+	for _, event := range events {
+		if event.Peer == peer {
+			return events
+		}
+	}
+	return append(events, TxPeerEvent{Peer: peer, Time: time})
+}
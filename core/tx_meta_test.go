@@ -0,0 +1,123 @@
+package core
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// Tests that the provenance of a transaction is assembled from announcements
+// and deliveries, keeping the earliest sighting and the first delivery kind.
+func TestTxMetaProvenance(t *testing.T) {
+	var (
+		tracker = newTxMetaTracker(16)
+		key, _  = crypto.GenerateKey()
+		start   = time.Now()
+		tx      = transaction(0, 100000, key)
+	)
+	if meta := tracker.get(tx.Hash()); meta != nil {
+		t.Fatalf("unknown transaction has metadata: %+v", meta)
+	}
+	tracker.announced("peer-a", []common.Hash{tx.Hash()}, start.Add(time.Second))
+	tracker.announced("peer-b", []common.Hash{tx.Hash()}, start)
+	tracker.announced("peer-a", []common.Hash{tx.Hash()}, start.Add(2*time.Second))
+	if meta := tracker.get(tx.Hash()); meta != nil {
+		t.Fatalf("announced-only transaction has metadata: %+v", meta)
+	}
+	tracker.delivered("peer-b", []*types.Transaction{tx}, true, start.Add(3*time.Second))
+	tracker.delivered("peer-c", []*types.Transaction{tx}, false, start.Add(4*time.Second))
+	tracker.accepted(tx, false)
+
+	meta := tracker.get(tx.Hash())
+	if meta == nil {
+		t.Fatalf("metadata missing")
+	}
+	if !meta.FirstSeen.Equal(start) {
+		t.Errorf("first seen mismatch: have %v, want %v", meta.FirstSeen, start)
+	}
+	if meta.Source != TxSourceAnnouncement {
+		t.Errorf("source mismatch: have %q, want %q", meta.Source, TxSourceAnnouncement)
+	}
+	if len(meta.AnnouncedBy) != 2 || meta.AnnouncedBy[0].Peer != "peer-a" || meta.AnnouncedBy[1].Peer != "peer-b" {
+		t.Errorf("announcers mismatch: have %+v", meta.AnnouncedBy)
+	}
+	if len(meta.DeliveredBy) != 2 || meta.DeliveredBy[0].Peer != "peer-b" || meta.DeliveredBy[1].Peer != "peer-c" {
+		t.Errorf("deliverers mismatch: have %+v", meta.DeliveredBy)
+	}
+	// Ensure the returned metadata is a copy
+	meta.AnnouncedBy[0].Peer = "mutated"
+	if tracker.get(tx.Hash()).AnnouncedBy[0].Peer != "peer-a" {
+		t.Errorf("tracker internals modified through returned metadata")
+	}
+}
+
+// Tests that announcements of transactions that never arrive don't evict the
+// provenance of delivered ones.
+func TestTxMetaAnnouncementFlood(t *testing.T) {
+	var (
+		tracker = newTxMetaTracker(4)
+		key, _  = crypto.GenerateKey()
+		tx      = transaction(0, 100000, key)
+	)
+	tracker.delivered("peer", []*types.Transaction{tx}, false, time.Now())
+
+	hashes := make([]common.Hash, 1024)
+	for i := range hashes {
+		hashes[i] = common.BytesToHash([]byte{byte(i >> 8), byte(i)})
+	}
+	tracker.announced("flooder", hashes, time.Now())
+
+	if tracker.cache.Len() != 1 {
+		t.Errorf("arrived entry count mismatch: have %d, want %d", tracker.cache.Len(), 1)
+	}
+	if meta := tracker.get(tx.Hash()); meta == nil || meta.Source != TxSourceBroadcast {
+		t.Errorf("delivered transaction metadata lost: %+v", meta)
+	}
+	if meta := tracker.get(hashes[0]); meta != nil {
+		t.Errorf("announced-only transaction has metadata: %+v", meta)
+	}
+}
+
+// Tests that the pool keeps the provenance of replaced transactions and links
+// them to their replacements.
+func TestTxPoolMetaReplacement(t *testing.T) {
+	t.Parallel()
+
+	pool, key := setupTxPool()
+	defer pool.Stop()
+
+	account := crypto.PubkeyToAddress(key.PublicKey)
+	pool.currentState.AddBalance(account, big.NewInt(1000000000))
+
+	original := pricedTransaction(0, 100000, big.NewInt(1), key)
+	replacement := pricedTransaction(0, 100000, big.NewInt(2), key)
+
+	pool.RecordTxDeliveries("peer", []*types.Transaction{original}, false, time.Now())
+	if err := pool.addRemoteSync(original); err != nil {
+		t.Fatalf("failed to add original transaction: %v", err)
+	}
+	if err := pool.addRemoteSync(replacement); err != nil {
+		t.Fatalf("failed to add replacement transaction: %v", err)
+	}
+	if pool.Get(original.Hash()) != nil {
+		t.Fatalf("original transaction not replaced")
+	}
+	meta := pool.TxMeta(original.Hash())
+	if meta == nil {
+		t.Fatalf("replaced transaction metadata missing")
+	}
+	if meta.Source != TxSourceBroadcast || len(meta.DeliveredBy) != 1 || meta.DeliveredBy[0].Peer != "peer" {
+		t.Errorf("replaced transaction provenance mismatch: %+v", meta)
+	}
+	if meta.ReplacedBy == nil || *meta.ReplacedBy != replacement.Hash() {
+		t.Errorf("replacement link mismatch: have %v, want %v", meta.ReplacedBy, replacement.Hash())
+	}
+	meta = pool.TxMeta(replacement.Hash())
+	if meta == nil || meta.Source != TxSourceRemote || meta.Replaces == nil || *meta.Replaces != original.Hash() {
+		t.Errorf("replacement metadata mismatch: %+v", meta)
+	}
+}
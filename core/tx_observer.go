@@ -0,0 +1,422 @@
+package core
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	// txObserverQueueSize is the number of records an asynchronous sink buffers
+	// before it starts dropping them. Sinks are invoked with the pool lock held,
+	// so they must never block on I/O.
+	txObserverQueueSize = 4096
+
+	// txObserverWriteTimeout is the maximum time a single remote write may take.
+	txObserverWriteTimeout = time.Second
+
+	// defaultTxObserverRingSize is the capacity of the in-memory sink if none
+	// was configured.
+	defaultTxObserverRingSize = 8192
+)
+
+var (
+	// errUnknownTxObserverSink is returned if the configured sink kind is not
+	// one of the built-in ones.
+	errUnknownTxObserverSink = errors.New("unknown tx observer sink")
+
+	txObserverDropMeter = metrics.NewRegisteredMeter("txpool/observer/dropped", nil)
+)
+
+// Built-in tx observer sink kinds.
+const (
+	TxObserverSinkFile   = "file"
+	TxObserverSinkMemory = "memory"
+	TxObserverSinkMongo  = "mongo"
+)
+
+// TxObserver is notified about every remote transaction accepted into the pool.
+// Implementations are called with the pool lock held and must return quickly.
+type TxObserver interface {
+	// ObserveTx is invoked for an accepted remote transaction, together with
+	// its sender, the peer that delivered it and the time it arrived.
+	ObserveTx(tx *types.Transaction, from common.Address, peer string, arrival time.Time)
+
+	// Close flushes any pending records and releases the sink's resources.
+	Close() error
+}
+
+// TxObserverConfig are the configuration parameters of the tx delivery tracking.
+type TxObserverConfig struct {
+	Sink string // Sink kind to deliver the records to (file, memory, mongo), empty to disable
+
+	Path     string // Output file of the file sink, written as JSON lines
+	RingSize int    // Number of records retained by the memory sink, served by bot_txDeliveries
+
+	MongoURI        string // Connection string of the mongo sink
+	MongoDB         string // Database name of the mongo sink
+	MongoCollection string // Collection name of the mongo sink
+
+	Methods   []string         // Method selectors (hex encoded) to track, empty to track all
+	Addresses []common.Address // Destination addresses to track, empty to track all
+}
+
+// MyArbTxObserverMethods are the method selectors of our own arb contracts,
+// whose delivery has always been tracked by default.
+var MyArbTxObserverMethods = []string{"c4d44074", "e40eb298"}
+
+// DefaultTxObserverConfig contains the default settings of the tx delivery
+// tracking. As before the sinks were pluggable, the delivery of our own arb
+// transactions is logged to the local mongo instance. Set Sink to an empty
+// string to disable tracking, or Methods to nil to track every transaction.
+var DefaultTxObserverConfig = TxObserverConfig{
+	Sink:            TxObserverSinkMongo,
+	Methods:         MyArbTxObserverMethods,
+	RingSize:        defaultTxObserverRingSize,
+	MongoURI:        "mongodb://localhost:27017",
+	MongoDB:         "txdelivery",
+	MongoCollection: "txs",
+}
+
+// TxDeliveryTrackingInfo is the record written by the tx observer sinks.
+type TxDeliveryTrackingInfo struct {
+	MethodId string    `json:"methodId" bson:"methodId"`
+	Hash     string    `json:"hash" bson:"hash"`
+	Peer     string    `json:"peer" bson:"peer"`
+	Data     string    `json:"data" bson:"data"`
+	From     string    `json:"from" bson:"from"`
+	To       string    `json:"to" bson:"to"`
+	Nonce    uint64    `json:"nonce" bson:"nonce"`
+	Time     time.Time `json:"time" bson:"time"`
+	GasPrice uint64    `json:"gasPrice" bson:"gasPrice"`
+	Gas      uint      `json:"gas" bson:"gas"`
+}
+
+// newTxDeliveryTrackingInfo assembles the tracking record of a transaction.
+func newTxDeliveryTrackingInfo(tx *types.Transaction, from common.Address, peer string, arrival time.Time) *TxDeliveryTrackingInfo {
+	info := &TxDeliveryTrackingInfo{
+		Hash:     tx.Hash().String(),
+		Peer:     peer,
+		Data:     hex.EncodeToString(tx.Data()),
+		From:     from.String(),
+		Nonce:    tx.Nonce(),
+		Time:     arrival,
+		GasPrice: tx.GasPrice().Uint64(),
+		Gas:      uint(tx.Gas()),
+	}
+	if len(tx.Data()) >= 4 {
+		info.MethodId = hex.EncodeToString(tx.Data()[:4])
+	}
+	if tx.To() != nil {
+		info.To = tx.To().String()
+	}
+	return info
+}
+
+// NewTxObserver creates the sink described by the config, wrapped into the
+// configured method and address filters. A nil observer is returned if no sink
+// is configured.
+func NewTxObserver(config TxObserverConfig) (TxObserver, error) {
+	var (
+		sink TxObserver
+		err  error
+	)
+	switch strings.ToLower(config.Sink) {
+	case "":
+		return nil, nil
+	case TxObserverSinkFile:
+		sink, err = NewFileTxObserver(config.Path)
+	case TxObserverSinkMemory:
+		sink = NewRingTxObserver(config.RingSize)
+	case TxObserverSinkMongo:
+		sink, err = NewMongoTxObserver(config.MongoURI, config.MongoDB, config.MongoCollection)
+	default:
+		return nil, fmt.Errorf("%w: %q", errUnknownTxObserverSink, config.Sink)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return NewFilteredTxObserver(sink, config.Methods, config.Addresses)
+}
+
+// FilteredTxObserver forwards transactions matching a set of method selectors
+// and destination addresses to a wrapped observer.
+type FilteredTxObserver struct {
+	sink      TxObserver
+	methods   [][]byte
+	addresses map[common.Address]struct{}
+}
+
+// NewFilteredTxObserver wraps an observer into a method selector and address
+// filter. A transaction is forwarded if it matches both filters, an empty filter
+// matches everything.
+func NewFilteredTxObserver(sink TxObserver, methods []string, addresses []common.Address) (*FilteredTxObserver, error) {
+	f := &FilteredTxObserver{
+		sink:      sink,
+		addresses: make(map[common.Address]struct{}, len(addresses)),
+	}
+	for _, method := range methods {
+		selector, err := hexutil.Decode(method)
+		if err != nil {
+			// Selectors are commonly written without the 0x prefix
+			if selector, err = hex.DecodeString(method); err != nil {
+				return nil, fmt.Errorf("invalid method selector %q: %v", method, err)
+			}
+		}
+		if len(selector) != 4 {
+			return nil, fmt.Errorf("invalid method selector %q: want 4 bytes, have %d", method, len(selector))
+		}
+		f.methods = append(f.methods, selector)
+	}
+	for _, addr := range addresses {
+		f.addresses[addr] = struct{}{}
+	}
+	return f, nil
+}
+
+// Match reports whether the transaction passes the filter.
+func (f *FilteredTxObserver) Match(tx *types.Transaction) bool {
+	if len(f.addresses) > 0 {
+		if tx.To() == nil {
+			return false
+		}
+		if _, ok := f.addresses[*tx.To()]; !ok {
+			return false
+		}
+	}
+	if len(f.methods) > 0 {
+		data := tx.Data()
+		if len(data) < 4 {
+			return false
+		}
+		for _, method := range f.methods {
+			if bytes.Equal(method, data[:4]) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// ObserveTx implements TxObserver, forwarding matching transactions.
+func (f *FilteredTxObserver) ObserveTx(tx *types.Transaction, from common.Address, peer string, arrival time.Time) {
+	if f.Match(tx) {
+		f.sink.ObserveTx(tx, from, peer, arrival)
+	}
+}
+
+// Close implements TxObserver, closing the wrapped sink.
+func (f *FilteredTxObserver) Close() error {
+	return f.sink.Close()
+}
+
+// Sink returns the observer the filter forwards to.
+func (f *FilteredTxObserver) Sink() TxObserver {
+	return f.sink
+}
+
+// RingTxObserver retains the most recent tracking records in memory.
+type RingTxObserver struct {
+	records []*TxDeliveryTrackingInfo
+	next    int  // Index the next record will be written to
+	full    bool // Whether the ring wrapped around at least once
+	lock    sync.RWMutex
+}
+
+// NewRingTxObserver creates an in-memory sink retaining the last size records.
+func NewRingTxObserver(size int) *RingTxObserver {
+	if size <= 0 {
+		size = defaultTxObserverRingSize
+	}
+	return &RingTxObserver{records: make([]*TxDeliveryTrackingInfo, size)}
+}
+
+// ObserveTx implements TxObserver, overwriting the oldest record if the ring
+// is full.
+func (r *RingTxObserver) ObserveTx(tx *types.Transaction, from common.Address, peer string, arrival time.Time) {
+	info := newTxDeliveryTrackingInfo(tx, from, peer, arrival)
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.records[r.next] = info
+	r.next = (r.next + 1) % len(r.records)
+	if r.next == 0 {
+		r.full = true
+	}
+}
+
+// Records returns the retained records, oldest first.
+func (r *RingTxObserver) Records() []*TxDeliveryTrackingInfo {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	if !r.full {
+		return append([]*TxDeliveryTrackingInfo(nil), r.records[:r.next]...)
+	}
+	records := make([]*TxDeliveryTrackingInfo, 0, len(r.records))
+	records = append(records, r.records[r.next:]...)
+	return append(records, r.records[:r.next]...)
+}
+
+// Close implements TxObserver.
+func (r *RingTxObserver) Close() error {
+	return nil
+}
+
+// asyncTxObserver decouples the pool from a slow sink by queueing the records
+// and handing them over to a writer goroutine. Records are dropped if the
+// writer can't keep up.
+type asyncTxObserver struct {
+	queue   chan *TxDeliveryTrackingInfo
+	write   func(*TxDeliveryTrackingInfo) error // Writes a single record
+	flush   func() error                        // Persists written records once the queue drains (optional)
+	release func() error                        // Releases the sink after the queue was drained
+
+	closed bool          // Whether the queue was closed, guarded by lock
+	lock   sync.RWMutex  // Protects the queue from being used after close
+	done   chan struct{} // Closed when the writer goroutine terminates
+}
+
+func newAsyncTxObserver(write func(*TxDeliveryTrackingInfo) error, flush func() error, release func() error) *asyncTxObserver {
+	a := &asyncTxObserver{
+		queue:   make(chan *TxDeliveryTrackingInfo, txObserverQueueSize),
+		write:   write,
+		flush:   flush,
+		release: release,
+		done:    make(chan struct{}),
+	}
+	go a.loop()
+	return a
+}
+
+func (a *asyncTxObserver) loop() {
+	defer close(a.done)
+
+	for info := range a.queue {
+		if err := a.write(info); err != nil {
+			log.Warn("Failed to write tx delivery record", "hash", info.Hash, "err", err)
+		}
+		if a.flush != nil && len(a.queue) == 0 {
+			if err := a.flush(); err != nil {
+				log.Warn("Failed to sync tx delivery records", "err", err)
+			}
+		}
+	}
+}
+
+// ObserveTx implements TxObserver.
+func (a *asyncTxObserver) ObserveTx(tx *types.Transaction, from common.Address, peer string, arrival time.Time) {
+	a.lock.RLock()
+	defer a.lock.RUnlock()
+
+	if a.closed {
+		return
+	}
+	select {
+	case a.queue <- newTxDeliveryTrackingInfo(tx, from, peer, arrival):
+	default:
+		txObserverDropMeter.Mark(1)
+	}
+}
+
+// Close implements TxObserver, waiting for the queued records to be written.
+func (a *asyncTxObserver) Close() error {
+	a.lock.Lock()
+	if a.closed {
+		a.lock.Unlock()
+		return nil
+	}
+	a.closed = true
+	close(a.queue)
+	a.lock.Unlock()
+
+	<-a.done
+	return a.release()
+}
+
+// FileTxObserver appends the tracking records to a file as JSON lines.
+type FileTxObserver struct {
+	*asyncTxObserver
+	file *os.File
+}
+
+// NewFileTxObserver creates a sink appending to the given file.
+func NewFileTxObserver(path string) (*FileTxObserver, error) {
+	if path == "" {
+		return nil, errors.New("tx observer file sink requires a path")
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		buf = bufio.NewWriter(file)
+		enc = json.NewEncoder(buf)
+	)
+	write := func(info *TxDeliveryTrackingInfo) error {
+		return enc.Encode(info)
+	}
+	release := func() error {
+		if err := buf.Flush(); err != nil {
+			file.Close()
+			return err
+		}
+		return file.Close()
+	}
+	return &FileTxObserver{
+		asyncTxObserver: newAsyncTxObserver(write, buf.Flush, release),
+		file:            file,
+	}, nil
+}
+
+// MongoTxObserver inserts the tracking records into a MongoDB collection.
+type MongoTxObserver struct {
+	*asyncTxObserver
+	client *mongo.Client
+}
+
+// NewMongoTxObserver creates a sink writing into the given mongo collection.
+// The connection is established lazily by the driver.
+func NewMongoTxObserver(uri string, db string, collection string) (*MongoTxObserver, error) {
+	client, err := mongo.Connect(context.Background(), options.Client().ApplyURI(uri))
+	if err != nil {
+		return nil, err
+	}
+	coll := client.Database(db).Collection(collection)
+
+	write := func(info *TxDeliveryTrackingInfo) error {
+		ctx, cancel := context.WithTimeout(context.Background(), txObserverWriteTimeout)
+		defer cancel()
+
+		_, err := coll.InsertOne(ctx, info)
+		return err
+	}
+	release := func() error {
+		ctx, cancel := context.WithTimeout(context.Background(), txObserverWriteTimeout)
+		defer cancel()
+
+		return client.Disconnect(ctx)
+	}
+	return &MongoTxObserver{
+		asyncTxObserver: newAsyncTxObserver(write, nil, release),
+		client:          client,
+	}, nil
+}
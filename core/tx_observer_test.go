@@ -0,0 +1,173 @@
+package core
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+func observedTransaction(nonce uint64, to common.Address, data []byte) *types.Transaction {
+	return types.NewTransaction(nonce, to, big.NewInt(0), 100000, big.NewInt(1), data)
+}
+
+// Tests that the method selector and address filters are combined correctly.
+func TestTxObserverFilter(t *testing.T) {
+	var (
+		router = common.HexToAddress("0x10ED43C718714eb63d5aA57B78B54704E256024E")
+		other  = common.HexToAddress("0x0000000000000000000000000000000000000001")
+		swap   = common.FromHex("0x38ed1739deadbeef")
+		xfer   = common.FromHex("0xa9059cbbdeadbeef")
+	)
+	tests := []struct {
+		methods   []string
+		addresses []common.Address
+		tx        *types.Transaction
+		match     bool
+	}{
+		{nil, nil, observedTransaction(0, other, nil), true},
+		{[]string{"0x38ed1739"}, nil, observedTransaction(0, other, swap), true},
+		{[]string{"38ed1739"}, nil, observedTransaction(0, other, swap), true},
+		{[]string{"0x38ed1739"}, nil, observedTransaction(0, other, xfer), false},
+		{[]string{"0x38ed1739"}, nil, observedTransaction(0, other, nil), false},
+		{nil, []common.Address{router}, observedTransaction(0, router, xfer), true},
+		{nil, []common.Address{router}, observedTransaction(0, other, xfer), false},
+		{[]string{"0x38ed1739"}, []common.Address{router}, observedTransaction(0, router, swap), true},
+		{[]string{"0x38ed1739"}, []common.Address{router}, observedTransaction(0, other, swap), false},
+		{[]string{"0x38ed1739"}, []common.Address{router}, observedTransaction(0, router, xfer), false},
+	}
+	for i, tt := range tests {
+		filter, err := NewFilteredTxObserver(NewRingTxObserver(1), tt.methods, tt.addresses)
+		if err != nil {
+			t.Fatalf("test %d: failed to create filter: %v", i, err)
+		}
+		if have := filter.Match(tt.tx); have != tt.match {
+			t.Errorf("test %d: match mismatch: have %v, want %v", i, have, tt.match)
+		}
+	}
+	// Ensure malformed selectors are rejected
+	for _, method := range []string{"0x38ed17", "nothex", "0x38ed173900"} {
+		if _, err := NewFilteredTxObserver(NewRingTxObserver(1), []string{method}, nil); err == nil {
+			t.Errorf("selector %q: expected error", method)
+		}
+	}
+}
+
+// Tests that the memory sink retains the most recent records in arrival order.
+func TestRingTxObserver(t *testing.T) {
+	ring := NewRingTxObserver(3)
+	if records := ring.Records(); len(records) != 0 {
+		t.Fatalf("empty ring has %d records", len(records))
+	}
+	for i := 0; i < 5; i++ {
+		ring.ObserveTx(observedTransaction(uint64(i), common.Address{}, nil), common.Address{}, "peer", time.Now())
+
+		records := ring.Records()
+		if want := i + 1; want > 3 && len(records) != 3 || want <= 3 && len(records) != want {
+			t.Fatalf("step %d: record count mismatch: have %d", i, len(records))
+		}
+		if last := records[len(records)-1]; last.Nonce != uint64(i) {
+			t.Fatalf("step %d: newest record mismatch: have nonce %d", i, last.Nonce)
+		}
+	}
+	for i, record := range ring.Records() {
+		if record.Nonce != uint64(i+2) {
+			t.Errorf("record %d: nonce mismatch: have %d, want %d", i, record.Nonce, i+2)
+		}
+	}
+}
+
+// Tests that the file sink writes one JSON record per line and flushes them all
+// on close.
+func TestFileTxObserver(t *testing.T) {
+	dir, err := ioutil.TempDir("", "txobserver")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "txs.jsonl")
+	observer, err := NewTxObserver(TxObserverConfig{Sink: TxObserverSinkFile, Path: path, Methods: []string{"0x38ed1739"}})
+	if err != nil {
+		t.Fatalf("failed to create observer: %v", err)
+	}
+	key, _ := crypto.GenerateKey()
+	from := crypto.PubkeyToAddress(key.PublicKey)
+
+	for i := 0; i < 10; i++ {
+		data := common.FromHex("0xa9059cbb")
+		if i%2 == 0 {
+			data = common.FromHex("0x38ed1739")
+		}
+		observer.ObserveTx(observedTransaction(uint64(i), common.Address{}, data), from, "peer", time.Now())
+	}
+	if err := observer.Close(); err != nil {
+		t.Fatalf("failed to close observer: %v", err)
+	}
+	// Observing after close must be a noop
+	observer.ObserveTx(observedTransaction(100, common.Address{}, nil), from, "peer", time.Now())
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("failed to open output: %v", err)
+	}
+	defer file.Close()
+
+	var nonces []uint64
+	for scanner := bufio.NewScanner(file); scanner.Scan(); {
+		var info TxDeliveryTrackingInfo
+		if err := json.Unmarshal(scanner.Bytes(), &info); err != nil {
+			t.Fatalf("failed to decode record: %v", err)
+		}
+		if info.MethodId != "38ed1739" || info.Peer != "peer" || info.From != from.String() {
+			t.Errorf("record mismatch: %+v", info)
+		}
+		nonces = append(nonces, info.Nonce)
+	}
+	if len(nonces) != 5 {
+		t.Fatalf("record count mismatch: have %d, want %d", len(nonces), 5)
+	}
+	for i, nonce := range nonces {
+		if nonce != uint64(2*i) {
+			t.Errorf("record %d: nonce mismatch: have %d, want %d", i, nonce, 2*i)
+		}
+	}
+}
+
+// Tests that the pool notifies the observer about remote transactions only.
+func TestTxPoolObserver(t *testing.T) {
+	t.Parallel()
+
+	pool, key := setupTxPool()
+	defer pool.Stop()
+
+	ring := NewRingTxObserver(16)
+	pool.SetObserver(ring)
+
+	account := crypto.PubkeyToAddress(key.PublicKey)
+	pool.currentState.AddBalance(account, big.NewInt(1000000000))
+
+	if err := pool.AddLocal(transaction(0, 100000, key)); err != nil {
+		t.Fatalf("failed to add local transaction: %v", err)
+	}
+	remote := transaction(1, 100000, key)
+	remote.PeerID = "remote-peer"
+	if err := pool.addRemoteSync(remote); err != nil {
+		t.Fatalf("failed to add remote transaction: %v", err)
+	}
+	records := ring.Records()
+	if len(records) != 1 {
+		t.Fatalf("record count mismatch: have %d, want %d", len(records), 1)
+	}
+	if records[0].Hash != remote.Hash().String() || records[0].Peer != "remote-peer" || records[0].From != account.String() {
+		t.Fatalf("record mismatch: %+v", records[0])
+	}
+}
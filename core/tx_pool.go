@@ -17,7 +17,6 @@
 package core
 
 import (
-	"context"
 	"errors"
 	"math"
 	"math/big"
@@ -33,8 +32,6 @@ import (
 	"github.com/ethereum/go-ethereum/log"
 	"github.com/ethereum/go-ethereum/metrics"
 	"github.com/ethereum/go-ethereum/params"
-	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 const (
@@ -111,6 +108,10 @@ var (
 	queuedNofundsMeter   = metrics.NewRegisteredMeter("txpool/queued/nofunds", nil)   // Dropped due to out-of-funds
 	queuedEvictionMeter  = metrics.NewRegisteredMeter("txpool/queued/eviction", nil)  // Dropped due to lifetime
 
+	// Metrics for the private transactions
+	privateTxMeter      = metrics.NewRegisteredMeter("txpool/private", nil)
+	privateExpiredMeter = metrics.NewRegisteredMeter("txpool/private/expired", nil) // Dropped due to private lifetime
+
 	// General tx metrics
 	knownTxMeter       = metrics.NewRegisteredMeter("txpool/known", nil)
 	validTxMeter       = metrics.NewRegisteredMeter("txpool/valid", nil)
@@ -159,8 +160,13 @@ type TxPoolConfig struct {
 	AccountQueue uint64 // Maximum number of non-executable transaction slots permitted per account
 	GlobalQueue  uint64 // Maximum number of non-executable transaction slots for all accounts
 
-	Lifetime       time.Duration // Maximum amount of time non-executable transaction are queued
-	ReannounceTime time.Duration // Duration for announcing local pending transactions again
+	Lifetime        time.Duration // Maximum amount of time non-executable transaction are queued
+	ReannounceTime  time.Duration // Duration for announcing local pending transactions again
+	PrivateLifetime uint64        // Number of blocks private transactions are kept in the pool
+
+	Rules string // JSON file of the content rules applied to remote transactions, local ones are exempt
+
+	Observer TxObserverConfig // Delivery tracking of accepted remote transactions
 }
 
 // DefaultTxPoolConfig contains the default configurations for the transaction
@@ -177,8 +183,11 @@ var DefaultTxPoolConfig = TxPoolConfig{
 	AccountQueue: 64,
 	GlobalQueue:  1024,
 
-	Lifetime:       3 * time.Hour,
-	ReannounceTime: 10 * 365 * 24 * time.Hour,
+	Lifetime:        3 * time.Hour,
+	ReannounceTime:  10 * 365 * 24 * time.Hour,
+	PrivateLifetime: 20,
+
+	Observer: DefaultTxObserverConfig,
 }
 
 // sanitize checks the provided user configurations and changes anything that's
@@ -221,6 +230,10 @@ func (config *TxPoolConfig) sanitize() TxPoolConfig {
 		log.Warn("Sanitizing invalid txpool reannounce time", "provided", conf.ReannounceTime, "updated", time.Minute)
 		conf.ReannounceTime = time.Minute
 	}
+	if conf.PrivateLifetime < 1 {
+		log.Warn("Sanitizing invalid txpool private lifetime", "provided", conf.PrivateLifetime, "updated", DefaultTxPoolConfig.PrivateLifetime)
+		conf.PrivateLifetime = DefaultTxPoolConfig.PrivateLifetime
+	}
 	return conf
 }
 
@@ -267,8 +280,10 @@ type TxPool struct {
 	reorgShutdownCh chan struct{}  // requests shutdown of scheduleReorgLoop
 	wg              sync.WaitGroup // tracks loop, scheduleReorgLoop
 
-	//AMH: cache for tx delivery data
-	mongoClient *mongo.Client //amh: used for bot tracking
+	observer TxObserver     // Optional sink notified about accepted remote transactions
+	meta     *txMetaTracker // Provenance of recently seen transactions
+	private  *txPrivateSet  // Transactions not to be propagated to the network
+	rules    *txRuleSet     // Content rules applied to remote transactions
 }
 
 type txpoolResetRequest struct {
@@ -298,11 +313,24 @@ func NewTxPool(config TxPoolConfig, chainconfig *params.ChainConfig, chain block
 		reorgDoneCh:     make(chan chan struct{}),
 		reorgShutdownCh: make(chan struct{}),
 		gasPrice:        new(big.Int).SetUint64(config.PriceLimit),
+		meta:            newTxMetaTracker(txMetaCacheSize),
+		private:         newTxPrivateSet(),
 	}
 
-	//amh: create client for mongo to track bot txs
-	if enableTxDeliveryLoggingForBots || enableTxDeliveryLoggingForMyArb {
-		pool.mongoClient, _ = mongo.Connect(context.Background(), options.Client().ApplyURI(MongoUri))
+	if observer, err := NewTxObserver(config.Observer); err != nil {
+		log.Warn("Failed to create tx observer, delivery tracking disabled", "sink", config.Observer.Sink, "err", err)
+	} else if observer != nil {
+		log.Info("Tracking transaction delivery", "sink", config.Observer.Sink)
+		pool.observer = observer
+	}
+
+	if config.Rules != "" {
+		rules, err := LoadTxPoolRules(config.Rules)
+		if err != nil {
+			log.Crit("Failed to load txpool rules", "file", config.Rules, "err", err)
+		}
+		pool.rules, _ = newTxRuleSet(rules) // already validated
+		log.Info("Loaded txpool rules", "file", config.Rules, "rules", len(pool.rules.rules))
 	}
 
 	pool.locals = newAccountSet(pool.signer)
@@ -393,7 +421,7 @@ func (pool *TxPool) loop() {
 					continue
 				}
 				// Any non-locals old enough should be removed
-				if time.Since(pool.beats[addr]) > pool.config.Lifetime {
+				if time.Since(pool.beats[addr]) > pool.lifetime(addr) {
 					list := pool.queue[addr].Flatten()
 					for _, tx := range list {
 						pool.removeTx(tx.Hash(), true)
@@ -417,6 +445,9 @@ func (pool *TxPool) loop() {
 						if time.Since(tx.Time()) < pool.config.ReannounceTime {
 							break
 						}
+						if pool.private.contains(tx.Hash()) {
+							continue
+						}
 						txs = append(txs, tx)
 						if len(txs) >= txReannoMaxNum {
 							return txs
@@ -455,6 +486,14 @@ func (pool *TxPool) Stop() {
 	if pool.journal != nil {
 		pool.journal.close()
 	}
+	pool.mu.Lock()
+	if pool.observer != nil {
+		if err := pool.observer.Close(); err != nil {
+			log.Warn("Failed to close tx observer", "err", err)
+		}
+		pool.observer = nil
+	}
+	pool.mu.Unlock()
 	log.Info("Transaction pool stopped")
 }
 
@@ -575,6 +614,20 @@ func (pool *TxPool) local() map[common.Address]types.Transactions {
 			txs[addr] = append(txs[addr], queued.Flatten()...)
 		}
 	}
+	// Private transactions are short lived, don't persist them
+	for addr, list := range txs {
+		public := list[:0]
+		for _, tx := range list {
+			if !pool.private.contains(tx.Hash()) {
+				public = append(public, tx)
+			}
+		}
+		if len(public) == 0 {
+			delete(txs, addr)
+		} else {
+			txs[addr] = public
+		}
+	}
 	return txs
 }
 
@@ -603,8 +656,14 @@ func (pool *TxPool) validateTx(tx *types.Transaction, local bool) error {
 	if err != nil {
 		return ErrInvalidSender
 	}
+	// Drop non-local transactions refused by the configured content rules
+	rule := pool.rules.match(from, tx)
+	if !local && !pool.rules.accepts(rule) {
+		ruleRejectedTxMeter.Mark(1)
+		return ErrTxRuleRejected
+	}
 	// Drop non-local transactions under our own minimal accepted gas price
-	if !local && tx.GasPriceIntCmp(pool.gasPrice) < 0 {
+	if !local && tx.GasPriceIntCmp(pool.minGasPrice(rule)) < 0 {
 		return ErrUnderpriced
 	}
 	// Ensure the transaction adheres to nonce ordering
@@ -646,11 +705,6 @@ func (pool *TxPool) add(tx *types.Transaction, local bool) (replaced bool, err e
 	// the sender is marked as local previously, treat it as the local transaction.
 	isLocal := local || pool.locals.containsTx(tx)
 
-	//AMH: if the tx method is the arb bot we want to track then log it to mongo
-	if enableTxDeliveryLoggingForBots || enableTxDeliveryLoggingForMyArb {
-		pool.checkForArbBotAndLogIfSeen(tx)
-	}
-
 	//AMH: if this is for my arb contract then always insert into pool so we can broadcast our stuff no matter what..
 	if tx.To() != nil && (tx.To().String() == ArbFlashSwapAddress || tx.To().String() == DodoArbAddress) {
 		// tx", "hash", tx.Hash().String())
@@ -660,14 +714,11 @@ func (pool *TxPool) add(tx *types.Transaction, local bool) (replaced bool, err e
 		pool.priced.Put(tx, false)
 		pool.queueTxEvent(tx)
 		// pool.txFeed.Send(NewTxsEvent{[]*types.Transaction{tx}})
+		pool.meta.accepted(tx, local)
+		pool.observeTx(tx, local)
 		return false, nil
 	}
 
-	//AMH: skip tx of not accepted by our customizations
-	if txAllowedForBotsAndArbContractOnly && !pool.txIsToRouterOrArbAddress(tx) && !pool.txIsToAllowedBotMethod(tx) {
-		return false, ErrNotToRouter
-	}
-
 	// If the transaction fails basic validation, discard it
 	if err := pool.validateTx(tx, isLocal); err != nil {
 		//log.Trace("Discarding invalid transaction", "hash", hash, "err", err)
@@ -723,7 +774,7 @@ func (pool *TxPool) add(tx *types.Transaction, local bool) (replaced bool, err e
 	from, _ := types.Sender(pool.signer, tx) // already validated
 	if list := pool.pending[from]; list != nil && list.Overlaps(tx) {
 		// Nonce already pending, check if required price bump is met
-		inserted, old := list.Add(tx, pool.config.PriceBump)
+		inserted, old := list.Add(tx, pool.priceBump(from, tx, isLocal))
 		if !inserted {
 			pendingDiscardMeter.Mark(1)
 			return false, ErrReplaceUnderpriced
@@ -732,6 +783,7 @@ func (pool *TxPool) add(tx *types.Transaction, local bool) (replaced bool, err e
 		if old != nil {
 			pool.all.Remove(old.Hash())
 			pool.priced.Removed(1)
+			pool.meta.replaced(old, tx)
 			pendingReplaceMeter.Mark(1)
 		}
 		pool.all.Add(tx, isLocal)
@@ -742,6 +794,8 @@ func (pool *TxPool) add(tx *types.Transaction, local bool) (replaced bool, err e
 
 		// Successful promotion, bump the heartbeat
 		pool.beats[from] = time.Now()
+		pool.meta.accepted(tx, local)
+		pool.observeTx(tx, local)
 		return old != nil, nil
 	}
 	// New transaction isn't replacing a pending one, push into queue
@@ -759,6 +813,8 @@ func (pool *TxPool) add(tx *types.Transaction, local bool) (replaced bool, err e
 		localGauge.Inc(1)
 	}
 	pool.journalTx(from, tx)
+	pool.meta.accepted(tx, local)
+	pool.observeTx(tx, local)
 
 	//log.Trace("Pooled new future transaction", "hash", hash, "from", from, "to", tx.To())
 	return replaced, nil
@@ -773,7 +829,7 @@ func (pool *TxPool) enqueueTx(hash common.Hash, tx *types.Transaction, local boo
 	if pool.queue[from] == nil {
 		pool.queue[from] = newTxList(false)
 	}
-	inserted, old := pool.queue[from].Add(tx, pool.config.PriceBump)
+	inserted, old := pool.queue[from].Add(tx, pool.priceBump(from, tx, local))
 	if !inserted {
 		// An older transaction was better, discard this
 		queuedDiscardMeter.Mark(1)
@@ -783,6 +839,7 @@ func (pool *TxPool) enqueueTx(hash common.Hash, tx *types.Transaction, local boo
 	if old != nil {
 		pool.all.Remove(old.Hash())
 		pool.priced.Removed(1)
+		pool.meta.replaced(old, tx)
 		queuedReplaceMeter.Mark(1)
 	} else {
 		// Nothing was replaced, bump the queued counter
@@ -807,8 +864,8 @@ func (pool *TxPool) enqueueTx(hash common.Hash, tx *types.Transaction, local boo
 // journalTx adds the specified transaction to the local disk journal if it is
 // deemed to have been sent from a local account.
 func (pool *TxPool) journalTx(from common.Address, tx *types.Transaction) {
-	// Only journal if it's enabled and the transaction is local
-	if pool.journal == nil || !pool.locals.contains(from) {
+	// Only journal if it's enabled and the transaction is local and public
+	if pool.journal == nil || !pool.locals.contains(from) || pool.private.contains(tx.Hash()) {
 		return
 	}
 	if err := pool.journal.insert(tx); err != nil {
@@ -816,6 +873,59 @@ func (pool *TxPool) journalTx(from common.Address, tx *types.Transaction) {
 	}
 }
 
+// observeTx notifies the tx observer, if any, about an accepted transaction
+// that arrived from the network.
+//
+// Note, this method assumes the pool lock is held!
+func (pool *TxPool) observeTx(tx *types.Transaction, local bool) {
+	if pool.observer == nil || local {
+		return
+	}
+	from, _ := types.Sender(pool.signer, tx) // already validated
+	pool.observer.ObserveTx(tx, from, tx.PeerID, tx.Time())
+}
+
+// SetObserver replaces the sink notified about accepted remote transactions,
+// closing the previous one. A nil observer disables delivery tracking.
+func (pool *TxPool) SetObserver(observer TxObserver) {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	if pool.observer != nil {
+		if err := pool.observer.Close(); err != nil {
+			log.Warn("Failed to close tx observer", "err", err)
+		}
+	}
+	pool.observer = observer
+}
+
+// RecordTxAnnouncements tracks that a peer announced the availability of a
+// batch of transactions.
+func (pool *TxPool) RecordTxAnnouncements(peer string, hashes []common.Hash, time time.Time) {
+	pool.meta.announced(peer, hashes, time)
+}
+
+// RecordTxDeliveries tracks that a peer delivered a batch of transactions,
+// either as a reply to a request (direct) or as a broadcast.
+func (pool *TxPool) RecordTxDeliveries(peer string, txs []*types.Transaction, direct bool, time time.Time) {
+	pool.meta.delivered(peer, txs, direct, time)
+}
+
+// TxMeta returns the first-seen time and peer provenance of a transaction, or
+// nil if the transaction wasn't seen recently. The metadata is retained after
+// the transaction leaves the pool.
+func (pool *TxPool) TxMeta(hash common.Hash) *TxMeta {
+	return pool.meta.get(hash)
+}
+
+// Observer returns the sink notified about accepted remote transactions.
+func (pool *TxPool) Observer() TxObserver {
+	pool.mu.RLock()
+	defer pool.mu.RUnlock()
+
+	return pool.observer
+}
+
 // promoteTx adds a transaction to the pending (processable) list of transactions
 // and returns whether it was inserted or an older was better.
 //
@@ -827,7 +937,7 @@ func (pool *TxPool) promoteTx(addr common.Address, hash common.Hash, tx *types.T
 	}
 	list := pool.pending[addr]
 
-	inserted, old := list.Add(tx, pool.config.PriceBump)
+	inserted, old := list.Add(tx, pool.priceBump(addr, tx, pool.locals.contains(addr)))
 	if !inserted {
 		// An older transaction was better, discard this
 		pool.all.Remove(hash)
@@ -868,6 +978,50 @@ func (pool *TxPool) AddLocal(tx *types.Transaction) error {
 	return errs[0]
 }
 
+// AddPrivate enqueues a single local transaction into the pool, marking it as
+// private: it's neither broadcast nor announced to the network, only relayed to
+// the trusted peers, and it's dropped if not included within the configured
+// number of blocks.
+func (pool *TxPool) AddPrivate(tx *types.Transaction) error {
+	if _, err := types.Sender(pool.signer, tx); err != nil {
+		invalidTxMeter.Mark(1)
+		return ErrInvalidSender
+	}
+	// The lookup, the marking and the insertion are done under the pool lock, so
+	// a copy of the transaction arriving from the network in between can neither
+	// be propagated nor be marked private after the fact.
+	hash := tx.Hash()
+
+	pool.mu.Lock()
+	if pool.all.Get(hash) != nil {
+		// The transaction might have been propagated already
+		pool.mu.Unlock()
+		knownTxMeter.Mark(1)
+		return ErrAlreadyKnown
+	}
+	pool.private.add(hash, pool.chain.CurrentBlock().NumberU64()+pool.config.PrivateLifetime)
+	errs, dirtyAddrs := pool.addTxsLocked([]*types.Transaction{tx}, !pool.config.NoLocals)
+	if errs[0] != nil {
+		pool.private.remove(hash)
+	}
+	pool.mu.Unlock()
+
+	if errs[0] != nil {
+		return errs[0]
+	}
+	privateTxMeter.Mark(1)
+
+	// Reorg the pool internals synchronously, same as for local transactions
+	<-pool.requestPromoteExecutables(dirtyAddrs)
+	return nil
+}
+
+// IsPrivate reports whether a transaction was added as private and must not be
+// propagated to the network.
+func (pool *TxPool) IsPrivate(hash common.Hash) bool {
+	return pool.private.contains(hash)
+}
+
 // AddRemotes enqueues a batch of transactions into the pool if they are valid. If the
 // senders are not among the locally tracked ones, full pricing constraints will apply.
 //
@@ -1187,6 +1341,9 @@ func (pool *TxPool) runReorg(done chan struct{}, reset *txpoolResetRequest, dirt
 	// because of another transaction (e.g. higher gas price).
 	if reset != nil {
 		pool.demoteUnexecutables()
+		if reset.newHead != nil {
+			pool.expirePrivate(reset.newHead.Number.Uint64())
+		}
 	}
 	// Ensure pool.queue and pool.pending sizes stay within the configured limits.
 	pool.truncatePending()
@@ -1216,6 +1373,23 @@ func (pool *TxPool) runReorg(done chan struct{}, reset *txpoolResetRequest, dirt
 	}
 }
 
+// expirePrivate drops the private transactions which weren't included within
+// their lifetime.
+//
+// Note, this method assumes the pool lock is held!
+func (pool *TxPool) expirePrivate(number uint64) {
+	if pool.private.len() == 0 {
+		return
+	}
+	expired := pool.private.expire(number, func(hash common.Hash) bool {
+		return pool.all.Get(hash) != nil
+	})
+	for _, hash := range expired {
+		pool.removeTx(hash, true)
+	}
+	privateExpiredMeter.Mark(int64(len(expired)))
+}
+
 // reset retrieves the current state of the blockchain and ensures the content
 // of the transaction pool is valid with regard to the chain state.
 func (pool *TxPool) reset(oldHead, newHead *types.Header) {
@@ -1349,7 +1523,7 @@ func (pool *TxPool) promoteExecutables(accounts []common.Address) []*types.Trans
 		// Drop all transactions over the allowed limit
 		var caps types.Transactions
 		if !pool.locals.contains(addr) {
-			caps = list.Cap(int(pool.config.AccountQueue))
+			caps = list.Cap(int(pool.accountQueue(addr)))
 			for _, tx := range caps {
 				hash := tx.Hash()
 				pool.all.Remove(hash)
@@ -1389,7 +1563,7 @@ func (pool *TxPool) truncatePending() {
 	spammers := prque.New(nil)
 	for addr, list := range pool.pending {
 		// Only evict transactions from high rollers
-		if !pool.locals.contains(addr) && uint64(len(list.txs.items)) > pool.config.AccountSlots {
+		if !pool.locals.contains(addr) && uint64(len(list.txs.items)) > pool.accountSlots(addr) {
 			spammers.Push(addr, int64(len(list.txs.items)))
 		}
 	}
@@ -1405,11 +1579,15 @@ func (pool *TxPool) truncatePending() {
 			// Calculate the equalization threshold for all current offenders
 			threshold := len(pool.pending[offender.(common.Address)].txs.items)
 
-			// Iteratively reduce all offenders until below limit or threshold reached
-			for pending > pool.config.GlobalSlots && len(pool.pending[offenders[len(offenders)-2]].txs.items) > threshold {
+			// Iteratively reduce all offenders until below limit or threshold reached,
+			// never capping an account below its own allowance
+			for pending > pool.config.GlobalSlots {
+				dropped := false
 				for i := 0; i < len(offenders)-1; i++ {
 					list := pool.pending[offenders[i]]
-
+					if len(list.txs.items) <= threshold || uint64(len(list.txs.items)) <= pool.accountSlots(offenders[i]) {
+						continue
+					}
 					caps := list.Cap(len(list.txs.items) - 1)
 					for _, tx := range caps {
 						// Drop the transaction from the global pools too
@@ -1426,6 +1604,10 @@ func (pool *TxPool) truncatePending() {
 						localGauge.Dec(int64(len(caps)))
 					}
 					pending--
+					dropped = true
+				}
+				if !dropped {
+					break
 				}
 			}
 		}
@@ -1433,10 +1615,13 @@ func (pool *TxPool) truncatePending() {
 
 	// If still above threshold, reduce to limit or min allowance
 	if pending > pool.config.GlobalSlots && len(offenders) > 0 {
-		for pending > pool.config.GlobalSlots && uint64(len(pool.pending[offenders[len(offenders)-1]].txs.items)) > pool.config.AccountSlots {
+		for pending > pool.config.GlobalSlots {
+			dropped := false
 			for _, addr := range offenders {
 				list := pool.pending[addr]
-
+				if uint64(len(list.txs.items)) <= pool.accountSlots(addr) {
+					continue
+				}
 				caps := list.Cap(len(list.txs.items) - 1)
 				for _, tx := range caps {
 					// Drop the transaction from the global pools too
@@ -1453,6 +1638,10 @@ func (pool *TxPool) truncatePending() {
 					localGauge.Dec(int64(len(caps)))
 				}
 				pending--
+				dropped = true
+			}
+			if !dropped {
+				break
 			}
 		}
 	}
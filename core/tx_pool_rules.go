@@ -0,0 +1,356 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+)
+
+var (
+	// ErrTxRuleRejected is returned if a remote transaction is refused by the
+	// content rules configured for the pool.
+	ErrTxRuleRejected = errors.New("transaction rejected by txpool rules")
+
+	// errNoTxPoolRules is returned if the rules are reloaded without a rules
+	// file being configured.
+	errNoTxPoolRules = errors.New("no txpool rules file configured")
+
+	ruleRejectedTxMeter = metrics.NewRegisteredMeter("txpool/rules/rejected", nil)
+)
+
+// Actions a txpool rule can take on the transactions it matches.
+const (
+	TxPoolRuleAccept = "accept" // Matching transactions are accepted, all others are rejected
+	TxPoolRuleReject = "reject" // Matching transactions are rejected
+)
+
+// TxPoolRules is the JSON encoded set of content rules applied to the remote
+// transactions entering the pool. Rules are evaluated in order and the first
+// one matching a transaction decides how it is treated.
+//
+// If any rule has the accept action, the pool only admits the transactions
+// whose first matching rule is an accept one.
+//
+// The rules never apply to local transactions: these are neither rejected nor
+// priced by them, and keep the pool wide price bump and the exemption from the
+// per-account limits.
+type TxPoolRules struct {
+	Rules []TxPoolRule `json:"rules"`
+}
+
+// TxPoolRule selects transactions by sender, destination contract and method
+// selector, and overrides the pool policies for them. Every non-empty criteria
+// must match; an address or selector list matches if any of its entries does.
+//
+// The per-account policies (slots, queue and lifetime) are taken from the first
+// rule matching the account which only selects by sender.
+type TxPoolRule struct {
+	Name      string           `json:"name,omitempty"`
+	Senders   []common.Address `json:"senders,omitempty"`
+	Contracts []common.Address `json:"contracts,omitempty"`
+	Methods   []hexutil.Bytes  `json:"methods,omitempty"`
+	Action    string           `json:"action,omitempty"`
+
+	MinGasPrice  *math.HexOrDecimal256 `json:"minGasPrice,omitempty"`  // Minimum gas price replacing the pool wide limit
+	PriceBump    uint64                `json:"priceBump,omitempty"`    // Price bump percentage to replace a transaction
+	AccountSlots uint64                `json:"accountSlots,omitempty"` // Executable transaction slots guaranteed per account
+	AccountQueue uint64                `json:"accountQueue,omitempty"` // Non-executable transaction slots permitted per account
+	Lifetime     string                `json:"lifetime,omitempty"`     // Maximum time non-executable transactions are queued
+}
+
+// LoadTxPoolRules reads and validates the JSON encoded txpool rules from a file.
+func LoadTxPoolRules(path string) (*TxPoolRules, error) {
+	blob, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	rules := new(TxPoolRules)
+	if err := json.Unmarshal(blob, rules); err != nil {
+		return nil, err
+	}
+	if _, err := newTxRuleSet(rules); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+// txPoolRule is a single txpool rule prepared for fast matching.
+type txPoolRule struct {
+	name      string
+	senders   map[common.Address]struct{}
+	contracts map[common.Address]struct{}
+	methods   map[[4]byte]struct{}
+	action    string
+
+	minGasPrice  *big.Int
+	priceBump    uint64
+	accountSlots uint64
+	accountQueue uint64
+	lifetime     time.Duration
+}
+
+// matches returns whether the rule selects the transaction sent by the given
+// account.
+func (r *txPoolRule) matches(from common.Address, tx *types.Transaction) bool {
+	if r.senders != nil {
+		if _, ok := r.senders[from]; !ok {
+			return false
+		}
+	}
+	if r.contracts != nil {
+		if tx.To() == nil {
+			return false
+		}
+		if _, ok := r.contracts[*tx.To()]; !ok {
+			return false
+		}
+	}
+	if r.methods != nil {
+		data := tx.Data()
+		if len(data) < 4 {
+			return false
+		}
+		var selector [4]byte
+		copy(selector[:], data)
+		if _, ok := r.methods[selector]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// txRuleSet is the compiled form of the txpool rules. A nil set has no rules
+// and leaves all pool policies at their configured values.
+type txRuleSet struct {
+	rules      []*txPoolRule
+	acceptOnly bool
+}
+
+// newTxRuleSet validates the txpool rules and prepares them for matching.
+func newTxRuleSet(rules *TxPoolRules) (*txRuleSet, error) {
+	set := new(txRuleSet)
+	for i, rule := range rules.Rules {
+		compiled := &txPoolRule{
+			name:         rule.Name,
+			action:       rule.Action,
+			priceBump:    rule.PriceBump,
+			accountSlots: rule.AccountSlots,
+			accountQueue: rule.AccountQueue,
+		}
+		if compiled.name == "" {
+			compiled.name = fmt.Sprintf("#%d", i)
+		}
+		switch rule.Action {
+		case "", TxPoolRuleReject:
+		case TxPoolRuleAccept:
+			set.acceptOnly = true
+		default:
+			return nil, fmt.Errorf("rule %s: unknown action %q", compiled.name, rule.Action)
+		}
+		if len(rule.Senders) > 0 {
+			compiled.senders = make(map[common.Address]struct{})
+			for _, addr := range rule.Senders {
+				compiled.senders[addr] = struct{}{}
+			}
+		}
+		if len(rule.Contracts) > 0 {
+			compiled.contracts = make(map[common.Address]struct{})
+			for _, addr := range rule.Contracts {
+				compiled.contracts[addr] = struct{}{}
+			}
+		}
+		if len(rule.Methods) > 0 {
+			compiled.methods = make(map[[4]byte]struct{})
+			for _, method := range rule.Methods {
+				if len(method) != 4 {
+					return nil, fmt.Errorf("rule %s: invalid method selector %s", compiled.name, method)
+				}
+				var selector [4]byte
+				copy(selector[:], method)
+				compiled.methods[selector] = struct{}{}
+			}
+		}
+		if rule.MinGasPrice != nil {
+			compiled.minGasPrice = (*big.Int)(rule.MinGasPrice)
+		}
+		if rule.Lifetime != "" {
+			lifetime, err := time.ParseDuration(rule.Lifetime)
+			if err != nil {
+				return nil, fmt.Errorf("rule %s: invalid lifetime: %v", compiled.name, err)
+			}
+			if lifetime <= 0 {
+				return nil, fmt.Errorf("rule %s: non-positive lifetime %v", compiled.name, lifetime)
+			}
+			compiled.lifetime = lifetime
+		}
+		set.rules = append(set.rules, compiled)
+	}
+	return set, nil
+}
+
+// match returns the first rule selecting the transaction, or nil if none does.
+func (set *txRuleSet) match(from common.Address, tx *types.Transaction) *txPoolRule {
+	if set == nil {
+		return nil
+	}
+	for _, rule := range set.rules {
+		if rule.matches(from, tx) {
+			return rule
+		}
+	}
+	return nil
+}
+
+// account returns the first rule selecting the account by sender only, or nil
+// if none does.
+func (set *txRuleSet) account(addr common.Address) *txPoolRule {
+	if set == nil {
+		return nil
+	}
+	for _, rule := range set.rules {
+		if rule.contracts != nil || rule.methods != nil {
+			continue
+		}
+		if rule.senders == nil {
+			return rule
+		}
+		if _, ok := rule.senders[addr]; ok {
+			return rule
+		}
+	}
+	return nil
+}
+
+// accepts returns whether a transaction whose first matching rule is the given
+// one may enter the pool.
+func (set *txRuleSet) accepts(rule *txPoolRule) bool {
+	if set == nil {
+		return true
+	}
+	if rule == nil {
+		return !set.acceptOnly
+	}
+	if rule.action == TxPoolRuleReject {
+		return false
+	}
+	return !set.acceptOnly || rule.action == TxPoolRuleAccept
+}
+
+// SetRules replaces the content rules of the pool. A nil rule set removes all of
+// them. The transactions already in the pool are not re-evaluated.
+func (pool *TxPool) SetRules(rules *TxPoolRules) error {
+	var set *txRuleSet
+	if rules != nil {
+		var err error
+		if set, err = newTxRuleSet(rules); err != nil {
+			return err
+		}
+	}
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	pool.rules = set
+	if set != nil {
+		log.Info("Updated txpool rules", "rules", len(set.rules), "acceptonly", set.acceptOnly)
+	} else {
+		log.Info("Cleared txpool rules")
+	}
+	return nil
+}
+
+// ReloadRules reads the content rules from the configured rules file again and
+// applies them to the pool.
+func (pool *TxPool) ReloadRules() error {
+	if pool.config.Rules == "" {
+		return errNoTxPoolRules
+	}
+	rules, err := LoadTxPoolRules(pool.config.Rules)
+	if err != nil {
+		return err
+	}
+	return pool.SetRules(rules)
+}
+
+// minGasPrice returns the minimum gas price of the transactions matching the
+// rule.
+//
+// Note, this method assumes the pool lock is held!
+func (pool *TxPool) minGasPrice(rule *txPoolRule) *big.Int {
+	if rule != nil && rule.minGasPrice != nil {
+		return rule.minGasPrice
+	}
+	return pool.gasPrice
+}
+
+// priceBump returns the price bump percentage required to replace a transaction
+// with the given one. Local transactions always use the pool wide price bump.
+//
+// Note, this method assumes the pool lock is held!
+func (pool *TxPool) priceBump(from common.Address, tx *types.Transaction, local bool) uint64 {
+	if local {
+		return pool.config.PriceBump
+	}
+	if rule := pool.rules.match(from, tx); rule != nil && rule.priceBump != 0 {
+		return rule.priceBump
+	}
+	return pool.config.PriceBump
+}
+
+// accountSlots returns the number of executable transaction slots guaranteed to
+// the account.
+//
+// Note, this method assumes the pool lock is held!
+func (pool *TxPool) accountSlots(addr common.Address) uint64 {
+	if rule := pool.rules.account(addr); rule != nil && rule.accountSlots != 0 {
+		return rule.accountSlots
+	}
+	return pool.config.AccountSlots
+}
+
+// accountQueue returns the number of non-executable transaction slots permitted
+// to the account.
+//
+// Note, this method assumes the pool lock is held!
+func (pool *TxPool) accountQueue(addr common.Address) uint64 {
+	if rule := pool.rules.account(addr); rule != nil && rule.accountQueue != 0 {
+		return rule.accountQueue
+	}
+	return pool.config.AccountQueue
+}
+
+// lifetime returns the maximum amount of time the non-executable transactions of
+// the account are queued.
+//
+// Note, this method assumes the pool lock is held!
+func (pool *TxPool) lifetime(addr common.Address) time.Duration {
+	if rule := pool.rules.account(addr); rule != nil && rule.lifetime != 0 {
+		return rule.lifetime
+	}
+	return pool.config.Lifetime
+}
@@ -0,0 +1,207 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"crypto/ecdsa"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/event"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+func callTransaction(nonce uint64, to common.Address, data []byte, gasprice *big.Int, key *ecdsa.PrivateKey) *types.Transaction {
+	tx, _ := types.SignTx(types.NewTransaction(nonce, to, big.NewInt(0), 100000, gasprice, data), types.HomesteadSigner{}, key)
+	return tx
+}
+
+// Tests that the content rules loaded from a file reject, price and limit the
+// remote transactions they match, leaving the local ones alone.
+func TestTxPoolRules(t *testing.T) {
+	t.Parallel()
+
+	pool, key := setupTxPool()
+	defer pool.Stop()
+
+	botKey, _ := crypto.GenerateKey()
+	bot := crypto.PubkeyToAddress(botKey.PublicKey)
+	for _, k := range []*ecdsa.PrivateKey{key, botKey} {
+		pool.currentState.AddBalance(crypto.PubkeyToAddress(k.PublicKey), big.NewInt(1000000000))
+	}
+	spam := common.Address{0xaa}
+
+	if err := pool.ReloadRules(); err != errNoTxPoolRules {
+		t.Fatalf("reload without rules file: have %v, want %v", err, errNoTxPoolRules)
+	}
+	dir, err := ioutil.TempDir("", "txpool-rules")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	pool.config.Rules = filepath.Join(dir, "rules.json")
+	rules := fmt.Sprintf(`{"rules": [
+		{"name": "spam", "contracts": ["%s"], "methods": ["0xdeadbeef"], "action": "reject"},
+		{"name": "bots", "senders": ["%s"], "minGasPrice": "5", "priceBump": 50, "accountSlots": 32, "lifetime": "10m"}
+	]}`, spam.Hex(), bot.Hex())
+	if err := ioutil.WriteFile(pool.config.Rules, []byte(rules), 0600); err != nil {
+		t.Fatalf("failed to write rules: %v", err)
+	}
+	if err := pool.ReloadRules(); err != nil {
+		t.Fatalf("failed to reload rules: %v", err)
+	}
+	// Remote calls of the rejected method are refused, others and locals are not
+	if err := pool.addRemoteSync(callTransaction(0, spam, common.FromHex("0xdeadbeef00"), big.NewInt(1), key)); err != ErrTxRuleRejected {
+		t.Errorf("rejected method call: have %v, want %v", err, ErrTxRuleRejected)
+	}
+	if err := pool.addRemoteSync(callTransaction(0, spam, common.FromHex("0xa9059cbb00"), big.NewInt(1), key)); err != nil {
+		t.Errorf("failed to add other method call: %v", err)
+	}
+	if err := pool.AddLocal(callTransaction(1, spam, common.FromHex("0xdeadbeef00"), big.NewInt(1), key)); err != nil {
+		t.Errorf("failed to add local rejected method call: %v", err)
+	}
+	// Bot transactions need the raised gas price and price bump
+	if err := pool.addRemoteSync(pricedTransaction(0, 100000, big.NewInt(4), botKey)); err != ErrUnderpriced {
+		t.Errorf("underpriced bot transaction: have %v, want %v", err, ErrUnderpriced)
+	}
+	if err := pool.addRemoteSync(pricedTransaction(0, 100000, big.NewInt(10), botKey)); err != nil {
+		t.Fatalf("failed to add bot transaction: %v", err)
+	}
+	if err := pool.addRemoteSync(pricedTransaction(0, 100000, big.NewInt(14), botKey)); err != ErrReplaceUnderpriced {
+		t.Errorf("underpriced bot replacement: have %v, want %v", err, ErrReplaceUnderpriced)
+	}
+	if err := pool.addRemoteSync(pricedTransaction(0, 100000, big.NewInt(15), botKey)); err != nil {
+		t.Errorf("failed to replace bot transaction: %v", err)
+	}
+	pool.mu.RLock()
+	if slots := pool.accountSlots(bot); slots != 32 {
+		t.Errorf("bot account slots mismatch: have %d, want %d", slots, 32)
+	}
+	if slots := pool.accountSlots(crypto.PubkeyToAddress(key.PublicKey)); slots != pool.config.AccountSlots {
+		t.Errorf("account slots mismatch: have %d, want %d", slots, pool.config.AccountSlots)
+	}
+	if lifetime := pool.lifetime(bot); lifetime != 10*time.Minute {
+		t.Errorf("bot lifetime mismatch: have %v, want %v", lifetime, 10*time.Minute)
+	}
+	pool.mu.RUnlock()
+
+	// Local bot transactions only need the pool wide price bump
+	if err := pool.AddLocal(pricedTransaction(1, 100000, big.NewInt(10), botKey)); err != nil {
+		t.Errorf("failed to add local bot transaction: %v", err)
+	}
+	if err := pool.AddLocal(pricedTransaction(1, 100000, big.NewInt(12), botKey)); err != nil {
+		t.Errorf("failed to replace local bot transaction: %v", err)
+	}
+	if err := validateTxPoolInternals(pool); err != nil {
+		t.Fatalf("pool internal state corrupted: %v", err)
+	}
+}
+
+// Tests that accept rules turn the pool into an allowlist, and that the rules
+// can be replaced and removed at runtime.
+func TestTxPoolAcceptRules(t *testing.T) {
+	t.Parallel()
+
+	pool, key := setupTxPool()
+	defer pool.Stop()
+
+	pool.currentState.AddBalance(crypto.PubkeyToAddress(key.PublicKey), big.NewInt(1000000000))
+	router := common.Address{0xbb}
+
+	if err := pool.SetRules(&TxPoolRules{Rules: []TxPoolRule{{Action: "drop"}}}); err == nil {
+		t.Fatalf("rule with unknown action accepted")
+	}
+	if err := pool.SetRules(&TxPoolRules{Rules: []TxPoolRule{{Contracts: []common.Address{router}, Action: TxPoolRuleAccept}}}); err != nil {
+		t.Fatalf("failed to set rules: %v", err)
+	}
+	if err := pool.addRemoteSync(callTransaction(0, common.Address{0xcc}, nil, big.NewInt(1), key)); err != ErrTxRuleRejected {
+		t.Errorf("transaction outside allowlist: have %v, want %v", err, ErrTxRuleRejected)
+	}
+	if err := pool.addRemoteSync(callTransaction(0, router, nil, big.NewInt(1), key)); err != nil {
+		t.Errorf("failed to add allowlisted transaction: %v", err)
+	}
+	if err := pool.SetRules(nil); err != nil {
+		t.Fatalf("failed to clear rules: %v", err)
+	}
+	if err := pool.addRemoteSync(callTransaction(1, common.Address{0xcc}, nil, big.NewInt(1), key)); err != nil {
+		t.Errorf("failed to add transaction after clearing rules: %v", err)
+	}
+}
+
+// Tests that the pending limits enforcement under global pressure never caps an
+// account below the slots guaranteed to it by the rules.
+func TestTxPoolRulesPendingGlobalLimiting(t *testing.T) {
+	t.Parallel()
+
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(rawdb.NewMemoryDatabase()), nil)
+	blockchain := &testBlockChain{statedb, 1000000, new(event.Feed)}
+
+	config := testTxPoolConfig
+	config.AccountSlots = 2
+	config.GlobalSlots = 24
+
+	pool := NewTxPool(config, params.TestChainConfig, blockchain)
+	defer pool.Stop()
+
+	// The bot is guaranteed more slots than the others hold after equalization
+	keys := make([]*ecdsa.PrivateKey, 3)
+	for i := range keys {
+		keys[i], _ = crypto.GenerateKey()
+		pool.currentState.AddBalance(crypto.PubkeyToAddress(keys[i].PublicKey), big.NewInt(1000000000))
+	}
+	bot := crypto.PubkeyToAddress(keys[0].PublicKey)
+	if err := pool.SetRules(&TxPoolRules{Rules: []TxPoolRule{{Senders: []common.Address{bot}, AccountSlots: 14}}}); err != nil {
+		t.Fatalf("failed to set rules: %v", err)
+	}
+	txs := types.Transactions{}
+	for i, count := range []int{18, 12, 10} {
+		for j := 0; j < count; j++ {
+			txs = append(txs, transaction(uint64(j), 100000, keys[i]))
+		}
+	}
+	pool.AddRemotesSync(txs)
+
+	pending := 0
+	for _, list := range pool.pending {
+		pending += list.Len()
+	}
+	if pending > int(config.GlobalSlots) {
+		t.Fatalf("total pending transactions overflow allowance: %d > %d", pending, config.GlobalSlots)
+	}
+	if have := pool.pending[bot].Len(); have != 14 {
+		t.Errorf("bot pending transactions mismatch: have %d, want %d", have, 14)
+	}
+	for _, key := range keys[1:] {
+		if have := pool.pending[crypto.PubkeyToAddress(key.PublicKey)].Len(); have < int(config.AccountSlots) {
+			t.Errorf("pending transactions below allowance: have %d, want at least %d", have, config.AccountSlots)
+		}
+	}
+	if err := validateTxPoolInternals(pool); err != nil {
+		t.Fatalf("pool internal state corrupted: %v", err)
+	}
+}
@@ -0,0 +1,74 @@
+package core
+
+import (
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// txPrivateSet tracks the private transactions of the pool, which must not be
+// propagated to the network, along with the block number they expire at. It
+// has its own lock, so the network handler can query it without contending on
+// the pool lock.
+type txPrivateSet struct {
+	txs  map[common.Hash]uint64 // Transaction hash -> expiry block number
+	lock sync.RWMutex
+}
+
+func newTxPrivateSet() *txPrivateSet {
+	return &txPrivateSet{txs: make(map[common.Hash]uint64)}
+}
+
+// add marks a transaction as private until the given block number.
+func (s *txPrivateSet) add(hash common.Hash, expiry uint64) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.txs[hash] = expiry
+}
+
+// remove unmarks a transaction.
+func (s *txPrivateSet) remove(hash common.Hash) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	delete(s.txs, hash)
+}
+
+// contains checks if a transaction is private.
+func (s *txPrivateSet) contains(hash common.Hash) bool {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	_, ok := s.txs[hash]
+	return ok
+}
+
+// len returns the number of tracked private transactions.
+func (s *txPrivateSet) len() int {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	return len(s.txs)
+}
+
+// expire forgets the transactions which are no longer known, e.g. because they
+// were included, and the ones expiring at the given block number or before. The
+// latter are returned, so they can be dropped.
+func (s *txPrivateSet) expire(number uint64, known func(common.Hash) bool) []common.Hash {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	var expired []common.Hash
+	for hash, expiry := range s.txs {
+		if !known(hash) {
+			delete(s.txs, hash)
+			continue
+		}
+		if expiry <= number {
+			expired = append(expired, hash)
+			delete(s.txs, hash)
+		}
+	}
+	return expired
+}
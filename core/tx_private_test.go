@@ -0,0 +1,111 @@
+package core
+
+import (
+	"crypto/ecdsa"
+	"math/big"
+	"sync"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// Tests that private transactions are executable but kept out of the journal,
+// and dropped if not included within their lifetime.
+func TestTxPoolPrivateTransactions(t *testing.T) {
+	t.Parallel()
+
+	pool, key := setupTxPool()
+	defer pool.Stop()
+
+	publicKey, _ := crypto.GenerateKey()
+	for _, k := range []*ecdsa.PrivateKey{key, publicKey} {
+		pool.currentState.AddBalance(crypto.PubkeyToAddress(k.PublicKey), big.NewInt(1000000000))
+	}
+	private := transaction(0, 100000, key)
+	public := transaction(0, 100000, publicKey)
+
+	if err := pool.AddPrivate(private); err != nil {
+		t.Fatalf("failed to add private transaction: %v", err)
+	}
+	if err := pool.AddLocal(public); err != nil {
+		t.Fatalf("failed to add public transaction: %v", err)
+	}
+	if err := pool.AddPrivate(public); err != ErrAlreadyKnown {
+		t.Errorf("known transaction added as private: have %v, want %v", err, ErrAlreadyKnown)
+	}
+	if !pool.IsPrivate(private.Hash()) {
+		t.Errorf("private transaction not marked private")
+	}
+	if pool.IsPrivate(public.Hash()) {
+		t.Errorf("public transaction marked private")
+	}
+	if pending, _ := pool.Stats(); pending != 2 {
+		t.Fatalf("pending transactions mismatch: have %d, want %d", pending, 2)
+	}
+	// Only the public transaction may be journaled
+	locals := pool.local()
+	if len(locals) != 1 || len(locals[crypto.PubkeyToAddress(publicKey.PublicKey)]) != 1 {
+		t.Errorf("journaled transactions mismatch: have %v", locals)
+	}
+	// The private transaction is kept until its lifetime elapses
+	pool.mu.Lock()
+	pool.expirePrivate(pool.config.PrivateLifetime - 1)
+	pool.mu.Unlock()
+	if pool.Get(private.Hash()) == nil || !pool.IsPrivate(private.Hash()) {
+		t.Fatalf("private transaction dropped before its lifetime")
+	}
+	pool.mu.Lock()
+	pool.expirePrivate(pool.config.PrivateLifetime)
+	pool.mu.Unlock()
+	if pool.Get(private.Hash()) != nil || pool.IsPrivate(private.Hash()) {
+		t.Errorf("private transaction not dropped after its lifetime")
+	}
+	if pool.Get(public.Hash()) == nil {
+		t.Errorf("public transaction dropped")
+	}
+	if err := validateTxPoolInternals(pool); err != nil {
+		t.Fatalf("pool internal state corrupted: %v", err)
+	}
+}
+
+// Tests that a transaction submitted privately and concurrently from elsewhere
+// is added exactly once, and stays private if the private submission won.
+func TestTxPoolPrivateTransactionRace(t *testing.T) {
+	t.Parallel()
+
+	pool, key := setupTxPool()
+	defer pool.Stop()
+
+	pool.currentState.AddBalance(crypto.PubkeyToAddress(key.PublicKey), big.NewInt(1000000000))
+	tx := transaction(0, 100000, key)
+
+	var (
+		wg   sync.WaitGroup
+		errs = make([]error, 8)
+	)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = pool.AddPrivate(tx)
+		}(i)
+	}
+	wg.Wait()
+
+	added := 0
+	for _, err := range errs {
+		switch err {
+		case nil:
+			added++
+		case ErrAlreadyKnown:
+		default:
+			t.Fatalf("failed to add private transaction: %v", err)
+		}
+	}
+	if added != 1 {
+		t.Errorf("added transaction count mismatch: have %d, want %d", added, 1)
+	}
+	if !pool.IsPrivate(tx.Hash()) {
+		t.Errorf("private transaction not marked private")
+	}
+}
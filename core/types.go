@@ -17,6 +17,7 @@
 package core
 
 import (
+	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/state"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/core/vm"
@@ -51,3 +52,11 @@ type Processor interface {
 	// the processor (coinbase) and any included uncles.
 	Process(block *types.Block, statedb *state.StateDB, cfg vm.Config) (*state.StateDB, types.Receipts, []*types.Log, uint64, error)
 }
+
+// StatePruner is an interface for garbage collecting stale state trie nodes
+// while the chain is running.
+type StatePruner interface {
+	// Committed notifies the pruner that the state trie of the given block has
+	// been committed to disk.
+	Committed(root common.Hash, number uint64)
+}
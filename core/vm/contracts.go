@@ -17,10 +17,12 @@
 package vm
 
 import (
+	"bytes"
 	"crypto/sha256"
 	"encoding/binary"
 	"errors"
 	"math/big"
+	"sort"
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/common/math"
@@ -133,16 +135,31 @@ func init() {
 
 // ActivePrecompiles returns the precompiles enabled with the current configuration.
 func ActivePrecompiles(rules params.Rules) []common.Address {
+	var active []common.Address
 	switch {
 	case rules.IsBerlin:
-		return PrecompiledAddressesBerlin
+		active = PrecompiledAddressesBerlin
 	case rules.IsIstanbul:
-		return PrecompiledAddressesIstanbul
+		active = PrecompiledAddressesIstanbul
 	case rules.IsByzantium:
-		return PrecompiledAddressesByzantium
+		active = PrecompiledAddressesByzantium
 	default:
-		return PrecompiledAddressesHomestead
+		active = PrecompiledAddressesHomestead
 	}
+	if len(rules.Precompiles) == 0 {
+		return active
+	}
+	// Append the plug-in precompiles without touching the shared fork lists,
+	// sorted so the list is deterministic
+	plugins := make([]common.Address, 0, len(rules.Precompiles))
+	for addr := range rules.Precompiles {
+		plugins = append(plugins, addr)
+	}
+	sort.Slice(plugins, func(i, j int) bool { return bytes.Compare(plugins[i][:], plugins[j][:]) < 0 })
+
+	extended := make([]common.Address, 0, len(active)+len(plugins))
+	extended = append(extended, active...)
+	return append(extended, plugins...)
 }
 
 // RunPrecompiledContract runs and evaluates the output of a precompiled contract.
@@ -0,0 +1,200 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package vm
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+var (
+	// errStatefulPrecompile is returned if a stateful plug-in precompile is run
+	// without an EVM.
+	errStatefulPrecompile = errors.New("precompile requires the EVM")
+
+	// errInvalidLogInput is returned if the input of the log emitting precompile
+	// cannot be decoded.
+	errInvalidLogInput = errors.New("invalid log input")
+)
+
+// pluginPrecompiles are the precompiled contracts which may be enabled at custom
+// addresses and blocks by the chain config, by name.
+var (
+	pluginPrecompiles    = make(map[string]PrecompiledContract)
+	pluginPrecompileLock sync.RWMutex
+)
+
+func init() {
+	RegisterPrecompile("keccakBatch", &keccakBatch{})
+	RegisterPrecompile("emitLog", &emitLog{})
+}
+
+// RegisterPrecompile makes a precompiled contract available under a name, to be
+// enabled through the Precompiles of the chain config. It is meant to be called
+// from the init function of the package implementing the contract, and panics
+// if the name is empty or already taken.
+func RegisterPrecompile(name string, p PrecompiledContract) {
+	pluginPrecompileLock.Lock()
+	defer pluginPrecompileLock.Unlock()
+
+	if name == "" {
+		panic("vm: precompile registered without name")
+	}
+	if _, ok := pluginPrecompiles[name]; ok {
+		panic("vm: precompile registered twice: " + name)
+	}
+	pluginPrecompiles[name] = p
+}
+
+// pluginPrecompile returns the plug-in precompile registered under a name.
+func pluginPrecompile(name string) (PrecompiledContract, bool) {
+	pluginPrecompileLock.RLock()
+	defer pluginPrecompileLock.RUnlock()
+
+	p, ok := pluginPrecompiles[name]
+	return p, ok
+}
+
+// CheckPrecompiles checks that the plug-in precompiles enabled by a chain config
+// are registered, and that their addresses are neither shared nor taken by the
+// precompiles of any fork, then schedules their activation on the config.
+func CheckPrecompiles(config *params.ChainConfig) error {
+	addresses := make(map[common.Address]string)
+	for _, precompile := range config.Precompiles {
+		if _, ok := pluginPrecompile(precompile.Name); !ok {
+			return fmt.Errorf("unknown precompile %q", precompile.Name)
+		}
+		if name, ok := addresses[precompile.Address]; ok {
+			return fmt.Errorf("precompiles %q and %q share address %x", name, precompile.Name, precompile.Address)
+		}
+		for _, builtins := range []map[common.Address]PrecompiledContract{PrecompiledContractsHomestead, PrecompiledContractsByzantium, PrecompiledContractsIstanbul, PrecompiledContractsBerlin} {
+			if _, ok := builtins[precompile.Address]; ok {
+				return fmt.Errorf("precompile %q address %x taken by a fork", precompile.Name, precompile.Address)
+			}
+		}
+		addresses[precompile.Address] = precompile.Name
+	}
+	config.SchedulePrecompiles()
+	return nil
+}
+
+// PrecompileEnv is the context a stateful plug-in precompile runs in.
+type PrecompileEnv struct {
+	EVM      *EVM
+	Caller   common.Address // Account calling the precompile
+	Address  common.Address // Account whose context the precompile runs in
+	ReadOnly bool           // Whether state modifications are forbidden
+}
+
+// StatefulPrecompiledContract is a plug-in precompile needing access to the
+// state or the block, like one emitting logs. Its gas is charged as for any
+// other precompile, before running.
+type StatefulPrecompiledContract interface {
+	PrecompiledContract
+	RunStateful(env *PrecompileEnv, input []byte) ([]byte, error)
+}
+
+// runPrecompiledContract runs a precompiled contract, giving the stateful ones
+// access to the EVM.
+func (evm *EVM) runPrecompiledContract(p PrecompiledContract, caller, self common.Address, input []byte, suppliedGas uint64, readOnly bool) ([]byte, uint64, error) {
+	stateful, ok := p.(StatefulPrecompiledContract)
+	if !ok {
+		return RunPrecompiledContract(p, input, suppliedGas)
+	}
+	gasCost := p.RequiredGas(input)
+	if suppliedGas < gasCost {
+		return nil, 0, ErrOutOfGas
+	}
+	suppliedGas -= gasCost
+
+	if in, ok := evm.interpreter.(*EVMInterpreter); ok && in.readOnly {
+		readOnly = true
+	}
+	output, err := stateful.RunStateful(&PrecompileEnv{EVM: evm, Caller: caller, Address: self, ReadOnly: readOnly}, input)
+	return output, suppliedGas, err
+}
+
+// keccakBatch hashes each 32 byte word of its input, returning the hashes in
+// order. A trailing partial word is right padded with zeroes.
+type keccakBatch struct{}
+
+func (c *keccakBatch) RequiredGas(input []byte) uint64 {
+	words := uint64(len(input)+31) / 32
+	return words * (params.Sha3Gas + params.Sha3WordGas)
+}
+
+func (c *keccakBatch) Run(input []byte) ([]byte, error) {
+	words := (len(input) + 31) / 32
+	input = common.RightPadBytes(input, words*32)
+
+	output := make([]byte, 0, words*32)
+	for i := 0; i < words; i++ {
+		output = append(output, crypto.Keccak256(input[i*32:(i+1)*32])...)
+	}
+	return output, nil
+}
+
+// emitLog is a cheatcode emitting a log from the account it runs in. Its input
+// is the number of topics in a byte, the topics and the data of the log.
+type emitLog struct{}
+
+// decode splits the input into the topics and the data of the log.
+func (c *emitLog) decode(input []byte) ([]common.Hash, []byte, error) {
+	if len(input) == 0 || input[0] > 4 || len(input) < 1+int(input[0])*common.HashLength {
+		return nil, nil, errInvalidLogInput
+	}
+	topics := make([]common.Hash, input[0])
+	for i := range topics {
+		topics[i] = common.BytesToHash(input[1+i*common.HashLength : 1+(i+1)*common.HashLength])
+	}
+	return topics, input[1+len(topics)*common.HashLength:], nil
+}
+
+func (c *emitLog) RequiredGas(input []byte) uint64 {
+	topics, data, err := c.decode(input)
+	if err != nil {
+		return params.LogGas
+	}
+	return params.LogGas + uint64(len(topics))*params.LogTopicGas + uint64(len(data))*params.LogDataGas
+}
+
+func (c *emitLog) Run(input []byte) ([]byte, error) {
+	return nil, errStatefulPrecompile
+}
+
+func (c *emitLog) RunStateful(env *PrecompileEnv, input []byte) ([]byte, error) {
+	if env.ReadOnly {
+		return nil, ErrWriteProtection
+	}
+	topics, data, err := c.decode(input)
+	if err != nil {
+		return nil, err
+	}
+	env.EVM.StateDB.AddLog(&types.Log{
+		Address:     env.Address,
+		Topics:      topics,
+		Data:        common.CopyBytes(data),
+		BlockNumber: env.EVM.Context.BlockNumber.Uint64(),
+	})
+	return nil, nil
+}
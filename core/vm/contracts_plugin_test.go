@@ -0,0 +1,107 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package vm
+
+import (
+	"bytes"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// Tests that the plug-in precompiles of the chain config are validated, and
+// activated at their blocks with gas accounting.
+func TestPluginPrecompiles(t *testing.T) {
+	var (
+		hasher  = common.BytesToAddress([]byte{0x01, 0x00})
+		emitter = common.BytesToAddress([]byte{0x01, 0x01})
+		config  = *params.TestChainConfig
+	)
+	config.Precompiles = []params.PrecompileConfig{
+		{Name: "keccakBatch", Address: hasher, Block: big.NewInt(0)},
+		{Name: "emitLog", Address: emitter, Block: big.NewInt(5)},
+	}
+	if err := CheckPrecompiles(&config); err != nil {
+		t.Fatalf("failed to check precompiles: %v", err)
+	}
+	for i, invalid := range [][]params.PrecompileConfig{
+		{{Name: "unknown", Address: hasher}},
+		{{Name: "keccakBatch", Address: hasher}, {Name: "emitLog", Address: hasher}},
+		{{Name: "keccakBatch", Address: common.BytesToAddress([]byte{1})}},
+	} {
+		if err := CheckPrecompiles(&params.ChainConfig{Precompiles: invalid}); err == nil {
+			t.Errorf("invalid precompiles %d accepted", i)
+		}
+	}
+	// Plug-in precompiles are listed from their activation block on
+	if active := ActivePrecompiles(config.Rules(big.NewInt(4))); len(active) != len(PrecompiledAddressesBerlin)+1 {
+		t.Errorf("active precompile count mismatch before activation: have %d, want %d", len(active), len(PrecompiledAddressesBerlin)+1)
+	}
+	active := ActivePrecompiles(config.Rules(big.NewInt(5)))
+	if len(active) != len(PrecompiledAddressesBerlin)+2 {
+		t.Fatalf("active precompile count mismatch after activation: have %d, want %d", len(active), len(PrecompiledAddressesBerlin)+2)
+	}
+	if plugins := active[len(PrecompiledAddressesBerlin):]; plugins[0] != hasher || plugins[1] != emitter {
+		t.Errorf("plug-in precompiles not sorted: have %x", plugins)
+	}
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(rawdb.NewMemoryDatabase()), nil)
+	newEVM := func(number int64) *EVM {
+		vmctx := BlockContext{
+			CanTransfer: func(StateDB, common.Address, *big.Int) bool { return true },
+			Transfer:    func(StateDB, common.Address, common.Address, *big.Int) {},
+			BlockNumber: big.NewInt(number),
+		}
+		return NewEVM(vmctx, TxContext{}, statedb, &config, Config{})
+	}
+	// Hash two words, one of them partial
+	input := append(bytes.Repeat([]byte{0xaa}, 32), 0xbb)
+	want := append(crypto.Keccak256(input[:32]), crypto.Keccak256(common.RightPadBytes(input[32:], 32))...)
+
+	ret, gas, err := newEVM(0).Call(AccountRef(common.Address{}), hasher, input, 100000, new(big.Int))
+	if err != nil {
+		t.Fatalf("failed to call hasher: %v", err)
+	}
+	if !bytes.Equal(ret, want) {
+		t.Errorf("hash mismatch: have %x, want %x", ret, want)
+	}
+	if used := 100000 - gas; used != 2*(params.Sha3Gas+params.Sha3WordGas) {
+		t.Errorf("gas used mismatch: have %d, want %d", used, 2*(params.Sha3Gas+params.Sha3WordGas))
+	}
+	// Emit a log with one topic, only after activation and outside static calls
+	input = append(append([]byte{1}, common.Hash{0x01}.Bytes()...), 0xcc)
+	if _, _, err := newEVM(4).Call(AccountRef(common.Address{}), emitter, input, 100000, new(big.Int)); err != nil || len(statedb.Logs()) != 0 {
+		t.Fatalf("inactive emitter called: err %v, logs %d", err, len(statedb.Logs()))
+	}
+	if _, _, err := newEVM(5).StaticCall(AccountRef(common.Address{}), emitter, input, 100000); err != ErrWriteProtection {
+		t.Errorf("static emitter call: have %v, want %v", err, ErrWriteProtection)
+	}
+	if _, _, err := newEVM(5).Call(AccountRef(common.Address{}), emitter, input, 100000, new(big.Int)); err != nil {
+		t.Fatalf("failed to call emitter: %v", err)
+	}
+	logs := statedb.Logs()
+	if len(logs) != 1 {
+		t.Fatalf("log count mismatch: have %d, want %d", len(logs), 1)
+	}
+	if logs[0].Address != emitter || len(logs[0].Topics) != 1 || logs[0].Topics[0] != (common.Hash{0x01}) || !bytes.Equal(logs[0].Data, []byte{0xcc}) || logs[0].BlockNumber != 5 {
+		t.Errorf("log mismatch: have %+v", logs[0])
+	}
+}
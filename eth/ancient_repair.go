@@ -0,0 +1,273 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package eth
+
+import (
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+	"github.com/ethereum/go-ethereum/trie"
+)
+
+const (
+	ancientRepairBatch   = 64               // Number of items requested from a peer at once
+	ancientRepairTimeout = 10 * time.Second // Time allowance for a peer to answer a repair request
+	ancientRepairCycle   = 3 * time.Second  // Interval between two rounds of repair requests
+)
+
+var (
+	ancientRepairedMeter   = metrics.NewRegisteredMeter("eth/ancient/repaired", nil)
+	ancientUnrepairedMeter = metrics.NewRegisteredMeter("eth/ancient/unrepaired", nil)
+)
+
+// ancientItem identifies an item of an ancient table.
+type ancientItem struct {
+	kind   string
+	number uint64
+}
+
+// ancientRepairRequest is a batch of corrupted items requested from a peer.
+type ancientRepairRequest struct {
+	kind    string
+	headers []*types.Header
+	time    time.Time
+}
+
+// ancientRepairer downloads again the ancient bodies and receipts found corrupted
+// by `geth db verify-ancients`, checks them against the headers of their blocks
+// and overwrites the corrupted items in place. The ranges left are persisted
+// after every repair, so an interrupted repair resumes after a restart.
+type ancientRepairer struct {
+	handler *handler
+
+	ranges   []rawdb.CorruptedRange           // Corrupted ranges left to repair
+	pending  map[string]*ancientRepairRequest // Requests in flight, by peer
+	inflight map[ancientItem]struct{}         // Items requested from any peer
+	lock     sync.Mutex
+
+	quit chan struct{}
+}
+
+// newAncientRepairer creates a repairer for the given corrupted ranges.
+func newAncientRepairer(h *handler, ranges []rawdb.CorruptedRange) *ancientRepairer {
+	return &ancientRepairer{
+		handler:  h,
+		ranges:   ranges,
+		pending:  make(map[string]*ancientRepairRequest),
+		inflight: make(map[ancientItem]struct{}),
+		quit:     make(chan struct{}),
+	}
+}
+
+// start launches the repair loop.
+func (r *ancientRepairer) start() {
+	go r.loop()
+}
+
+// stop terminates the repair loop.
+func (r *ancientRepairer) stop() {
+	close(r.quit)
+}
+
+func (r *ancientRepairer) loop() {
+	defer r.handler.wg.Done()
+
+	ticker := time.NewTicker(ancientRepairCycle)
+	defer ticker.Stop()
+
+	for r.request() {
+		select {
+		case <-ticker.C:
+		case <-r.quit:
+			return
+		}
+	}
+	log.Info("Repaired corrupted ancient items from the network")
+}
+
+// request expires the unanswered requests and asks the idle peers for the
+// corrupted items not in flight. It returns false once no items are left.
+func (r *ancientRepairer) request() bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	for id, req := range r.pending {
+		if time.Since(req.time) > ancientRepairTimeout {
+			r.release(id)
+		}
+	}
+	if len(r.ranges) == 0 {
+		return false
+	}
+	peers := r.handler.peers.headPeers(uint(r.handler.peers.len()))
+	for _, peer := range peers {
+		if _, ok := r.pending[peer.ID()]; ok {
+			continue
+		}
+		req := r.next()
+		if req == nil {
+			break
+		}
+		hashes := make([]common.Hash, len(req.headers))
+		for i, header := range req.headers {
+			hashes[i] = header.Hash()
+		}
+		var err error
+		if req.kind == rawdb.AncientBodies {
+			err = peer.RequestBodies(hashes)
+		} else {
+			err = peer.RequestReceipts(hashes)
+		}
+		if err != nil {
+			peer.Log().Debug("Failed to request corrupted ancient items", "kind", req.kind, "err", err)
+			continue
+		}
+		r.pending[peer.ID()] = req
+		for _, header := range req.headers {
+			r.inflight[ancientItem{req.kind, header.Number.Uint64()}] = struct{}{}
+		}
+	}
+	return true
+}
+
+// next assembles a request for the next batch of corrupted items not in flight.
+// Items without a local header can't be checked, they are dropped from the
+// repair and have to be restored from a backup.
+func (r *ancientRepairer) next() *ancientRepairRequest {
+	db := r.handler.database
+	for _, rng := range r.ranges {
+		var headers []*types.Header
+		for number := rng.From; number <= rng.To && len(headers) < ancientRepairBatch; number++ {
+			if _, ok := r.inflight[ancientItem{rng.Kind, number}]; ok {
+				continue
+			}
+			header := rawdb.ReadHeader(db, rawdb.ReadCanonicalHash(db, number), number)
+			if header == nil {
+				log.Warn("Corrupted ancient item without header, restore it from a backup", "kind", rng.Kind, "number", number)
+				ancientUnrepairedMeter.Mark(1)
+				r.remove(rng.Kind, number)
+				return nil
+			}
+			headers = append(headers, header)
+		}
+		if len(headers) > 0 {
+			return &ancientRepairRequest{kind: rng.Kind, headers: headers, time: time.Now()}
+		}
+	}
+	return nil
+}
+
+// release forgets the request in flight to a peer, its items are requested
+// again from another one.
+func (r *ancientRepairer) release(id string) {
+	req := r.pending[id]
+	if req == nil {
+		return
+	}
+	for _, header := range req.headers {
+		delete(r.inflight, ancientItem{req.kind, header.Number.Uint64()})
+	}
+	delete(r.pending, id)
+}
+
+// remove deletes a single item from the corrupted ranges and persists the
+// ranges left.
+func (r *ancientRepairer) remove(kind string, number uint64) {
+	for i, rng := range r.ranges {
+		if rng.Kind != kind || number < rng.From || number > rng.To {
+			continue
+		}
+		switch {
+		case rng.From == rng.To:
+			r.ranges = append(r.ranges[:i:i], r.ranges[i+1:]...)
+		case number == rng.From:
+			r.ranges[i].From++
+		case number == rng.To:
+			r.ranges[i].To--
+		default:
+			tail := rng
+			tail.From = number + 1
+			r.ranges[i].To = number - 1
+			r.ranges = append(r.ranges[:i+1:i+1], append([]rawdb.CorruptedRange{tail}, r.ranges[i+1:]...)...)
+		}
+		break
+	}
+	rawdb.WriteAncientRepairRanges(r.handler.database, r.ranges)
+}
+
+// filterBodies consumes the block bodies answering a repair request to the peer,
+// returning the ones which don't.
+func (r *ancientRepairer) filterBodies(id string, txs [][]*types.Transaction, uncles [][]*types.Header) ([][]*types.Transaction, [][]*types.Header) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	req := r.pending[id]
+	if req == nil || req.kind != rawdb.AncientBodies || len(txs) == 0 || len(txs) > len(req.headers) {
+		return txs, uncles
+	}
+	for i, header := range req.headers[:len(txs)] {
+		if types.DeriveSha(types.Transactions(txs[i]), trie.NewStackTrie(nil)) != header.TxHash || types.CalcUncleHash(uncles[i]) != header.UncleHash {
+			return txs, uncles
+		}
+	}
+	for i, header := range req.headers[:len(txs)] {
+		r.repaired(req.kind, header, rawdb.RepairAncientBody(r.handler.database, header.Number.Uint64(), &types.Body{Transactions: txs[i], Uncles: uncles[i]}))
+	}
+	r.release(id)
+	return nil, nil
+}
+
+// filterReceipts consumes the receipts answering a repair request to the peer,
+// returning the ones which don't.
+func (r *ancientRepairer) filterReceipts(id string, receipts [][]*types.Receipt) [][]*types.Receipt {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	req := r.pending[id]
+	if req == nil || req.kind != rawdb.AncientReceipts || len(receipts) == 0 || len(receipts) > len(req.headers) {
+		return receipts
+	}
+	for i, header := range req.headers[:len(receipts)] {
+		if types.DeriveSha(types.Receipts(receipts[i]), trie.NewStackTrie(nil)) != header.ReceiptHash {
+			return receipts
+		}
+	}
+	for i, header := range req.headers[:len(receipts)] {
+		r.repaired(req.kind, header, rawdb.RepairAncientReceipts(r.handler.database, header.Number.Uint64(), receipts[i]))
+	}
+	r.release(id)
+	return nil
+}
+
+// repaired drops a repaired item from the corrupted ranges. Items failing to be
+// written back, e.g. because the stored item has a different encoding, are
+// dropped as well and have to be restored from a backup.
+func (r *ancientRepairer) repaired(kind string, header *types.Header, err error) {
+	if err != nil {
+		log.Warn("Failed to repair corrupted ancient item, restore it from a backup", "kind", kind, "number", header.Number, "err", err)
+		ancientUnrepairedMeter.Mark(1)
+	} else {
+		log.Info("Repaired corrupted ancient item", "kind", kind, "number", header.Number)
+		ancientRepairedMeter.Mark(1)
+	}
+	r.remove(kind, header.Number.Uint64())
+}
@@ -0,0 +1,92 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package eth
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// Tests that the corrupted ranges are split as items get repaired, and that the
+// ranges left are persisted.
+func TestAncientRepairRanges(t *testing.T) {
+	handler := newTestHandlerWithBlocks(0)
+	defer handler.close()
+
+	repairer := newAncientRepairer(handler.handler, []rawdb.CorruptedRange{
+		{Kind: rawdb.AncientBodies, From: 1, To: 5},
+		{Kind: rawdb.AncientReceipts, From: 3, To: 3},
+	})
+	repairer.remove(rawdb.AncientBodies, 3)
+	repairer.remove(rawdb.AncientBodies, 1)
+	repairer.remove(rawdb.AncientReceipts, 3)
+
+	want := []rawdb.CorruptedRange{
+		{Kind: rawdb.AncientBodies, From: 2, To: 2},
+		{Kind: rawdb.AncientBodies, From: 4, To: 5},
+	}
+	if !reflect.DeepEqual(repairer.ranges, want) {
+		t.Fatalf("ranges mismatch: have %v, want %v", repairer.ranges, want)
+	}
+	if stored := rawdb.ReadAncientRepairRanges(handler.db); !reflect.DeepEqual(stored, want) {
+		t.Fatalf("stored ranges mismatch: have %v, want %v", stored, want)
+	}
+	for _, r := range want {
+		for number := r.From; number <= r.To; number++ {
+			repairer.remove(r.Kind, number)
+		}
+	}
+	if stored := rawdb.ReadAncientRepairRanges(handler.db); len(stored) != 0 {
+		t.Fatalf("stored ranges not deleted: %v", stored)
+	}
+}
+
+// Tests that only the bodies answering a repair request and matching the headers
+// of their blocks are consumed by the repairer.
+func TestAncientRepairFilterBodies(t *testing.T) {
+	handler := newTestHandlerWithBlocks(4)
+	defer handler.close()
+
+	repairer := newAncientRepairer(handler.handler, []rawdb.CorruptedRange{
+		{Kind: rawdb.AncientBodies, From: 1, To: 2},
+	})
+	req := repairer.next()
+	if req == nil || len(req.headers) != 2 {
+		t.Fatalf("unexpected request: %v", req)
+	}
+	repairer.pending["peer"] = req
+
+	// Bodies of unrelated peers and bodies not matching the headers are passed on
+	txs, uncles := make([][]*types.Transaction, 2), make([][]*types.Header, 2)
+	if txs, _ := repairer.filterBodies("other", txs, uncles); len(txs) != 2 {
+		t.Fatalf("bodies of an unrelated peer consumed")
+	}
+	bad := [][]*types.Header{{handler.chain.Genesis().Header()}, nil}
+	if txs, _ := repairer.filterBodies("peer", txs, bad); len(txs) != 2 {
+		t.Fatalf("mismatching bodies consumed")
+	}
+	// Matching bodies are consumed and their items dropped from the ranges
+	if txs, _ := repairer.filterBodies("peer", txs, uncles); len(txs) != 0 {
+		t.Fatalf("matching bodies not consumed")
+	}
+	if len(repairer.ranges) != 0 || len(repairer.pending) != 0 || len(repairer.inflight) != 0 {
+		t.Fatalf("repair not completed: ranges %v, pending %d, inflight %d", repairer.ranges, len(repairer.pending), len(repairer.inflight))
+	}
+}
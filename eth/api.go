@@ -33,8 +33,10 @@ import (
 	"github.com/ethereum/go-ethereum/core"
 	"github.com/ethereum/go-ethereum/core/rawdb"
 	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/state/pruner"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/internal/ethapi"
+	"github.com/ethereum/go-ethereum/miner"
 	"github.com/ethereum/go-ethereum/rlp"
 	"github.com/ethereum/go-ethereum/rpc"
 	"github.com/ethereum/go-ethereum/trie"
@@ -140,6 +142,38 @@ func (api *PrivateMinerAPI) SetRecommitInterval(interval int) {
 	api.e.Miner().SetRecommitInterval(time.Duration(interval) * time.Millisecond)
 }
 
+// SendBundleArgs represents the arguments of a bundle submitted for inclusion at
+// the top of the mined blocks.
+type SendBundleArgs struct {
+	Txs               []hexutil.Bytes `json:"txs"`
+	MinBlockNumber    hexutil.Uint64  `json:"minBlockNumber"`
+	MaxBlockNumber    hexutil.Uint64  `json:"maxBlockNumber"`
+	RevertingTxHashes []common.Hash   `json:"revertingTxHashes"`
+}
+
+// SendBundle queues a bundle of signed transactions for atomic inclusion at the
+// top of the mined blocks, returning the bundle hash. It requires the miner to
+// run with the bundle ordering strategy.
+func (api *PrivateMinerAPI) SendBundle(args SendBundleArgs) (common.Hash, error) {
+	bundle := &miner.Bundle{
+		Txs:               make(types.Transactions, 0, len(args.Txs)),
+		MinBlockNumber:    uint64(args.MinBlockNumber),
+		MaxBlockNumber:    uint64(args.MaxBlockNumber),
+		RevertingTxHashes: args.RevertingTxHashes,
+	}
+	for i, input := range args.Txs {
+		tx := new(types.Transaction)
+		if err := tx.UnmarshalBinary(input); err != nil {
+			return common.Hash{}, fmt.Errorf("tx %d: %v", i, err)
+		}
+		bundle.Txs = append(bundle.Txs, tx)
+	}
+	if err := api.e.Miner().SendBundle(bundle); err != nil {
+		return common.Hash{}, err
+	}
+	return bundle.Hash(), nil
+}
+
 // PrivateAdminAPI is the collection of Ethereum full node-related APIs
 // exposed over the private admin endpoint.
 type PrivateAdminAPI struct {
@@ -250,6 +284,15 @@ func (api *PrivateAdminAPI) ImportChain(file string) (bool, error) {
 	return true, nil
 }
 
+// ReloadTxPoolRules reads the transaction pool content rules from the configured
+// rules file again and applies them to the pool.
+func (api *PrivateAdminAPI) ReloadTxPoolRules() (bool, error) {
+	if err := api.eth.TxPool().ReloadRules(); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
 // PublicDebugAPI is the collection of Ethereum full node APIs exposed
 // over the public debugging endpoint.
 type PublicDebugAPI struct {
@@ -307,6 +350,34 @@ func (api *PrivateDebugAPI) Preimage(ctx context.Context, hash common.Hash) (hex
 	return nil, errors.New("unknown preimage")
 }
 
+// PrunedBlocksResult is the result of a debug_prunedBlocks API call.
+type PrunedBlocksResult struct {
+	HistoryBlocks uint64             `json:"historyBlocks"` // Number of recent blocks retained, 0 if not pruning
+	Tail          uint64             `json:"tail"`          // First block still available in the ancient store
+	Ranges        []core.PrunedRange `json:"ranges"`        // Most recent ranges pruned since startup
+}
+
+// PrunedBlocks returns the block ranges deleted from the ancient store by the
+// online history pruner since startup, along with the first available block.
+func (api *PrivateDebugAPI) PrunedBlocks() PrunedBlocksResult {
+	chain := api.eth.BlockChain()
+	return PrunedBlocksResult{
+		HistoryBlocks: chain.HistoryBlocks(),
+		Tail:          chain.HistoryTail(),
+		Ranges:        chain.PrunedRanges(),
+	}
+}
+
+// StatePruningStatus returns the progress of the current online state pruning
+// cycle.
+func (api *PrivateDebugAPI) StatePruningStatus() (*pruner.OnlinePruneStatus, error) {
+	if api.eth.statePruner == nil {
+		return nil, errors.New("online state pruning is disabled")
+	}
+	status := api.eth.statePruner.Status()
+	return &status, nil
+}
+
 // BadBlockArgs represents the entries in the list returned when bad blocks are queried.
 type BadBlockArgs struct {
 	Hash  common.Hash            `json:"hash"`
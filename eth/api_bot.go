@@ -66,57 +66,10 @@ type Simulator struct {
 
 type PublicBotAPI struct {
 	eth *Ethereum
-
-	//channels for subscription stuff
-	install   chan *subscription
-	uninstall chan *subscription
-
-	simResultCh chan *SimulateSingleTxResult
-	newTxsCh    chan core.NewTxsEvent
-}
-
-type subscription struct {
-	id        rpc.ID
-	created   time.Time
-	installed chan struct{} // closed when the filter is installed
-	err       chan error    // closed when the filter is uninstalled
-
-	//todo: testing by just sending a feed of ticker ticks as ints
-	ticks      chan []int
-	hashes     chan []common.Hash
-	simResults chan *SimulateSingleTxResult
 }
 
-// Subscription is created when the client registers itself for a particular event.
-type Subscription struct {
-	ID        rpc.ID
-	f         *subscription
-	api       *PublicBotAPI
-	unsubOnce sync.Once
-}
-
-type simulatorSubscriptions map[rpc.ID]*subscription
-
 func NewPublicBotAPI(eth *Ethereum) *PublicBotAPI {
-	api := &PublicBotAPI{
-		eth:       eth,
-		install:   make(chan *subscription),
-		uninstall: make(chan *subscription),
-
-		simResultCh: make(chan *SimulateSingleTxResult),
-		newTxsCh:    make(chan core.NewTxsEvent),
-	}
-
-	api.Start()
-
-	// go api.eventLoop()
-
-	return api
-}
-
-func (api *PublicBotAPI) Start() {
-
-	api.eth.TxPool().SubscribeNewTxsEvent(api.newTxsCh)
+	return &PublicBotAPI{eth: eth}
 }
 
 func NewSimulator(backend *EthAPIBackend) *Simulator {
@@ -126,46 +79,6 @@ func NewSimulator(backend *EthAPIBackend) *Simulator {
 
 }
 
-// func (api *PublicBotAPI) eventLoop() {
-
-// 	api.eth.txPool.SubscribeNewTxsEvent(api.newTxsCh)
-
-// 	simSubs := make(simulatorSubscriptions)
-// 	dumbTicker := time.NewTicker(1 * time.Second)
-// 	for {
-// 		select {
-
-// 		case txs := <-api.newTxsCh:
-// 			for _, tx := range txs.Txs {
-// 				log.Info("newSimulatorResults", "tx-eloop", tx.Hash())
-// 				for _, s := range simSubs {
-// 					s.hashes <- []common.Hash{tx.Hash()}
-// 				}
-// 			}
-// 			//api.handleNewTxs(txs.Txs)
-
-// 		case r := <-api.simResultCh:
-// 			for _, sub := range simSubs {
-// 				sub.simResults <- r
-// 			}
-
-// 		case <-dumbTicker.C:
-// 			//send event to subscribers if any
-// 			for _, s := range simSubs {
-// 				s.ticks <- []int{time.Now().Second()}
-// 			}
-
-// 		case s := <-api.install:
-// 			simSubs[s.id] = s
-// 			close(s.installed)
-
-// 		case <-api.uninstall:
-// 			//need to delete from simSubs array, copied code uses a map and deletes from map
-
-// 		}
-// 	}
-// }
-
 func (api *PublicBotAPI) isWatchedTx(tx *types.Transaction) bool {
 
 	if len(tx.Data()) < 4 {
@@ -180,27 +93,6 @@ func (api *PublicBotAPI) isWatchedTx(tx *types.Transaction) bool {
 	return false
 }
 
-func (api *PublicBotAPI) subscribeSimulatorResults(ticksCh chan []int) *Subscription {
-	sub := &subscription{
-		id:        rpc.NewID(),
-		created:   time.Now(),
-		ticks:     ticksCh,
-		installed: make(chan struct{}),
-	}
-	//code i'm copying calls subcribe which installs the subscription into the event ssystem in the eventLoop
-	return api.subscribe(sub)
-}
-
-func (sub *Subscription) Unsubscribe() {
-}
-
-// subscribe installs the subscription in the event broadcast loop.
-func (api *PublicBotAPI) subscribe(sub *subscription) *Subscription {
-	api.install <- sub
-	<-sub.installed
-	return &Subscription{ID: sub.id, f: sub, api: api}
-}
-
 type SimulateResult struct {
 	Duration            *time.Duration `json:"duration"`
 	Logs                []*types.Log   `json:"logs"`
@@ -280,37 +172,20 @@ func (api *PublicBotAPI) NewSimulatorResults(ctx context.Context) (*rpc.Subscrip
 	log.Info("newSimulatorResults", "ID", rpcSub.ID)
 
 	gopool.Submit(func() {
-
-		// resultCh := make(chan []int, 128)
-		// resultSub := api.subscribeSimulatorResults(resultCh)
-
-		// dumbTicker := time.NewTicker(1 * time.Second)
+		newTxsCh := make(chan core.NewTxsEvent, txChanSize)
+		newTxsSub := api.eth.TxPool().SubscribeNewTxsEvent(newTxsCh)
+		defer newTxsSub.Unsubscribe()
 
 		for {
 			select {
-
-			case txs := <-api.newTxsCh:
+			case txs := <-newTxsCh:
 				api.handleNewTxs(txs.Txs, notifier, rpcSub.ID)
-				// for _, tx := range txs.Txs {
-				// 	log.Info("newSimulatorResults", "tx", tx.Hash())
-				// 	notifier.Notify(rpcSub.ID, []common.Hash{tx.Hash()})
-				// }
-
-				// case r := <-api.simResultCh:
-				// 	log.Info("newSimulatorResults", "result", r.TxHash)
-				// 	notifier.Notify(rpcSub.ID, r)
-
-				// case <-dumbTicker.C:
-				// 	notifier.Notify(rpcSub.ID, []int{time.Now().Second()})
-
-				// case result := <-resultCh:
-				// 	notifier.Notify(rpcSub.ID, result)
-				// case <-rpcSub.Err():
-				// 	resultSub.Unsubscribe()
-				// 	return
-				// case <-notifier.Closed():
-				// 	resultSub.Unsubscribe()
-				// 	return
+			case <-rpcSub.Err():
+				return
+			case <-notifier.Closed():
+				return
+			case <-newTxsSub.Err():
+				return
 			}
 		}
 	})
@@ -0,0 +1,337 @@
+package eth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/gopool"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/consensus"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/eth/tracers"
+	"github.com/ethereum/go-ethereum/internal/ethapi"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// defaultBundleTimeout is the maximum time a bundle simulation may run if the
+// caller didn't specify a timeout of its own.
+const defaultBundleTimeout = 5 * time.Second
+
+// BundleTxArgs is a single entry of a simulated bundle. It is either a signed
+// raw transaction or an unsigned call, in which case the CallArgs fields are
+// used to assemble the message.
+type BundleTxArgs struct {
+	ethapi.CallArgs
+	SignedTx *hexutil.Bytes `json:"signedTx"`
+}
+
+// CallBundleArgs represents the arguments for a bundle simulation. If a pending
+// transaction index is given, the bundle is executed on the pending state after
+// that many pool transactions instead of on top of BlockNumber. If a tracer is
+// given (e.g. dexTracer), every transaction is traced with it.
+type CallBundleArgs struct {
+	Txs            []BundleTxArgs        `json:"txs"`
+	BlockNumber    rpc.BlockNumberOrHash `json:"blockNumber"`
+	PendingTxIndex *hexutil.Uint64       `json:"pendingTxIndex"`
+	Coinbase       *common.Address       `json:"coinbase"`
+	Timestamp      *hexutil.Uint64       `json:"timestamp"`
+	GasLimit       *hexutil.Uint64       `json:"gasLimit"`
+	StateOverrides *ethapi.StateOverride `json:"stateOverrides"`
+	Timeout        *string               `json:"timeout"`
+	Tracer         *string               `json:"tracer"`
+	TracerConfig   json.RawMessage       `json:"tracerConfig"`
+}
+
+// BundleTxResult is the outcome of a single transaction within a bundle.
+type BundleTxResult struct {
+	TxHash       common.Hash     `json:"txHash"`
+	From         common.Address  `json:"from"`
+	To           *common.Address `json:"to"`
+	GasUsed      uint64          `json:"gasUsed"`
+	GasPrice     *hexutil.Big    `json:"gasPrice"`
+	GasFees      *hexutil.Big    `json:"gasFees"`
+	CoinbaseDiff *hexutil.Big    `json:"coinbaseDiff"`
+	ReturnData   hexutil.Bytes   `json:"returnData,omitempty"`
+	Error        string          `json:"error,omitempty"`
+	RevertReason string          `json:"revertReason,omitempty"`
+	Receipt      *types.Receipt  `json:"receipt"`
+	Trace        json.RawMessage `json:"trace,omitempty"`
+}
+
+// CallBundleResult is the aggregate outcome of a bundle simulation.
+type CallBundleResult struct {
+	BundleHash       common.Hash       `json:"bundleHash"`
+	StateBlockNumber uint64            `json:"stateBlockNumber"`
+	BlockNumber      uint64            `json:"blockNumber"`
+	Coinbase         common.Address    `json:"coinbase"`
+	CoinbaseDiff     *hexutil.Big      `json:"coinbaseDiff"`
+	GasFees          *hexutil.Big      `json:"gasFees"`
+	TotalGasUsed     uint64            `json:"totalGasUsed"`
+	Results          []*BundleTxResult `json:"results"`
+	DurationMs       uint64            `json:"durationMs"` // Wall time of the simulation in milliseconds
+}
+
+// CallBundle simulates an ordered list of transactions on top of the given
+// block. Contrary to SimulateSingleTx all transactions are executed against one
+// evolving state, so later transactions observe the effects of earlier ones.
+func (api *PublicBotAPI) CallBundle(ctx context.Context, args CallBundleArgs) (*CallBundleResult, error) {
+	if len(args.Txs) == 0 {
+		return nil, errors.New("bundle missing txs")
+	}
+	if args.BlockNumber.BlockNumber == nil && args.BlockNumber.BlockHash == nil {
+		args.BlockNumber = rpc.BlockNumberOrHashWithNumber(rpc.PendingBlockNumber)
+	}
+	timeout := defaultBundleTimeout
+	if args.Timeout != nil {
+		var err error
+		if timeout, err = time.ParseDuration(*args.Timeout); err != nil {
+			return nil, err
+		}
+	}
+	var (
+		statedb        *state.StateDB
+		parent, header *types.Header
+		err            error
+	)
+	if args.PendingTxIndex != nil {
+		if statedb, parent, header, err = api.pendingBundleState(int(*args.PendingTxIndex)); err != nil {
+			return nil, err
+		}
+	} else {
+		statedb, parent, err = api.eth.APIBackend.StateAndHeaderByNumberOrHash(ctx, args.BlockNumber)
+		if statedb == nil || err != nil {
+			return nil, err
+		}
+		header = &types.Header{
+			ParentHash: parent.Hash(),
+			Number:     new(big.Int).Add(parent.Number, common.Big1),
+			GasLimit:   parent.GasLimit,
+			Time:       parent.Time + 1,
+			Difficulty: parent.Difficulty,
+			Coinbase:   parent.Coinbase,
+		}
+	}
+	if err := args.StateOverrides.Apply(statedb); err != nil {
+		return nil, err
+	}
+	if args.Coinbase != nil {
+		header.Coinbase = *args.Coinbase
+	}
+	if args.Timestamp != nil {
+		header.Time = uint64(*args.Timestamp)
+	}
+	if args.GasLimit != nil {
+		header.GasLimit = uint64(*args.GasLimit)
+	}
+	// Setup context so the simulation is aborted if it runs for too long
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	s := &bundleSimulator{
+		config:  api.eth.blockchain.Config(),
+		chain:   api.eth.blockchain,
+		vmCfg:   *api.eth.blockchain.GetVMConfig(),
+		gasCap:  api.eth.APIBackend.RPCGasCap(),
+		statedb: statedb,
+		header:  header,
+	}
+	if args.Tracer != nil {
+		s.tracer, s.tracerConfig = *args.Tracer, args.TracerConfig
+	}
+	return s.run(ctx, parent, args.Txs)
+}
+
+// bundleSimulator executes the transactions of a bundle one after the other on
+// top of a single state.
+type bundleSimulator struct {
+	config  *params.ChainConfig
+	chain   core.ChainContext
+	vmCfg   vm.Config
+	gasCap  uint64
+	statedb *state.StateDB
+	header  *types.Header
+	tracer  string // Name of the tracer to run every transaction with, if any
+
+	tracerConfig json.RawMessage // Config of the tracer, if any
+}
+
+func (s *bundleSimulator) run(ctx context.Context, parent *types.Header, txs []BundleTxArgs) (*CallBundleResult, error) {
+	var (
+		start   = time.Now()
+		signer  = types.MakeSigner(s.config, s.header.Number)
+		gasPool = new(core.GasPool).AddGas(s.header.GasLimit)
+		hashes  = make([]byte, 0, len(txs)*common.HashLength)
+
+		coinbaseBefore = s.coinbaseBalance()
+		gasFees        = new(big.Int)
+		usedGas        uint64
+	)
+	gasPool.SubGas(params.SystemTxsGas)
+
+	result := &CallBundleResult{
+		StateBlockNumber: parent.Number.Uint64(),
+		BlockNumber:      s.header.Number.Uint64(),
+		Coinbase:         s.header.Coinbase,
+		Results:          make([]*BundleTxResult, 0, len(txs)),
+	}
+	for i, args := range txs {
+		msg, tx, err := s.toMessage(signer, &args)
+		if err != nil {
+			return nil, fmt.Errorf("bundle tx %d: %w", i, err)
+		}
+		txResult, err := s.apply(ctx, i, msg, tx, gasPool, &usedGas)
+		if err != nil {
+			return nil, fmt.Errorf("bundle tx %d (%s): %w", i, tx.Hash().Hex(), err)
+		}
+		gasFees.Add(gasFees, txResult.GasFees.ToInt())
+		hashes = append(hashes, tx.Hash().Bytes()...)
+		result.Results = append(result.Results, txResult)
+	}
+	result.BundleHash = crypto.Keccak256Hash(hashes)
+	result.CoinbaseDiff = (*hexutil.Big)(new(big.Int).Sub(s.coinbaseBalance(), coinbaseBefore))
+	result.GasFees = (*hexutil.Big)(gasFees)
+	result.TotalGasUsed = usedGas
+	result.DurationMs = uint64(time.Since(start).Milliseconds())
+	return result, nil
+}
+
+// toMessage converts a bundle entry into a message to execute and the
+// transaction used to identify it. Unsigned calls are wrapped into an unsigned
+// legacy transaction, so they still yield a stable hash for logs and receipts.
+func (s *bundleSimulator) toMessage(signer types.Signer, args *BundleTxArgs) (types.Message, *types.Transaction, error) {
+	if args.SignedTx != nil {
+		tx := new(types.Transaction)
+		if err := tx.UnmarshalBinary(*args.SignedTx); err != nil {
+			return types.Message{}, nil, err
+		}
+		msg, err := tx.AsMessage(signer)
+		if err != nil {
+			return types.Message{}, nil, err
+		}
+		return msg, tx, nil
+	}
+	msg := args.ToMessage(s.gasCap)
+	tx := types.NewTx(&types.LegacyTx{
+		Nonce:    s.statedb.GetNonce(msg.From()),
+		GasPrice: msg.GasPrice(),
+		Gas:      msg.Gas(),
+		To:       msg.To(),
+		Value:    msg.Value(),
+		Data:     msg.Data(),
+	})
+	return msg, tx, nil
+}
+
+// apply executes a single message of the bundle and assembles its result.
+// Failing to apply the message at all (bad nonce, insufficient funds, etc.)
+// invalidates the whole bundle, reverted executions do not.
+func (s *bundleSimulator) apply(ctx context.Context, index int, msg types.Message, tx *types.Transaction, gasPool *core.GasPool, usedGas *uint64) (*BundleTxResult, error) {
+	coinbaseBefore := s.coinbaseBalance()
+	nonce := s.statedb.GetNonce(msg.From())
+
+	s.statedb.Prepare(tx.Hash(), common.Hash{}, index)
+
+	vmCfg := s.vmCfg
+	var tracer tracers.Tracer
+	if s.tracer != "" {
+		var err error
+		if tracer, err = tracers.New(s.tracer, &tracers.Context{TxIndex: index, TxHash: tx.Hash(), GasLimit: tx.Gas()}, s.tracerConfig); err != nil {
+			return nil, err
+		}
+		vmCfg.Debug, vmCfg.Tracer = true, tracer
+	}
+	blockCtx := core.NewEVMBlockContext(s.header, s.chain, nil)
+	evm := vm.NewEVM(blockCtx, core.NewEVMTxContext(msg), s.statedb, s.config, vmCfg)
+
+	// Wait for the context to be done and cancel the evm. Even if the
+	// EVM has finished, cancelling may be done (repeatedly)
+	done := make(chan struct{})
+	defer close(done)
+	gopool.Submit(func() {
+		select {
+		case <-ctx.Done():
+			evm.Cancel()
+		case <-done:
+		}
+	})
+	res, err := core.ApplyMessage(evm, msg, gasPool)
+	if err != nil {
+		return nil, err
+	}
+	if evm.Cancelled() {
+		return nil, fmt.Errorf("execution aborted: %w", ctx.Err())
+	}
+	if s.config.IsByzantium(s.header.Number) {
+		s.statedb.Finalise(true)
+	} else {
+		s.statedb.IntermediateRoot(s.config.IsEIP158(s.header.Number))
+	}
+	*usedGas += res.UsedGas
+
+	receipt := &types.Receipt{Type: tx.Type(), CumulativeGasUsed: *usedGas}
+	if res.Failed() {
+		receipt.Status = types.ReceiptStatusFailed
+	} else {
+		receipt.Status = types.ReceiptStatusSuccessful
+	}
+	receipt.TxHash = tx.Hash()
+	receipt.GasUsed = res.UsedGas
+	if msg.To() == nil {
+		receipt.ContractAddress = crypto.CreateAddress(msg.From(), nonce)
+	}
+	receipt.Logs = s.statedb.GetLogs(tx.Hash())
+	receipt.Bloom = types.CreateBloom(types.Receipts{receipt})
+	receipt.BlockNumber = s.header.Number
+	receipt.TransactionIndex = uint(index)
+
+	txResult := &BundleTxResult{
+		TxHash:       tx.Hash(),
+		From:         msg.From(),
+		To:           msg.To(),
+		GasUsed:      res.UsedGas,
+		GasPrice:     (*hexutil.Big)(msg.GasPrice()),
+		GasFees:      (*hexutil.Big)(new(big.Int).Mul(new(big.Int).SetUint64(res.UsedGas), msg.GasPrice())),
+		CoinbaseDiff: (*hexutil.Big)(new(big.Int).Sub(s.coinbaseBalance(), coinbaseBefore)),
+		Receipt:      receipt,
+	}
+	if res.Err != nil {
+		txResult.Error = res.Err.Error()
+		if revert := res.Revert(); len(revert) > 0 {
+			if reason, errUnpack := abi.UnpackRevert(revert); errUnpack == nil {
+				txResult.RevertReason = reason
+			} else {
+				txResult.RevertReason = hexutil.Encode(revert)
+			}
+		}
+	} else {
+		txResult.ReturnData = res.Return()
+	}
+	if tracer != nil {
+		if txResult.Trace, err = tracer.GetResult(); err != nil {
+			return nil, err
+		}
+	}
+	return txResult, nil
+}
+
+// coinbaseBalance returns what the block producer would earn from the current
+// state. Under parlia the gas fees are collected on the system address and only
+// handed over to the validator on finalisation, so they are accounted as well.
+func (s *bundleSimulator) coinbaseBalance() *big.Int {
+	balance := new(big.Int).Set(s.statedb.GetBalance(s.header.Coinbase))
+	if s.config.Parlia != nil && s.header.Coinbase != consensus.SystemAddress {
+		balance.Add(balance, s.statedb.GetBalance(consensus.SystemAddress))
+	}
+	return balance
+}
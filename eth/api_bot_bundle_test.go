@@ -0,0 +1,112 @@
+package eth
+
+import (
+	"context"
+	"encoding/json"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/internal/ethapi"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// newTestBundleSimulator creates a bundle simulator on top of the head state of
+// the test handler's chain.
+func newTestBundleSimulator(t *testing.T, handler *testHandler, coinbase common.Address) *bundleSimulator {
+	t.Helper()
+
+	parent := handler.chain.CurrentBlock().Header()
+	statedb, err := handler.chain.StateAt(parent.Root)
+	if err != nil {
+		t.Fatalf("failed to retrieve head state: %v", err)
+	}
+	return &bundleSimulator{
+		config:  handler.chain.Config(),
+		chain:   handler.chain,
+		vmCfg:   *handler.chain.GetVMConfig(),
+		statedb: statedb,
+		header: &types.Header{
+			ParentHash: parent.Hash(),
+			Number:     new(big.Int).Add(parent.Number, common.Big1),
+			GasLimit:   10 * params.SystemTxsGas,
+			Time:       parent.Time + 1,
+			Difficulty: parent.Difficulty,
+			Coinbase:   coinbase,
+		},
+	}
+}
+
+// Tests that the transactions of a bundle are executed on one evolving state,
+// with their gas and coinbase profits accounted individually and in total.
+func TestCallBundle(t *testing.T) {
+	handler := newTestHandler()
+	defer handler.close()
+
+	var (
+		coinbase  = common.Address{0xc0}
+		recipient = common.Address{0xde, 0xad}
+		gasPrice  = big.NewInt(2)
+		signer    = types.MakeSigner(handler.chain.Config(), common.Big1)
+	)
+	tx, _ := types.SignTx(types.NewTransaction(0, recipient, big.NewInt(1000), params.TxGas, gasPrice, nil), signer, testKey)
+	raw, _ := tx.MarshalBinary()
+
+	// The unsigned call spends funds the signed transaction sent to the recipient
+	var (
+		gas   = hexutil.Uint64(params.TxGas)
+		value = (*hexutil.Big)(big.NewInt(600))
+		txs   = []BundleTxArgs{
+			{SignedTx: (*hexutil.Bytes)(&raw)},
+			{CallArgs: ethapi.CallArgs{From: &recipient, To: &coinbase, Gas: &gas, Value: value}},
+		}
+	)
+	s := newTestBundleSimulator(t, handler, coinbase)
+	result, err := s.run(context.Background(), handler.chain.CurrentBlock().Header(), txs)
+	if err != nil {
+		t.Fatalf("failed to simulate bundle: %v", err)
+	}
+	if len(result.Results) != 2 {
+		t.Fatalf("result count mismatch: have %d, want %d", len(result.Results), 2)
+	}
+	if result.Results[0].TxHash != tx.Hash() || result.Results[0].Error != "" || result.Results[1].Error != "" {
+		t.Errorf("tx results mismatch: have %+v, %+v", result.Results[0], result.Results[1])
+	}
+	if have := s.statedb.GetBalance(recipient); have.Cmp(big.NewInt(400)) != 0 {
+		t.Errorf("recipient balance mismatch: have %v, want %v", have, 400)
+	}
+	fees := new(big.Int).Mul(gasPrice, new(big.Int).SetUint64(params.TxGas))
+	if have := result.Results[0].CoinbaseDiff.ToInt(); have.Cmp(fees) != 0 {
+		t.Errorf("tx coinbase diff mismatch: have %v, want %v", have, fees)
+	}
+	if have, want := result.CoinbaseDiff.ToInt(), new(big.Int).Add(fees, big.NewInt(600)); have.Cmp(want) != 0 {
+		t.Errorf("bundle coinbase diff mismatch: have %v, want %v", have, want)
+	}
+	if result.GasFees.ToInt().Cmp(fees) != 0 || result.TotalGasUsed != 2*params.TxGas {
+		t.Errorf("bundle gas mismatch: have fees %v used %d, want fees %v used %d", result.GasFees, result.TotalGasUsed, fees, 2*params.TxGas)
+	}
+	if want := crypto.Keccak256Hash(tx.Hash().Bytes(), result.Results[1].TxHash.Bytes()); result.BundleHash != want {
+		t.Errorf("bundle hash mismatch: have %x, want %x", result.BundleHash, want)
+	}
+	if result.Results[1].Receipt.CumulativeGasUsed != 2*params.TxGas || result.Results[1].Receipt.TransactionIndex != 1 {
+		t.Errorf("receipt mismatch: have %+v", result.Results[1].Receipt)
+	}
+	// The simulation time is reported in milliseconds under an explicit name
+	blob, _ := json.Marshal(result)
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(blob, &fields); err != nil {
+		t.Fatalf("failed to decode result: %v", err)
+	}
+	if _, ok := fields["durationMs"]; !ok {
+		t.Errorf("result missing durationMs: %s", blob)
+	}
+	// Replaying the signed transaction on a fresh state fails on its nonce after
+	// the first one, invalidating the whole bundle
+	s = newTestBundleSimulator(t, handler, coinbase)
+	if _, err := s.run(context.Background(), handler.chain.CurrentBlock().Header(), []BundleTxArgs{txs[0], txs[0]}); err == nil {
+		t.Errorf("bundle with duplicate nonce accepted")
+	}
+}
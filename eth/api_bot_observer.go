@@ -0,0 +1,31 @@
+package eth
+
+import (
+	"errors"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core"
+)
+
+// errNoMemoryObserver is returned if the delivery records are requested but the
+// pool doesn't track deliveries into the in-memory sink.
+var errNoMemoryObserver = errors.New("tx delivery tracking not configured with the memory sink")
+
+// TxDeliveries returns the delivery records retained by the in-memory tx
+// observer sink, oldest first. If count is given, only the most recent count
+// records are returned.
+func (api *PublicBotAPI) TxDeliveries(count *hexutil.Uint) ([]*core.TxDeliveryTrackingInfo, error) {
+	observer := api.eth.txPool.Observer()
+	if filter, ok := observer.(*core.FilteredTxObserver); ok {
+		observer = filter.Sink()
+	}
+	ring, ok := observer.(*core.RingTxObserver)
+	if !ok {
+		return nil, errNoMemoryObserver
+	}
+	records := ring.Records()
+	if count != nil && int(*count) < len(records) {
+		records = records[len(records)-int(*count):]
+	}
+	return records, nil
+}
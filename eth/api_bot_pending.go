@@ -0,0 +1,79 @@
+package eth
+
+import (
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// PendingStateTx is a transaction executed on the pending state.
+type PendingStateTx struct {
+	Index    hexutil.Uint64  `json:"index"`
+	Hash     common.Hash     `json:"hash"`
+	From     common.Address  `json:"from"`
+	To       *common.Address `json:"to"`
+	GasPrice *hexutil.Big    `json:"gasPrice"`
+	GasUsed  hexutil.Uint64  `json:"gasUsed"`
+	Status   hexutil.Uint64  `json:"status"`
+	Logs     []*types.Log    `json:"logs"`
+}
+
+// PendingStateInfo returns a summary of the incrementally simulated pending
+// state, requires the node to run with --pendingstate.
+func (api *PublicBotAPI) PendingStateInfo() (*PendingStateInfo, error) {
+	if api.eth.pendingState == nil {
+		return nil, errPendingStateDisabled
+	}
+	return api.eth.pendingState.info()
+}
+
+// PendingStateTxs returns the pool transactions executed on the pending state,
+// in execution order. The index of a transaction can be passed as the
+// pendingTxIndex of bot_callBundle to simulate on the state before it.
+func (api *PublicBotAPI) PendingStateTxs() ([]*PendingStateTx, error) {
+	if api.eth.pendingState == nil {
+		return nil, errPendingStateDisabled
+	}
+	header, txs, receipts := api.eth.pendingState.transactions()
+	if header == nil {
+		return nil, errPendingStateNotReady
+	}
+	signer := types.MakeSigner(api.eth.blockchain.Config(), header.Number)
+
+	results := make([]*PendingStateTx, len(txs))
+	for i, tx := range txs {
+		from, _ := types.Sender(signer, tx)
+		results[i] = &PendingStateTx{
+			Index:    hexutil.Uint64(i),
+			Hash:     tx.Hash(),
+			From:     from,
+			To:       tx.To(),
+			GasPrice: (*hexutil.Big)(tx.GasPrice()),
+			GasUsed:  hexutil.Uint64(receipts[i].GasUsed),
+			Status:   hexutil.Uint64(receipts[i].Status),
+			Logs:     receipts[i].Logs,
+		}
+	}
+	return results, nil
+}
+
+// pendingBundleState returns a copy of the pending state after the first index
+// pool transactions, along with the chain head it was forked off and the header
+// of the pending block.
+func (api *PublicBotAPI) pendingBundleState(index int) (*state.StateDB, *types.Header, *types.Header, error) {
+	if api.eth.pendingState == nil {
+		return nil, nil, nil, errPendingStateDisabled
+	}
+	statedb, header, err := api.eth.pendingState.stateAt(index)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	parent := api.eth.blockchain.GetHeaderByHash(header.ParentHash)
+	if parent == nil {
+		return nil, nil, nil, fmt.Errorf("pending state parent %s not found", header.ParentHash.Hex())
+	}
+	return statedb, parent, header, nil
+}
@@ -0,0 +1,22 @@
+package eth
+
+import (
+	"context"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/internal/ethapi"
+)
+
+// SendPrivate adds the signed transaction to the local pool without broadcasting
+// it to the network. The transaction is only relayed to the trusted peers set
+// with --txpool.privatepeers and dropped if not included within
+// --txpool.privatelifetime blocks.
+func (api *PublicBotAPI) SendPrivate(ctx context.Context, input hexutil.Bytes) (common.Hash, error) {
+	tx := new(types.Transaction)
+	if err := tx.UnmarshalBinary(input); err != nil {
+		return common.Hash{}, err
+	}
+	return ethapi.SubmitPrivateTransaction(ctx, api.eth.APIBackend, tx)
+}
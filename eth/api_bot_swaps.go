@@ -0,0 +1,226 @@
+package eth
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/gopool"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// uniswapV2RouterABI contains the swap methods of the UniswapV2 router, which
+// the pancake, biswap, apeswap, etc. routers on BSC share.
+const uniswapV2RouterABI = `[
+{"name":"swapExactTokensForTokens","type":"function","stateMutability":"nonpayable","inputs":[{"name":"amountIn","type":"uint256"},{"name":"amountOutMin","type":"uint256"},{"name":"path","type":"address[]"},{"name":"to","type":"address"},{"name":"deadline","type":"uint256"}],"outputs":[{"name":"amounts","type":"uint256[]"}]},
+{"name":"swapTokensForExactTokens","type":"function","stateMutability":"nonpayable","inputs":[{"name":"amountOut","type":"uint256"},{"name":"amountInMax","type":"uint256"},{"name":"path","type":"address[]"},{"name":"to","type":"address"},{"name":"deadline","type":"uint256"}],"outputs":[{"name":"amounts","type":"uint256[]"}]},
+{"name":"swapExactETHForTokens","type":"function","stateMutability":"payable","inputs":[{"name":"amountOutMin","type":"uint256"},{"name":"path","type":"address[]"},{"name":"to","type":"address"},{"name":"deadline","type":"uint256"}],"outputs":[{"name":"amounts","type":"uint256[]"}]},
+{"name":"swapTokensForExactETH","type":"function","stateMutability":"nonpayable","inputs":[{"name":"amountOut","type":"uint256"},{"name":"amountInMax","type":"uint256"},{"name":"path","type":"address[]"},{"name":"to","type":"address"},{"name":"deadline","type":"uint256"}],"outputs":[{"name":"amounts","type":"uint256[]"}]},
+{"name":"swapExactTokensForETH","type":"function","stateMutability":"nonpayable","inputs":[{"name":"amountIn","type":"uint256"},{"name":"amountOutMin","type":"uint256"},{"name":"path","type":"address[]"},{"name":"to","type":"address"},{"name":"deadline","type":"uint256"}],"outputs":[{"name":"amounts","type":"uint256[]"}]},
+{"name":"swapETHForExactTokens","type":"function","stateMutability":"payable","inputs":[{"name":"amountOut","type":"uint256"},{"name":"path","type":"address[]"},{"name":"to","type":"address"},{"name":"deadline","type":"uint256"}],"outputs":[{"name":"amounts","type":"uint256[]"}]},
+{"name":"swapExactTokensForTokensSupportingFeeOnTransferTokens","type":"function","stateMutability":"nonpayable","inputs":[{"name":"amountIn","type":"uint256"},{"name":"amountOutMin","type":"uint256"},{"name":"path","type":"address[]"},{"name":"to","type":"address"},{"name":"deadline","type":"uint256"}],"outputs":[]},
+{"name":"swapExactETHForTokensSupportingFeeOnTransferTokens","type":"function","stateMutability":"payable","inputs":[{"name":"amountOutMin","type":"uint256"},{"name":"path","type":"address[]"},{"name":"to","type":"address"},{"name":"deadline","type":"uint256"}],"outputs":[]},
+{"name":"swapExactTokensForETHSupportingFeeOnTransferTokens","type":"function","stateMutability":"nonpayable","inputs":[{"name":"amountIn","type":"uint256"},{"name":"amountOutMin","type":"uint256"},{"name":"path","type":"address[]"},{"name":"to","type":"address"},{"name":"deadline","type":"uint256"}],"outputs":[]}
+]`
+
+// knownRouterABIs are the router interfaces pending swaps are decoded with.
+var knownRouterABIs []abi.ABI
+
+func init() {
+	for _, definition := range []string{uniswapV2RouterABI} {
+		parsed, err := abi.JSON(strings.NewReader(definition))
+		if err != nil {
+			panic(err)
+		}
+		knownRouterABIs = append(knownRouterABIs, parsed)
+	}
+}
+
+// SwapCall is the decoded calldata of a router swap.
+type SwapCall struct {
+	Method       string           `json:"method"`
+	Path         []common.Address `json:"path"`
+	AmountIn     *hexutil.Big     `json:"amountIn,omitempty"`
+	AmountInMax  *hexutil.Big     `json:"amountInMax,omitempty"`
+	AmountOut    *hexutil.Big     `json:"amountOut,omitempty"`
+	AmountOutMin *hexutil.Big     `json:"amountOutMin,omitempty"`
+	To           common.Address   `json:"to"`
+	Deadline     *hexutil.Big     `json:"deadline"`
+}
+
+// decodeSwapCall decodes the calldata of a transaction calling one of the known
+// router swap methods. Nil is returned if the method is unknown or the calldata
+// is malformed.
+func decodeSwapCall(tx *types.Transaction) *SwapCall {
+	data := tx.Data()
+	if len(data) < 4 {
+		return nil
+	}
+	for _, router := range knownRouterABIs {
+		method, err := router.MethodById(data[:4])
+		if err != nil {
+			continue
+		}
+		args, err := method.Inputs.Unpack(data[4:])
+		if err != nil || len(args) != len(method.Inputs) {
+			return nil
+		}
+		swap := &SwapCall{Method: method.RawName}
+		for i, input := range method.Inputs {
+			switch v := args[i].(type) {
+			case *big.Int:
+				switch input.Name {
+				case "amountIn":
+					swap.AmountIn = (*hexutil.Big)(v)
+				case "amountInMax":
+					swap.AmountInMax = (*hexutil.Big)(v)
+				case "amountOut":
+					swap.AmountOut = (*hexutil.Big)(v)
+				case "amountOutMin":
+					swap.AmountOutMin = (*hexutil.Big)(v)
+				case "deadline":
+					swap.Deadline = (*hexutil.Big)(v)
+				}
+			case []common.Address:
+				swap.Path = v
+			case common.Address:
+				swap.To = v
+			}
+		}
+		// Native currency swaps carry the input amount as the tx value
+		if method.IsPayable() && swap.AmountIn == nil && swap.AmountOut == nil {
+			swap.AmountIn = (*hexutil.Big)(tx.Value())
+		}
+		if method.IsPayable() && swap.AmountInMax == nil && swap.AmountOut != nil {
+			swap.AmountInMax = (*hexutil.Big)(tx.Value())
+		}
+		return swap
+	}
+	return nil
+}
+
+// PendingSwapsFilter selects the pool transactions streamed by PendingSwaps. A
+// transaction matches if it calls one of the methods and is sent to one of the
+// addresses. An empty filter matches the well known DEX swap methods.
+type PendingSwapsFilter struct {
+	Methods   []hexutil.Bytes  `json:"methods"`
+	Addresses []common.Address `json:"addresses"`
+}
+
+// validate checks that every method of the filter is a 4 byte selector, as a
+// longer or shorter one would silently never match.
+func (filter *PendingSwapsFilter) validate() error {
+	for _, method := range filter.Methods {
+		if len(method) != 4 {
+			return fmt.Errorf("invalid method selector %s: want 4 bytes, have %d", method, len(method))
+		}
+	}
+	return nil
+}
+
+// matchPendingSwap reports whether the transaction passes the filter.
+func (api *PublicBotAPI) matchPendingSwap(filter *PendingSwapsFilter, addresses map[common.Address]struct{}, tx *types.Transaction) bool {
+	if len(filter.Methods) == 0 && len(addresses) == 0 {
+		return api.isWatchedTx(tx)
+	}
+	if len(addresses) > 0 {
+		if tx.To() == nil {
+			return false
+		}
+		if _, ok := addresses[*tx.To()]; !ok {
+			return false
+		}
+	}
+	if len(filter.Methods) == 0 {
+		return true
+	}
+	data := tx.Data()
+	if len(data) < 4 {
+		return false
+	}
+	for _, method := range filter.Methods {
+		if bytes.Equal(method, data[:4]) {
+			return true
+		}
+	}
+	return false
+}
+
+// PendingSwap is a pool transaction streamed by PendingSwaps.
+type PendingSwap struct {
+	Hash    common.Hash        `json:"hash"`
+	From    common.Address     `json:"from"`
+	Tx      *types.Transaction `json:"tx"`
+	Peer    string             `json:"peer"`
+	Arrival time.Time          `json:"arrival"`
+	Swap    *SwapCall          `json:"swap,omitempty"`
+}
+
+// PendingSwaps streams the transactions entering the pool that match the given
+// filter, decoding the calldata of known router swaps.
+//
+// Subscribe with bot_subscribe("pendingSwaps", filter).
+func (api *PublicBotAPI) PendingSwaps(ctx context.Context, filter *PendingSwapsFilter) (*rpc.Subscription, error) {
+	notifier, supported := rpc.NotifierFromContext(ctx)
+	if !supported {
+		return &rpc.Subscription{}, rpc.ErrNotificationsUnsupported
+	}
+	if filter == nil {
+		filter = new(PendingSwapsFilter)
+	}
+	if err := filter.validate(); err != nil {
+		return &rpc.Subscription{}, err
+	}
+	addresses := make(map[common.Address]struct{}, len(filter.Addresses))
+	for _, addr := range filter.Addresses {
+		addresses[addr] = struct{}{}
+	}
+	rpcSub := notifier.CreateSubscription()
+
+	gopool.Submit(func() {
+		newTxsCh := make(chan core.NewTxsEvent, txChanSize)
+		newTxsSub := api.eth.TxPool().SubscribeNewTxsEvent(newTxsCh)
+		defer newTxsSub.Unsubscribe()
+
+		signer := types.LatestSigner(api.eth.blockchain.Config())
+		for {
+			select {
+			case ev := <-newTxsCh:
+				for _, tx := range ev.Txs {
+					if !api.matchPendingSwap(filter, addresses, tx) {
+						continue
+					}
+					from, err := types.Sender(signer, tx)
+					if err != nil {
+						log.Debug("Skipping pending swap with invalid sender", "hash", tx.Hash(), "err", err)
+						continue
+					}
+					notifier.Notify(rpcSub.ID, &PendingSwap{
+						Hash:    tx.Hash(),
+						From:    from,
+						Tx:      tx,
+						Peer:    tx.PeerID,
+						Arrival: tx.Time(),
+						Swap:    decodeSwapCall(tx),
+					})
+				}
+			case <-rpcSub.Err():
+				return
+			case <-notifier.Closed():
+				return
+			case <-newTxsSub.Err():
+				return
+			}
+		}
+	})
+	return rpcSub, nil
+}
@@ -0,0 +1,79 @@
+package eth
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// Tests that router swap calldata is decoded into its path and amounts.
+func TestDecodeSwapCall(t *testing.T) {
+	var (
+		router = common.HexToAddress("0x10ED43C718714eb63d5aA57B78B54704E256024E")
+		wbnb   = common.HexToAddress("0xbb4CdB9CBd36B01bD1cBaEBF2De08d9173bc095c")
+		busd   = common.HexToAddress("0xe9e7CEA3DedcA5984780Bafc599bD69ADd087D56")
+		to     = common.HexToAddress("0x0000000000000000000000000000000000000123")
+	)
+	method := knownRouterABIs[0].Methods["swapExactTokensForTokens"]
+	args, err := method.Inputs.Pack(big.NewInt(1000), big.NewInt(900), []common.Address{busd, wbnb}, to, big.NewInt(1700000000))
+	if err != nil {
+		t.Fatalf("failed to pack swap: %v", err)
+	}
+	tx := types.NewTransaction(0, router, big.NewInt(0), 200000, big.NewInt(5000000000), append(method.ID, args...))
+
+	swap := decodeSwapCall(tx)
+	if swap == nil {
+		t.Fatalf("failed to decode swap")
+	}
+	if swap.Method != "swapExactTokensForTokens" {
+		t.Errorf("method mismatch: have %s", swap.Method)
+	}
+	if len(swap.Path) != 2 || swap.Path[0] != busd || swap.Path[1] != wbnb {
+		t.Errorf("path mismatch: have %v", swap.Path)
+	}
+	if swap.AmountIn.ToInt().Int64() != 1000 || swap.AmountOutMin.ToInt().Int64() != 900 {
+		t.Errorf("amount mismatch: have in %v, out min %v", swap.AmountIn, swap.AmountOutMin)
+	}
+	if swap.To != to || swap.Deadline.ToInt().Int64() != 1700000000 {
+		t.Errorf("recipient or deadline mismatch: have %v, %v", swap.To, swap.Deadline)
+	}
+	// Native currency swaps take the input amount from the tx value
+	method = knownRouterABIs[0].Methods["swapExactETHForTokens"]
+	args, _ = method.Inputs.Pack(big.NewInt(900), []common.Address{wbnb, busd}, to, big.NewInt(1700000000))
+	tx = types.NewTransaction(0, router, big.NewInt(1000), 200000, big.NewInt(5000000000), append(method.ID, args...))
+
+	if swap = decodeSwapCall(tx); swap == nil || swap.AmountIn.ToInt().Int64() != 1000 {
+		t.Errorf("native swap amount mismatch: have %+v", swap)
+	}
+	// Unknown methods and truncated calldata must not be decoded
+	if swap := decodeSwapCall(types.NewTransaction(0, router, big.NewInt(0), 0, big.NewInt(0), common.FromHex("0xa9059cbb"))); swap != nil {
+		t.Errorf("decoded unknown method: %+v", swap)
+	}
+	if swap := decodeSwapCall(types.NewTransaction(0, router, big.NewInt(0), 0, big.NewInt(0), method.ID)); swap != nil {
+		t.Errorf("decoded truncated calldata: %+v", swap)
+	}
+}
+
+// Tests that pending swap filters only accept 4 byte method selectors.
+func TestPendingSwapsFilterValidate(t *testing.T) {
+	tests := []struct {
+		methods []hexutil.Bytes
+		valid   bool
+	}{
+		{nil, true},
+		{[]hexutil.Bytes{common.FromHex("0x38ed1739")}, true},
+		{[]hexutil.Bytes{common.FromHex("0x38ed1739"), common.FromHex("0x7ff36ab5")}, true},
+		{[]hexutil.Bytes{common.FromHex("0x38ed17")}, false},
+		{[]hexutil.Bytes{common.FromHex("0x38ed173900")}, false},
+		{[]hexutil.Bytes{common.FromHex("0x38ed1739"), {}}, false},
+	}
+	for i, tt := range tests {
+		filter := &PendingSwapsFilter{Methods: tt.methods}
+		if err := filter.validate(); (err == nil) != tt.valid {
+			t.Errorf("test %d: validity mismatch: have err %v, want valid %v", i, err, tt.valid)
+		}
+	}
+}
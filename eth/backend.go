@@ -87,6 +87,10 @@ type Ethereum struct {
 
 	APIBackend *EthAPIBackend
 
+	pendingState *pendingState        // Incremental pending state simulator, nil if disabled
+	statePruner  *pruner.OnlinePruner // Online state garbage collector, nil if disabled
+	stateRegen   *stateRegen          // Historical state regenerator, nil if disabled
+
 	miner     *miner.Miner
 	gasPrice  *big.Int
 	etherbase common.Address
@@ -210,6 +214,12 @@ func New(stack *node.Node, config *ethconfig.Config) (*Ethereum, error) {
 	if config.PersistDiff {
 		bcOps = append(bcOps, core.EnablePersistDiff(config.DiffBlock))
 	}
+	if config.HistoryBlocks > 0 {
+		bcOps = append(bcOps, core.EnableHistoryPruning(config.HistoryBlocks))
+	}
+	if config.ParallelTx {
+		bcOps = append(bcOps, core.EnableParallelTxExecution(config.ParallelTxWorkers))
+	}
 	eth.blockchain, err = core.NewBlockChain(chainDb, cacheConfig, chainConfig, eth.engine, vmConfig, eth.shouldPreserve, &config.TxLookupLimit, bcOps...)
 	if err != nil {
 		return nil, err
@@ -222,9 +232,32 @@ func New(stack *node.Node, config *ethconfig.Config) (*Ethereum, error) {
 	}
 	eth.bloomIndexer.Start(eth.blockchain)
 
+	if config.StatePruning {
+		if eth.blockchain.Snapshots() == nil || config.NoPruning {
+			return nil, errors.New("online state pruning requires snapshots and a non-archive node")
+		}
+		eth.statePruner, err = pruner.NewOnlinePruner(chainDb, eth.blockchain.StateCache().TrieDB(), eth.blockchain.Snapshots(), eth.blockchain, pruner.OnlinePrunerConfig{
+			BloomSize: config.StatePruningBloomSize,
+			Rate:      config.StatePruningRate,
+			Interval:  config.StatePruningInterval,
+		})
+		if err != nil {
+			return nil, err
+		}
+		eth.blockchain.SetStatePruner(eth.statePruner)
+	}
+	if config.StateRegen {
+		if !config.PersistDiff {
+			log.Info("Historical state regeneration without persisted diff layers re-executes every block")
+		}
+		eth.stateRegen = newStateRegen(eth.blockchain, chainDb, config.StateRegenDepth, config.StateRegenCache)
+	}
 	if config.TxPool.Journal != "" {
 		config.TxPool.Journal = stack.ResolvePath(config.TxPool.Journal)
 	}
+	if config.TxPool.Rules != "" {
+		config.TxPool.Rules = stack.ResolvePath(config.TxPool.Rules)
+	}
 	eth.txPool = core.NewTxPool(config.TxPool, chainConfig, eth.blockchain)
 
 	// Permit the downloader to use the trie cache allowance during fast sync
@@ -246,11 +279,16 @@ func New(stack *node.Node, config *ethconfig.Config) (*Ethereum, error) {
 		Whitelist:              config.Whitelist,
 		DirectBroadcast:        config.DirectBroadcast,
 		DiffSync:               config.DiffSync,
+		DiffVerifyPeers:        config.DiffSyncVerifyPeers,
 		DisablePeerTxBroadcast: config.DisablePeerTxBroadcast,
+		PrivatePeers:           config.PrivateTxPeers,
 	}); err != nil {
 		return nil, err
 	}
 
+	if config.PendingState {
+		eth.pendingState = newPendingState(eth.blockchain, eth.txPool)
+	}
 	eth.miner = miner.New(eth, &config.Miner, chainConfig, eth.EventMux(), eth.engine, eth.isLocalBlock)
 	eth.miner.SetExtra(makeExtraData(config.Miner.ExtraData))
 
@@ -580,6 +618,13 @@ func (s *Ethereum) Start() error {
 	}
 	// Start the networking layer and the light server if requested
 	s.handler.Start(maxPeers)
+
+	if s.pendingState != nil {
+		s.pendingState.start()
+	}
+	if s.statePruner != nil {
+		s.statePruner.Start()
+	}
 	return nil
 }
 
@@ -594,6 +639,12 @@ func (s *Ethereum) Stop() error {
 	// Then stop everything else.
 	s.bloomIndexer.Close()
 	close(s.closeBloomHandler)
+	if s.pendingState != nil {
+		s.pendingState.stop()
+	}
+	if s.statePruner != nil {
+		s.statePruner.Stop()
+	}
 	s.txPool.Stop()
 	s.miner.Stop()
 	s.miner.Close()
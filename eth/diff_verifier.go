@@ -0,0 +1,137 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package eth
+
+import (
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/eth/protocols/diff"
+	"github.com/ethereum/go-ethereum/event"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+)
+
+var (
+	diffRootMatchMeter    = metrics.NewRegisteredMeter("eth/diff/roots/match", nil)
+	diffRootMismatchMeter = metrics.NewRegisteredMeter("eth/diff/roots/mismatch", nil)
+	diffPeerDropMeter     = metrics.NewRegisteredMeter("eth/diff/peers/dropped", nil)
+)
+
+// diffVerifier guards diff sync against untrusted diff layers. It drops the
+// peers which sent a diff layer not leading to the state root of its block,
+// and asks several peers to attest the diff layers they serve for every new
+// chain head, dropping those attesting another one than they sent.
+type diffVerifier struct {
+	handler *handler
+	peers   int // Number of peers asked to attest each new chain head
+
+	headCh     chan core.ChainHeadEvent
+	headSub    event.Subscription
+	disputeCh  chan core.DiffLayerDisputeEvent
+	disputeSub event.Subscription
+}
+
+// newDiffVerifier creates a verifier asking the given number of peers to attest
+// each new chain head.
+func newDiffVerifier(h *handler, peers int) *diffVerifier {
+	return &diffVerifier{
+		handler: h,
+		peers:   peers,
+	}
+}
+
+// start subscribes to the chain events and launches the verification loop.
+func (v *diffVerifier) start() {
+	v.headCh = make(chan core.ChainHeadEvent, chainHeadChanSize)
+	v.headSub = v.handler.chain.SubscribeChainHeadEvent(v.headCh)
+	v.disputeCh = make(chan core.DiffLayerDisputeEvent, chainHeadChanSize)
+	v.disputeSub = v.handler.chain.SubscribeDiffLayerDisputeEvent(v.disputeCh)
+
+	go v.loop()
+}
+
+// stop terminates the verification loop.
+func (v *diffVerifier) stop() {
+	v.headSub.Unsubscribe()
+	v.disputeSub.Unsubscribe()
+}
+
+func (v *diffVerifier) loop() {
+	defer v.handler.wg.Done()
+
+	for {
+		select {
+		case ev := <-v.headCh:
+			v.requestRoots(ev.Block)
+
+		case ev := <-v.disputeCh:
+			for _, id := range ev.Peers {
+				log.Warn("Dropping peer sending mismatching diff layer", "peer", id, "hash", ev.BlockHash, "diff", ev.DiffHash)
+				v.drop(id)
+			}
+		case <-v.headSub.Err():
+			return
+		case <-v.disputeSub.Err():
+			return
+		}
+	}
+}
+
+// requestRoots asks the peers to attest the diff layer they serve for the given
+// block.
+func (v *diffVerifier) requestRoots(block *types.Block) {
+	if v.peers <= 0 {
+		return
+	}
+	for _, peer := range v.handler.peers.diffRootPeers(v.peers) {
+		if err := peer.RequestDiffRoots([]common.Hash{block.Hash()}); err != nil {
+			peer.Log().Debug("Failed to request diff layer roots", "err", err)
+		}
+	}
+}
+
+// deliverRoots checks the diff layers attested by a peer, dropping the peer if
+// it attests another diff layer than the one it sent for the block. Only the
+// hashes are compared, a diff layer not leading to the state root of its block
+// is caught when applying it and disputed by the chain.
+func (v *diffVerifier) deliverRoots(id string, roots []diff.DiffRoot) {
+	chain := v.handler.chain
+	for _, root := range roots {
+		header := chain.GetHeaderByHash(root.BlockHash)
+		if header == nil || chain.GetCanonicalHash(header.Number.Uint64()) != root.BlockHash {
+			continue // Unknown or side block, not processed
+		}
+		if received, ok := chain.GetUnTrustedDiffHash(root.BlockHash, id); ok && received != root.DiffHash {
+			diffRootMismatchMeter.Mark(1)
+			log.Warn("Dropping peer attesting another diff layer than the one sent", "peer", id, "number", header.Number, "hash", root.BlockHash,
+				"have", root.DiffHash, "sent", received)
+			v.drop(id)
+			return
+		}
+		diffRootMatchMeter.Mark(1)
+	}
+}
+
+// drop disconnects a peer which served or attested a bad diff layer.
+func (v *diffVerifier) drop(id string) {
+	if v.handler.peers.peer(id) == nil {
+		return
+	}
+	diffPeerDropMeter.Mark(1)
+	v.handler.removePeer(id)
+}
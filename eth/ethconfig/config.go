@@ -81,6 +81,13 @@ var Defaults = Config{
 	TriesInMemory:           128,
 	SnapshotCache:           102,
 	DiffBlock:               uint64(86400),
+	DiffSyncVerifyPeers:     3,
+	StatePruningRate:        10000,
+	StatePruningInterval:    24 * time.Hour,
+	StatePruningBloomSize:   2048,
+	StateRegenDepth:         8192,
+	StateRegenCache:         256,
+	ParallelTxWorkers:       runtime.NumCPU(),
 	Miner: miner.Config{
 		GasFloor:      8000000,
 		GasCeil:       8000000,
@@ -137,10 +144,29 @@ type Config struct {
 	DirectBroadcast     bool
 	DisableSnapProtocol bool //Whether disable snap protocol
 	DiffSync            bool // Whether support diff sync
+	DiffSyncVerifyPeers int  // Number of peers asked to attest the diff layer of each new head
 	PipeCommit          bool
 	RangeLimit          bool
+	PendingState        bool     // Whether to maintain an incrementally simulated pending state
+	PrivateTxPeers      []string // Enode IDs of the trusted peers private transactions are relayed to
 
 	TxLookupLimit uint64 `toml:",omitempty"` // The maximum number of blocks from head whose tx indices are reserved.
+	HistoryBlocks uint64 `toml:",omitempty"` // The number of recent blocks retained in the ancient store (0 = entire chain).
+
+	// Online state pruning options
+	StatePruning          bool          // Whether to garbage collect stale trie nodes while running
+	StatePruningRate      int           // Maximum number of trie nodes deleted per second
+	StatePruningInterval  time.Duration // Pause between two online pruning cycles
+	StatePruningBloomSize uint64        // Megabytes of memory allocated to the bloom filter of the live state
+
+	// Historical state regeneration options
+	StateRegen      bool   // Whether to regenerate the historical states missing from the database
+	StateRegenDepth uint64 // Maximum number of blocks replayed to regenerate a state
+	StateRegenCache int    // Megabytes of memory allocated to the regenerated states
+
+	// Parallel transaction execution options
+	ParallelTx        bool // Whether to execute the transactions of imported blocks in parallel
+	ParallelTxWorkers int  // Number of workers executing transactions in parallel
 
 	// Whitelist of required block number -> hash values to accept
 	Whitelist map[uint64]common.Hash `toml:"-"`
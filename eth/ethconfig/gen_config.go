@@ -24,8 +24,21 @@ func (c Config) MarshalTOML() (interface{}, error) {
 		EthDiscoveryURLs        []string
 		SnapDiscoveryURLs       []string
 		NoPruning               bool
+		DiffSyncVerifyPeers     int
 		NoPrefetch              bool
-		TxLookupLimit           uint64                 `toml:",omitempty"`
+		PendingState            bool
+		PrivateTxPeers          []string
+		TxLookupLimit           uint64 `toml:",omitempty"`
+		HistoryBlocks           uint64 `toml:",omitempty"`
+		StatePruning            bool
+		StatePruningRate        int
+		StatePruningInterval    time.Duration
+		StatePruningBloomSize   uint64
+		StateRegen              bool
+		StateRegenDepth         uint64
+		StateRegenCache         int
+		ParallelTx              bool
+		ParallelTxWorkers       int
 		Whitelist               map[uint64]common.Hash `toml:"-"`
 		LightServ               int                    `toml:",omitempty"`
 		LightIngress            int                    `toml:",omitempty"`
@@ -73,7 +86,20 @@ func (c Config) MarshalTOML() (interface{}, error) {
 	enc.EthDiscoveryURLs = c.EthDiscoveryURLs
 	enc.SnapDiscoveryURLs = c.SnapDiscoveryURLs
 	enc.NoPruning = c.NoPruning
+	enc.DiffSyncVerifyPeers = c.DiffSyncVerifyPeers
+	enc.PendingState = c.PendingState
+	enc.PrivateTxPeers = c.PrivateTxPeers
 	enc.TxLookupLimit = c.TxLookupLimit
+	enc.HistoryBlocks = c.HistoryBlocks
+	enc.StatePruning = c.StatePruning
+	enc.StatePruningRate = c.StatePruningRate
+	enc.StatePruningInterval = c.StatePruningInterval
+	enc.StatePruningBloomSize = c.StatePruningBloomSize
+	enc.StateRegen = c.StateRegen
+	enc.StateRegenDepth = c.StateRegenDepth
+	enc.StateRegenCache = c.StateRegenCache
+	enc.ParallelTx = c.ParallelTx
+	enc.ParallelTxWorkers = c.ParallelTxWorkers
 	enc.Whitelist = c.Whitelist
 	enc.LightServ = c.LightServ
 	enc.LightIngress = c.LightIngress
@@ -125,8 +151,21 @@ func (c *Config) UnmarshalTOML(unmarshal func(interface{}) error) error {
 		EthDiscoveryURLs        []string
 		SnapDiscoveryURLs       []string
 		NoPruning               *bool
+		DiffSyncVerifyPeers     *int
 		NoPrefetch              *bool
-		TxLookupLimit           *uint64                `toml:",omitempty"`
+		PendingState            *bool
+		PrivateTxPeers          []string
+		TxLookupLimit           *uint64 `toml:",omitempty"`
+		HistoryBlocks           *uint64 `toml:",omitempty"`
+		StatePruning            *bool
+		StatePruningRate        *int
+		StatePruningInterval    *time.Duration
+		StatePruningBloomSize   *uint64
+		StateRegen              *bool
+		StateRegenDepth         *uint64
+		StateRegenCache         *int
+		ParallelTx              *bool
+		ParallelTxWorkers       *int
 		Whitelist               map[uint64]common.Hash `toml:"-"`
 		LightServ               *int                   `toml:",omitempty"`
 		LightIngress            *int                   `toml:",omitempty"`
@@ -191,9 +230,48 @@ func (c *Config) UnmarshalTOML(unmarshal func(interface{}) error) error {
 	if dec.NoPruning != nil {
 		c.NoPruning = *dec.NoPruning
 	}
+	if dec.DiffSyncVerifyPeers != nil {
+		c.DiffSyncVerifyPeers = *dec.DiffSyncVerifyPeers
+	}
+	if dec.PendingState != nil {
+		c.PendingState = *dec.PendingState
+	}
+	if dec.PrivateTxPeers != nil {
+		c.PrivateTxPeers = dec.PrivateTxPeers
+	}
 	if dec.TxLookupLimit != nil {
 		c.TxLookupLimit = *dec.TxLookupLimit
 	}
+	if dec.HistoryBlocks != nil {
+		c.HistoryBlocks = *dec.HistoryBlocks
+	}
+	if dec.StatePruning != nil {
+		c.StatePruning = *dec.StatePruning
+	}
+	if dec.StatePruningRate != nil {
+		c.StatePruningRate = *dec.StatePruningRate
+	}
+	if dec.StatePruningInterval != nil {
+		c.StatePruningInterval = *dec.StatePruningInterval
+	}
+	if dec.StatePruningBloomSize != nil {
+		c.StatePruningBloomSize = *dec.StatePruningBloomSize
+	}
+	if dec.StateRegen != nil {
+		c.StateRegen = *dec.StateRegen
+	}
+	if dec.StateRegenDepth != nil {
+		c.StateRegenDepth = *dec.StateRegenDepth
+	}
+	if dec.StateRegenCache != nil {
+		c.StateRegenCache = *dec.StateRegenCache
+	}
+	if dec.ParallelTx != nil {
+		c.ParallelTx = *dec.ParallelTx
+	}
+	if dec.ParallelTxWorkers != nil {
+		c.ParallelTxWorkers = *dec.ParallelTxWorkers
+	}
 	if dec.Whitelist != nil {
 		c.Whitelist = dec.Whitelist
 	}
@@ -98,6 +98,17 @@ var (
 	txFetcherFetchingHashes = metrics.NewRegisteredGauge("eth/fetcher/transaction/fetching/hashes", nil)
 )
 
+// TxProvenance is notified about the peers announcing and delivering
+// transactions, allowing their origin to be tracked.
+type TxProvenance interface {
+	// RecordTxAnnouncements tracks that a peer announced a batch of hashes.
+	RecordTxAnnouncements(peer string, hashes []common.Hash, time time.Time)
+
+	// RecordTxDeliveries tracks that a peer delivered a batch of transactions,
+	// either as a reply to a request (direct) or as a broadcast.
+	RecordTxDeliveries(peer string, txs []*types.Transaction, direct bool, time time.Time)
+}
+
 // txAnnounce is the notification of the availability of a batch
 // of new transactions in the network.
 type txAnnounce struct {
@@ -182,6 +193,8 @@ type TxFetcher struct {
 	hashesFetchedByPeer map[string]int64
 	announceTripTime    map[common.Hash]*AnnounceTripTimeInfo
 	annLock             sync.Mutex
+
+	provenance TxProvenance // Optional tracker of announcing and delivering peers
 }
 
 type AnnounceTripTimeInfo struct {
@@ -226,11 +239,20 @@ func NewTxFetcherForTests(
 	}
 }
 
+// SetProvenance sets the tracker notified about the peers announcing and
+// delivering transactions. It must be called before the fetcher is started.
+func (f *TxFetcher) SetProvenance(provenance TxProvenance) {
+	f.provenance = provenance
+}
+
 // Notify announces the fetcher of the potential availability of a new batch of
 // transactions in the network.
 func (f *TxFetcher) Notify(peer string, hashes []common.Hash) error {
 	// Keep track of all the announced transactions
 	txAnnounceInMeter.Mark(int64(len(hashes)))
+	if f.provenance != nil {
+		f.provenance.RecordTxAnnouncements(peer, hashes, time.Now())
+	}
 
 	// Skip any transaction announcements that we already know of, or that we've
 	// previously marked as cheap and discarded. This check is of course racey,
@@ -295,6 +317,9 @@ func (f *TxFetcher) Enqueue(peer string, txs []*types.Transaction, direct bool)
 	} else {
 		txBroadcastInMeter.Mark(int64(len(txs)))
 	}
+	if f.provenance != nil {
+		f.provenance.RecordTxDeliveries(peer, txs, direct, time.Now())
+	}
 	// Push all the transactions into the pool, tracking underpriced ones to avoid
 	// re-requesting them and dropping the peer in case of malicious transfers.
 	var (
@@ -238,6 +238,73 @@ func (f *Filter) unindexedLogs(ctx context.Context, end uint64) ([]*types.Log, e
 	return logs, nil
 }
 
+// scan calls fn with the header of every block up to end whose bloom may match
+// the filter criteria, using the bloom bits indexed where available, until fn
+// returns false. The start of the filter is moved past the visited blocks.
+func (f *Filter) scan(ctx context.Context, end uint64, fn func(header *types.Header) (bool, error)) error {
+	size, sections := f.backend.BloomStatus()
+	if indexed := sections * size; indexed > uint64(f.begin) {
+		last := end
+		if indexed <= end {
+			last = indexed - 1
+		}
+		matches := make(chan uint64, 64)
+
+		session, err := f.matcher.Start(ctx, uint64(f.begin), last, matches)
+		if err != nil {
+			return err
+		}
+		defer session.Close()
+
+		f.backend.ServiceFilter(ctx, session)
+
+	indexed:
+		for {
+			select {
+			case number, ok := <-matches:
+				if !ok {
+					if err := session.Error(); err != nil {
+						return err
+					}
+					f.begin = int64(last) + 1
+					break indexed
+				}
+				header, err := f.backend.HeaderByNumber(ctx, rpc.BlockNumber(number))
+				if err != nil {
+					return err
+				}
+				if header == nil {
+					return fmt.Errorf("block #%d not found", number)
+				}
+				f.begin = int64(number) + 1
+				if more, err := fn(header); !more || err != nil {
+					return err
+				}
+
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+	}
+	for f.begin <= int64(end) {
+		header, err := f.backend.HeaderByNumber(ctx, rpc.BlockNumber(f.begin))
+		if err != nil {
+			return err
+		}
+		if header == nil {
+			return fmt.Errorf("block #%d not found", f.begin)
+		}
+		f.begin++
+		if !bloomFilter(header.Bloom, f.addresses, f.topics) {
+			continue
+		}
+		if more, err := fn(header); !more || err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // blockLogs returns the logs matching the filter criteria within a single block.
 func (f *Filter) blockLogs(ctx context.Context, header *types.Header) (logs []*types.Log, err error) {
 	if bloomFilter(header.Bloom, f.addresses, f.topics) {
@@ -0,0 +1,202 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package filters
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+const (
+	// defaultLogPageSize is the number of logs returned per page if the client
+	// does not ask for a specific limit.
+	defaultLogPageSize = 1000
+
+	// maxLogPageSize is the maximum number of logs a client may ask per page.
+	maxLogPageSize = 10000
+
+	// logPageTokenLength is the length of a continuation token: the block and the
+	// log index to resume from, then the last block of the search.
+	logPageTokenLength = 8 + 4 + 8
+)
+
+var (
+	// errInvalidPageToken is returned if a continuation token cannot be decoded.
+	errInvalidPageToken = errors.New("invalid continuation token")
+
+	// errPagedBlockHash is returned if a paged search is requested for a single
+	// block hash instead of a block range.
+	errPagedBlockHash = errors.New("paged log search requires a block range")
+)
+
+// LogPageOptions are the paging options of a log search.
+type LogPageOptions struct {
+	Token     *hexutil.Bytes `json:"token"`     // Continuation token of the previous page
+	Limit     *hexutil.Uint  `json:"limit"`     // Maximum number of logs in the page
+	CountOnly bool           `json:"countOnly"` // Count the blocks possibly holding logs instead of returning logs
+}
+
+// LogPage is a page of the results of a log search.
+type LogPage struct {
+	Logs   []*types.Log    `json:"logs"`
+	Count  hexutil.Uint64  `json:"count"`            // Number of logs in the page
+	Blocks *hexutil.Uint64 `json:"blocks,omitempty"` // Number of blocks possibly holding logs, if counting only
+	Next   hexutil.Bytes   `json:"token,omitempty"`  // Continuation token, empty on the last page
+}
+
+// logPagePosition is the point a paged log search resumes from.
+type logPagePosition struct {
+	block uint64 // Next block to search
+	index uint   // Index of the first log to return within that block
+	end   uint64 // Last block of the search, pinned on the first page
+}
+
+// encode serialises the position into a continuation token.
+func (p *logPagePosition) encode() hexutil.Bytes {
+	token := make([]byte, logPageTokenLength)
+	binary.BigEndian.PutUint64(token[:8], p.block)
+	binary.BigEndian.PutUint32(token[8:12], uint32(p.index))
+	binary.BigEndian.PutUint64(token[12:], p.end)
+	return token
+}
+
+// decodeLogPagePosition parses a continuation token.
+func decodeLogPagePosition(token []byte) (*logPagePosition, error) {
+	if len(token) != logPageTokenLength {
+		return nil, errInvalidPageToken
+	}
+	pos := &logPagePosition{
+		block: binary.BigEndian.Uint64(token[:8]),
+		index: uint(binary.BigEndian.Uint32(token[8:12])),
+		end:   binary.BigEndian.Uint64(token[12:]),
+	}
+	if pos.block > pos.end {
+		return nil, errInvalidPageToken
+	}
+	return pos, nil
+}
+
+// GetLogsPaged returns a page of the logs matching the given criteria, along
+// with a token to request the next page with, if any. The criteria must stay
+// the same across the pages of a search; the block range is pinned by the
+// first page, later ones are positioned by the token.
+//
+// If the range limit is enabled, a page searches at most as many blocks as a
+// plain log query may, so a page can be cut short of the limit or even be empty
+// while more logs follow.
+//
+// In count only mode, no logs are returned. The blocks whose bloom matches the
+// criteria are counted instead, without retrieving their receipts. Blooms may
+// yield false positives, so the count is an upper bound of the blocks holding
+// matching logs.
+func (api *PublicFilterAPI) GetLogsPaged(ctx context.Context, crit FilterCriteria, opts *LogPageOptions) (*LogPage, error) {
+	if crit.BlockHash != nil {
+		return nil, errPagedBlockHash
+	}
+	if opts == nil {
+		opts = new(LogPageOptions)
+	}
+	limit := defaultLogPageSize
+	if opts.Limit != nil {
+		if *opts.Limit == 0 || *opts.Limit > maxLogPageSize {
+			return nil, fmt.Errorf("page limit must be between 1 and %d", maxLogPageSize)
+		}
+		limit = int(*opts.Limit)
+	}
+	// Resolve the position of the page, from the token or the criteria
+	var pos *logPagePosition
+	if opts.Token != nil {
+		var err error
+		if pos, err = decodeLogPagePosition(*opts.Token); err != nil {
+			return nil, err
+		}
+	} else {
+		header, err := api.backend.HeaderByNumber(ctx, rpc.LatestBlockNumber)
+		if err != nil {
+			return nil, err
+		}
+		if header == nil {
+			return &LogPage{Logs: returnLogs(nil)}, nil
+		}
+		head := header.Number.Uint64()
+
+		pos = &logPagePosition{block: head, end: head}
+		if crit.FromBlock != nil && crit.FromBlock.Sign() >= 0 {
+			pos.block = crit.FromBlock.Uint64()
+		}
+		if crit.ToBlock != nil && crit.ToBlock.Sign() >= 0 && crit.ToBlock.Uint64() < head {
+			pos.end = crit.ToBlock.Uint64()
+		}
+		if pos.block > pos.end {
+			return &LogPage{Logs: returnLogs(nil)}, nil
+		}
+	}
+	end := pos.end
+	if api.rangeLimit && end-pos.block > maxFilterBlockRange {
+		end = pos.block + maxFilterBlockRange
+	}
+	filter := NewRangeFilter(api.backend, int64(pos.block), int64(end), crit.Addresses, crit.Topics, false)
+
+	var (
+		page   = new(LogPage)
+		next   *logPagePosition
+		blocks hexutil.Uint64
+	)
+	err := filter.scan(ctx, end, func(header *types.Header) (bool, error) {
+		if opts.CountOnly {
+			blocks++
+			return true, nil
+		}
+		logs, err := filter.checkMatches(ctx, header)
+		if err != nil {
+			return false, err
+		}
+		for _, log := range logs {
+			if header.Number.Uint64() == pos.block && log.Index < pos.index {
+				continue // Returned by the previous page
+			}
+			if len(page.Logs) == limit {
+				next = &logPagePosition{block: log.BlockNumber, index: log.Index, end: pos.end}
+				return false, nil
+			}
+			page.Logs = append(page.Logs, log)
+		}
+		return len(page.Logs) < limit, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	page.Logs = returnLogs(page.Logs)
+	page.Count = hexutil.Uint64(len(page.Logs))
+	if opts.CountOnly {
+		page.Blocks = &blocks
+	}
+	// Resume from the cut log, or past the searched blocks if any are left
+	if next == nil && uint64(filter.begin) <= pos.end {
+		next = &logPagePosition{block: uint64(filter.begin), end: pos.end}
+	}
+	if next != nil {
+		page.Next = next.encode()
+	}
+	return page, nil
+}
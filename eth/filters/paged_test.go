@@ -0,0 +1,111 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package filters
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// Tests that paging through a log search returns every log exactly once, in
+// order, cutting pages within blocks where needed.
+func TestGetLogsPaged(t *testing.T) {
+	t.Parallel()
+
+	var (
+		db      = rawdb.NewMemoryDatabase()
+		backend = &testBackend{db: db}
+		api     = NewPublicFilterAPI(backend, false, deadline, false)
+		addr    = common.BytesToAddress([]byte("pair"))
+		genesis = core.GenesisBlockForTesting(db, addr, big.NewInt(1000000))
+	)
+	// Every other block has three matching logs
+	chain, receipts := core.GenerateChain(params.TestChainConfig, genesis, ethash.NewFaker(), db, 20, func(i int, gen *core.BlockGen) {
+		if i%2 == 0 {
+			receipt := types.NewReceipt(nil, false, 0)
+			receipt.Logs = []*types.Log{{Address: addr}, {Address: addr}, {Address: addr}}
+			gen.AddUncheckedReceipt(receipt)
+			gen.AddUncheckedTx(types.NewTransaction(uint64(i), common.Address{}, big.NewInt(1), 1, big.NewInt(1), nil))
+		}
+	})
+	for i, block := range chain {
+		rawdb.WriteBlock(db, block)
+		rawdb.WriteCanonicalHash(db, block.Hash(), block.NumberU64())
+		rawdb.WriteHeadBlockHash(db, block.Hash())
+		rawdb.WriteReceipts(db, block.Hash(), block.NumberU64(), receipts[i])
+	}
+	var (
+		crit  = FilterCriteria{FromBlock: big.NewInt(0), ToBlock: big.NewInt(int64(rpc.LatestBlockNumber)), Addresses: []common.Address{addr}}
+		limit = hexutil.Uint(4)
+		opts  = &LogPageOptions{Limit: &limit}
+		logs  []*types.Log
+	)
+	for pages := 0; ; pages++ {
+		if pages > 10 {
+			t.Fatalf("paging did not terminate")
+		}
+		page, err := api.GetLogsPaged(context.Background(), crit, opts)
+		if err != nil {
+			t.Fatalf("failed to retrieve page %d: %v", pages, err)
+		}
+		if len(page.Logs) > int(limit) || int(page.Count) != len(page.Logs) {
+			t.Fatalf("page %d: log count mismatch: have %d, count %d, limit %d", pages, len(page.Logs), page.Count, limit)
+		}
+		logs = append(logs, page.Logs...)
+		if len(page.Next) == 0 {
+			break
+		}
+		opts.Token = &page.Next
+	}
+	if len(logs) != 30 {
+		t.Fatalf("log count mismatch: have %d, want %d", len(logs), 30)
+	}
+	for i, log := range logs {
+		if number := uint64(i/3*2 + 1); log.BlockNumber != number || log.Index != uint(i%3) {
+			t.Errorf("log %d mismatch: have block %d index %d, want block %d index %d", i, log.BlockNumber, log.Index, number, i%3)
+		}
+	}
+	// Counting only visits the blocks matching the bloom filter
+	page, err := api.GetLogsPaged(context.Background(), crit, &LogPageOptions{CountOnly: true})
+	if err != nil {
+		t.Fatalf("failed to count blocks: %v", err)
+	}
+	if page.Blocks == nil || *page.Blocks != 10 {
+		t.Errorf("block count mismatch: have %v, want %d", page.Blocks, 10)
+	}
+	if page.Logs == nil || len(page.Logs) != 0 || page.Count != 0 || len(page.Next) != 0 {
+		t.Errorf("count only page mismatch: have logs %v, count %d, token %x", page.Logs, page.Count, page.Next)
+	}
+	// Invalid paging options are refused
+	invalid := hexutil.Bytes{0x01}
+	if _, err := api.GetLogsPaged(context.Background(), crit, &LogPageOptions{Token: &invalid}); err != errInvalidPageToken {
+		t.Errorf("invalid token: have %v, want %v", err, errInvalidPageToken)
+	}
+	if _, err := api.GetLogsPaged(context.Background(), FilterCriteria{BlockHash: &common.Hash{}}, nil); err != errPagedBlockHash {
+		t.Errorf("block hash search: have %v, want %v", err, errPagedBlockHash)
+	}
+}
@@ -0,0 +1,211 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package filters
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/gopool"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// errUnknownCursor is returned if the block of a log cursor is not known to
+// the node.
+var errUnknownCursor = errors.New("unknown cursor block")
+
+// LogCursor identifies the last log a client of a resumable log subscription
+// processed, by the hash of its block and its index within that block.
+type LogCursor struct {
+	BlockHash common.Hash  `json:"blockHash"`
+	LogIndex  hexutil.Uint `json:"logIndex"`
+}
+
+// logReplay is the backlog of logs a client missed since its cursor.
+type logReplay struct {
+	removed []*types.Log         // Delivered logs of the blocks reorged out since, newest first
+	logs    []*types.Log         // Logs of the canonical blocks after the cursor
+	blocks  map[common.Hash]bool // Blocks whose logs were replayed
+	head    uint64               // Number of the last replayed block
+}
+
+// ResumableLogs creates a subscription that fires for all new logs that match
+// the given filter criteria, like Logs. If a cursor is given, the subscription
+// first replays the logs after it: the already delivered logs of the blocks
+// reorged out since are sent again with the removed flag set, then the logs of
+// the canonical chain up to the head. The from and to blocks of the criteria
+// are ignored.
+func (api *PublicFilterAPI) ResumableLogs(ctx context.Context, crit FilterCriteria, cursor *LogCursor) (*rpc.Subscription, error) {
+	notifier, supported := rpc.NotifierFromContext(ctx)
+	if !supported {
+		return &rpc.Subscription{}, rpc.ErrNotificationsUnsupported
+	}
+	var (
+		rpcSub      = notifier.CreateSubscription()
+		matchedLogs = make(chan []*types.Log)
+		replayCh    = make(chan *logReplay, 1)
+		done        = make(chan struct{})
+	)
+	// Subscribe to the live logs before replaying, so none is lost in between
+	live := crit
+	live.FromBlock, live.ToBlock = nil, nil
+	logsSub, err := api.events.SubscribeLogs(ethereum.FilterQuery(live), matchedLogs)
+	if err != nil {
+		return nil, err
+	}
+	gopool.Submit(func() {
+		defer logsSub.Unsubscribe()
+
+		var (
+			replay    *logReplay
+			replaying = cursor != nil
+			pending   [][]*types.Log // Live logs arrived while replaying
+		)
+		deliver := func(logs []*types.Log) {
+			for _, log := range logs {
+				// Skip the live logs of the blocks already replayed, until the
+				// chain moved past the replayed head
+				if replay != nil && !log.Removed {
+					if log.BlockNumber > replay.head {
+						replay = nil
+					} else if replay.blocks[log.BlockHash] {
+						continue
+					}
+				}
+				notifier.Notify(rpcSub.ID, &log)
+			}
+		}
+		for {
+			select {
+			case logs := <-matchedLogs:
+				if replaying {
+					pending = append(pending, logs)
+					continue
+				}
+				deliver(logs)
+			case replay = <-replayCh:
+				for _, log := range append(replay.removed, replay.logs...) {
+					notifier.Notify(rpcSub.ID, &log)
+				}
+				for _, logs := range pending {
+					deliver(logs)
+				}
+				replaying, pending = false, nil
+			case <-done: // replay failed
+				return
+			case <-rpcSub.Err(): // client send an unsubscribe request
+				return
+			case <-notifier.Closed(): // connection dropped
+				return
+			}
+		}
+	})
+	if cursor == nil {
+		return rpcSub, nil
+	}
+	replay, err := api.replayLogs(ctx, crit, *cursor)
+	if err != nil {
+		close(done)
+		return nil, err
+	}
+	replayCh <- replay
+	return rpcSub, nil
+}
+
+// replayLogs collects the logs matching the filter criteria a client missed
+// since its cursor.
+func (api *PublicFilterAPI) replayLogs(ctx context.Context, crit FilterCriteria, cursor LogCursor) (*logReplay, error) {
+	header, err := api.backend.HeaderByHash(ctx, cursor.BlockHash)
+	if err != nil {
+		return nil, err
+	}
+	if header == nil {
+		return nil, errUnknownCursor
+	}
+	replay := &logReplay{blocks: make(map[common.Hash]bool)}
+
+	// Walk back from the cursor to the canonical chain, revoking the logs of the
+	// blocks reorged out on the way
+	for depth := 0; ; depth++ {
+		canonical, err := api.backend.HeaderByNumber(ctx, rpc.BlockNumber(header.Number.Int64()))
+		if err != nil {
+			return nil, err
+		}
+		if canonical != nil && canonical.Hash() == header.Hash() {
+			break
+		}
+		if api.rangeLimit && depth >= maxFilterBlockRange {
+			return nil, fmt.Errorf("exceed maximum block range: %d", maxFilterBlockRange)
+		}
+		logs, err := NewBlockFilter(api.backend, header.Hash(), crit.Addresses, crit.Topics).blockLogs(ctx, header)
+		if err != nil {
+			return nil, err
+		}
+		for i := len(logs) - 1; i >= 0; i-- {
+			if header.Hash() == cursor.BlockHash && logs[i].Index > uint(cursor.LogIndex) {
+				continue // Never delivered
+			}
+			removed := *logs[i]
+			removed.Removed = true
+			replay.removed = append(replay.removed, &removed)
+		}
+		if header, err = api.backend.HeaderByHash(ctx, header.ParentHash); err != nil {
+			return nil, err
+		}
+		if header == nil {
+			return nil, errUnknownCursor
+		}
+	}
+	// All logs of the canonical ancestor were delivered, unless it's the cursor
+	// block itself
+	begin := header.Number.Int64() + 1
+	if header.Hash() == cursor.BlockHash {
+		begin--
+	}
+	head, err := api.backend.HeaderByNumber(ctx, rpc.LatestBlockNumber)
+	if err != nil {
+		return nil, err
+	}
+	if head == nil {
+		return nil, errors.New("unknown head block")
+	}
+	replay.head = head.Number.Uint64()
+
+	if begin <= head.Number.Int64() {
+		logs, err := NewRangeFilter(api.backend, begin, head.Number.Int64(), crit.Addresses, crit.Topics, api.rangeLimit).Logs(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, log := range logs {
+			if log.BlockHash == cursor.BlockHash && log.Index <= uint(cursor.LogIndex) {
+				continue // Already delivered
+			}
+			replay.logs = append(replay.logs, log)
+			replay.blocks[log.BlockHash] = true
+		}
+		// The cursor block may still be delivered live, partially seen already
+		if begin == header.Number.Int64() {
+			replay.blocks[cursor.BlockHash] = true
+		}
+	}
+	return replay, nil
+}
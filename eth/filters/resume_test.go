@@ -0,0 +1,116 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package filters
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// Tests that the logs missed since a cursor are replayed, revoking the ones of
+// the blocks reorged out in the meantime.
+func TestReplayLogs(t *testing.T) {
+	t.Parallel()
+
+	var (
+		db      = rawdb.NewMemoryDatabase()
+		backend = &testBackend{db: db}
+		api     = NewPublicFilterAPI(backend, false, deadline, false)
+		addr    = common.BytesToAddress([]byte("dex"))
+		genesis = core.GenesisBlockForTesting(db, addr, big.NewInt(1000000))
+	)
+	// Every block has two logs, the fork diverges after block 5
+	generate := func(parent *types.Block, n int, coinbase common.Address) []*types.Block {
+		blocks, receipts := core.GenerateChain(params.TestChainConfig, parent, ethash.NewFaker(), db, n, func(i int, gen *core.BlockGen) {
+			gen.SetCoinbase(coinbase)
+			receipt := types.NewReceipt(nil, false, 0)
+			receipt.Logs = []*types.Log{{Address: addr}, {Address: addr}}
+			gen.AddUncheckedReceipt(receipt)
+			gen.AddUncheckedTx(types.NewTransaction(uint64(i), common.Address{}, big.NewInt(1), 1, big.NewInt(1), nil))
+		})
+		for i, block := range blocks {
+			rawdb.WriteBlock(db, block)
+			rawdb.WriteCanonicalHash(db, block.Hash(), block.NumberU64())
+			rawdb.WriteHeadBlockHash(db, block.Hash())
+			rawdb.WriteReceipts(db, block.Hash(), block.NumberU64(), receipts[i])
+		}
+		return blocks
+	}
+	old := generate(genesis, 10, common.Address{0x01})
+	fork := generate(old[4], 6, common.Address{0x02})
+
+	tests := []struct {
+		cursor  LogCursor
+		removed []common.Hash // Blocks of the removed logs
+		logs    []common.Hash // Blocks of the replayed logs
+	}{
+		// Cursor reorged out, revoke up to the fork point and replay the new chain
+		{
+			cursor:  LogCursor{BlockHash: old[7].Hash(), LogIndex: 0},
+			removed: []common.Hash{old[7].Hash(), old[6].Hash(), old[6].Hash(), old[5].Hash(), old[5].Hash()},
+			logs: []common.Hash{
+				fork[0].Hash(), fork[0].Hash(), fork[1].Hash(), fork[1].Hash(), fork[2].Hash(), fork[2].Hash(),
+				fork[3].Hash(), fork[3].Hash(), fork[4].Hash(), fork[4].Hash(), fork[5].Hash(), fork[5].Hash(),
+			},
+		},
+		// Canonical cursor, replay the rest of its block and the following ones
+		{
+			cursor: LogCursor{BlockHash: fork[3].Hash(), LogIndex: 0},
+			logs:   []common.Hash{fork[3].Hash(), fork[4].Hash(), fork[4].Hash(), fork[5].Hash(), fork[5].Hash()},
+		},
+		// Cursor at the last log, nothing to replay
+		{
+			cursor: LogCursor{BlockHash: fork[5].Hash(), LogIndex: 1},
+		},
+	}
+	for i, tt := range tests {
+		replay, err := api.replayLogs(context.Background(), FilterCriteria{Addresses: []common.Address{addr}}, tt.cursor)
+		if err != nil {
+			t.Fatalf("test %d: failed to replay logs: %v", i, err)
+		}
+		if len(replay.removed) != len(tt.removed) {
+			t.Fatalf("test %d: removed log count mismatch: have %d, want %d", i, len(replay.removed), len(tt.removed))
+		}
+		for j, log := range replay.removed {
+			if log.BlockHash != tt.removed[j] || !log.Removed {
+				t.Errorf("test %d: removed log %d mismatch: have %x (removed %v), want %x", i, j, log.BlockHash, log.Removed, tt.removed[j])
+			}
+		}
+		if len(replay.logs) != len(tt.logs) {
+			t.Fatalf("test %d: log count mismatch: have %d, want %d", i, len(replay.logs), len(tt.logs))
+		}
+		for j, log := range replay.logs {
+			if log.BlockHash != tt.logs[j] || log.Removed {
+				t.Errorf("test %d: log %d mismatch: have %x (removed %v), want %x", i, j, log.BlockHash, log.Removed, tt.logs[j])
+			}
+		}
+		if replay.head != fork[5].NumberU64() {
+			t.Errorf("test %d: replay head mismatch: have %d, want %d", i, replay.head, fork[5].NumberU64())
+		}
+	}
+	if _, err := api.replayLogs(context.Background(), FilterCriteria{}, LogCursor{BlockHash: common.Hash{0xff}}); err != errUnknownCursor {
+		t.Errorf("unknown cursor: have %v, want %v", err, errUnknownCursor)
+	}
+}
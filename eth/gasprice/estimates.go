@@ -0,0 +1,248 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package gasprice
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// EstimateConfidences are the confidences, in percent, of landing in the next
+// block the estimates are reported for.
+var EstimateConfidences = []int{50, 75, 90, 99}
+
+// Estimate is the gas price needed to land in the next block with the given
+// confidence.
+type Estimate struct {
+	Confidence int          `json:"confidence"`
+	Price      *hexutil.Big `json:"price"`
+}
+
+// Estimates are the gas price estimates of all the oracle modes.
+type Estimates struct {
+	BlockNumber    hexutil.Uint64 `json:"blockNumber"`
+	Percentile     *hexutil.Big   `json:"percentile"`     // Percentile of the recent transaction prices
+	FullBlockRatio float64        `json:"fullBlockRatio"` // Fraction of the recent blocks that were full
+	Pool           []Estimate     `json:"pool,omitempty"` // Prices to outbid the pending pool, full nodes only
+	Congestion     []Estimate     `json:"congestion"`     // Prices given how many recent blocks were full
+}
+
+// congestionStats sums up how contended the recent blocks were.
+type congestionStats struct {
+	blocks     int        // Number of blocks sampled
+	full       int        // Number of full blocks sampled
+	fullPrices []*big.Int // Lowest gas prices included in the full blocks sampled, sorted
+}
+
+// Estimates returns the gas prices needed to land in the next block with each
+// of the EstimateConfidences, per oracle mode.
+func (gpo *Oracle) Estimates(ctx context.Context) (*Estimates, error) {
+	head, err := gpo.backend.HeaderByNumber(ctx, rpc.LatestBlockNumber)
+	if err != nil {
+		return nil, err
+	}
+	if head == nil {
+		return nil, errors.New("unknown head block")
+	}
+	base, err := gpo.percentilePrice(ctx)
+	if err != nil {
+		return nil, err
+	}
+	stats, err := gpo.congestion(ctx, head)
+	if err != nil {
+		return nil, err
+	}
+	estimates := &Estimates{
+		BlockNumber: hexutil.Uint64(head.Number.Uint64()),
+		Percentile:  (*hexutil.Big)(base),
+	}
+	if stats.blocks > 0 {
+		estimates.FullBlockRatio = float64(stats.full) / float64(stats.blocks)
+	}
+	var pending types.Transactions
+	if gpo.pool != nil {
+		if pending, err = gpo.pending(head); err != nil {
+			return nil, err
+		}
+	}
+	for _, confidence := range EstimateConfidences {
+		if gpo.pool != nil {
+			price := gpo.capPrice(outbidPool(pending, usableGas(head.GasLimit), base, confidence))
+			estimates.Pool = append(estimates.Pool, Estimate{Confidence: confidence, Price: (*hexutil.Big)(price)})
+		}
+		price := gpo.capPrice(stats.price(base, confidence))
+		estimates.Congestion = append(estimates.Congestion, Estimate{Confidence: confidence, Price: (*hexutil.Big)(price)})
+	}
+	return estimates, nil
+}
+
+// poolPrice returns the gas price needed to land in the next block with the
+// given confidence, given the transactions pending in the pool.
+func (gpo *Oracle) poolPrice(ctx context.Context, base *big.Int, confidence int) (*big.Int, error) {
+	head, err := gpo.backend.HeaderByNumber(ctx, rpc.LatestBlockNumber)
+	if err != nil {
+		return nil, err
+	}
+	if head == nil {
+		return nil, errors.New("unknown head block")
+	}
+	pending, err := gpo.pending(head)
+	if err != nil {
+		return nil, err
+	}
+	return outbidPool(pending, usableGas(head.GasLimit), base, confidence), nil
+}
+
+// congestionPrice returns the gas price needed to land in the next block with
+// the given confidence, given how many of the recent blocks were full.
+func (gpo *Oracle) congestionPrice(ctx context.Context, base *big.Int, confidence int) (*big.Int, error) {
+	head, err := gpo.backend.HeaderByNumber(ctx, rpc.LatestBlockNumber)
+	if err != nil {
+		return nil, err
+	}
+	if head == nil {
+		return nil, errors.New("unknown head block")
+	}
+	stats, err := gpo.congestion(ctx, head)
+	if err != nil {
+		return nil, err
+	}
+	return stats.price(base, confidence), nil
+}
+
+// pending returns the transactions pending in the pool, sorted by decreasing
+// gas price, cached for the current head.
+func (gpo *Oracle) pending(head *types.Header) (types.Transactions, error) {
+	gpo.pendingLock.Lock()
+	defer gpo.pendingLock.Unlock()
+
+	if gpo.pendingHead == head.Hash() && gpo.pendingTxs != nil {
+		return gpo.pendingTxs, nil
+	}
+	pending, err := gpo.pool.TxPool().Pending()
+	if err != nil {
+		return nil, err
+	}
+	txs := make(types.Transactions, 0, len(pending))
+	for _, batch := range pending {
+		txs = append(txs, batch...)
+	}
+	sort.Sort(sort.Reverse(transactionsByGasPrice(txs)))
+
+	gpo.pendingHead, gpo.pendingTxs = head.Hash(), txs
+	return txs, nil
+}
+
+// usableGas returns the gas of a block left to the user transactions, once the
+// gas reserved for the system transactions is set aside.
+func usableGas(gasLimit uint64) uint64 {
+	if gasLimit < params.SystemTxsGas {
+		return 0
+	}
+	return gasLimit - params.SystemTxsGas
+}
+
+// blockFull returns whether a block had no room left for another transaction.
+func blockFull(gasLimit, gasUsed uint64) bool {
+	return gasUsed+params.TxGas > usableGas(gasLimit)
+}
+
+// outbidPool returns the gas price placing a transaction among the pending ones
+// so that the gas of the better priced ones leaves it room in the next block.
+// The higher the confidence, the less room is assumed to be left to pending
+// transactions, accounting for the ones arriving before the block is sealed.
+func outbidPool(pending types.Transactions, gasLimit uint64, base *big.Int, confidence int) *big.Int {
+	var (
+		budget = gasLimit / 100 * uint64(100-confidence)
+		gas    uint64
+	)
+	for _, tx := range pending {
+		if gas += tx.Gas(); gas+params.TxGas > budget {
+			if price := new(big.Int).Add(tx.GasPrice(), common.Big1); price.Cmp(base) > 0 {
+				return price
+			}
+			break
+		}
+	}
+	return base
+}
+
+// congestion returns the congestion stats of the recent blocks, cached for the
+// current head.
+func (gpo *Oracle) congestion(ctx context.Context, head *types.Header) (*congestionStats, error) {
+	gpo.statsLock.Lock()
+	defer gpo.statsLock.Unlock()
+
+	if gpo.statsHead == head.Hash() && gpo.stats != nil {
+		return gpo.stats, nil
+	}
+	stats := new(congestionStats)
+	for number := head.Number.Uint64(); stats.blocks < gpo.checkBlocks && number > 0; number-- {
+		block, err := gpo.backend.BlockByNumber(ctx, rpc.BlockNumber(number))
+		if err != nil {
+			return nil, err
+		}
+		if block == nil {
+			break
+		}
+		stats.blocks++
+		if !blockFull(block.GasLimit(), block.GasUsed()) {
+			continue
+		}
+		stats.full++
+		signer := types.MakeSigner(gpo.backend.ChainConfig(), block.Number())
+		if prices := blockPrices(block, signer, 1); len(prices) > 0 {
+			stats.fullPrices = append(stats.fullPrices, prices[0])
+		}
+	}
+	sort.Sort(bigIntArray(stats.fullPrices))
+
+	gpo.statsHead, gpo.stats = head.Hash(), stats
+	return stats, nil
+}
+
+// price returns the gas price needed to land in the next block with the given
+// confidence. A block that is not full includes any transaction priced at the
+// base, so only the confidence beyond the share of such blocks needs to beat
+// the lowest price included in the full ones.
+func (s *congestionStats) price(base *big.Int, confidence int) *big.Int {
+	if s.blocks == 0 || len(s.fullPrices) == 0 {
+		return base
+	}
+	open := 100 * (s.blocks - s.full) // Chance of an open block, scaled by the sample size
+	if confidence*s.blocks <= open {
+		return base
+	}
+	// Pick the rank among the full blocks matching the conditional confidence
+	needed := confidence*s.blocks - open
+	index := (needed*len(s.fullPrices)+100*s.full-1)/(100*s.full) - 1
+	if index >= len(s.fullPrices) {
+		index = len(s.fullPrices) - 1
+	}
+	if price := s.fullPrices[index]; price.Cmp(base) > 0 {
+		return price
+	}
+	return base
+}
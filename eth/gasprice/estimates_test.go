@@ -0,0 +1,139 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package gasprice
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+func TestOutbidPool(t *testing.T) {
+	var (
+		base    = big.NewInt(5)
+		pending types.Transactions
+	)
+	// Ten transactions of a tenth of the block each, priced 100 down to 10
+	for i := 10; i > 0; i-- {
+		pending = append(pending, types.NewTransaction(0, common.Address{}, nil, 100000, big.NewInt(int64(i*10)), nil))
+	}
+	tests := []struct {
+		pending    types.Transactions
+		confidence int
+		want       int64
+	}{
+		{nil, 99, 5},           // Empty pool, the base suffices
+		{pending[:2], 50, 5},   // Room left in half the block
+		{pending, 50, 61},      // Five transactions fit ahead in half the block
+		{pending, 90, 101},     // No room left ahead in a tenth of the block
+		{pending[8:], 80, 11},  // Two transactions fit ahead, but not with ours
+		{pending[9:], 80, 5},   // The only transaction leaves room for ours
+		{pending[9:], 100, 11}, // Outbid all at full confidence
+	}
+	for i, tt := range tests {
+		if price := outbidPool(tt.pending, 1000000, base, tt.confidence); price.Int64() != tt.want {
+			t.Errorf("test %d: price mismatch: have %d, want %d", i, price, tt.want)
+		}
+	}
+}
+
+func TestBlockFull(t *testing.T) {
+	tests := []struct {
+		gasLimit, gasUsed uint64
+		full              bool
+	}{
+		{30000000, 0, false},
+		{30000000, 30000000 - params.SystemTxsGas - params.TxGas, false}, // Room left for one transaction
+		{30000000, 30000000 - params.SystemTxsGas - params.TxGas + 1, true},
+		{30000000, 30000000 - params.TxGas, true}, // Only the system transactions reserve left
+		{params.SystemTxsGas, 0, true},
+	}
+	for i, tt := range tests {
+		if full := blockFull(tt.gasLimit, tt.gasUsed); full != tt.full {
+			t.Errorf("test %d: full mismatch: have %v, want %v", i, full, tt.full)
+		}
+	}
+}
+
+func TestCongestionPrice(t *testing.T) {
+	base := big.NewInt(5)
+	prices := func(values ...int64) []*big.Int {
+		var prices []*big.Int
+		for _, value := range values {
+			prices = append(prices, big.NewInt(value))
+		}
+		return prices
+	}
+	tests := []struct {
+		stats      congestionStats
+		confidence int
+		want       int64
+	}{
+		{congestionStats{}, 90, 5},                                                 // Nothing sampled
+		{congestionStats{blocks: 10}, 99, 5},                                       // No full block
+		{congestionStats{blocks: 10, full: 2, fullPrices: prices(10, 20)}, 80, 5},  // Open blocks suffice
+		{congestionStats{blocks: 10, full: 2, fullPrices: prices(10, 20)}, 90, 10}, // Beat half the full blocks
+		{congestionStats{blocks: 10, full: 2, fullPrices: prices(10, 20)}, 99, 20}, // Beat all full blocks
+		{congestionStats{blocks: 4, full: 4, fullPrices: prices(1, 2, 3, 4)}, 50, 5},
+		{congestionStats{blocks: 4, full: 4, fullPrices: prices(6, 7, 8, 9)}, 75, 8},
+	}
+	for i, tt := range tests {
+		if price := tt.stats.price(base, tt.confidence); price.Int64() != tt.want {
+			t.Errorf("test %d: price mismatch: have %d, want %d", i, price, tt.want)
+		}
+	}
+}
+
+func TestEstimates(t *testing.T) {
+	config := Config{
+		Blocks:     3,
+		Percentile: 60,
+		Default:    big.NewInt(params.GWei),
+		Mode:       ModePool,
+	}
+	backend := newTestBackend(t)
+	oracle := NewOracle(backend, config)
+
+	// Without a transaction pool, the pool mode is unavailable
+	if oracle.mode != ModePercentile {
+		t.Fatalf("oracle mode mismatch: have %s, want %s", oracle.mode, ModePercentile)
+	}
+	estimates, err := oracle.Estimates(context.Background())
+	if err != nil {
+		t.Fatalf("failed to retrieve estimates: %v", err)
+	}
+	if estimates.Pool != nil {
+		t.Errorf("pool estimates without transaction pool: %v", estimates.Pool)
+	}
+	// None of the test blocks is full, the percentile price lands in any
+	expect := big.NewInt(params.GWei * int64(30))
+	if estimates.Percentile.ToInt().Cmp(expect) != 0 || estimates.FullBlockRatio != 0 {
+		t.Fatalf("estimates mismatch: have %v (full %v), want %v", estimates.Percentile, estimates.FullBlockRatio, expect)
+	}
+	if len(estimates.Congestion) != len(EstimateConfidences) {
+		t.Fatalf("congestion estimate count mismatch: have %d, want %d", len(estimates.Congestion), len(EstimateConfidences))
+	}
+	for _, estimate := range estimates.Congestion {
+		if estimate.Price.ToInt().Cmp(expect) != 0 {
+			t.Errorf("congestion estimate mismatch at %d%%: have %v, want %v", estimate.Confidence, estimate.Price, expect)
+		}
+	}
+}
@@ -23,6 +23,7 @@ import (
 	"sync"
 
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/log"
 	"github.com/ethereum/go-ethereum/params"
@@ -31,6 +32,17 @@ import (
 
 const sampleNumber = 3 // Number of transactions sampled in a block
 
+// Oracle modes, selecting the strategy behind the suggested gas price.
+const (
+	ModePercentile = "percentile" // Percentile of the recent transaction prices
+	ModePool       = "pool"       // Price to outbid the pending pool into the next block
+	ModeCongestion = "congestion" // Price to land in the next block given how many recent ones were full
+)
+
+// DefaultConfidence is the confidence, in percent, of landing in the next block
+// the pool and congestion modes suggest a price for.
+const DefaultConfidence = 90
+
 var DefaultMaxPrice = big.NewInt(500 * params.GWei)
 
 type Config struct {
@@ -39,6 +51,8 @@ type Config struct {
 	Default         *big.Int `toml:",omitempty"`
 	MaxPrice        *big.Int `toml:",omitempty"`
 	OracleThreshold int      `toml:",omitempty"`
+	Mode            string   `toml:",omitempty"`
+	Confidence      int      `toml:",omitempty"`
 }
 
 // OracleBackend includes all necessary background APIs for oracle.
@@ -48,21 +62,38 @@ type OracleBackend interface {
 	ChainConfig() *params.ChainConfig
 }
 
+// PoolBackend is implemented by the oracle backends of full nodes, giving
+// access to the pending transactions of the pool.
+type PoolBackend interface {
+	TxPool() *core.TxPool
+}
+
 // Oracle recommends gas prices based on the content of recent
 // blocks. Suitable for both light and full clients.
 type Oracle struct {
 	backend   OracleBackend
+	pool      PoolBackend
 	lastHead  common.Hash
 	lastPrice *big.Int
 	maxPrice  *big.Int
 	cacheLock sync.RWMutex
 	fetchLock sync.Mutex
 
+	statsHead common.Hash
+	stats     *congestionStats
+	statsLock sync.Mutex
+
+	pendingHead common.Hash
+	pendingTxs  types.Transactions
+	pendingLock sync.Mutex
+
 	defaultPrice      *big.Int
 	sampleTxThreshold int
 
 	checkBlocks int
 	percentile  int
+	mode        string
+	confidence  int
 }
 
 // NewOracle returns a new gasprice oracle which can recommend suitable
@@ -87,12 +118,38 @@ func NewOracle(backend OracleBackend, params Config) *Oracle {
 		maxPrice = DefaultMaxPrice
 		log.Warn("Sanitizing invalid gasprice oracle price cap", "provided", params.MaxPrice, "updated", maxPrice)
 	}
+	pool, _ := backend.(PoolBackend)
+
+	mode := params.Mode
+	switch mode {
+	case "":
+		mode = ModePercentile
+	case ModePercentile, ModeCongestion:
+	case ModePool:
+		if pool == nil {
+			mode = ModePercentile
+			log.Warn("Sanitizing gasprice oracle mode without transaction pool", "provided", params.Mode, "updated", mode)
+		}
+	default:
+		mode = ModePercentile
+		log.Warn("Sanitizing invalid gasprice oracle mode", "provided", params.Mode, "updated", mode)
+	}
+	confidence := params.Confidence
+	if confidence <= 0 || confidence > 100 {
+		confidence = DefaultConfidence
+		if params.Confidence != 0 {
+			log.Warn("Sanitizing invalid gasprice oracle confidence", "provided", params.Confidence, "updated", confidence)
+		}
+	}
 	return &Oracle{
 		backend:           backend,
+		pool:              pool,
 		lastPrice:         params.Default,
 		maxPrice:          maxPrice,
 		checkBlocks:       blocks,
 		percentile:        percent,
+		mode:              mode,
+		confidence:        confidence,
 		defaultPrice:      params.Default,
 		sampleTxThreshold: params.OracleThreshold,
 	}
@@ -101,6 +158,28 @@ func NewOracle(backend OracleBackend, params Config) *Oracle {
 // SuggestPrice returns a gasprice so that newly created transaction can
 // have a very high chance to be included in the following blocks.
 func (gpo *Oracle) SuggestPrice(ctx context.Context) (*big.Int, error) {
+	if gpo.mode == ModePercentile {
+		return gpo.percentilePrice(ctx)
+	}
+	base, err := gpo.percentilePrice(ctx)
+	if err != nil {
+		return base, err
+	}
+	var price *big.Int
+	if gpo.mode == ModePool {
+		price, err = gpo.poolPrice(ctx, base, gpo.confidence)
+	} else {
+		price, err = gpo.congestionPrice(ctx, base, gpo.confidence)
+	}
+	if err != nil {
+		return base, err
+	}
+	return gpo.capPrice(price), nil
+}
+
+// percentilePrice returns the configured percentile of the gas prices of the
+// recent transactions.
+func (gpo *Oracle) percentilePrice(ctx context.Context) (*big.Int, error) {
 	head, _ := gpo.backend.HeaderByNumber(ctx, rpc.LatestBlockNumber)
 	headHash := head.Hash()
 
@@ -171,9 +250,8 @@ func (gpo *Oracle) SuggestPrice(ctx context.Context) (*big.Int, error) {
 	} else {
 		price = gpo.defaultPrice
 	}
-	if price.Cmp(gpo.maxPrice) > 0 {
-		price = new(big.Int).Set(gpo.maxPrice)
-	}
+	price = gpo.capPrice(price)
+
 	gpo.cacheLock.Lock()
 	gpo.lastHead = headHash
 	gpo.lastPrice = price
@@ -206,6 +284,16 @@ func (gpo *Oracle) getBlockPrices(ctx context.Context, signer types.Signer, bloc
 		}
 		return
 	}
+	prices := blockPrices(block, signer, limit)
+	select {
+	case result <- getBlockPricesResult{len(prices), prices, nil}:
+	case <-quit:
+	}
+}
+
+// blockPrices returns the lowest gas prices of the transactions in a block, up
+// to the given limit, skipping the ones sent by the miner itself.
+func blockPrices(block *types.Block, signer types.Signer, limit int) []*big.Int {
 	blockTxs := block.Transactions()
 	txs := make([]*types.Transaction, len(blockTxs))
 	copy(txs, blockTxs)
@@ -224,10 +312,15 @@ func (gpo *Oracle) getBlockPrices(ctx context.Context, signer types.Signer, bloc
 			}
 		}
 	}
-	select {
-	case result <- getBlockPricesResult{len(prices), prices, nil}:
-	case <-quit:
+	return prices
+}
+
+// capPrice limits a suggested price to the configured maximum.
+func (gpo *Oracle) capPrice(price *big.Int) *big.Int {
+	if price.Cmp(gpo.maxPrice) > 0 {
+		return new(big.Int).Set(gpo.maxPrice)
 	}
+	return price
 }
 
 type bigIntArray []*big.Int
@@ -18,6 +18,7 @@ package eth
 
 import (
 	"errors"
+	"fmt"
 	"math"
 	"math/big"
 	"sync"
@@ -27,6 +28,7 @@ import (
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core"
 	"github.com/ethereum/go-ethereum/core/forkid"
+	"github.com/ethereum/go-ethereum/core/rawdb"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/eth/downloader"
 	"github.com/ethereum/go-ethereum/eth/fetcher"
@@ -37,6 +39,7 @@ import (
 	"github.com/ethereum/go-ethereum/event"
 	"github.com/ethereum/go-ethereum/log"
 	"github.com/ethereum/go-ethereum/p2p"
+	"github.com/ethereum/go-ethereum/p2p/enode"
 	"github.com/ethereum/go-ethereum/params"
 	"github.com/ethereum/go-ethereum/rlp"
 	"github.com/ethereum/go-ethereum/trie"
@@ -77,6 +80,10 @@ type txPool interface {
 	// SubscribeReannoTxsEvent should return an event subscription of
 	// ReannoTxsEvent and send events to the given channel.
 	SubscribeReannoTxsEvent(chan<- core.ReannoTxsEvent) event.Subscription
+
+	// IsPrivate returns whether the transaction was submitted privately and
+	// must not be propagated to the network.
+	IsPrivate(hash common.Hash) bool
 }
 
 // handlerConfig is the collection of initialization parameters to create a full
@@ -88,12 +95,14 @@ type handlerConfig struct {
 	Network                uint64                    // Network identifier to adfvertise
 	Sync                   downloader.SyncMode       // Whether to fast or full sync
 	DiffSync               bool                      // Whether to diff sync
+	DiffVerifyPeers        int                       // Number of peers asked to attest the diff layer of each new head
 	BloomCache             uint64                    // Megabytes to alloc for fast sync bloom
 	EventMux               *event.TypeMux            // Legacy event mux, deprecate for `feed`
 	Checkpoint             *params.TrustedCheckpoint // Hard coded checkpoint for sync challenges
 	Whitelist              map[uint64]common.Hash    // Hard coded whitelist for sync challenged
 	DirectBroadcast        bool
 	DisablePeerTxBroadcast bool
+	PrivatePeers           []string // Enode IDs of the trusted peers private transactions are relayed to
 }
 
 type handler struct {
@@ -128,15 +137,18 @@ type handler struct {
 	reannoTxsSub  event.Subscription
 	minedBlockSub *event.TypeMuxSubscription
 
-	whitelist map[uint64]common.Hash
+	whitelist    map[uint64]common.Hash
+	privatePeers map[string]struct{} // Trusted peers private transactions are relayed to
 
 	// channels for fetcher, syncer, txsyncLoop
 	txsyncCh chan *txsync
 	quitSync chan struct{}
 
-	chainSync *chainSyncer
-	wg        sync.WaitGroup
-	peerWG    sync.WaitGroup
+	chainSync    *chainSyncer
+	diffVerifier *diffVerifier    // Untrusted diff layer verifier, nil if diff sync is disabled
+	repairer     *ancientRepairer // Corrupted ancient items downloader, nil if nothing to repair
+	wg           sync.WaitGroup
+	peerWG       sync.WaitGroup
 }
 
 // newHandler returns a handler for all Ethereum chain management protocol.
@@ -159,6 +171,14 @@ func newHandler(config *handlerConfig) (*handler, error) {
 		diffSync:               config.DiffSync,
 		txsyncCh:               make(chan *txsync),
 		quitSync:               make(chan struct{}),
+		privatePeers:           make(map[string]struct{}),
+	}
+	for _, id := range config.PrivatePeers {
+		node, err := enode.ParseID(id)
+		if err != nil {
+			return nil, fmt.Errorf("invalid private transaction peer %q: %v", id, err)
+		}
+		h.privatePeers[node.String()] = struct{}{}
 	}
 	if config.Sync == downloader.FullSync {
 		// The database seems empty as the current block is the genesis. Yet the fast
@@ -250,7 +270,17 @@ func newHandler(config *handlerConfig) (*handler, error) {
 		return p.RequestTxs(hashes)
 	}
 	h.txFetcher = fetcher.NewTxFetcher(h.txpool.Has, h.txpool.AddRemotes, fetchTx)
+	if provenance, ok := h.txpool.(fetcher.TxProvenance); ok {
+		h.txFetcher.SetProvenance(provenance)
+	}
 	h.chainSync = newChainSyncer(h)
+	if h.diffSync {
+		h.diffVerifier = newDiffVerifier(h, config.DiffVerifyPeers)
+	}
+	if ranges := rawdb.ReadAncientRepairRanges(config.Database); len(ranges) > 0 {
+		log.Info("Repairing corrupted ancient items from the network", "ranges", len(ranges))
+		h.repairer = newAncientRepairer(h, ranges)
+	}
 	return h, nil
 }
 
@@ -459,12 +489,29 @@ func (h *handler) Start(maxPeers int) {
 	h.wg.Add(2)
 	go h.chainSync.loop()
 	go h.txsyncLoop64() // TODO(karalabe): Legacy initial tx echange, drop with eth/64.
+
+	// verify untrusted diff layers
+	if h.diffVerifier != nil {
+		h.wg.Add(1)
+		h.diffVerifier.start()
+	}
+	// download again the corrupted ancient items
+	if h.repairer != nil {
+		h.wg.Add(1)
+		h.repairer.start()
+	}
 }
 
 func (h *handler) Stop() {
 	h.txsSub.Unsubscribe()        // quits txBroadcastLoop
 	h.reannoTxsSub.Unsubscribe()  // quits txReannounceLoop
 	h.minedBlockSub.Unsubscribe() // quits blockBroadcastLoop
+	if h.diffVerifier != nil {
+		h.diffVerifier.stop() // quits diffVerifier.loop
+	}
+	if h.repairer != nil {
+		h.repairer.stop() // quits ancientRepairer.loop
+	}
 
 	// Quit chainSync and txsync64.
 	// After this is done, no new peers will be accepted.
@@ -553,6 +600,11 @@ func (h *handler) BroadcastTransactions(txs types.Transactions) {
 		annos = make(map[*ethPeer][]common.Hash) // Set peer->hash to announce
 
 	)
+	// Private transactions are only ever sent directly to trusted peers
+	txs = h.relayPrivateTransactions(txs)
+	if len(txs) == 0 {
+		return
+	}
 	//AMH: send my arb txs to a range of peers that do not overlap, send direct, not just announcement
 	//i'm assuming this list of txs may contain all of my arb txs i've pooled and not just one at a time assuming i sent fast enough from client..
 	arbTxs := make([]*types.Transaction, 0)
@@ -630,6 +682,39 @@ func (h *handler) BroadcastTransactions(txs types.Transactions) {
 	}
 }
 
+// relayPrivateTransactions sends the private transactions directly to the
+// trusted peers not yet knowing about them, and returns the remaining ones.
+func (h *handler) relayPrivateTransactions(txs types.Transactions) types.Transactions {
+	var (
+		public = make(types.Transactions, 0, len(txs))
+		txset  = make(map[*ethPeer][]common.Hash)
+	)
+	for _, tx := range txs {
+		if !h.txpool.IsPrivate(tx.Hash()) {
+			public = append(public, tx)
+			continue
+		}
+		for _, peer := range h.peers.peersWithoutTransaction(tx.Hash()) {
+			if h.isPrivatePeer(peer.ID()) {
+				txset[peer] = append(txset[peer], tx.Hash())
+			}
+		}
+	}
+	for peer, hashes := range txset {
+		peer.AsyncSendTransactions(hashes)
+	}
+	if len(public) < len(txs) {
+		log.Debug("Private transaction relay", "txs", len(txs)-len(public), "peers", len(txset))
+	}
+	return public
+}
+
+// isPrivatePeer returns whether private transactions may be relayed to the peer.
+func (h *handler) isPrivatePeer(id string) bool {
+	_, ok := h.privatePeers[id]
+	return ok
+}
+
 // ReannounceTransactions will announce a batch of local pending transactions
 // to a square root of all peers.
 func (h *handler) ReannounceTransactions(txs types.Transactions) {
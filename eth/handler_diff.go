@@ -70,6 +70,12 @@ func (h *diffHandler) Handle(peer *diff.Peer, packet diff.Packet) error {
 	case *diff.FullDiffLayersPacket:
 		return h.handleDiffLayerPackage(&packet.DiffLayersPacket, peer.ID(), true)
 
+	case *diff.DiffRootsPacket:
+		if h.diffVerifier != nil {
+			h.diffVerifier.deliverRoots(peer.ID(), packet.Roots)
+		}
+		return nil
+
 	default:
 		return fmt.Errorf("unexpected diff packet type: %T", packet)
 	}
@@ -60,6 +60,12 @@ func (h *ethHandler) AcceptTxs() bool {
 	return atomic.LoadUint32(&h.acceptTxs) == 1
 }
 
+// PrivateTxPeer retrieves whether the private transactions of the local pool
+// may be disclosed to the remote peer.
+func (h *ethHandler) PrivateTxPeer(peer *eth.Peer) bool {
+	return (*handler)(h).isPrivatePeer(peer.ID())
+}
+
 // Handle is invoked from a peer's message handler when it receives a new remote
 // message that the handler couldn't consume and serve itself.
 func (h *ethHandler) Handle(peer *eth.Peer, packet eth.Packet) error {
@@ -79,7 +85,13 @@ func (h *ethHandler) Handle(peer *eth.Peer, packet eth.Packet) error {
 		return nil
 
 	case *eth.ReceiptsPacket:
-		if err := h.downloader.DeliverReceipts(peer.ID(), *packet); err != nil {
+		receipts := [][]*types.Receipt(*packet)
+		if h.repairer != nil && len(receipts) > 0 {
+			if receipts = h.repairer.filterReceipts(peer.ID(), receipts); len(receipts) == 0 {
+				return nil
+			}
+		}
+		if err := h.downloader.DeliverReceipts(peer.ID(), receipts); err != nil {
 			log.Debug("Failed to deliver receipts", "err", err)
 		}
 		return nil
@@ -165,7 +177,10 @@ func (h *ethHandler) handleHeaders(peer *eth.Peer, headers []*types.Header) erro
 func (h *ethHandler) handleBodies(peer *eth.Peer, txs [][]*types.Transaction, uncles [][]*types.Header) error {
 	// Filter out any explicitly requested bodies, deliver the rest to the downloader
 	filter := len(txs) > 0 || len(uncles) > 0
-	if filter {
+	if filter && h.repairer != nil {
+		txs, uncles = h.repairer.filterBodies(peer.ID(), txs, uncles)
+	}
+	if filter && (len(txs) > 0 || len(uncles) > 0) {
 		txs, uncles = h.blockFetcher.FilterBodies(peer.ID(), txs, uncles, time.Now())
 	}
 	if len(txs) > 0 || len(uncles) > 0 || !filter {
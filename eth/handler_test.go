@@ -131,6 +131,12 @@ func (p *testTxPool) SubscribeReannoTxsEvent(ch chan<- core.ReannoTxsEvent) even
 	return p.reannoTxFeed.Subscribe(ch)
 }
 
+// IsPrivate returns whether the transaction was submitted privately, the mock
+// pool has no private transactions.
+func (p *testTxPool) IsPrivate(hash common.Hash) bool {
+	return false
+}
+
 // testHandler is a live implementation of the Ethereum protocol handler, just
 // preinitialized with some sane testing defaults and the transaction pool mocked
 // out.
@@ -310,6 +310,24 @@ func (ps *peerSet) headPeers(num uint) []*ethPeer {
 	return list
 }
 
+// diffRootPeers retrieves up to the specified number of `diff` peers able to
+// attest the diff layers they serve.
+func (ps *peerSet) diffRootPeers(num int) []*diffPeer {
+	ps.lock.RLock()
+	defer ps.lock.RUnlock()
+
+	list := make([]*diffPeer, 0, num)
+	for _, p := range ps.peers {
+		if len(list) >= num {
+			break
+		}
+		if p.diffExt != nil && p.diffExt.Version() >= diff.Diff2 {
+			list = append(list, p.diffExt)
+		}
+	}
+	return list
+}
+
 // peersWithoutBlock retrieves a list of peers that do not have a given block in
 // their set of known hashes so it might be propagated to them.
 func (ps *peerSet) peersWithoutBlock(hash common.Hash) []*ethPeer {
@@ -0,0 +1,398 @@
+package eth
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+const (
+	// pendingStateCheckpointInterval is the number of applied transactions after
+	// which a copy of the pending state is retained. Retrieving the state after an
+	// arbitrary transaction replays at most this many transactions.
+	pendingStateCheckpointInterval = 64
+
+	// chainHeadChanSize is the size of channel listening to ChainHeadEvent.
+	chainHeadChanSize = 10
+)
+
+var (
+	errPendingStateDisabled = errors.New("pending state simulator disabled")
+	errPendingStateNotReady = errors.New("pending state not yet initialized")
+
+	pendingStateResetTimer = metrics.NewRegisteredTimer("eth/pendingstate/reset", nil)
+	pendingStateApplyTimer = metrics.NewRegisteredTimer("eth/pendingstate/apply", nil)
+	pendingStateTxsMeter   = metrics.NewRegisteredMeter("eth/pendingstate/txs", nil)
+	pendingStateFailMeter  = metrics.NewRegisteredMeter("eth/pendingstate/failed", nil)
+)
+
+// pendingState maintains the state of the next block as it would look after
+// executing the pending pool transactions on top of the chain head. Contrary to
+// a Simulator fork, the state is long-lived: new pool transactions are applied
+// incrementally and only a new chain head triggers a full re-execution.
+//
+// Every batch of new transactions is executed in price and nonce order, batches
+// themselves are appended in arrival order. The resulting ordering approximates
+// the one of the next block without reshuffling already executed transactions.
+type pendingState struct {
+	chain  *core.BlockChain
+	txpool txPool
+	config *params.ChainConfig
+
+	header      *types.Header                         // Pending header the transactions are executed in
+	signer      types.Signer                          // Signer of the pending block
+	state       *state.StateDB                        // State after the last applied transaction
+	gasPool     *core.GasPool                         // Gas left in the pending block
+	gasUsed     uint64                                // Gas used by the applied transactions
+	txs         types.Transactions                    // Applied transactions in execution order
+	receipts    types.Receipts                        // Receipts of the applied transactions
+	checkpoints []*state.StateDB                      // State after every pendingStateCheckpointInterval transactions
+	future      map[common.Address]types.Transactions // Transactions waiting for a nonce gap to be filled
+	updated     time.Time                             // Time of the last state change
+	lock        sync.RWMutex                          // Protects the pending state fields
+
+	quit chan struct{}
+	wg   sync.WaitGroup
+}
+
+// newPendingState creates a pending state simulator tracking the given chain
+// and transaction pool. It needs to be started before use.
+func newPendingState(chain *core.BlockChain, txpool txPool) *pendingState {
+	return &pendingState{
+		chain:  chain,
+		txpool: txpool,
+		config: chain.Config(),
+		future: make(map[common.Address]types.Transactions),
+		quit:   make(chan struct{}),
+	}
+}
+
+// start forks the pending state off the current head and starts tracking new
+// chain heads and pool transactions.
+func (p *pendingState) start() {
+	p.wg.Add(1)
+	go p.loop()
+}
+
+// stop terminates the pending state simulator.
+func (p *pendingState) stop() {
+	close(p.quit)
+	p.wg.Wait()
+}
+
+func (p *pendingState) loop() {
+	defer p.wg.Done()
+
+	headCh := make(chan core.ChainHeadEvent, chainHeadChanSize)
+	headSub := p.chain.SubscribeChainHeadEvent(headCh)
+	defer headSub.Unsubscribe()
+
+	txsCh := make(chan core.NewTxsEvent, txChanSize)
+	txsSub := p.txpool.SubscribeNewTxsEvent(txsCh)
+	defer txsSub.Unsubscribe()
+
+	p.reset(p.chain.CurrentBlock())
+	for {
+		select {
+		case ev := <-headCh:
+			// Skip over intermediate heads if the chain progressed multiple blocks
+			head := ev.Block
+			for len(headCh) > 0 {
+				head = (<-headCh).Block
+			}
+			p.reset(head)
+
+		case ev := <-txsCh:
+			p.add(ev.Txs)
+
+		case <-txsSub.Err():
+			return
+		case <-headSub.Err():
+			return
+		case <-p.quit:
+			return
+		}
+	}
+}
+
+// reset forks a fresh pending state off the given block and executes all the
+// pending pool transactions on top.
+func (p *pendingState) reset(head *types.Block) {
+	start := time.Now()
+
+	statedb, err := p.chain.StateAt(head.Root())
+	if err != nil {
+		log.Warn("Failed to fork pending state", "number", head.Number(), "hash", head.Hash(), "err", err)
+		return
+	}
+	header := &types.Header{
+		ParentHash: head.Hash(),
+		Number:     new(big.Int).Add(head.Number(), common.Big1),
+		GasLimit:   head.GasLimit(),
+		Time:       head.Time() + 1,
+		Difficulty: head.Difficulty(),
+		Coinbase:   head.Coinbase(),
+	}
+	if p.config.Parlia != nil {
+		header.Time = head.Time() + p.config.Parlia.Period
+	}
+	gasPool := p.newGasPool(header)
+
+	pending, err := p.txpool.Pending()
+	if err != nil {
+		log.Warn("Failed to retrieve pending transactions", "err", err)
+	}
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.header = header
+	p.signer = types.MakeSigner(p.config, header.Number)
+	p.state = statedb
+	p.gasPool = gasPool
+	p.gasUsed = 0
+	p.txs = nil
+	p.receipts = nil
+	p.checkpoints = []*state.StateDB{statedb.Copy()}
+	p.future = make(map[common.Address]types.Transactions)
+
+	p.apply(pending)
+	pendingStateResetTimer.UpdateSince(start)
+
+	log.Debug("Reset pending state", "number", header.Number, "txs", len(p.txs), "gas", p.gasUsed, "elapsed", common.PrettyDuration(time.Since(start)))
+}
+
+// newGasPool creates the gas pool of the pending block, reserving the gas of the
+// system transactions the same way the miner does.
+func (p *pendingState) newGasPool(header *types.Header) *core.GasPool {
+	gasPool := new(core.GasPool).AddGas(header.GasLimit)
+	if p.config.IsEuler(header.Number) {
+		gasPool.SubGas(params.SystemTxsGas * 3)
+	} else {
+		gasPool.SubGas(params.SystemTxsGas)
+	}
+	return gasPool
+}
+
+// add executes a batch of new pool transactions on top of the pending state.
+func (p *pendingState) add(txs types.Transactions) {
+	start := time.Now()
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if p.state == nil {
+		return
+	}
+	batch := make(map[common.Address]types.Transactions)
+	for _, tx := range txs {
+		from, err := types.Sender(p.signer, tx)
+		if err != nil {
+			continue
+		}
+		batch[from] = append(batch[from], tx)
+	}
+	p.apply(batch)
+	pendingStateApplyTimer.UpdateSince(start)
+}
+
+// apply executes the given transactions in price and nonce order. Transactions
+// not executable yet due to a nonce gap are retained until the gap is filled.
+//
+// Note, this method assumes the state lock is held!
+func (p *pendingState) apply(batch map[common.Address]types.Transactions) {
+	ready := make(map[common.Address]types.Transactions, len(batch))
+	for from, txs := range batch {
+		txs = append(p.future[from], txs...)
+		delete(p.future, from)
+
+		sort.Sort(types.TxByNonce(txs))
+		nonce := p.state.GetNonce(from)
+		for _, tx := range txs {
+			switch {
+			case tx.Nonce() < nonce:
+				// Already executed, or a replacement of an executed transaction,
+				// which is only picked up on the next reset
+			case tx.Nonce() == nonce:
+				ready[from] = append(ready[from], tx)
+				nonce++
+			default:
+				p.future[from] = append(p.future[from], tx)
+			}
+		}
+	}
+	if len(ready) == 0 {
+		return
+	}
+	txs := types.NewTransactionsByPriceAndNonce(p.signer, ready)
+	for {
+		tx := txs.Peek()
+		if tx == nil {
+			break
+		}
+		err := p.commit(tx)
+		switch {
+		case errors.Is(err, core.ErrGasLimitReached):
+			// Pop the current out-of-gas transaction without shifting in the next from the account
+			txs.Pop()
+
+		case errors.Is(err, core.ErrNonceTooLow):
+			// Executed meanwhile by an earlier batch, shift in the next from the account
+			txs.Shift()
+
+		case errors.Is(err, core.ErrNonceTooHigh):
+			// Nonce gap within the account, skip the rest of it
+			txs.Pop()
+
+		case errors.Is(err, nil):
+			// Everything ok, shift in the next transaction from the same account
+			pendingStateTxsMeter.Mark(1)
+			txs.Shift()
+
+		case errors.Is(err, core.ErrTxTypeNotSupported):
+			// Pop the unsupported transaction without shifting in the next from the account
+			txs.Pop()
+
+		default:
+			// Strange error, discard the transaction and get the next in line (note, the
+			// nonce-too-high clause will prevent us from executing in vain).
+			txs.Shift()
+		}
+		if err != nil {
+			log.Trace("Skipping pending transaction", "hash", tx.Hash(), "err", err)
+			pendingStateFailMeter.Mark(1)
+		}
+	}
+	p.updated = time.Now()
+}
+
+// commit executes a single transaction on top of the pending state, retaining a
+// checkpoint of the resulting state if needed.
+//
+// Note, this method assumes the state lock is held!
+func (p *pendingState) commit(tx *types.Transaction) error {
+	var (
+		snap = p.state.Snapshot()
+		gas  = p.gasPool.Gas()
+	)
+	p.state.Prepare(tx.Hash(), common.Hash{}, len(p.txs))
+
+	receipt, err := core.ApplyTransaction(p.config, p.chain, &p.header.Coinbase, p.gasPool, p.state, p.header, tx, &p.gasUsed, *p.chain.GetVMConfig())
+	if err != nil {
+		p.state.RevertToSnapshot(snap)
+		p.gasPool = new(core.GasPool).AddGas(gas)
+		return err
+	}
+	p.txs = append(p.txs, tx)
+	p.receipts = append(p.receipts, receipt)
+
+	if len(p.txs)%pendingStateCheckpointInterval == 0 {
+		p.checkpoints = append(p.checkpoints, p.state.Copy())
+	}
+	return nil
+}
+
+// stateAt returns a copy of the pending state after executing the first n
+// pending transactions, along with the pending header. The returned state may
+// be freely modified by the caller.
+func (p *pendingState) stateAt(n int) (*state.StateDB, *types.Header, error) {
+	p.lock.RLock()
+	if p.state == nil {
+		p.lock.RUnlock()
+		return nil, nil, errPendingStateNotReady
+	}
+	if n < 0 || n > len(p.txs) {
+		count := len(p.txs)
+		p.lock.RUnlock()
+		return nil, nil, fmt.Errorf("pending transaction index %d out of range, have %d", n, count)
+	}
+	header := types.CopyHeader(p.header)
+	if n == len(p.txs) {
+		statedb := p.state.Copy()
+		p.lock.RUnlock()
+		return statedb, header, nil
+	}
+	var (
+		checkpoint = n / pendingStateCheckpointInterval
+		statedb    = p.checkpoints[checkpoint].Copy()
+		txs        = p.txs[checkpoint*pendingStateCheckpointInterval : n]
+		offset     = checkpoint * pendingStateCheckpointInterval
+	)
+	p.lock.RUnlock()
+
+	// Replay the transactions between the checkpoint and the requested index
+	var (
+		gasPool = p.newGasPool(header)
+		gasUsed uint64
+	)
+	for i, tx := range txs {
+		statedb.Prepare(tx.Hash(), common.Hash{}, offset+i)
+		if _, err := core.ApplyTransaction(p.config, p.chain, &header.Coinbase, gasPool, statedb, header, tx, &gasUsed, *p.chain.GetVMConfig()); err != nil {
+			return nil, nil, fmt.Errorf("failed to replay pending transaction %d (%s): %v", offset+i, tx.Hash().Hex(), err)
+		}
+	}
+	return statedb, header, nil
+}
+
+// transactions returns the executed pending transactions and their receipts.
+// The returned header and slices are copies, safe to use without the lock.
+func (p *pendingState) transactions() (*types.Header, types.Transactions, types.Receipts) {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+
+	var header *types.Header
+	if p.header != nil {
+		header = types.CopyHeader(p.header)
+	}
+	txs := make(types.Transactions, len(p.txs))
+	copy(txs, p.txs)
+
+	receipts := make(types.Receipts, len(p.receipts))
+	copy(receipts, p.receipts)
+
+	return header, txs, receipts
+}
+
+// PendingStateInfo summarizes the current pending state.
+type PendingStateInfo struct {
+	ParentHash common.Hash `json:"parentHash"`
+	Number     uint64      `json:"number"`
+	TxCount    int         `json:"txCount"`
+	Future     int         `json:"future"`
+	GasUsed    uint64      `json:"gasUsed"`
+	GasLimit   uint64      `json:"gasLimit"`
+	Updated    time.Time   `json:"updated"`
+}
+
+// info returns a summary of the current pending state.
+func (p *pendingState) info() (*PendingStateInfo, error) {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+
+	if p.state == nil {
+		return nil, errPendingStateNotReady
+	}
+	future := 0
+	for _, txs := range p.future {
+		future += len(txs)
+	}
+	return &PendingStateInfo{
+		ParentHash: p.header.ParentHash,
+		Number:     p.header.Number.Uint64(),
+		TxCount:    len(p.txs),
+		Future:     future,
+		GasUsed:    p.gasUsed,
+		GasLimit:   p.header.GasLimit,
+		Updated:    p.updated,
+	}, nil
+}
@@ -0,0 +1,105 @@
+package eth
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// waitPendingState blocks until the pending state reaches the expected number
+// of executed and future transactions.
+func waitPendingState(t *testing.T, p *pendingState, number uint64, txs int, future int) {
+	t.Helper()
+
+	var info *PendingStateInfo
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if info, _ = p.info(); info != nil && info.Number == number && info.TxCount == txs && info.Future == future {
+			return
+		}
+	}
+	t.Fatalf("pending state mismatch: have %+v, want number %d, txs %d, future %d", info, number, txs, future)
+}
+
+// Tests that the pending state applies new pool transactions incrementally,
+// holds back nonce gaps, serves the state after any transaction and resets on
+// new chain heads.
+func TestPendingState(t *testing.T) {
+	handler := newTestHandler()
+	defer handler.close()
+
+	pending := newPendingState(handler.chain, handler.txpool)
+	pending.start()
+	defer pending.stop()
+
+	waitPendingState(t, pending, 1, 0, 0)
+
+	var (
+		recipient = common.Address{0xde, 0xad}
+		amount    = big.NewInt(1000)
+		txs       = make([]*types.Transaction, 100)
+	)
+	for i := range txs {
+		txs[i], _ = types.SignTx(types.NewTransaction(uint64(i), recipient, amount, params.TxGas, big.NewInt(0), nil), types.HomesteadSigner{}, testKey)
+	}
+	// Transactions behind a nonce gap must be held back until the gap is filled
+	handler.txpool.AddRemotes([]*types.Transaction{txs[0], txs[2]})
+	waitPendingState(t, pending, 1, 1, 1)
+
+	handler.txpool.AddRemotes([]*types.Transaction{txs[1]})
+	waitPendingState(t, pending, 1, 3, 0)
+
+	handler.txpool.AddRemotes(txs[3:])
+	waitPendingState(t, pending, 1, len(txs), 0)
+
+	// Ensure the state after every transaction is retrievable, including those
+	// between and on checkpoints
+	for _, n := range []int{0, 1, 2, 3, 63, 64, 65, 99, 100} {
+		statedb, header, err := pending.stateAt(n)
+		if err != nil {
+			t.Fatalf("state after %d txs: failed to retrieve: %v", n, err)
+		}
+		if header.Number.Uint64() != 1 {
+			t.Errorf("state after %d txs: header number mismatch: have %d, want 1", n, header.Number)
+		}
+		if have, want := statedb.GetBalance(recipient), new(big.Int).Mul(amount, big.NewInt(int64(n))); have.Cmp(want) != 0 {
+			t.Errorf("state after %d txs: balance mismatch: have %v, want %v", n, have, want)
+		}
+		if have := statedb.GetNonce(testAddr); have != uint64(n) {
+			t.Errorf("state after %d txs: nonce mismatch: have %d, want %d", n, have, n)
+		}
+		// Modifying the returned state must not leak into the pending state
+		statedb.AddBalance(recipient, big.NewInt(1))
+	}
+	if _, _, err := pending.stateAt(len(txs) + 1); err == nil {
+		t.Errorf("expected error for out of range index")
+	}
+	// A new chain head must re-execute the pool on top of the new block
+	blocks, _ := core.GenerateChain(params.TestChainConfig, handler.chain.CurrentBlock(), ethash.NewFaker(), handler.db, 1, nil)
+	if _, err := handler.chain.InsertChain(blocks); err != nil {
+		t.Fatalf("failed to insert block: %v", err)
+	}
+	waitPendingState(t, pending, 2, len(txs), 0)
+
+	statedb, _, err := pending.stateAt(len(txs))
+	if err != nil {
+		t.Fatalf("failed to retrieve reset state: %v", err)
+	}
+	if have, want := statedb.GetBalance(recipient), new(big.Int).Mul(amount, big.NewInt(int64(len(txs)))); have.Cmp(want) != 0 {
+		t.Errorf("reset state balance mismatch: have %v, want %v", have, want)
+	}
+	// Modifying the returned transactions must not leak into the pending state
+	header, executed, receipts := pending.transactions()
+	header.Number.SetUint64(100)
+	executed[0], receipts[0] = nil, nil
+
+	header, executed, receipts = pending.transactions()
+	if header.Number.Uint64() != 2 || executed[0] == nil || receipts[0] == nil {
+		t.Errorf("pending state internals modified through returned transactions")
+	}
+}
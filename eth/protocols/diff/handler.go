@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/metrics"
 	"github.com/ethereum/go-ethereum/p2p"
 	"github.com/ethereum/go-ethereum/p2p/enode"
@@ -18,6 +19,9 @@ const (
 
 	// maxDiffLayerServe is the maximum number of diff layers to serve.
 	maxDiffLayerServe = 128
+
+	// maxDiffRootServe is the maximum number of diff layer roots to serve.
+	maxDiffRootServe = 1024
 )
 
 var requestTracker = NewTracker(time.Minute)
@@ -145,6 +149,28 @@ func handleMessage(backend Backend, peer *Peer) error {
 			return backend.Handle(peer, res)
 		}
 		return fmt.Errorf("%w: %v", errUnexpectedMsg, msg.Code)
+
+	case peer.Version() >= Diff2 && msg.Code == GetDiffRootsMsg:
+		res := new(GetDiffRootsPacket)
+		if err := msg.Decode(res); err != nil {
+			return fmt.Errorf("%w: message %v: %v", errDecode, msg, err)
+		}
+		return p2p.Send(peer.rw, DiffRootsMsg, &DiffRootsPacket{
+			RequestId: res.RequestId,
+			Roots:     answerDiffRootsQuery(backend, res),
+		})
+
+	case peer.Version() >= Diff2 && msg.Code == DiffRootsMsg:
+		// A batch of diff layer roots arrived to one of our previous requests
+		res := new(DiffRootsPacket)
+		if err := msg.Decode(res); err != nil {
+			return fmt.Errorf("%w: message %v: %v", errDecode, msg, err)
+		}
+		if fulfilled := requestTracker.Fulfil(peer.id, peer.version, DiffRootsMsg, res.RequestId); fulfilled {
+			return backend.Handle(peer, res)
+		}
+		return fmt.Errorf("%w: %v", errUnexpectedMsg, msg.Code)
+
 	default:
 		return fmt.Errorf("%w: %v", errInvalidMsgCode, msg.Code)
 	}
@@ -170,6 +196,32 @@ func answerDiffLayersQuery(backend Backend, query *GetDiffLayersPacket) []rlp.Ra
 	return diffLayers
 }
 
+func answerDiffRootsQuery(backend Backend, query *GetDiffRootsPacket) []DiffRoot {
+	// Gather roots until the fetch or network limits is reached, the diff
+	// layers being loaded and hashed count against the limit
+	var (
+		bytes int
+		roots []DiffRoot
+	)
+	for lookups, hash := range query.BlockHashes {
+		if bytes >= softResponseLimit || len(roots) >= maxDiffRootServe ||
+			lookups >= 2*maxDiffRootServe {
+			break
+		}
+		// Only the diff layers served to the peers are attested
+		data := backend.Chain().GetDiffLayerRLP(hash)
+		if len(data) == 0 {
+			continue
+		}
+		bytes += len(data)
+		roots = append(roots, DiffRoot{
+			BlockHash: hash,
+			DiffHash:  crypto.Keccak256Hash(data),
+		})
+	}
+	return roots
+}
+
 // NodeInfo represents a short summary of the `diff` sub-protocol metadata
 // known about the host peer.
 type NodeInfo struct{}
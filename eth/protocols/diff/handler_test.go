@@ -190,3 +190,33 @@ func testGetDiffLayers(t *testing.T, protocol uint) {
 		t.Errorf("test: diff layer mismatch: %v", err)
 	}
 }
+
+func TestGetDiffRoots(t *testing.T) { testGetDiffRoots(t, Diff2) }
+
+func testGetDiffRoots(t *testing.T, protocol uint) {
+	t.Parallel()
+
+	backend := newTestBackend(128)
+	defer backend.close()
+
+	peer, _ := newTestPeer("peer", protocol, backend)
+	defer peer.close()
+
+	// Roots are attested for the blocks with a diff layer, the rest are omitted
+	head := backend.chain.CurrentBlock()
+	data := backend.chain.GetDiffLayerRLP(head.Hash())
+	if len(data) == 0 {
+		t.Fatalf("Failed to find rlp encoded diff layer %v", head.Hash())
+	}
+	hashes := []common.Hash{head.Hash(), backend.chain.Genesis().Hash(), {0x01}}
+	p2p.Send(peer.app, GetDiffRootsMsg, GetDiffRootsPacket{RequestId: 111, BlockHashes: hashes})
+	if err := p2p.ExpectMsg(peer.app, DiffRootsMsg, DiffRootsPacket{
+		RequestId: 111,
+		Roots: []DiffRoot{{
+			BlockHash: head.Hash(),
+			DiffHash:  crypto.Keccak256Hash(data),
+		}},
+	}); err != nil {
+		t.Errorf("diff roots mismatch: %v", err)
+	}
+}
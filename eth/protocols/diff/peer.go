@@ -94,6 +94,18 @@ func (p *Peer) RequestDiffLayers(hashes []common.Hash) error {
 	})
 }
 
+// RequestDiffRoots fetches the hashes of the diff layers served for the blocks
+// specified.
+func (p *Peer) RequestDiffRoots(hashes []common.Hash) error {
+	id := rand.Uint64()
+
+	requestTracker.Track(p.id, p.version, GetDiffRootsMsg, DiffRootsMsg, id)
+	return p2p.Send(p.rw, GetDiffRootsMsg, GetDiffRootsPacket{
+		RequestId:   id,
+		BlockHashes: hashes,
+	})
+}
+
 func (p *Peer) SendDiffLayers(diffs []rlp.RawValue) error {
 	return p2p.Send(p.rw, DiffLayerMsg, diffs)
 }
@@ -30,6 +30,7 @@ import (
 // Constants to match up protocol versions and messages
 const (
 	Diff1 = 1
+	Diff2 = 2
 )
 
 // ProtocolName is the official short name of the `diff` protocol used during
@@ -38,11 +39,11 @@ const ProtocolName = "diff"
 
 // ProtocolVersions are the supported versions of the `diff` protocol (first
 // is primary).
-var ProtocolVersions = []uint{Diff1}
+var ProtocolVersions = []uint{Diff2, Diff1}
 
 // protocolLengths are the number of implemented message corresponding to
 // different protocol versions.
-var protocolLengths = map[uint]uint64{Diff1: 4}
+var protocolLengths = map[uint]uint64{Diff2: 6, Diff1: 4}
 
 // maxMessageSize is the maximum cap on the size of a protocol message.
 const maxMessageSize = 10 * 1024 * 1024
@@ -52,6 +53,10 @@ const (
 	GetDiffLayerMsg  = 0x01
 	DiffLayerMsg     = 0x02
 	FullDiffLayerMsg = 0x03
+
+	// Protocol messages added in diff/2
+	GetDiffRootsMsg = 0x04
+	DiffRootsMsg    = 0x05
 )
 
 var defaultExtra = []byte{0x00}
@@ -109,6 +114,27 @@ type FullDiffLayersPacket struct {
 	DiffLayersPacket
 }
 
+// GetDiffRootsPacket represents a request for the hashes of the diff layers a
+// peer serves for a number of blocks.
+type GetDiffRootsPacket struct {
+	RequestId   uint64
+	BlockHashes []common.Hash
+}
+
+// DiffRoot is the attestation of the diff layer a peer serves for a block. It
+// carries no state root, a bad diff layer is only caught when applying it.
+type DiffRoot struct {
+	BlockHash common.Hash
+	DiffHash  common.Hash // Hash of the diff layer served for the block
+}
+
+// DiffRootsPacket is the response to GetDiffRootsPacket, omitting the blocks
+// without a diff layer available.
+type DiffRootsPacket struct {
+	RequestId uint64
+	Roots     []DiffRoot
+}
+
 func (*GetDiffLayersPacket) Name() string { return "GetDiffLayers" }
 func (*GetDiffLayersPacket) Kind() byte   { return GetDiffLayerMsg }
 
@@ -120,3 +146,9 @@ func (*FullDiffLayersPacket) Kind() byte   { return FullDiffLayerMsg }
 
 func (*DiffCapPacket) Name() string { return "DiffCap" }
 func (*DiffCapPacket) Kind() byte   { return DiffCapMsg }
+
+func (*GetDiffRootsPacket) Name() string { return "GetDiffRoots" }
+func (*GetDiffRootsPacket) Kind() byte   { return GetDiffRootsMsg }
+
+func (*DiffRootsPacket) Name() string { return "DiffRoots" }
+func (*DiffRootsPacket) Kind() byte   { return DiffRootsMsg }
@@ -79,6 +79,10 @@ type Backend interface {
 	// or if inbound transactions should simply be dropped.
 	AcceptTxs() bool
 
+	// PrivateTxPeer retrieves whether the private transactions of the local pool
+	// may be disclosed to the remote peer.
+	PrivateTxPeer(peer *Peer) bool
+
 	// RunPeer is invoked when a peer joins on the `eth` protocol. The handler
 	// should do any peer maintenance work, handshakes and validations. If all
 	// is passed, control should be given back to the `handler` to process the
@@ -98,6 +102,10 @@ type Backend interface {
 type TxPool interface {
 	// Get retrieves the the transaction from the local txpool with the given hash.
 	Get(hash common.Hash) *types.Transaction
+
+	// IsPrivate returns whether the transaction was submitted privately and
+	// must not be propagated to the network.
+	IsPrivate(hash common.Hash) bool
 }
 
 // MakeProtocols constructs the P2P protocol definitions for `eth`.
@@ -52,6 +52,8 @@ type testBackend struct {
 	db     ethdb.Database
 	chain  *core.BlockChain
 	txpool *core.TxPool
+
+	privatePeer bool // Whether private transactions may be served to peers
 }
 
 // newTestBackend creates an empty chain and wraps it into a mock backend.
@@ -105,6 +107,7 @@ func (b *testBackend) PeerInfo(enode.ID) interface{} { panic("not implemented")
 func (b *testBackend) AcceptTxs() bool {
 	panic("data processing tests should be done in the handler package")
 }
+func (b *testBackend) PrivateTxPeer(*Peer) bool { return b.privatePeer }
 func (b *testBackend) Handle(*Peer, Packet) error {
 	panic("data processing tests should be done in the handler package")
 }
@@ -584,3 +587,31 @@ func testGetBlockReceipts(t *testing.T, protocol uint) {
 		}
 	}
 }
+
+// Tests that private pooled transactions are only served to trusted peers.
+func TestGetPooledTransactionsPrivate(t *testing.T) {
+	backend := newTestBackend(0)
+	defer backend.close()
+
+	signer := types.HomesteadSigner{}
+	public, _ := types.SignTx(types.NewTransaction(0, common.Address{}, big.NewInt(1), params.TxGas, big.NewInt(1), nil), signer, testKey)
+	private, _ := types.SignTx(types.NewTransaction(1, common.Address{}, big.NewInt(1), params.TxGas, big.NewInt(1), nil), signer, testKey)
+
+	if err := backend.txpool.AddLocal(public); err != nil {
+		t.Fatalf("failed to add public transaction: %v", err)
+	}
+	if err := backend.txpool.AddPrivate(private); err != nil {
+		t.Fatalf("failed to add private transaction: %v", err)
+	}
+	query := GetPooledTransactionsPacket{public.Hash(), private.Hash()}
+
+	hashes, _ := answerGetPooledTransactions(backend, query, nil)
+	if len(hashes) != 1 || hashes[0] != public.Hash() {
+		t.Errorf("untrusted peer: served transactions mismatch: have %x, want %x", hashes, []common.Hash{public.Hash()})
+	}
+	backend.privatePeer = true
+	hashes, _ = answerGetPooledTransactions(backend, query, nil)
+	if len(hashes) != 2 {
+		t.Errorf("trusted peer: served transaction count mismatch: have %d, want %d", len(hashes), 2)
+	}
+}
@@ -432,17 +432,19 @@ func handleGetPooledTransactions66(backend Backend, msg Decoder, peer *Peer) err
 func answerGetPooledTransactions(backend Backend, query GetPooledTransactionsPacket, peer *Peer) ([]common.Hash, []rlp.RawValue) {
 	// Gather transactions until the fetch or network limits is reached
 	var (
-		bytes  int
-		hashes []common.Hash
-		txs    []rlp.RawValue
+		bytes   int
+		hashes  []common.Hash
+		txs     []rlp.RawValue
+		private = backend.PrivateTxPeer(peer)
 	)
 	for _, hash := range query {
 		if bytes >= softResponseLimit {
 			break
 		}
-		// Retrieve the requested transaction, skipping if unknown to us
+		// Retrieve the requested transaction, skipping if unknown to us or if
+		// it's private and the peer is not trusted with it
 		tx := backend.TxPool().Get(hash)
-		if tx == nil {
+		if tx == nil || (!private && backend.TxPool().IsPrivate(hash)) {
 			continue
 		}
 		// If known, encode and queue for response packet
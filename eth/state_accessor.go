@@ -94,7 +94,15 @@ func (eth *Ethereum) stateAtBlock(block *types.Block, reexec uint64, base *state
 				return statedb, nil
 			}
 		}
-		// Database does not have the state for the given block, try to regenerate
+		// Database does not have the state for the given block, try the
+		// historical state regenerator first if enabled
+		if eth.stateRegen != nil {
+			if statedb, err = eth.stateRegen.stateAt(block.Header()); err == nil {
+				return statedb, nil
+			}
+			log.Debug("Failed to regenerate historical state", "number", block.NumberU64(), "hash", block.Hash(), "err", err)
+		}
+		// Try to regenerate by reexecuting the nearby blocks
 		for i := uint64(0); i < reexec; i++ {
 			if current.NumberU64() == 0 {
 				return nil, errors.New("genesis state is missing")
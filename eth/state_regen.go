@@ -0,0 +1,406 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package eth
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/state/snapshot"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/trie"
+	lru "github.com/hashicorp/golang-lru"
+)
+
+const (
+	// stateRegenStates is the maximum number of regenerated states retained,
+	// regardless of the memory they use.
+	stateRegenStates = 128
+
+	// stateRegenJobs is the maximum number of states regenerated concurrently.
+	stateRegenJobs = 4
+)
+
+var (
+	stateRegenHitMeter  = metrics.NewRegisteredMeter("eth/stateregen/hit", nil)
+	stateRegenMissMeter = metrics.NewRegisteredMeter("eth/stateregen/miss", nil)
+	stateRegenDiffMeter = metrics.NewRegisteredMeter("eth/stateregen/diff", nil)
+	stateRegenExecMeter = metrics.NewRegisteredMeter("eth/stateregen/exec", nil)
+	stateRegenTimer     = metrics.NewRegisteredTimer("eth/stateregen/time", nil)
+)
+
+// stateRegen reconstructs historical states missing from the database, e.g.
+// after the state was pruned. Starting from the nearest state still stored,
+// every block is replayed either by applying its persisted diff layer or, if
+// none is available, by executing it.
+//
+// All regenerated states live in a single in-memory trie database on top of
+// the disk one, so that states regenerated from each other share their nodes.
+// The most recently used states are kept referenced within a memory budget.
+//
+// Distinct states are regenerated concurrently, up to a limit, while requests
+// for a state being regenerated wait for it.
+type stateRegen struct {
+	chain    *core.BlockChain
+	db       ethdb.Database
+	database state.Database     // Ephemeral database holding the regenerated states
+	depth    uint64             // Maximum number of blocks replayed for a state
+	budget   common.StorageSize // Memory allowance of the regenerated trie nodes
+	states   *lru.Cache         // Roots of the regenerated states retained
+
+	jobs    chan struct{}                 // Semaphore bounding the concurrent regenerations
+	pending map[common.Hash]chan struct{} // Regenerations in progress, by target root
+	lock    sync.Mutex                    // Protects the pending regenerations and the retained states
+}
+
+// newStateRegen creates a historical state regenerator replaying at most depth
+// blocks and retaining the regenerated states within cache megabytes.
+func newStateRegen(chain *core.BlockChain, db ethdb.Database, depth uint64, cache int) *stateRegen {
+	// Create an ephemeral trie.Database for isolating the live one. Otherwise
+	// the regenerated states would be persisted into the disk.
+	database := state.NewDatabaseWithConfig(db, &trie.Config{Cache: 16})
+	states, _ := lru.NewWithEvict(stateRegenStates, func(key, value interface{}) {
+		database.TrieDB().Dereference(key.(common.Hash))
+	})
+	return &stateRegen{
+		chain:    chain,
+		db:       db,
+		database: database,
+		depth:    depth,
+		budget:   common.StorageSize(cache) * 1024 * 1024,
+		states:   states,
+		jobs:     make(chan struct{}, stateRegenJobs),
+		pending:  make(map[common.Hash]chan struct{}),
+	}
+}
+
+// stateAt returns the state of the given block, regenerating it if missing.
+//
+// The returned state is backed by the regenerated trie nodes, which might be
+// evicted by later regenerations. Long-running users should not expect the
+// untouched parts of the state to remain readable forever.
+func (r *stateRegen) stateAt(header *types.Header) (*state.StateDB, error) {
+	for {
+		if _, ok := r.states.Get(header.Root); ok {
+			if statedb, err := state.New(header.Root, r.database, nil); err == nil {
+				stateRegenHitMeter.Mark(1)
+				return statedb, nil
+			}
+		}
+		// Wait for the state if it's already being regenerated
+		r.lock.Lock()
+		if wait, ok := r.pending[header.Root]; ok {
+			r.lock.Unlock()
+			<-wait
+			continue
+		}
+		done := make(chan struct{})
+		r.pending[header.Root] = done
+		r.lock.Unlock()
+
+		statedb, err := r.regenerate(header)
+
+		r.lock.Lock()
+		delete(r.pending, header.Root)
+		r.lock.Unlock()
+		close(done)
+
+		return statedb, err
+	}
+}
+
+// regenerate replays the blocks leading to the given one on top of the nearest
+// state available.
+func (r *stateRegen) regenerate(header *types.Header) (*state.StateDB, error) {
+	r.jobs <- struct{}{}
+	defer func() { <-r.jobs }()
+
+	// Walk back to the nearest state available, either regenerated or on disk.
+	// The lock keeps the starting state from being evicted until referenced.
+	r.lock.Lock()
+	var (
+		headers []*types.Header
+		current = header
+		statedb *state.StateDB
+		err     error
+	)
+	for {
+		if statedb, err = state.New(current.Root, r.database, nil); err == nil {
+			break
+		}
+		if current.Number.Uint64() == 0 {
+			r.lock.Unlock()
+			return nil, errors.New("genesis state is missing")
+		}
+		if uint64(len(headers)) >= r.depth {
+			r.lock.Unlock()
+			return nil, fmt.Errorf("required historical state unavailable (depth=%d)", r.depth)
+		}
+		headers = append(headers, current)
+		if current = r.chain.GetHeader(current.ParentHash, current.Number.Uint64()-1); current == nil {
+			r.lock.Unlock()
+			return nil, fmt.Errorf("missing header %v %d", headers[len(headers)-1].ParentHash, headers[len(headers)-1].Number.Uint64()-1)
+		}
+	}
+	if len(headers) == 0 {
+		// The state was retained in the meantime or never went missing
+		r.lock.Unlock()
+		return statedb, nil
+	}
+	stateRegenMissMeter.Mark(1)
+	r.states.Get(current.Root) // Bump the starting state if it was a regenerated one
+	r.database.TrieDB().Reference(current.Root, common.Hash{})
+	r.lock.Unlock()
+
+	// Replay the blocks on top of the starting state, keeping the last state
+	// referenced until the next one is
+	var (
+		start  = time.Now()
+		logged = time.Now()
+		root   = current.Root
+		parent = current.Root
+	)
+	for i := len(headers) - 1; i >= 0; i-- {
+		block := r.chain.GetBlock(headers[i].Hash(), headers[i].Number.Uint64())
+		if block == nil {
+			err = fmt.Errorf("block #%d not found", headers[i].Number.Uint64())
+		} else {
+			root, err = r.replay(root, block)
+		}
+		if err != nil {
+			r.database.TrieDB().Dereference(parent)
+			return nil, err
+		}
+		r.database.TrieDB().Reference(root, common.Hash{})
+		r.database.TrieDB().Dereference(parent)
+		parent = root
+
+		if time.Since(logged) > 8*time.Second {
+			log.Info("Regenerating historical state", "block", block.NumberU64(), "target", header.Number, "remaining", i, "elapsed", common.PrettyDuration(time.Since(start)))
+			logged = time.Now()
+		}
+	}
+	// Retain the regenerated state, evicting the least recently used ones
+	// beyond the memory allowance
+	r.lock.Lock()
+	if !r.states.Contains(root) {
+		r.states.Add(root, nil)
+	} else {
+		r.database.TrieDB().Dereference(root) // Retained already, drop the extra reference
+	}
+	for r.states.Len() > 1 {
+		if nodes, _ := r.database.TrieDB().Size(); nodes <= r.budget {
+			break
+		}
+		r.states.RemoveOldest()
+	}
+	r.lock.Unlock()
+	stateRegenTimer.UpdateSince(start)
+
+	nodes, _ := r.database.TrieDB().Size()
+	log.Info("Historical state regenerated", "block", header.Number, "replayed", len(headers), "elapsed", common.PrettyDuration(time.Since(start)), "cached", r.states.Len(), "nodes", nodes)
+	return state.New(root, r.database, nil)
+}
+
+// release drops the trie nodes committed under the given roots unless another
+// state references them, cleaning up after a replay failing past its commit.
+func (r *stateRegen) release(roots ...common.Hash) {
+	triedb := r.database.TrieDB()
+	for _, root := range roots {
+		if root == (common.Hash{}) || root == types.EmptyRootHash {
+			continue
+		}
+		// Claim the root first, so that a root referenced elsewhere only loses
+		// the claim while an orphaned one is removed
+		triedb.Reference(root, common.Hash{})
+		triedb.Dereference(root)
+	}
+}
+
+// replay applies a block on top of the state with the given root and returns
+// the root of the resulting state.
+func (r *stateRegen) replay(root common.Hash, block *types.Block) (common.Hash, error) {
+	if diffStore := r.db.DiffStore(); diffStore != nil {
+		if diff := rawdb.ReadDiffLayer(diffStore, block.Hash()); diff != nil {
+			root, err := r.applyDiff(root, block, diff)
+			if err == nil {
+				stateRegenDiffMeter.Mark(1)
+				return root, nil
+			}
+			log.Debug("Failed to apply persisted diff layer", "number", block.NumberU64(), "hash", block.Hash(), "err", err)
+		}
+	}
+	statedb, err := state.New(root, r.database, nil)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	statedb.SetExpectedStateRoot(block.Root())
+	statedb, _, _, _, err = r.chain.Processor().Process(block, statedb, vm.Config{})
+	if err != nil {
+		return common.Hash{}, fmt.Errorf("processing block %d failed: %v", block.NumberU64(), err)
+	}
+	// Finalize the state so any modifications are written to the trie
+	statedb.Finalise(r.chain.Config().IsEIP158(block.Number()))
+	statedb.AccountsIntermediateRoot()
+	if root, _, err = statedb.Commit(nil); err != nil {
+		// The storage tries might have been committed already
+		var roots []common.Hash
+		for _, addr := range statedb.GetDirtyAccounts() {
+			if tr := statedb.StorageTrie(addr); tr != nil {
+				roots = append(roots, tr.Hash())
+			}
+		}
+		r.release(roots...)
+		return common.Hash{}, fmt.Errorf("commit failed, number %d root %v: %w", block.NumberU64(), block.Root().Hex(), err)
+	}
+	if root != block.Root() {
+		r.release(root)
+		return common.Hash{}, fmt.Errorf("state root mismatch at block %d: have %x, want %x", block.NumberU64(), root, block.Root())
+	}
+	stateRegenExecMeter.Mark(1)
+	return root, nil
+}
+
+// applyDiff applies the diff layer of a block on top of the state with the
+// given root and returns the root of the resulting state. The resulting tries
+// are only committed if they match the state root of the block.
+func (r *stateRegen) applyDiff(root common.Hash, block *types.Block, diff *types.DiffLayer) (common.Hash, error) {
+	accTrie, err := r.database.OpenTrie(root)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	destructs := make(map[common.Address]struct{}, len(diff.Destructs))
+	for _, addr := range diff.Destructs {
+		destructs[addr] = struct{}{}
+		if err := accTrie.TryDelete(addr[:]); err != nil {
+			return common.Hash{}, err
+		}
+	}
+	storages := make(map[common.Address]types.DiffStorage, len(diff.Storages))
+	for _, storage := range diff.Storages {
+		if len(storage.Keys) != len(storage.Vals) {
+			return common.Hash{}, errors.New("invalid diff layer: length of keys and values mismatch")
+		}
+		storages[storage.Account] = storage
+	}
+	storageTries := make([]state.Trie, 0, len(diff.Accounts))
+	for _, diffAccount := range diff.Accounts {
+		latest, err := snapshot.FullAccount(diffAccount.Blob)
+		if err != nil {
+			return common.Hash{}, err
+		}
+		// Destructed accounts are recreated with an empty storage
+		prevRoot := types.EmptyRootHash
+		if _, ok := destructs[diffAccount.Account]; !ok {
+			enc, err := accTrie.TryGet(diffAccount.Account[:])
+			if err != nil {
+				return common.Hash{}, err
+			}
+			if len(enc) != 0 {
+				var prev state.Account
+				if err := rlp.DecodeBytes(enc, &prev); err != nil {
+					return common.Hash{}, err
+				}
+				if prev.Root != (common.Hash{}) {
+					prevRoot = prev.Root
+				}
+			}
+		}
+		latestRoot := common.BytesToHash(latest.Root)
+		if latestRoot != prevRoot {
+			storageTrie, err := r.database.OpenStorageTrie(crypto.Keccak256Hash(diffAccount.Account[:]), prevRoot)
+			if err != nil {
+				return common.Hash{}, err
+			}
+			storage := storages[diffAccount.Account]
+			for i, key := range storage.Keys {
+				if len(storage.Vals[i]) != 0 {
+					err = storageTrie.TryUpdate([]byte(key), storage.Vals[i])
+				} else {
+					err = storageTrie.TryDelete([]byte(key))
+				}
+				if err != nil {
+					return common.Hash{}, err
+				}
+			}
+			if hash := storageTrie.Hash(); hash != latestRoot {
+				return common.Hash{}, fmt.Errorf("storage root mismatch of %x: have %x, want %x", diffAccount.Account, hash, latestRoot)
+			}
+			storageTries = append(storageTries, storageTrie)
+		}
+		blob, err := rlp.EncodeToBytes(&state.Account{
+			Nonce:    latest.Nonce,
+			Balance:  latest.Balance,
+			Root:     latestRoot,
+			CodeHash: latest.CodeHash,
+		})
+		if err != nil {
+			return common.Hash{}, err
+		}
+		if err := accTrie.TryUpdate(diffAccount.Account[:], blob); err != nil {
+			return common.Hash{}, err
+		}
+	}
+	if hash := accTrie.Hash(); hash != block.Root() {
+		return common.Hash{}, fmt.Errorf("state root mismatch: have %x, want %x", hash, block.Root())
+	}
+	// The diff layer is correct, write out the new codes and commit the tries
+	for _, code := range diff.Codes {
+		if crypto.Keccak256Hash(code.Code) != code.Hash {
+			return common.Hash{}, fmt.Errorf("code hash mismatch: %x", code.Hash)
+		}
+		if len(rawdb.ReadCode(r.db, code.Hash)) == 0 {
+			rawdb.WriteCode(r.db, code.Hash, code.Code)
+		}
+	}
+	committed := make([]common.Hash, 0, len(storageTries)+1)
+	for _, storageTrie := range storageTries {
+		hash, err := storageTrie.Commit(nil)
+		if err != nil {
+			r.release(committed...)
+			return common.Hash{}, err
+		}
+		committed = append(committed, hash)
+	}
+	root, err = accTrie.Commit(func(_ [][]byte, _ []byte, leaf []byte, parent common.Hash) error {
+		var account state.Account
+		if err := rlp.DecodeBytes(leaf, &account); err != nil {
+			return nil
+		}
+		if account.Root != types.EmptyRootHash {
+			r.database.TrieDB().Reference(account.Root, parent)
+		}
+		return nil
+	})
+	if err != nil {
+		r.release(append(committed, block.Root())...)
+		return common.Hash{}, err
+	}
+	return root, nil
+}
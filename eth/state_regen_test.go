@@ -0,0 +1,121 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package eth
+
+import (
+	"math/big"
+	"sync"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/ethdb/memorydb"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// Tests that historical states missing from the database are regenerated both
+// by executing the blocks and by applying their persisted diff layers.
+func TestStateRegen(t *testing.T) {
+	var (
+		gspec     = &core.Genesis{Config: params.TestChainConfig, Alloc: core.GenesisAlloc{testAddr: {Balance: big.NewInt(100000000000000000)}}}
+		db        = rawdb.NewMemoryDatabase()
+		gendb     = rawdb.NewMemoryDatabase()
+		genesis   = gspec.MustCommit(db)
+		signer    = types.HomesteadSigner{}
+		recipient = common.Address{0xde, 0xad}
+		amount    = big.NewInt(1000)
+	)
+	gspec.MustCommit(gendb)
+
+	// Generate the states in a separate database, so only the live chain
+	// holds them, in memory
+	blocks, _ := core.GenerateChain(params.TestChainConfig, genesis, ethash.NewFaker(), gendb, 10, func(i int, block *core.BlockGen) {
+		tx, _ := types.SignTx(types.NewTransaction(block.TxNonce(testAddr), recipient, amount, params.TxGas, big.NewInt(1), nil), signer, testKey)
+		block.AddTx(tx)
+	})
+	chain, _ := core.NewBlockChain(db, nil, params.TestChainConfig, ethash.NewFaker(), vm.Config{}, nil, nil)
+	defer chain.Stop()
+	if _, err := chain.InsertChain(blocks); err != nil {
+		t.Fatalf("failed to insert chain: %v", err)
+	}
+	checkBalance := func(regen *stateRegen, block *types.Block) {
+		t.Helper()
+		statedb, err := regen.stateAt(block.Header())
+		if err != nil {
+			t.Fatalf("block %d: failed to regenerate state: %v", block.NumberU64(), err)
+		}
+		if have, want := statedb.GetBalance(recipient), new(big.Int).Mul(amount, block.Number()); have.Cmp(want) != 0 {
+			t.Fatalf("block %d: balance mismatch: have %v, want %v", block.NumberU64(), have, want)
+		}
+		if !regen.states.Contains(block.Root()) {
+			t.Fatalf("block %d: regenerated state not retained", block.NumberU64())
+		}
+	}
+	// Regenerate by executing the blocks, further states are regenerated on
+	// top of the retained ones
+	regen := newStateRegen(chain, db, 128, 16)
+	checkBalance(regen, blocks[4])
+	checkBalance(regen, blocks[9])
+
+	// Distinct states are regenerated concurrently, the same one only once
+	regen = newStateRegen(chain, db, 128, 16)
+	var wg sync.WaitGroup
+	for _, block := range append(blocks[5:], blocks[5:]...) {
+		wg.Add(1)
+		go func(block *types.Block) {
+			defer wg.Done()
+			statedb, err := regen.stateAt(block.Header())
+			if err != nil {
+				t.Errorf("block %d: failed to regenerate state: %v", block.NumberU64(), err)
+				return
+			}
+			if have, want := statedb.GetBalance(recipient), new(big.Int).Mul(amount, block.Number()); have.Cmp(want) != 0 {
+				t.Errorf("block %d: balance mismatch: have %v, want %v", block.NumberU64(), have, want)
+			}
+		}(block)
+	}
+	wg.Wait()
+	if len(regen.pending) != 0 {
+		t.Fatalf("regenerations left pending: %d", len(regen.pending))
+	}
+	// States beyond the maximum depth can't be regenerated
+	if _, err := newStateRegen(chain, db, 3, 16).stateAt(blocks[9].Header()); err == nil {
+		t.Fatalf("regenerated state beyond the maximum depth")
+	}
+	// Persist the diff layers of the blocks and regenerate out of them
+	diffdb := memorydb.New()
+	for _, block := range blocks {
+		diff := new(types.DiffLayer)
+		if err := rlp.DecodeBytes(chain.GetDiffLayerRLP(block.Hash()), diff); err != nil {
+			t.Fatalf("block %d: failed to decode diff layer: %v", block.NumberU64(), err)
+		}
+		rawdb.WriteDiffLayer(diffdb, block.Hash(), diff)
+	}
+	db.SetDiffStore(diffdb)
+
+	regen = newStateRegen(chain, db, 128, 16)
+	diff := rawdb.ReadDiffLayer(diffdb, blocks[0].Hash())
+	if root, err := regen.applyDiff(genesis.Root(), blocks[0], diff); err != nil || root != blocks[0].Root() {
+		t.Fatalf("failed to apply diff layer: root %x, err %v", root, err)
+	}
+	checkBalance(regen, blocks[9])
+}
@@ -54,10 +54,19 @@ func (h *handler) syncTransactions(p *eth.Peer) {
 	// order, insertions could overflow the non-executable queues and get dropped.
 	//
 	// TODO(karalabe): Figure out if we could get away with random order somehow
-	var txs types.Transactions
+	var (
+		txs     types.Transactions
+		private = h.isPrivatePeer(p.ID())
+	)
 	pending, _ := h.txpool.Pending()
 	for _, batch := range pending {
-		txs = append(txs, batch...)
+		for _, tx := range batch {
+			// Private transactions are only disclosed to trusted peers
+			if !private && h.txpool.IsPrivate(tx.Hash()) {
+				continue
+			}
+			txs = append(txs, tx)
+		}
 	}
 	if len(txs) == 0 {
 		return
@@ -0,0 +1,200 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package tracetest
+
+import (
+	"encoding/json"
+	"math/big"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/eth/tracers"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/tests"
+)
+
+// pushBytes assembles a PUSHn instruction for the given value.
+func pushBytes(value []byte) []byte {
+	return append([]byte{byte(vm.PUSH1) + byte(len(value)-1)}, value...)
+}
+
+// emitCode assembles code storing the given words in memory and emitting them
+// as a log with the given topics.
+func emitCode(words []*big.Int, topics ...common.Hash) []byte {
+	var code []byte
+	for i, word := range words {
+		code = append(code, pushBytes(common.LeftPadBytes(word.Bytes(), 32))...)
+		code = append(code, pushBytes([]byte{byte(32 * i)})...)
+		code = append(code, byte(vm.MSTORE))
+	}
+	for i := len(topics) - 1; i >= 0; i-- {
+		code = append(code, pushBytes(topics[i].Bytes())...)
+	}
+	code = append(code, pushBytes([]byte{byte(32 * len(words))})...)
+	code = append(code, pushBytes([]byte{0})...)
+	return append(code, byte(vm.LOG0)+byte(len(topics)))
+}
+
+// callCode assembles code calling the given address without input and
+// discarding the result.
+func callCode(addr common.Address) []byte {
+	code := []byte{byte(vm.PUSH1), 0, byte(vm.DUP1), byte(vm.DUP1), byte(vm.DUP1), byte(vm.DUP1)}
+	code = append(code, pushBytes(addr.Bytes())...)
+	return append(code, byte(vm.GAS), byte(vm.CALL), byte(vm.POP))
+}
+
+func TestDexTracer(t *testing.T) {
+	var (
+		pair     = common.HexToAddress("0x00000000000000000000000000000000000000aa")
+		token0   = common.HexToAddress("0x00000000000000000000000000000000000000bb")
+		token1   = common.HexToAddress("0x00000000000000000000000000000000000000cc")
+		holder   = common.HexToAddress("0x00000000000000000000000000000000000000dd")
+		receiver = common.HexToAddress("0x00000000000000000000000000000000000000ee")
+
+		syncTopic     = crypto.Keccak256Hash([]byte("Sync(uint112,uint112)"))
+		swapTopic     = crypto.Keccak256Hash([]byte("Swap(address,uint256,uint256,uint256,uint256,address)"))
+		transferTopic = crypto.Keccak256Hash([]byte("Transfer(address,address,uint256)"))
+	)
+	privkey, err := crypto.HexToECDSA("0000000000000000deadbeef00000000000000000000000000000000deadbeef")
+	if err != nil {
+		t.Fatalf("err %v", err)
+	}
+	signer := types.NewEIP155Signer(big.NewInt(1))
+	tx, err := types.SignNewTx(privkey, signer, &types.LegacyTx{
+		GasPrice: big.NewInt(0),
+		Gas:      500000,
+		To:       &pair,
+	})
+	if err != nil {
+		t.Fatalf("err %v", err)
+	}
+	origin, _ := signer.Sender(tx)
+	txContext := vm.TxContext{
+		Origin:   origin,
+		GasPrice: big.NewInt(1),
+	}
+	context := vm.BlockContext{
+		CanTransfer: core.CanTransfer,
+		Transfer:    core.Transfer,
+		Coinbase:    common.Address{},
+		BlockNumber: new(big.Int).SetUint64(8000000),
+		Time:        new(big.Int).SetUint64(5),
+		Difficulty:  big.NewInt(0x30000),
+		GasLimit:    uint64(6000000),
+	}
+	// The first token transfers successfully, the second one reverts, so only
+	// the transfer of the first one may be reported
+	transfer := emitCode([]*big.Int{big.NewInt(100)}, transferTopic, holder.Hash(), receiver.Hash())
+
+	token0Code := append(transfer, byte(vm.STOP))
+	token1Code := append(append([]byte{}, transfer...), byte(vm.PUSH1), 0, byte(vm.DUP1), byte(vm.REVERT))
+
+	var pairCode []byte
+	pairCode = append(pairCode, callCode(token0)...)
+	pairCode = append(pairCode, callCode(token1)...)
+	pairCode = append(pairCode, emitCode([]*big.Int{big.NewInt(1100), big.NewInt(1900)}, syncTopic)...)
+	pairCode = append(pairCode, emitCode([]*big.Int{big.NewInt(100), big.NewInt(0), big.NewInt(0), big.NewInt(100)}, swapTopic, origin.Hash(), receiver.Hash())...)
+	pairCode = append(pairCode, byte(vm.STOP))
+
+	reserves := new(big.Int).Or(big.NewInt(1000), new(big.Int).Lsh(big.NewInt(2000), 112))
+	alloc := core.GenesisAlloc{
+		pair: core.GenesisAccount{
+			Nonce: 1,
+			Code:  pairCode,
+			Storage: map[common.Hash]common.Hash{
+				common.BigToHash(big.NewInt(6)): token0.Hash(),
+				common.BigToHash(big.NewInt(7)): token1.Hash(),
+				common.BigToHash(big.NewInt(8)): common.BigToHash(reserves),
+			},
+		},
+		token0: core.GenesisAccount{Nonce: 1, Code: token0Code},
+		token1: core.GenesisAccount{Nonce: 1, Code: token1Code},
+		origin: core.GenesisAccount{
+			Nonce:   0,
+			Balance: big.NewInt(500000000000000),
+		},
+	}
+	_, statedb := tests.MakePreState(rawdb.NewMemoryDatabase(), alloc, false)
+
+	// Create the tracer, the EVM environment and run it
+	tracer, err := tracers.New("dexTracer", nil, nil)
+	if err != nil {
+		t.Fatalf("failed to create dex tracer: %v", err)
+	}
+	evm := vm.NewEVM(context, txContext, statedb, params.MainnetChainConfig, vm.Config{Debug: true, Tracer: tracer})
+	msg, err := tx.AsMessage(signer)
+	if err != nil {
+		t.Fatalf("failed to prepare transaction for tracing: %v", err)
+	}
+	st := core.NewStateTransition(evm, msg, new(core.GasPool).AddGas(tx.Gas()))
+	if _, err = st.TransitionDb(); err != nil {
+		t.Fatalf("failed to execute transaction: %v", err)
+	}
+	// Retrieve the trace result and compare against the etalon
+	res, err := tracer.GetResult()
+	if err != nil {
+		t.Fatalf("failed to retrieve trace result: %v", err)
+	}
+	var have, want interface{}
+	if err := json.Unmarshal(res, &have); err != nil {
+		t.Fatalf("failed to unmarshal trace result: %v", err)
+	}
+	wantStr := `{
+		"pairs": [{
+			"address": "0x00000000000000000000000000000000000000aa",
+			"token0": "0x00000000000000000000000000000000000000bb",
+			"token1": "0x00000000000000000000000000000000000000cc",
+			"reserve0Before": "0x3e8",
+			"reserve1Before": "0x7d0",
+			"reserve0After": "0x44c",
+			"reserve1After": "0x76c",
+			"swaps": [{
+				"sender": "` + strings.ToLower(origin.Hex()) + `",
+				"to": "0x00000000000000000000000000000000000000ee",
+				"amount0In": "0x64",
+				"amount1In": "0x0",
+				"amount0Out": "0x0",
+				"amount1Out": "0x64"
+			}]
+		}],
+		"transfers": [{
+			"token": "0x00000000000000000000000000000000000000bb",
+			"from": "0x00000000000000000000000000000000000000dd",
+			"to": "0x00000000000000000000000000000000000000ee",
+			"value": "0x64"
+		}],
+		"balanceChanges": {
+			"0x00000000000000000000000000000000000000bb": {
+				"0x00000000000000000000000000000000000000dd": "-0x64",
+				"0x00000000000000000000000000000000000000ee": "0x64"
+			}
+		}
+	}`
+	if err := json.Unmarshal([]byte(wantStr), &want); err != nil {
+		t.Fatalf("failed to unmarshal expected result: %v", err)
+	}
+	if !reflect.DeepEqual(have, want) {
+		t.Errorf("trace mismatch:\nhave %s\nwant %s", res, wantStr)
+	}
+}
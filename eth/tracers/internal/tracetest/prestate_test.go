@@ -0,0 +1,196 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package tracetest
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/eth/tracers"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/tests"
+)
+
+func TestPrestateTracer(t *testing.T) {
+	var (
+		contract = common.HexToAddress("0x00000000000000000000000000000000000000aa")
+		coinbase = common.HexToAddress("0x00000000000000000000000000000000000000bb")
+		balance  = big.NewInt(500000000000000)
+	)
+	privkey, err := crypto.HexToECDSA("0000000000000000deadbeef00000000000000000000000000000000deadbeef")
+	if err != nil {
+		t.Fatalf("err %v", err)
+	}
+	// The access list adds intrinsic gas the tracer can't see from within the EVM
+	signer := types.NewEIP2930Signer(big.NewInt(1))
+	tx, err := types.SignNewTx(privkey, signer, &types.AccessListTx{
+		ChainID:    big.NewInt(1),
+		GasPrice:   big.NewInt(1),
+		Gas:        100000,
+		To:         &contract,
+		Value:      big.NewInt(10),
+		AccessList: types.AccessList{{Address: contract, StorageKeys: []common.Hash{{}}}},
+	})
+	if err != nil {
+		t.Fatalf("err %v", err)
+	}
+	origin, _ := signer.Sender(tx)
+
+	// The contract increments slot 0 and reads slot 1 without modifying it
+	code := []byte{
+		byte(vm.PUSH1), 0, byte(vm.SLOAD), byte(vm.PUSH1), 1, byte(vm.ADD), byte(vm.PUSH1), 0, byte(vm.SSTORE),
+		byte(vm.PUSH1), 1, byte(vm.SLOAD), byte(vm.POP), byte(vm.STOP),
+	}
+	alloc := core.GenesisAlloc{
+		contract: core.GenesisAccount{
+			Nonce: 1,
+			Code:  code,
+			Storage: map[common.Hash]common.Hash{
+				common.BigToHash(big.NewInt(0)): common.BigToHash(big.NewInt(1)),
+				common.BigToHash(big.NewInt(1)): common.BigToHash(big.NewInt(5)),
+			},
+		},
+		origin: core.GenesisAccount{
+			Nonce:   0,
+			Balance: balance,
+		},
+	}
+	var (
+		sender  = strings.ToLower(origin.Hex())
+		codeHex = hexutil.Encode(code)
+		slot0   = common.BigToHash(big.NewInt(0)).Hex()
+		slot1   = common.BigToHash(big.NewInt(1)).Hex()
+	)
+	for i, tt := range []struct {
+		config string
+		want   func(statedb vm.StateDB) string
+	}{
+		{
+			config: "",
+			want: func(vm.StateDB) string {
+				return `{
+					"` + sender + `": {"balance": "` + hexutil.EncodeBig(balance) + `"},
+					"0x00000000000000000000000000000000000000aa": {
+						"balance": "0x0",
+						"nonce": 1,
+						"code": "` + codeHex + `",
+						"storage": {
+							"` + slot0 + `": "` + common.BigToHash(big.NewInt(1)).Hex() + `",
+							"` + slot1 + `": "` + common.BigToHash(big.NewInt(5)).Hex() + `"
+						}
+					},
+					"0x00000000000000000000000000000000000000bb": {"balance": "0x0"}
+				}`
+			},
+		},
+		{
+			config: `{"diffMode": true}`,
+			want: func(statedb vm.StateDB) string {
+				return `{
+					"post": {
+						"` + sender + `": {"balance": "` + hexutil.EncodeBig(statedb.GetBalance(origin)) + `", "nonce": 1},
+						"0x00000000000000000000000000000000000000aa": {
+							"balance": "0xa",
+							"storage": {"` + slot0 + `": "` + common.BigToHash(big.NewInt(2)).Hex() + `"}
+						},
+						"0x00000000000000000000000000000000000000bb": {"balance": "` + hexutil.EncodeBig(statedb.GetBalance(coinbase)) + `"}
+					},
+					"pre": {
+						"` + sender + `": {"balance": "` + hexutil.EncodeBig(balance) + `"},
+						"0x00000000000000000000000000000000000000aa": {
+							"balance": "0x0",
+							"nonce": 1,
+							"code": "` + codeHex + `",
+							"storage": {"` + slot0 + `": "` + common.BigToHash(big.NewInt(1)).Hex() + `"}
+						},
+						"0x00000000000000000000000000000000000000bb": {"balance": "0x0"}
+					}
+				}`
+			},
+		},
+	} {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			_, statedb := tests.MakePreState(rawdb.NewMemoryDatabase(), alloc, false)
+
+			var cfg json.RawMessage
+			if tt.config != "" {
+				cfg = json.RawMessage(tt.config)
+			}
+			tracer, err := tracers.New("prestateTracer", &tracers.Context{GasLimit: tx.Gas()}, cfg)
+			if err != nil {
+				t.Fatalf("failed to create prestate tracer: %v", err)
+			}
+			msg, err := tx.AsMessage(signer)
+			if err != nil {
+				t.Fatalf("failed to prepare transaction for tracing: %v", err)
+			}
+			context := vm.BlockContext{
+				CanTransfer: core.CanTransfer,
+				Transfer:    core.Transfer,
+				Coinbase:    coinbase,
+				BlockNumber: new(big.Int).SetUint64(8000000),
+				Time:        new(big.Int).SetUint64(5),
+				Difficulty:  big.NewInt(0x30000),
+				GasLimit:    uint64(6000000),
+			}
+			evm := vm.NewEVM(context, core.NewEVMTxContext(msg), statedb, params.MainnetChainConfig, vm.Config{Debug: true, Tracer: tracer})
+			st := core.NewStateTransition(evm, msg, new(core.GasPool).AddGas(tx.Gas()))
+			if _, err = st.TransitionDb(); err != nil {
+				t.Fatalf("failed to execute transaction: %v", err)
+			}
+			// Retrieve the trace result and compare against the etalon
+			res, err := tracer.GetResult()
+			if err != nil {
+				t.Fatalf("failed to retrieve trace result: %v", err)
+			}
+			wantStr := tt.want(statedb)
+			var have, want interface{}
+			if err := json.Unmarshal(res, &have); err != nil {
+				t.Fatalf("failed to unmarshal trace result: %v", err)
+			}
+			if err := json.Unmarshal([]byte(wantStr), &want); err != nil {
+				t.Fatalf("failed to unmarshal expected result: %v", err)
+			}
+			if !reflect.DeepEqual(have, want) {
+				t.Errorf("trace mismatch:\nhave %s\nwant %s", res, wantStr)
+			}
+		})
+	}
+}
+
+// Tests that an invalid config of the native prestate tracer is reported to the
+// caller instead of silently falling back to a JavaScript tracer.
+func TestPrestateTracerInvalidConfig(t *testing.T) {
+	if _, err := tracers.New("prestateTracer", nil, json.RawMessage(`{"diffMode":"yes"}`)); err == nil || errors.Is(err, tracers.ErrTracerNotFound) {
+		t.Errorf("invalid config error mismatch: have %v", err)
+	}
+	if _, err := tracers.New("prestateTracerLegacy", nil, nil); err != nil {
+		t.Errorf("failed to create legacy prestate tracer: %v", err)
+	}
+}
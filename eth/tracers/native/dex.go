@@ -0,0 +1,281 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package native
+
+import (
+	"encoding/json"
+	"math/big"
+	"sync/atomic"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/eth/tracers"
+)
+
+func init() {
+	register("dexTracer", newDexTracer)
+}
+
+var (
+	syncEventTopic     = crypto.Keccak256Hash([]byte("Sync(uint112,uint112)"))
+	swapEventTopic     = crypto.Keccak256Hash([]byte("Swap(address,uint256,uint256,uint256,uint256,address)"))
+	transferEventTopic = crypto.Keccak256Hash([]byte("Transfer(address,address,uint256)"))
+
+	// Storage slots of the UniswapV2Pair contract, shared by its forks.
+	pairToken0Slot   = common.BigToHash(big.NewInt(6))
+	pairToken1Slot   = common.BigToHash(big.NewInt(7))
+	pairReservesSlot = common.BigToHash(big.NewInt(8))
+
+	reserveMask = new(big.Int).Sub(new(big.Int).Lsh(common.Big1, 112), common.Big1)
+)
+
+// dexLog is a log emitted during execution, reduced to the fields the tracer
+// interprets.
+type dexLog struct {
+	address common.Address
+	topics  []common.Hash
+	data    []byte
+}
+
+type dexSwap struct {
+	Sender     common.Address `json:"sender"`
+	To         common.Address `json:"to"`
+	Amount0In  *hexutil.Big   `json:"amount0In"`
+	Amount1In  *hexutil.Big   `json:"amount1In"`
+	Amount0Out *hexutil.Big   `json:"amount0Out"`
+	Amount1Out *hexutil.Big   `json:"amount1Out"`
+}
+
+type dexPair struct {
+	Address        common.Address `json:"address"`
+	Token0         common.Address `json:"token0"`
+	Token1         common.Address `json:"token1"`
+	Reserve0Before *hexutil.Big   `json:"reserve0Before"`
+	Reserve1Before *hexutil.Big   `json:"reserve1Before"`
+	Reserve0After  *hexutil.Big   `json:"reserve0After"`
+	Reserve1After  *hexutil.Big   `json:"reserve1After"`
+	Swaps          []dexSwap      `json:"swaps,omitempty"`
+}
+
+type dexTransfer struct {
+	Token common.Address `json:"token"`
+	From  common.Address `json:"from"`
+	To    common.Address `json:"to"`
+	Value *hexutil.Big   `json:"value"`
+}
+
+type dexResult struct {
+	Pairs          []*dexPair                                         `json:"pairs"`
+	Transfers      []dexTransfer                                      `json:"transfers"`
+	BalanceChanges map[common.Address]map[common.Address]*hexutil.Big `json:"balanceChanges"`
+}
+
+// dexTracer is a native go tracer reporting the effects of a transaction on
+// UniswapV2 style pairs: the pairs that emitted Sync or Swap events with their
+// reserves before and after the transaction, all ERC20 token transfers and the
+// resulting net token balance change of every address.
+//
+// Logs of reverted call frames are discarded. The reserves before execution are
+// read from the UniswapV2Pair storage layout, the reserves after execution are
+// taken from the last Sync event of the pair.
+type dexTracer struct {
+	env       *vm.EVM
+	frames    [][]dexLog // Logs emitted by the call frames on the stack
+	result    *dexResult
+	interrupt uint32 // Atomic flag to signal execution interruption
+	reason    error  // Textual reason for the interruption
+}
+
+// newDexTracer returns a native go tracer which tracks DEX pair reserves and
+// token transfers of a tx, and implements vm.EVMLogger.
+func newDexTracer(ctx *tracers.Context, _ json.RawMessage) (tracers.Tracer, error) {
+	return &dexTracer{frames: make([][]dexLog, 1)}, nil
+}
+
+// CaptureStart implements the EVMLogger interface to initialize the tracing operation.
+func (t *dexTracer) CaptureStart(env *vm.EVM, from common.Address, to common.Address, create bool, input []byte, gas uint64, value *big.Int) {
+	t.env = env
+}
+
+// CaptureEnd is called after the call finishes to finalize the tracing.
+func (t *dexTracer) CaptureEnd(output []byte, gasUsed uint64, _ time.Duration, err error) {
+	logs := t.frames[0]
+	if err != nil {
+		logs = nil
+	}
+	t.result = t.process(logs)
+}
+
+// CaptureState implements the EVMLogger interface to trace a single step of VM execution.
+func (t *dexTracer) CaptureState(pc uint64, op vm.OpCode, gas, cost uint64, scope *vm.ScopeContext, rData []byte, depth int, err error) {
+	if err != nil || op < vm.LOG1 || op > vm.LOG4 {
+		return
+	}
+	stack := scope.Stack
+	topic := common.Hash(stack.Back(2).Bytes32())
+	if topic != syncEventTopic && topic != swapEventTopic && topic != transferEventTopic {
+		return
+	}
+	var (
+		offset = stack.Back(0)
+		size   = stack.Back(1)
+		topics = make([]common.Hash, int(op-vm.LOG0))
+	)
+	for i := range topics {
+		topics[i] = stack.Back(2 + i).Bytes32()
+	}
+	t.frames[len(t.frames)-1] = append(t.frames[len(t.frames)-1], dexLog{
+		address: scope.Contract.Address(),
+		topics:  topics,
+		data:    scope.Memory.GetCopy(int64(offset.Uint64()), int64(size.Uint64())),
+	})
+}
+
+// CaptureFault implements the EVMLogger interface to trace an execution fault.
+func (t *dexTracer) CaptureFault(pc uint64, op vm.OpCode, gas, cost uint64, _ *vm.ScopeContext, depth int, err error) {
+}
+
+// CaptureEnter is called when EVM enters a new scope (via call, create or selfdestruct).
+func (t *dexTracer) CaptureEnter(typ vm.OpCode, from common.Address, to common.Address, input []byte, gas uint64, value *big.Int) {
+	// Skip if tracing was interrupted
+	if atomic.LoadUint32(&t.interrupt) > 0 {
+		t.env.Cancel()
+		return
+	}
+	t.frames = append(t.frames, nil)
+}
+
+// CaptureExit is called when EVM exits a scope, even if the scope didn't
+// execute any code.
+func (t *dexTracer) CaptureExit(output []byte, gasUsed uint64, err error) {
+	size := len(t.frames)
+	if size <= 1 {
+		return
+	}
+	logs := t.frames[size-1]
+	t.frames = t.frames[:size-1]
+
+	if err == nil {
+		t.frames[size-2] = append(t.frames[size-2], logs...)
+	}
+}
+
+// process interprets the logs of a successful execution.
+func (t *dexTracer) process(logs []dexLog) *dexResult {
+	var (
+		result = &dexResult{
+			Pairs:          make([]*dexPair, 0),
+			Transfers:      make([]dexTransfer, 0),
+			BalanceChanges: make(map[common.Address]map[common.Address]*hexutil.Big),
+		}
+		pairs  = make(map[common.Address]*dexPair)
+		deltas = make(map[common.Address]map[common.Address]*big.Int)
+	)
+	pair := func(addr common.Address) *dexPair {
+		if p, ok := pairs[addr]; ok {
+			return p
+		}
+		reserves := t.env.StateDB.GetCommittedState(addr, pairReservesSlot).Big()
+		p := &dexPair{
+			Address:        addr,
+			Token0:         common.BytesToAddress(t.env.StateDB.GetState(addr, pairToken0Slot).Bytes()),
+			Token1:         common.BytesToAddress(t.env.StateDB.GetState(addr, pairToken1Slot).Bytes()),
+			Reserve0Before: (*hexutil.Big)(new(big.Int).And(reserves, reserveMask)),
+			Reserve1Before: (*hexutil.Big)(new(big.Int).And(new(big.Int).Rsh(reserves, 112), reserveMask)),
+		}
+		p.Reserve0After, p.Reserve1After = p.Reserve0Before, p.Reserve1Before
+
+		pairs[addr] = p
+		result.Pairs = append(result.Pairs, p)
+		return p
+	}
+	delta := func(token, addr common.Address, value *big.Int) {
+		if deltas[token] == nil {
+			deltas[token] = make(map[common.Address]*big.Int)
+		}
+		if deltas[token][addr] == nil {
+			deltas[token][addr] = new(big.Int)
+		}
+		deltas[token][addr].Add(deltas[token][addr], value)
+	}
+	for _, log := range logs {
+		switch {
+		case log.topics[0] == syncEventTopic && len(log.topics) == 1 && len(log.data) == 64:
+			p := pair(log.address)
+			p.Reserve0After = (*hexutil.Big)(new(big.Int).SetBytes(log.data[:32]))
+			p.Reserve1After = (*hexutil.Big)(new(big.Int).SetBytes(log.data[32:]))
+
+		case log.topics[0] == swapEventTopic && len(log.topics) == 3 && len(log.data) == 128:
+			p := pair(log.address)
+			p.Swaps = append(p.Swaps, dexSwap{
+				Sender:     common.BytesToAddress(log.topics[1].Bytes()),
+				To:         common.BytesToAddress(log.topics[2].Bytes()),
+				Amount0In:  (*hexutil.Big)(new(big.Int).SetBytes(log.data[:32])),
+				Amount1In:  (*hexutil.Big)(new(big.Int).SetBytes(log.data[32:64])),
+				Amount0Out: (*hexutil.Big)(new(big.Int).SetBytes(log.data[64:96])),
+				Amount1Out: (*hexutil.Big)(new(big.Int).SetBytes(log.data[96:])),
+			})
+
+		case log.topics[0] == transferEventTopic && len(log.topics) == 3 && len(log.data) == 32:
+			// ERC721 transfers index the token id and carry no data, skip them
+			transfer := dexTransfer{
+				Token: log.address,
+				From:  common.BytesToAddress(log.topics[1].Bytes()),
+				To:    common.BytesToAddress(log.topics[2].Bytes()),
+				Value: (*hexutil.Big)(new(big.Int).SetBytes(log.data)),
+			}
+			result.Transfers = append(result.Transfers, transfer)
+
+			delta(transfer.Token, transfer.From, new(big.Int).Neg(transfer.Value.ToInt()))
+			delta(transfer.Token, transfer.To, transfer.Value.ToInt())
+		}
+	}
+	for token, changes := range deltas {
+		for addr, change := range changes {
+			if change.Sign() == 0 {
+				continue
+			}
+			if result.BalanceChanges[token] == nil {
+				result.BalanceChanges[token] = make(map[common.Address]*hexutil.Big)
+			}
+			result.BalanceChanges[token][addr] = (*hexutil.Big)(change)
+		}
+	}
+	return result
+}
+
+// GetResult returns the json-encoded pair, transfer and balance change report,
+// and any error arising from the encoding or forceful termination (via `Stop`).
+func (t *dexTracer) GetResult() (json.RawMessage, error) {
+	if t.result == nil {
+		t.result = t.process(nil)
+	}
+	res, err := json.Marshal(t.result)
+	if err != nil {
+		return nil, err
+	}
+	return json.RawMessage(res), t.reason
+}
+
+// Stop terminates execution of the tracer at the first opportune moment.
+func (t *dexTracer) Stop(err error) {
+	t.reason = err
+	atomic.StoreUint32(&t.interrupt, 1)
+}
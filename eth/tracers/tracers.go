@@ -31,6 +31,7 @@ type Context struct {
 	BlockHash common.Hash // Hash of the block the tx is contained within (zero if dangling tx or call)
 	TxIndex   int         // Index of the transaction within a block (zero if dangling tx or call)
 	TxHash    common.Hash // Hash of the transaction being traced (zero if dangling call)
+	GasLimit  uint64      // Gas limit of the transaction or call being traced
 }
 
 // Tracer interface extends vm.EVMLogger and additionally
@@ -42,10 +43,14 @@ type Tracer interface {
 	Stop(err error)
 }
 
-type lookupFunc func(string, *Context) (Tracer, error)
+type lookupFunc func(string, *Context, json.RawMessage) (Tracer, error)
 
 var (
 	lookups []lookupFunc
+
+	// ErrTracerNotFound is returned by a lookup if it doesn't know the requested
+	// tracer, so the next lookup is tried.
+	ErrTracerNotFound = errors.New("tracer not found")
 )
 
 // RegisterLookup registers a method as a lookup for tracers, meaning that
@@ -61,12 +66,19 @@ func RegisterLookup(wildcard bool, lookup lookupFunc) {
 }
 
 // New returns a new instance of a tracer, by iterating through the
-// registered lookups.
-func New(code string, ctx *Context) (Tracer, error) {
+// registered lookups. The config is passed on to the tracer as is, its format
+// is specific to every tracer. If a lookup knows the tracer but fails to create
+// it, e.g. due to an invalid config, the error is returned as is instead of
+// falling through to the next lookup.
+func New(code string, ctx *Context, cfg json.RawMessage) (Tracer, error) {
 	for _, lookup := range lookups {
-		if tracer, err := lookup(code, ctx); err == nil {
+		tracer, err := lookup(code, ctx, cfg)
+		if err == nil {
 			return tracer, nil
 		}
+		if !errors.Is(err, ErrTracerNotFound) {
+			return nil, err
+		}
 	}
-	return nil, errors.New("tracer not found")
+	return nil, ErrTracerNotFound
 }
@@ -85,7 +85,9 @@ type AncientReader interface {
 	// ItemAmountInAncient returns the actual length of current ancientDB.
 	ItemAmountInAncient() (uint64, error)
 
-	// AncientOffSet returns the offset of current ancientDB.
+	// AncientOffSet returns the offset of current ancientDB, which is the number
+	// of the first block available in it. Blocks deleted from the tail of the
+	// ancientDB are accounted for in the offset.
 	AncientOffSet() uint64
 }
 
@@ -98,6 +100,13 @@ type AncientWriter interface {
 	// TruncateAncients discards all but the first n ancient data from the ancient store.
 	TruncateAncients(n uint64) error
 
+	// TruncateTail discards the ancient data below block n from the ancient store.
+	TruncateTail(n uint64) error
+
+	// RepairAncient overwrites a corrupted ancient item in place with a copy of
+	// the original, which must have the size of the stored item.
+	RepairAncient(kind string, number uint64, item []byte) error
+
 	// Sync flushes all in-memory ancient store data to disk.
 	Sync() error
 }
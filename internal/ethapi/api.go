@@ -44,6 +44,7 @@ import (
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/core/vm"
 	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/eth/gasprice"
 	"github.com/ethereum/go-ethereum/log"
 	"github.com/ethereum/go-ethereum/p2p"
 	"github.com/ethereum/go-ethereum/params"
@@ -71,6 +72,12 @@ func (s *PublicEthereumAPI) GasPrice(ctx context.Context) (*hexutil.Big, error)
 	return (*hexutil.Big)(price), err
 }
 
+// GasPriceEstimates returns the gas prices needed to land in the next block with
+// various confidences, as estimated by each gas price oracle mode.
+func (s *PublicEthereumAPI) GasPriceEstimates(ctx context.Context) (*gasprice.Estimates, error) {
+	return s.b.GasPriceEstimates(ctx)
+}
+
 // Syncing returns false in case the node is currently not syncing with the network. It can be up to date or has not
 // yet received the latest block headers from its pears. In case it is synchronizing:
 // - startingBlock: block number this node started to synchronise from
@@ -105,19 +112,32 @@ func NewPublicTxPoolAPI(b Backend) *PublicTxPoolAPI {
 	return &PublicTxPoolAPI{b}
 }
 
+// TxPoolContentOptions are the optional parameters of the content query.
+type TxPoolContentOptions struct {
+	Meta bool `json:"meta"` // Whether to include the first-seen time and peer provenance
+}
+
 // Content returns the transactions contained within the transaction pool.
-func (s *PublicTxPoolAPI) Content() map[string]map[string]map[string]*RPCTransaction {
+func (s *PublicTxPoolAPI) Content(options *TxPoolContentOptions) map[string]map[string]map[string]*RPCTransaction {
 	content := map[string]map[string]map[string]*RPCTransaction{
 		"pending": make(map[string]map[string]*RPCTransaction),
 		"queued":  make(map[string]map[string]*RPCTransaction),
 	}
 	pending, queue := s.b.TxPoolContent()
 
+	format := newRPCPendingTransaction
+	if options != nil && options.Meta {
+		format = func(tx *types.Transaction) *RPCTransaction {
+			rpcTx := newRPCPendingTransaction(tx)
+			rpcTx.Meta = s.b.TxMeta(tx.Hash())
+			return rpcTx
+		}
+	}
 	// Flatten the pending transactions
 	for account, txs := range pending {
 		dump := make(map[string]*RPCTransaction)
 		for _, tx := range txs {
-			dump[fmt.Sprintf("%d", tx.Nonce())] = newRPCPendingTransaction(tx)
+			dump[fmt.Sprintf("%d", tx.Nonce())] = format(tx)
 		}
 		content["pending"][account.Hex()] = dump
 	}
@@ -125,13 +145,20 @@ func (s *PublicTxPoolAPI) Content() map[string]map[string]map[string]*RPCTransac
 	for account, txs := range queue {
 		dump := make(map[string]*RPCTransaction)
 		for _, tx := range txs {
-			dump[fmt.Sprintf("%d", tx.Nonce())] = newRPCPendingTransaction(tx)
+			dump[fmt.Sprintf("%d", tx.Nonce())] = format(tx)
 		}
 		content["queued"][account.Hex()] = dump
 	}
 	return content
 }
 
+// GetTransactionMeta returns the first-seen time of a transaction and the peers
+// that announced or delivered it. The metadata is retained for a while after
+// the transaction was replaced, included or dropped from the pool.
+func (s *PublicTxPoolAPI) GetTransactionMeta(hash common.Hash) *core.TxMeta {
+	return s.b.TxMeta(hash)
+}
+
 // Status returns the number of pending and queued transaction in the pool.
 func (s *PublicTxPoolAPI) Status() map[string]hexutil.Uint {
 	pending, queue := s.b.Stats()
@@ -896,7 +923,7 @@ func DoCall(ctx context.Context, b Backend, args CallArgs, blockNrOrHash rpc.Blo
 
 	// Get a new instance of the EVM.
 	msg := args.ToMessage(globalGasCap)
-	evm, vmError, err := b.GetEVM(ctx, msg, state, header, nil)
+	evm, vmError, err := b.GetEVM(ctx, msg, state, header, nil, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -972,6 +999,183 @@ func (s *PublicBlockChainAPI) Call(ctx context.Context, args CallArgs, blockNrOr
 	return result.Return(), result.Err
 }
 
+// maxCallManyCalls is the maximum number of calls executed by a single
+// eth_callMany request.
+const maxCallManyCalls = 1024
+
+// BlockOverrides is the set of header fields to override when executing calls.
+type BlockOverrides struct {
+	Number     *hexutil.Big    `json:"number"`
+	Time       *hexutil.Uint64 `json:"time"`
+	GasLimit   *hexutil.Uint64 `json:"gasLimit"`
+	Coinbase   *common.Address `json:"coinbase"`
+	Difficulty *hexutil.Big    `json:"difficulty"`
+}
+
+// Apply overrides the given fields into the context of the block the calls are
+// executed in. The block hashes are still the ones of the chain the state was
+// taken from.
+func (diff *BlockOverrides) Apply(blockCtx *vm.BlockContext) {
+	if diff == nil {
+		return
+	}
+	if diff.Number != nil {
+		blockCtx.BlockNumber = diff.Number.ToInt()
+	}
+	if diff.Time != nil {
+		blockCtx.Time = new(big.Int).SetUint64(uint64(*diff.Time))
+	}
+	if diff.GasLimit != nil {
+		blockCtx.GasLimit = uint64(*diff.GasLimit)
+	}
+	if diff.Coinbase != nil {
+		blockCtx.Coinbase = *diff.Coinbase
+	}
+	if diff.Difficulty != nil {
+		blockCtx.Difficulty = diff.Difficulty.ToInt()
+	}
+}
+
+// chainContext implements core.ChainContext on top of the API backend, so block
+// contexts can be created without access to the blockchain.
+type chainContext struct {
+	b   Backend
+	ctx context.Context
+}
+
+func (c *chainContext) Engine() consensus.Engine {
+	return c.b.Engine()
+}
+
+func (c *chainContext) GetHeader(hash common.Hash, number uint64) *types.Header {
+	// Resolved by hash, as BLOCKHASH walks the ancestors of a possibly
+	// non-canonical block
+	header, err := c.b.HeaderByHash(c.ctx, hash)
+	if err != nil {
+		return nil
+	}
+	return header
+}
+
+// CallManyResult is the outcome of a single call executed by eth_callMany.
+type CallManyResult struct {
+	ReturnData hexutil.Bytes  `json:"returnData"`
+	GasUsed    hexutil.Uint64 `json:"gasUsed"`
+	Logs       []*types.Log   `json:"logs"`
+	Error      string         `json:"error,omitempty"`
+}
+
+// CallMany executes the given calls one after the other on the state of the
+// given block, each one seeing the state changes of the previous ones. The
+// state and the header of the block may be overridden beforehand.
+//
+// A call that fails or reverts doesn't abort the sequence, its error and revert
+// reason are reported in its result instead. The RPC gas cap and the timeout
+// apply to the whole sequence.
+//
+// Note, this function doesn't make any changes in the state/blockchain and is
+// useful to execute and retrieve values.
+func (s *PublicBlockChainAPI) CallMany(ctx context.Context, calls []CallArgs, blockNrOrHash rpc.BlockNumberOrHash, overrides *StateOverride, blockOverrides *BlockOverrides) ([]*CallManyResult, error) {
+	defer func(start time.Time) { log.Debug("Executing EVM calls finished", "calls", len(calls), "runtime", time.Since(start)) }(time.Now())
+
+	if len(calls) > maxCallManyCalls {
+		return nil, fmt.Errorf("too many calls: have %d, max %d", len(calls), maxCallManyCalls)
+	}
+	state, header, err := s.b.StateAndHeaderByNumberOrHash(ctx, blockNrOrHash)
+	if state == nil || err != nil {
+		return nil, err
+	}
+	if err := overrides.Apply(state); err != nil {
+		return nil, err
+	}
+	// The block hashes are resolved from the original header, whatever number
+	// the block is overridden with
+	blockCtx := core.NewEVMBlockContext(header, &chainContext{b: s.b, ctx: ctx}, nil)
+	blockOverrides.Apply(&blockCtx)
+
+	// Setup context so it may be cancelled once all calls completed, the
+	// timeout applies to the whole sequence.
+	timeout := 5 * time.Second
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var (
+		globalGasCap = s.b.RPCGasCap()
+		gasLeft      = globalGasCap
+		results      = make([]*CallManyResult, 0, len(calls))
+		evm          *vm.EVM
+		vmError      func() error
+	)
+	for i, args := range calls {
+		// The gas cap is shared by all the calls, a zero cap meaning none
+		if globalGasCap != 0 && gasLeft == 0 {
+			return nil, fmt.Errorf("gas cap of %d exhausted after %d calls", globalGasCap, i)
+		}
+		msg := args.ToMessage(gasLeft)
+
+		// Logs are keyed by transaction hash, derive a unique one for each call
+		hash := types.NewTx(&types.LegacyTx{
+			Nonce:    state.GetNonce(msg.From()),
+			GasPrice: msg.GasPrice(),
+			Gas:      msg.Gas(),
+			To:       msg.To(),
+			Value:    msg.Value(),
+			Data:     msg.Data(),
+		}).Hash()
+		state.Prepare(hash, header.Hash(), i)
+		snapshot := state.Snapshot()
+
+		// All calls run on the same EVM, cancelled once the context is done
+		if evm == nil {
+			if evm, vmError, err = s.b.GetEVM(ctx, msg, state, header, nil, &blockCtx); err != nil {
+				return nil, err
+			}
+			gopool.Submit(func() {
+				<-ctx.Done()
+				evm.Cancel()
+			})
+		} else {
+			evm.Reset(core.NewEVMTxContext(msg), state)
+		}
+		gp := new(core.GasPool).AddGas(math.MaxUint64)
+		result, err := core.ApplyMessage(evm, msg, gp)
+		if err := vmError(); err != nil {
+			return nil, err
+		}
+		// If the timer caused an abort, return an appropriate error message
+		if evm.Cancelled() {
+			return nil, fmt.Errorf("execution aborted (timeout = %v)", timeout)
+		}
+		if err != nil {
+			// The call couldn't be applied at all, drop any leftover of it
+			state.RevertToSnapshot(snapshot)
+			results = append(results, &CallManyResult{Logs: []*types.Log{}, Error: fmt.Sprintf("err: %v (supplied gas %d)", err, msg.Gas())})
+			continue
+		}
+		if globalGasCap != 0 {
+			gasLeft -= result.UsedGas
+		}
+		// Make the state changes visible to the next call
+		state.Finalise(true)
+
+		callResult := &CallManyResult{
+			ReturnData: result.ReturnData,
+			GasUsed:    hexutil.Uint64(result.UsedGas),
+			Logs:       state.GetLogs(hash),
+		}
+		if len(result.Revert()) > 0 {
+			callResult.Error = newRevertError(result).Error()
+		} else if result.Err != nil {
+			callResult.Error = result.Err.Error()
+		}
+		if callResult.Logs == nil {
+			callResult.Logs = []*types.Log{}
+		}
+		results = append(results, callResult)
+	}
+	return results, nil
+}
+
 func DoEstimateGas(ctx context.Context, b Backend, args CallArgs, blockNrOrHash rpc.BlockNumberOrHash, gasCap uint64) (hexutil.Uint64, error) {
 	// Binary search the gas requirement, as it may be higher than the amount used
 	var (
@@ -1451,6 +1655,7 @@ type RPCTransaction struct {
 	V                *hexutil.Big      `json:"v"`
 	R                *hexutil.Big      `json:"r"`
 	S                *hexutil.Big      `json:"s"`
+	Meta             *core.TxMeta      `json:"meta,omitempty"`
 }
 
 // newRPCTransaction returns a transaction that will serialize to the RPC
@@ -1626,7 +1831,7 @@ func AccessList(ctx context.Context, b Backend, blockNrOrHash rpc.BlockNumberOrH
 		// Apply the transaction with the access list tracer
 		tracer := vm.NewAccessListTracer(accessList, args.From, to, precompiles)
 		config := vm.Config{Tracer: tracer, Debug: true}
-		vmenv, _, err := b.GetEVM(ctx, msg, statedb, header, &config)
+		vmenv, _, err := b.GetEVM(ctx, msg, statedb, header, &config, nil)
 		if err != nil {
 			return nil, 0, nil, err
 		}
@@ -2093,6 +2298,16 @@ func (args *SendTxArgs) toTransaction() *types.Transaction {
 
 // SubmitTransaction is a helper function that submits tx to txPool and logs a message.
 func SubmitTransaction(ctx context.Context, b Backend, tx *types.Transaction) (common.Hash, error) {
+	return submitTransaction(ctx, b, tx, false)
+}
+
+// SubmitPrivateTransaction is a helper function that submits tx to txPool as a
+// private transaction, which is not broadcast to the network, and logs a message.
+func SubmitPrivateTransaction(ctx context.Context, b Backend, tx *types.Transaction) (common.Hash, error) {
+	return submitTransaction(ctx, b, tx, true)
+}
+
+func submitTransaction(ctx context.Context, b Backend, tx *types.Transaction, private bool) (common.Hash, error) {
 	// If the transaction fee cap is already specified, ensure the
 	// fee of the given transaction is _reasonable_.
 	if err := checkTxFee(tx.GasPrice(), tx.Gas(), b.RPCTxFeeCap()); err != nil {
@@ -2102,7 +2317,11 @@ func SubmitTransaction(ctx context.Context, b Backend, tx *types.Transaction) (c
 		// Ensure only eip155 signed transactions are submitted if EIP155Required is set.
 		return common.Hash{}, errors.New("only replay-protected (EIP-155) transactions allowed over RPC")
 	}
-	if err := b.SendTx(ctx, tx); err != nil {
+	if private {
+		if err := b.SendPrivateTx(ctx, tx); err != nil {
+			return common.Hash{}, err
+		}
+	} else if err := b.SendTx(ctx, tx); err != nil {
 		return common.Hash{}, err
 	}
 	// Print a log with full tx details for manual investigations and interventions
@@ -2116,7 +2335,7 @@ func SubmitTransaction(ctx context.Context, b Backend, tx *types.Transaction) (c
 		addr := crypto.CreateAddress(from, tx.Nonce())
 		log.Info("Submitted contract creation", "hash", tx.Hash().Hex(), "from", from, "nonce", tx.Nonce(), "contract", addr.Hex(), "value", tx.Value())
 	} else {
-		log.Info("Submitted transaction", "hash", tx.Hash().Hex(), "from", from, "nonce", tx.Nonce(), "recipient", tx.To(), "value", tx.Value())
+		log.Info("Submitted transaction", "hash", tx.Hash().Hex(), "from", from, "nonce", tx.Nonce(), "recipient", tx.To(), "value", tx.Value(), "private", private)
 	}
 	return tx.Hash(), nil
 }
@@ -2179,6 +2398,18 @@ func (s *PublicTransactionPoolAPI) SendRawTransaction(ctx context.Context, input
 	return SubmitTransaction(ctx, s.b, tx)
 }
 
+// SendPrivateRawTransaction will add the signed transaction to the transaction
+// pool without broadcasting it to the network. It is only relayed to the trusted
+// peers configured by the operator and dropped if not included within the
+// configured number of blocks.
+func (s *PublicTransactionPoolAPI) SendPrivateRawTransaction(ctx context.Context, input hexutil.Bytes) (common.Hash, error) {
+	tx := new(types.Transaction)
+	if err := tx.UnmarshalBinary(input); err != nil {
+		return common.Hash{}, err
+	}
+	return SubmitPrivateTransaction(ctx, s.b, tx)
+}
+
 // Sign calculates an ECDSA signature for:
 // keccack256("\x19Ethereum Signed Message:\n" + len(message) + message).
 //
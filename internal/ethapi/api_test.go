@@ -0,0 +1,200 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethapi
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/consensus"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// testBackend is a Backend on top of a local chain, implementing only the
+// methods needed to execute calls.
+type testBackend struct {
+	Backend // Unimplemented methods panic
+
+	chain  *core.BlockChain
+	gasCap uint64
+}
+
+// newTestBackend creates a backend on top of a chain of the given number of
+// empty blocks, with the given account funded in the genesis.
+func newTestBackend(t *testing.T, blocks int, funded common.Address) *testBackend {
+	t.Helper()
+
+	var (
+		db    = rawdb.NewMemoryDatabase()
+		gspec = &core.Genesis{
+			Config: params.TestChainConfig,
+			Alloc:  core.GenesisAlloc{funded: {Balance: big.NewInt(1000000)}},
+		}
+		genesis = gspec.MustCommit(db)
+	)
+	chain, err := core.NewBlockChain(db, nil, params.TestChainConfig, ethash.NewFaker(), vm.Config{}, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to create chain: %v", err)
+	}
+	generated, _ := core.GenerateChain(params.TestChainConfig, genesis, ethash.NewFaker(), db, blocks, nil)
+	if _, err := chain.InsertChain(generated); err != nil {
+		t.Fatalf("failed to insert chain: %v", err)
+	}
+	return &testBackend{chain: chain}
+}
+
+func (b *testBackend) ChainConfig() *params.ChainConfig { return b.chain.Config() }
+func (b *testBackend) Engine() consensus.Engine         { return b.chain.Engine() }
+func (b *testBackend) RPCGasCap() uint64                { return b.gasCap }
+
+func (b *testBackend) HeaderByNumber(ctx context.Context, number rpc.BlockNumber) (*types.Header, error) {
+	if number == rpc.LatestBlockNumber {
+		return b.chain.CurrentHeader(), nil
+	}
+	return b.chain.GetHeaderByNumber(uint64(number)), nil
+}
+
+func (b *testBackend) HeaderByHash(ctx context.Context, hash common.Hash) (*types.Header, error) {
+	return b.chain.GetHeaderByHash(hash), nil
+}
+
+func (b *testBackend) StateAndHeaderByNumberOrHash(ctx context.Context, blockNrOrHash rpc.BlockNumberOrHash) (*state.StateDB, *types.Header, error) {
+	number, _ := blockNrOrHash.Number()
+	header, _ := b.HeaderByNumber(ctx, number)
+	statedb, err := b.chain.StateAt(header.Root)
+	return statedb, header, err
+}
+
+func (b *testBackend) GetEVM(ctx context.Context, msg core.Message, state *state.StateDB, header *types.Header, vmConfig *vm.Config, blockCtx *vm.BlockContext) (*vm.EVM, func() error, error) {
+	if vmConfig == nil {
+		vmConfig = new(vm.Config)
+	}
+	context := core.NewEVMBlockContext(header, b.chain, nil)
+	if blockCtx != nil {
+		context = *blockCtx
+	}
+	return vm.NewEVM(context, core.NewEVMTxContext(msg), state, b.chain.Config(), *vmConfig), state.Error, nil
+}
+
+// Tests that the calls of eth_callMany are executed on one evolving state, and
+// that failing calls are reported without aborting the sequence.
+func TestCallMany(t *testing.T) {
+	var (
+		sender    = common.Address{0x01}
+		recipient = common.Address{0x02}
+		logger    = common.Address{0x03}
+		reverter  = common.Address{0x04}
+		latest    = rpc.BlockNumberOrHashWithNumber(rpc.LatestBlockNumber)
+	)
+	backend := newTestBackend(t, 1, sender)
+	defer backend.chain.Stop()
+
+	overrides := &StateOverride{
+		logger:   {Code: &hexutil.Bytes{0x60, 0x00, 0x60, 0x00, 0xa0, 0x00}}, // LOG0(0, 0)
+		reverter: {Code: &hexutil.Bytes{0x60, 0x00, 0x60, 0x00, 0xfd}},       // REVERT(0, 0)
+	}
+	// The recipient can only forward the funds received in the first call
+	calls := []CallArgs{
+		{From: &sender, To: &recipient, Value: (*hexutil.Big)(big.NewInt(1000))},
+		{From: &recipient, To: &logger, Value: (*hexutil.Big)(big.NewInt(600))},
+		{From: &sender, To: &reverter},
+		{From: &recipient, To: &logger, Value: (*hexutil.Big)(big.NewInt(600))},
+	}
+	api := NewPublicBlockChainAPI(backend)
+	results, err := api.CallMany(context.Background(), calls, latest, overrides, nil)
+	if err != nil {
+		t.Fatalf("failed to execute calls: %v", err)
+	}
+	if len(results) != len(calls) {
+		t.Fatalf("result count mismatch: have %d, want %d", len(results), len(calls))
+	}
+	if results[0].Error != "" || results[0].GasUsed != hexutil.Uint64(params.TxGas) {
+		t.Errorf("transfer result mismatch: have %+v", results[0])
+	}
+	if results[1].Error != "" || len(results[1].Logs) != 1 || results[1].Logs[0].Address != logger {
+		t.Errorf("forward result mismatch: have %+v", results[1])
+	}
+	if results[2].Error != "execution reverted" {
+		t.Errorf("revert error mismatch: have %q, want %q", results[2].Error, "execution reverted")
+	}
+	if results[3].Error == "" || len(results[3].Logs) != 0 {
+		t.Errorf("forward without funds succeeded: have %+v", results[3])
+	}
+	// Too many calls are refused upfront
+	if _, err := api.CallMany(context.Background(), make([]CallArgs, maxCallManyCalls+1), latest, nil, nil); err == nil {
+		t.Errorf("oversized batch accepted")
+	}
+}
+
+// Tests that the RPC gas cap applies to the whole eth_callMany sequence.
+func TestCallManyGasCap(t *testing.T) {
+	var (
+		sender    = common.Address{0x01}
+		recipient = common.Address{0x02}
+		latest    = rpc.BlockNumberOrHashWithNumber(rpc.LatestBlockNumber)
+	)
+	backend := newTestBackend(t, 1, sender)
+	defer backend.chain.Stop()
+
+	backend.gasCap = 2 * params.TxGas
+	call := CallArgs{From: &sender, To: &recipient}
+
+	api := NewPublicBlockChainAPI(backend)
+	if _, err := api.CallMany(context.Background(), []CallArgs{call, call}, latest, nil, nil); err != nil {
+		t.Fatalf("failed to execute calls within the gas cap: %v", err)
+	}
+	if _, err := api.CallMany(context.Background(), []CallArgs{call, call, call}, latest, nil, nil); err == nil {
+		t.Errorf("calls exceeding the gas cap executed")
+	}
+}
+
+// Tests that BLOCKHASH resolves against the chain the state was taken from when
+// the block number is overridden.
+func TestCallManyBlockHash(t *testing.T) {
+	var (
+		sender = common.Address{0x01}
+		hasher = common.Address{0x02}
+		latest = rpc.BlockNumberOrHashWithNumber(rpc.LatestBlockNumber)
+	)
+	backend := newTestBackend(t, 10, sender)
+	defer backend.chain.Stop()
+
+	overrides := &StateOverride{
+		// MSTORE(0, BLOCKHASH(9)); RETURN(0, 32)
+		hasher: {Code: &hexutil.Bytes{0x60, 0x09, 0x40, 0x60, 0x00, 0x52, 0x60, 0x20, 0x60, 0x00, 0xf3}},
+	}
+	blockOverrides := &BlockOverrides{Number: (*hexutil.Big)(big.NewInt(12))}
+
+	api := NewPublicBlockChainAPI(backend)
+	results, err := api.CallMany(context.Background(), []CallArgs{{From: &sender, To: &hasher}}, latest, overrides, blockOverrides)
+	if err != nil {
+		t.Fatalf("failed to execute call: %v", err)
+	}
+	if have, want := common.BytesToHash(results[0].ReturnData), backend.chain.GetHeaderByNumber(9).Hash(); have != want {
+		t.Errorf("block hash mismatch: have %x, want %x", have, want)
+	}
+}
@@ -181,6 +181,10 @@ web3._extend({
 			call: 'admin_importChain',
 			params: 1
 		}),
+		new web3._extend.Method({
+			name: 'reloadTxPoolRules',
+			call: 'admin_reloadTxPoolRules'
+		}),
 		new web3._extend.Method({
 			name: 'sleepBlocks',
 			call: 'admin_sleepBlocks',
@@ -472,6 +476,16 @@ web3._extend({
 			call: 'debug_getBadBlocks',
 			params: 0,
 		}),
+		new web3._extend.Method({
+			name: 'prunedBlocks',
+			call: 'debug_prunedBlocks',
+			params: 0,
+		}),
+		new web3._extend.Method({
+			name: 'statePruningStatus',
+			call: 'debug_statePruningStatus',
+			params: 0,
+		}),
 		new web3._extend.Method({
 			name: 'storageRangeAt',
 			call: 'debug_storageRangeAt',
@@ -545,6 +559,11 @@ web3._extend({
 			params: 1,
 			inputFormatter: [web3._extend.formatters.inputTransactionFormatter]
 		}),
+		new web3._extend.Method({
+			name: 'sendPrivateRawTransaction',
+			call: 'eth_sendPrivateRawTransaction',
+			params: 1
+		}),
 		new web3._extend.Method({
 			name: 'getHeaderByNumber',
 			call: 'eth_getHeaderByNumber',
@@ -593,6 +612,22 @@ web3._extend({
 			params: 2,
 			inputFormatter: [null, web3._extend.formatters.inputBlockNumberFormatter],
 		}),
+		new web3._extend.Method({
+			name: 'callMany',
+			call: 'eth_callMany',
+			params: 4,
+			inputFormatter: [null, web3._extend.formatters.inputBlockNumberFormatter, null, null],
+		}),
+		new web3._extend.Method({
+			name: 'getLogsPaged',
+			call: 'eth_getLogsPaged',
+			params: 2,
+		}),
+		new web3._extend.Method({
+			name: 'gasPriceEstimates',
+			call: 'eth_gasPriceEstimates',
+			params: 0,
+		}),
 	],
 	properties: [
 		new web3._extend.Property({
@@ -647,6 +682,11 @@ web3._extend({
 			call: 'miner_setRecommitInterval',
 			params: 1,
 		}),
+		new web3._extend.Method({
+			name: 'sendBundle',
+			call: 'miner_sendBundle',
+			params: 1,
+		}),
 		new web3._extend.Method({
 			name: 'getHashrate',
 			call: 'miner_getHashrate'
@@ -785,7 +825,13 @@ web3._extend({
 const TxpoolJs = `
 web3._extend({
 	property: 'txpool',
-	methods: [],
+	methods: [
+		new web3._extend.Method({
+			name: 'getTransactionMeta',
+			call: 'txpool_getTransactionMeta',
+			params: 1
+		}),
+	],
 	properties:
 	[
 		new web3._extend.Property({
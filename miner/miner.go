@@ -52,6 +52,8 @@ type Config struct {
 	GasPrice      *big.Int       // Minimum gas price for mining a transaction
 	Recommit      time.Duration  // The time interval for miner to re-create mining work.
 	Noverify      bool           // Disable remote mining solution verification(only useful in ethash).
+
+	Ordering OrderingStrategy `toml:"-"` // Strategy supplying the transactions of new blocks (nil = price and nonce)
 }
 
 // Miner creates blocks and searches for proof-of-work values.
@@ -239,6 +241,23 @@ func (miner *Miner) DisablePreseal() {
 	miner.worker.disablePreseal()
 }
 
+// SendBundle queues a bundle for inclusion at the top of the blocks within its
+// range. Without a maximum block number, the bundle is kept for a default
+// number of blocks. It fails unless the ordering strategy supports bundles.
+func (miner *Miner) SendBundle(bundle *Bundle) error {
+	acceptor, ok := miner.worker.ordering.(bundleAcceptor)
+	if !ok {
+		return errBundlesNotSupported
+	}
+	if bundle.MaxBlockNumber == 0 {
+		bundle.MaxBlockNumber = miner.eth.BlockChain().CurrentBlock().NumberU64() + defaultBundleBlocks
+	}
+	if bundle.MinBlockNumber > bundle.MaxBlockNumber {
+		return errBundleRange
+	}
+	return acceptor.AddBundle(bundle)
+}
+
 // SubscribePendingLogs starts delivering logs from pending transactions
 // to the given channel.
 func (miner *Miner) SubscribePendingLogs(ch chan<- []*types.Log) event.Subscription {
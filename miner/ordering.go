@@ -0,0 +1,209 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package miner
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+const (
+	// maxBundles is the maximum number of bundles waiting for inclusion.
+	maxBundles = 256
+
+	// defaultBundleBlocks is the number of blocks a bundle without a maximum
+	// block number may be included in.
+	defaultBundleBlocks = 100
+)
+
+var (
+	// errBundlesNotSupported is returned if a bundle is submitted to a miner whose
+	// ordering strategy does not include bundles.
+	errBundlesNotSupported = errors.New("ordering strategy does not support bundles")
+
+	// errEmptyBundle is returned if a bundle without transactions is submitted.
+	errEmptyBundle = errors.New("bundle without transactions")
+
+	// errBundlePoolFull is returned if a bundle is submitted while the maximum
+	// number of bundles are already waiting for inclusion.
+	errBundlePoolFull = errors.New("bundle pool full")
+
+	// errBundleRange is returned if a bundle's minimum block number is above its
+	// maximum one.
+	errBundleRange = errors.New("bundle minimum block above maximum")
+
+	// errBundleReverted is returned if a transaction of a bundle reverted without
+	// being allowed to.
+	errBundleReverted = errors.New("bundle transaction reverted")
+)
+
+// TransactionSequence is an ordered set of transactions committed into a block
+// one after the other. After a transaction was committed, the worker either
+// shifts in the next one of the same account or pops the whole account if its
+// remaining transactions cannot be executed any more.
+type TransactionSequence interface {
+	// Peek returns the next transaction to commit, or nil if all are done.
+	Peek() *types.Transaction
+
+	// Shift replaces the current transaction with the next one of its account.
+	Shift()
+
+	// Pop removes the current transaction along with the rest of its account.
+	Pop()
+
+	// CurrentSize returns the number of accounts with transactions left.
+	CurrentSize() int
+}
+
+// Bundle is a list of transactions committed atomically, in order, on top of a
+// block. If any of its transactions fails, or reverts without being allowed to,
+// none of them is included.
+type Bundle struct {
+	Txs               types.Transactions
+	MinBlockNumber    uint64        // First block the bundle may be included in (0 = next block)
+	MaxBlockNumber    uint64        // Last block the bundle may be included in
+	RevertingTxHashes []common.Hash // Transactions allowed to revert without discarding the bundle
+}
+
+// Hash returns the hash identifying the bundle, the hash of its concatenated
+// transaction hashes.
+func (b *Bundle) Hash() common.Hash {
+	hashes := make([]byte, 0, len(b.Txs)*common.HashLength)
+	for _, tx := range b.Txs {
+		hashes = append(hashes, tx.Hash().Bytes()...)
+	}
+	return crypto.Keccak256Hash(hashes)
+}
+
+// canRevert returns whether the given transaction of the bundle may revert.
+func (b *Bundle) canRevert(hash common.Hash) bool {
+	for _, reverting := range b.RevertingTxHashes {
+		if reverting == hash {
+			return true
+		}
+	}
+	return false
+}
+
+// BlockOrder is the sequence of transactions of a new block: the bundles go
+// first, then the transaction sequences, one after the other.
+type BlockOrder struct {
+	Bundles   []*Bundle
+	Sequences []TransactionSequence
+}
+
+// OrderingStrategy supplies the transactions of the blocks created by the miner.
+type OrderingStrategy interface {
+	// Order arranges the pending transactions of the pool, split into the local
+	// and the remote ones, for the block with the given header.
+	Order(signer types.Signer, header *types.Header, locals, remotes map[common.Address]types.Transactions) *BlockOrder
+}
+
+// bundleAcceptor is implemented by the ordering strategies including bundles.
+type bundleAcceptor interface {
+	AddBundle(bundle *Bundle) error
+}
+
+// PriceNonceOrdering is the default ordering strategy. It commits the local
+// transactions before the remote ones, each sorted by price and nonce.
+type PriceNonceOrdering struct{}
+
+// Order implements OrderingStrategy, sorting the transactions by price and nonce.
+func (PriceNonceOrdering) Order(signer types.Signer, header *types.Header, locals, remotes map[common.Address]types.Transactions) *BlockOrder {
+	order := new(BlockOrder)
+	if len(locals) > 0 {
+		order.Sequences = append(order.Sequences, types.NewTransactionsByPriceAndNonce(signer, locals))
+	}
+	if len(remotes) > 0 {
+		order.Sequences = append(order.Sequences, types.NewTransactionsByPriceAndNonce(signer, remotes))
+	}
+	return order
+}
+
+// BundleOrdering is an ordering strategy committing the bundles submitted by the
+// operator at the top of the block, in submission order, followed by the pool
+// transactions sorted by price and nonce.
+//
+// Bundles are kept until the head passes their maximum block number. A bundle
+// already included in a block is discarded by any later one, its transactions
+// failing the nonce check.
+type BundleOrdering struct {
+	PriceNonceOrdering
+
+	bundles []*Bundle
+	lock    sync.Mutex
+}
+
+// NewBundleOrdering creates an ordering strategy placing bundles first.
+func NewBundleOrdering() *BundleOrdering {
+	return new(BundleOrdering)
+}
+
+// AddBundle queues a bundle for inclusion in the blocks within its range.
+func (o *BundleOrdering) AddBundle(bundle *Bundle) error {
+	if len(bundle.Txs) == 0 {
+		return errEmptyBundle
+	}
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	if len(o.bundles) >= maxBundles {
+		return errBundlePoolFull
+	}
+	o.bundles = append(o.bundles, bundle)
+	return nil
+}
+
+// Bundles returns the bundles waiting for inclusion.
+func (o *BundleOrdering) Bundles() []*Bundle {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	return append([]*Bundle(nil), o.bundles...)
+}
+
+// Order implements OrderingStrategy, placing the bundles eligible for the block
+// before the pool transactions.
+func (o *BundleOrdering) Order(signer types.Signer, header *types.Header, locals, remotes map[common.Address]types.Transactions) *BlockOrder {
+	order := o.PriceNonceOrdering.Order(signer, header, locals, remotes)
+
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	number := header.Number.Uint64()
+	live := o.bundles[:0]
+	for _, bundle := range o.bundles {
+		if bundle.MaxBlockNumber < number {
+			log.Debug("Dropping expired bundle", "hash", bundle.Hash(), "max", bundle.MaxBlockNumber)
+			continue
+		}
+		live = append(live, bundle)
+		if bundle.MinBlockNumber <= number {
+			order.Bundles = append(order.Bundles, bundle)
+		}
+	}
+	for i := len(live); i < len(o.bundles); i++ {
+		o.bundles[i] = nil
+	}
+	o.bundles = live
+	return order
+}
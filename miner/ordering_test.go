@@ -0,0 +1,98 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package miner
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/event"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// Tests that the bundle ordering commits the eligible bundles atomically at the
+// top of the block, discarding the ones with unexpected reverts.
+func TestBundleOrdering(t *testing.T) {
+	backend := newTestWorkerBackend(t, ethashChainConfig, ethash.NewFaker(), rawdb.NewMemoryDatabase(), 0)
+	defer backend.chain.Stop()
+
+	ordering := NewBundleOrdering()
+	config := *testConfig
+	config.Ordering = ordering
+
+	w := newWorker(&config, ethashChainConfig, ethash.NewFaker(), backend, new(event.TypeMux), nil, false)
+	defer w.close()
+
+	transfer := func(nonce uint64) *types.Transaction {
+		tx, _ := types.SignTx(types.NewTransaction(nonce, testUserAddress, big.NewInt(1000), params.TxGas, big.NewInt(0), nil), types.HomesteadSigner{}, testBankKey)
+		return tx
+	}
+	revert := func(nonce uint64) *types.Transaction {
+		// PUSH1 0 PUSH1 0 REVERT
+		tx, _ := types.SignTx(types.NewContractCreation(nonce, big.NewInt(0), 100000, big.NewInt(0), common.FromHex("0x60006000fd")), types.HomesteadSigner{}, testBankKey)
+		return tx
+	}
+	var (
+		good     = &Bundle{Txs: types.Transactions{transfer(0), transfer(1)}, MaxBlockNumber: 1}
+		reverted = &Bundle{Txs: types.Transactions{transfer(2), revert(3)}, MaxBlockNumber: 1}
+		allowed  = &Bundle{Txs: types.Transactions{transfer(2), revert(3)}, MaxBlockNumber: 1}
+		future   = &Bundle{Txs: types.Transactions{transfer(4)}, MinBlockNumber: 2, MaxBlockNumber: 2}
+	)
+	allowed.RevertingTxHashes = []common.Hash{allowed.Txs[1].Hash()}
+
+	if err := ordering.AddBundle(&Bundle{}); err != errEmptyBundle {
+		t.Fatalf("empty bundle: have %v, want %v", err, errEmptyBundle)
+	}
+	for _, bundle := range []*Bundle{good, reverted, allowed, future} {
+		if err := ordering.AddBundle(bundle); err != nil {
+			t.Fatalf("failed to add bundle: %v", err)
+		}
+	}
+	w.commitNewWork(nil, true, time.Now().Unix())
+
+	var want []common.Hash
+	for _, tx := range append(good.Txs, allowed.Txs...) {
+		want = append(want, tx.Hash())
+	}
+	if len(w.current.txs) != len(want) {
+		t.Fatalf("transaction count mismatch: have %d, want %d", len(w.current.txs), len(want))
+	}
+	// All transactions but the allowed revert at the end succeed
+	for i, tx := range w.current.txs {
+		if tx.Hash() != want[i] {
+			t.Errorf("transaction %d mismatch: have %x, want %x", i, tx.Hash(), want[i])
+		}
+		if i < len(w.current.receipts)-1 && w.current.receipts[i].Status != types.ReceiptStatusSuccessful {
+			t.Errorf("transaction %d failed", i)
+		}
+	}
+	if nonce := w.current.state.GetNonce(testBankAddress); nonce != 4 {
+		t.Errorf("nonce mismatch: have %d, want %d", nonce, 4)
+	}
+	if gas := w.current.receipts[len(w.current.receipts)-1].CumulativeGasUsed; w.current.header.GasUsed != gas {
+		t.Errorf("gas used mismatch: have %d, want %d", w.current.header.GasUsed, gas)
+	}
+	// Only the future bundle is kept for the next blocks
+	if bundles := ordering.Bundles(); len(bundles) != 1 || bundles[0] != future {
+		t.Errorf("pending bundles mismatch: have %v", bundles)
+	}
+}
@@ -137,6 +137,7 @@ type worker struct {
 	engine      consensus.Engine
 	eth         Backend
 	chain       *core.BlockChain
+	ordering    OrderingStrategy
 
 	// Feeds
 	pendingLogsFeed event.Feed
@@ -222,6 +223,9 @@ func newWorker(config *Config, chainConfig *params.ChainConfig, engine consensus
 		resubmitIntervalCh: make(chan time.Duration),
 		resubmitAdjustCh:   make(chan *intervalAdjust, resubmitAdjustChanSize),
 	}
+	if worker.ordering = config.Ordering; worker.ordering == nil {
+		worker.ordering = PriceNonceOrdering{}
+	}
 	// Subscribe NewTxsEvent for tx pool
 	worker.txsSub = eth.TxPool().SubscribeNewTxsEvent(worker.txsCh)
 	// Subscribe events for blockchain
@@ -776,13 +780,9 @@ func (w *worker) commitTransaction(tx *types.Transaction, coinbase common.Addres
 	return receipt.Logs, nil
 }
 
-func (w *worker) commitTransactions(txs *types.TransactionsByPriceAndNonce, coinbase common.Address, interrupt *int32) bool {
-
-	// Short circuit if current is nil
-	if w.current == nil {
-		return true
-	}
-
+// prepareGasPool creates the gas pool of the current block if not done yet,
+// reserving the gas of the system transactions.
+func (w *worker) prepareGasPool() {
 	if w.current.gasPool == nil {
 		w.current.gasPool = new(core.GasPool).AddGas(w.current.header.GasLimit)
 		if w.chain.Config().IsEuler(w.current.header.Number) {
@@ -790,8 +790,64 @@ func (w *worker) commitTransactions(txs *types.TransactionsByPriceAndNonce, coin
 		} else {
 			w.current.gasPool.SubGas(params.SystemTxsGas)
 		}
+	}
+}
+
+// commitBundle commits the transactions of a bundle on top of the current block.
+// If any of them fails, or reverts without being allowed to, the block is left
+// untouched.
+func (w *worker) commitBundle(bundle *Bundle, coinbase common.Address) error {
+	w.prepareGasPool()
 
+	var (
+		env      = *w.current
+		gas      = w.current.gasPool.Gas()
+		gasUsed  = w.current.header.GasUsed
+		bundleTx = len(w.current.txs)
+	)
+	// Transactions are finalised as they are applied, so the state can't be
+	// reverted to a snapshot. Work on a copy instead and only keep it if the
+	// whole bundle went through.
+	w.current.state = env.state.Copy()
+
+	for _, tx := range bundle.Txs {
+		if tx.Protected() && !w.chainConfig.IsEIP155(w.current.header.Number) {
+			w.abortBundle(&env, gas, gasUsed)
+			return core.ErrTxTypeNotSupported
+		}
+		w.current.state.Prepare(tx.Hash(), common.Hash{}, w.current.tcount)
+
+		_, err := w.commitTransaction(tx, coinbase)
+		if err == nil && w.current.receipts[len(w.current.receipts)-1].Status == types.ReceiptStatusFailed && !bundle.canRevert(tx.Hash()) {
+			err = errBundleReverted
+		}
+		if err != nil {
+			w.abortBundle(&env, gas, gasUsed)
+			return err
+		}
+		w.current.tcount++
 	}
+	log.Debug("Committed bundle", "hash", bundle.Hash(), "txs", len(w.current.txs)-bundleTx)
+	return nil
+}
+
+// abortBundle restores the current block to its state before a failed bundle.
+func (w *worker) abortBundle(env *environment, gas uint64, gasUsed uint64) {
+	*w.current.gasPool = core.GasPool(gas)
+	w.current.header.GasUsed = gasUsed
+	w.current.state = env.state
+	w.current.tcount = env.tcount
+	w.current.txs = env.txs
+	w.current.receipts = env.receipts
+}
+
+func (w *worker) commitTransactions(txs TransactionSequence, coinbase common.Address, interrupt *int32) bool {
+
+	// Short circuit if current is nil
+	if w.current == nil {
+		return true
+	}
+	w.prepareGasPool()
 
 	var coalescedLogs []*types.Log
 	var stopTimer *time.Timer
@@ -812,10 +868,13 @@ func (w *worker) commitTransactions(txs *types.TransactionsByPriceAndNonce, coin
 	interruptCh := make(chan struct{})
 	defer close(interruptCh)
 	//prefetch txs from all pending txs
-	txsPrefetch := txs.Copy()
-	tx := txsPrefetch.Peek()
+	var tx *types.Transaction
 	txCurr := &tx
-	w.prefetcher.PrefetchMining(txsPrefetch, w.current.header, w.current.gasPool.Gas(), w.current.state.Copy(), *w.chain.GetVMConfig(), interruptCh, txCurr)
+	if heap, ok := txs.(*types.TransactionsByPriceAndNonce); ok {
+		txsPrefetch := heap.Copy()
+		tx = txsPrefetch.Peek()
+		w.prefetcher.PrefetchMining(txsPrefetch, w.current.header, w.current.gasPool.Gas(), w.current.state.Copy(), *w.chain.GetVMConfig(), interruptCh, txCurr)
+	}
 
 LOOP:
 	for {
@@ -1025,25 +1084,25 @@ func (w *worker) commitNewWork(interrupt *int32, noempty bool, timestamp int64)
 	if err != nil {
 		log.Error("Failed to fetch pending transactions", "err", err)
 	}
+	// Split the pending transactions into locals and remotes
+	localTxs, remoteTxs := make(map[common.Address]types.Transactions), pending
+	for _, account := range w.eth.TxPool().Locals() {
+		if txs := remoteTxs[account]; len(txs) > 0 {
+			delete(remoteTxs, account)
+			localTxs[account] = txs
+		}
+	}
+	order := w.ordering.Order(w.current.signer, header, localTxs, remoteTxs)
+
 	// Short circuit if there is no available pending transactions
-	if len(pending) != 0 {
+	if len(order.Bundles) != 0 || len(order.Sequences) != 0 {
 		start := time.Now()
-		// Split the pending transactions into locals and remotes
-		localTxs, remoteTxs := make(map[common.Address]types.Transactions), pending
-		for _, account := range w.eth.TxPool().Locals() {
-			if txs := remoteTxs[account]; len(txs) > 0 {
-				delete(remoteTxs, account)
-				localTxs[account] = txs
-			}
-		}
-		if len(localTxs) > 0 {
-			txs := types.NewTransactionsByPriceAndNonce(w.current.signer, localTxs)
-			if w.commitTransactions(txs, w.coinbase, interrupt) {
-				return
+		for _, bundle := range order.Bundles {
+			if err := w.commitBundle(bundle, w.coinbase); err != nil {
+				log.Debug("Bundle discarded", "hash", bundle.Hash(), "err", err)
 			}
 		}
-		if len(remoteTxs) > 0 {
-			txs := types.NewTransactionsByPriceAndNonce(w.current.signer, remoteTxs)
+		for _, txs := range order.Sequences {
 			if w.commitTransactions(txs, w.coinbase, interrupt) {
 				return
 			}
@@ -70,6 +70,15 @@ type Config struct {
 	// in memory.
 	DataDir string
 
+	// DBEngine is the storage engine of the databases, either "leveldb" or
+	// "pebble". If empty, the engine of an existing database is used and new
+	// ones are created with leveldb.
+	DBEngine string `toml:",omitempty"`
+
+	// AncientZstd compresses the new ancient bodies and receipts tables with zstd
+	// instead of snappy. Existing tables keep their compression.
+	AncientZstd bool `toml:",omitempty"`
+
 	// Configuration of peer-to-peer networking.
 	P2P p2p.Config
 
@@ -32,7 +32,6 @@ import (
 	"github.com/ethereum/go-ethereum/accounts"
 	"github.com/ethereum/go-ethereum/core/rawdb"
 	"github.com/ethereum/go-ethereum/ethdb"
-	"github.com/ethereum/go-ethereum/ethdb/leveldb"
 	"github.com/ethereum/go-ethereum/event"
 	"github.com/ethereum/go-ethereum/log"
 	"github.com/ethereum/go-ethereum/p2p"
@@ -573,7 +572,11 @@ func (n *Node) OpenDatabase(name string, cache, handles int, namespace string, r
 	if n.config.DataDir == "" {
 		db = rawdb.NewMemoryDatabase()
 	} else {
-		db, err = rawdb.NewLevelDBDatabase(n.ResolvePath(name), cache, handles, namespace, readonly)
+		var kvdb ethdb.KeyValueStore
+		kvdb, err = rawdb.NewKeyValueStore(n.config.DBEngine, n.ResolvePath(name), cache, handles, namespace, readonly)
+		if err == nil {
+			db = rawdb.NewDatabase(kvdb)
+		}
 	}
 
 	if err == nil {
@@ -626,7 +629,7 @@ func (n *Node) OpenDatabaseWithFreezer(name string, cache, handles int, freezer,
 		case !filepath.IsAbs(freezer):
 			freezer = n.ResolvePath(freezer)
 		}
-		db, err = rawdb.NewLevelDBDatabaseWithFreezer(root, cache, handles, freezer, namespace, readonly, disableFreeze, isLastOffset)
+		db, err = rawdb.NewKeyValueStoreWithFreezer(n.config.DBEngine, root, cache, handles, freezer, namespace, readonly, disableFreeze, isLastOffset, n.config.AncientZstd)
 	}
 
 	if err == nil {
@@ -635,15 +638,15 @@ func (n *Node) OpenDatabaseWithFreezer(name string, cache, handles int, freezer,
 	return db, err
 }
 
-func (n *Node) OpenDiffDatabase(name string, handles int, diff, namespace string, readonly bool) (*leveldb.Database, error) {
+// OpenDiffDatabase opens the store of the persisted diff layers, using the same
+// storage engine as the chain database.
+func (n *Node) OpenDiffDatabase(name string, handles int, diff, namespace string, readonly bool) (ethdb.KeyValueStore, error) {
 	n.lock.Lock()
 	defer n.lock.Unlock()
 	if n.state == closedState {
 		return nil, ErrNodeStopped
 	}
 
-	var db *leveldb.Database
-	var err error
 	if n.config.DataDir == "" {
 		panic("datadir is missing")
 	}
@@ -654,9 +657,7 @@ func (n *Node) OpenDiffDatabase(name string, handles int, diff, namespace string
 	case !filepath.IsAbs(diff):
 		diff = n.ResolvePath(diff)
 	}
-	db, err = leveldb.New(diff, 0, handles, namespace, readonly)
-
-	return db, err
+	return rawdb.NewKeyValueStore(n.config.DBEngine, diff, 0, handles, namespace, readonly)
 }
 
 // ResolvePath returns the absolute path of a resource in the instance directory.
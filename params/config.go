@@ -20,6 +20,7 @@ import (
 	"encoding/binary"
 	"fmt"
 	"math/big"
+	"sort"
 
 	"github.com/ethereum/go-ethereum/common"
 	"golang.org/x/crypto/sha3"
@@ -341,16 +342,16 @@ var (
 	//
 	// This configuration is intentionally not using keyed fields to force anyone
 	// adding flags to the config to also have to set these fields.
-	AllEthashProtocolChanges = &ChainConfig{big.NewInt(1337), big.NewInt(0), nil, false, big.NewInt(0), common.Hash{}, big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), nil, nil, nil, big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), new(EthashConfig), nil, nil}
+	AllEthashProtocolChanges = &ChainConfig{big.NewInt(1337), big.NewInt(0), nil, false, big.NewInt(0), common.Hash{}, big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), nil, nil, nil, big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), new(EthashConfig), nil, nil, nil, nil}
 
 	// AllCliqueProtocolChanges contains every protocol change (EIPs) introduced
 	// and accepted by the Ethereum core developers into the Clique consensus.
 	//
 	// This configuration is intentionally not using keyed fields to force anyone
 	// adding flags to the config to also have to set these fields.
-	AllCliqueProtocolChanges = &ChainConfig{big.NewInt(1337), big.NewInt(0), nil, false, big.NewInt(0), common.Hash{}, big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), nil, nil, nil, big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), nil, &CliqueConfig{Period: 0, Epoch: 30000}, nil}
+	AllCliqueProtocolChanges = &ChainConfig{big.NewInt(1337), big.NewInt(0), nil, false, big.NewInt(0), common.Hash{}, big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), nil, nil, nil, big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), nil, &CliqueConfig{Period: 0, Epoch: 30000}, nil, nil, nil}
 
-	TestChainConfig = &ChainConfig{big.NewInt(1), big.NewInt(0), nil, false, big.NewInt(0), common.Hash{}, big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), nil, nil, nil, big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), new(EthashConfig), nil, nil}
+	TestChainConfig = &ChainConfig{big.NewInt(1), big.NewInt(0), nil, false, big.NewInt(0), common.Hash{}, big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), nil, nil, nil, big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), new(EthashConfig), nil, nil, nil, nil}
 
 	TestRules = TestChainConfig.Rules(new(big.Int))
 )
@@ -444,6 +445,20 @@ type ChainConfig struct {
 	Ethash *EthashConfig `json:"ethash,omitempty" toml:",omitempty"`
 	Clique *CliqueConfig `json:"clique,omitempty" toml:",omitempty"`
 	Parlia *ParliaConfig `json:"parlia,omitempty" toml:",omitempty"`
+
+	// Plug-in precompiled contracts enabled on top of the ones of the forks
+	Precompiles []PrecompileConfig `json:"precompiles,omitempty" toml:",omitempty"`
+
+	precompiles *precompileSchedule // Activation schedule of the plug-in precompiles, see SchedulePrecompiles
+}
+
+// PrecompileConfig enables a plug-in precompiled contract, registered with the
+// virtual machine under its name, at an address from a block on. It is meant
+// for devnets and testing.
+type PrecompileConfig struct {
+	Name    string         `json:"name"`
+	Address common.Address `json:"address"`
+	Block   *big.Int       `json:"block"` // Activation block (nil = disabled, 0 = already activated)
 }
 
 // EthashConfig is the consensus engine configs for proof-of-work based sealing.
@@ -746,6 +761,35 @@ func (c *ChainConfig) checkCompatible(newcfg *ChainConfig, head *big.Int) *Confi
 	if isForkIncompatible(c.EulerBlock, newcfg.EulerBlock, head) {
 		return newCompatError("euler fork block", c.EulerBlock, newcfg.EulerBlock)
 	}
+	return checkPrecompilesCompatible(c.Precompiles, newcfg.Precompiles, head)
+}
+
+// checkPrecompilesCompatible checks whether the plug-in precompiles scheduled
+// by two configs only differ after the head.
+func checkPrecompilesCompatible(stored, updated []PrecompileConfig, head *big.Int) *ConfigCompatError {
+	index := func(precompiles []PrecompileConfig) map[common.Address]PrecompileConfig {
+		indexed := make(map[common.Address]PrecompileConfig)
+		for _, precompile := range precompiles {
+			indexed[precompile.Address] = precompile
+		}
+		return indexed
+	}
+	olds, news := index(stored), index(updated)
+	for addr := range news {
+		if _, ok := olds[addr]; !ok {
+			olds[addr] = PrecompileConfig{Address: addr}
+		}
+	}
+	for addr, old := range olds {
+		updated := news[addr]
+		what := fmt.Sprintf("precompile %x activation block", addr)
+		if isForkIncompatible(old.Block, updated.Block, head) {
+			return newCompatError(what, old.Block, updated.Block)
+		}
+		if old.Name != updated.Name && isForked(old.Block, head) {
+			return newCompatError(what, old.Block, updated.Block)
+		}
+	}
 	return nil
 }
 
@@ -814,6 +858,8 @@ type Rules struct {
 	IsHomestead, IsEIP150, IsEIP155, IsEIP158               bool
 	IsByzantium, IsConstantinople, IsPetersburg, IsIstanbul bool
 	IsBerlin, IsCatalyst                                    bool
+
+	Precompiles map[common.Address]string // Names of the plug-in precompiles active, by address, shared and read only
 }
 
 // Rules ensures c's ChainID is not nil.
@@ -834,5 +880,74 @@ func (c *ChainConfig) Rules(num *big.Int) Rules {
 		IsIstanbul:       c.IsIstanbul(num),
 		IsBerlin:         c.IsBerlin(num),
 		IsCatalyst:       c.IsCatalyst(num),
+		Precompiles:      c.activePrecompiles(num),
+	}
+}
+
+// precompileSchedule is the set of plug-in precompiles active from each of the
+// activation blocks of a config on. The sets are shared by all the rules
+// created from the config.
+type precompileSchedule struct {
+	source []PrecompileConfig          // Precompiles the schedule was built from
+	blocks []*big.Int                  // Distinct activation blocks, ascending
+	active []map[common.Address]string // Precompiles active from each block on
+}
+
+// newPrecompileSchedule builds the activation schedule of plug-in precompiles.
+func newPrecompileSchedule(precompiles []PrecompileConfig) *precompileSchedule {
+	enabled := make([]PrecompileConfig, 0, len(precompiles))
+	for _, precompile := range precompiles {
+		if precompile.Block != nil {
+			enabled = append(enabled, precompile)
+		}
+	}
+	sort.SliceStable(enabled, func(i, j int) bool { return enabled[i].Block.Cmp(enabled[j].Block) < 0 })
+
+	schedule := &precompileSchedule{source: precompiles}
+	for _, precompile := range enabled {
+		last := len(schedule.blocks) - 1
+		if last < 0 || schedule.blocks[last].Cmp(precompile.Block) != 0 {
+			active := make(map[common.Address]string)
+			if last >= 0 {
+				for addr, name := range schedule.active[last] {
+					active[addr] = name
+				}
+			}
+			schedule.blocks = append(schedule.blocks, precompile.Block)
+			schedule.active = append(schedule.active, active)
+			last++
+		}
+		schedule.active[last][precompile.Address] = precompile.Name
+	}
+	return schedule
+}
+
+// SchedulePrecompiles builds the activation schedule of the plug-in precompiles
+// of the config, so rules are created without allocating. It must be called
+// again whenever the precompiles are replaced, never while the config is in use.
+func (c *ChainConfig) SchedulePrecompiles() {
+	if len(c.Precompiles) != 0 {
+		c.precompiles = newPrecompileSchedule(c.Precompiles)
+	}
+}
+
+// activePrecompiles returns the names of the plug-in precompiles active at the
+// given block, by address, or nil if there are none. The precompiles of a config
+// must not be modified in place once scheduled.
+func (c *ChainConfig) activePrecompiles(num *big.Int) map[common.Address]string {
+	if len(c.Precompiles) == 0 || num == nil {
+		return nil
+	}
+	// Build a temporary schedule if the config wasn't scheduled, or if its
+	// precompiles were replaced since
+	schedule := c.precompiles
+	if schedule == nil || len(schedule.source) != len(c.Precompiles) || &schedule.source[0] != &c.Precompiles[0] {
+		schedule = newPrecompileSchedule(c.Precompiles)
+	}
+	// Pick the last activation block reached
+	index := sort.Search(len(schedule.blocks), func(i int) bool { return schedule.blocks[i].Cmp(num) > 0 })
+	if index == 0 {
+		return nil
 	}
+	return schedule.active[index-1]
 }
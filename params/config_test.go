@@ -20,6 +20,8 @@ import (
 	"math/big"
 	"reflect"
 	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
 )
 
 func TestCheckCompatible(t *testing.T) {
@@ -96,3 +98,47 @@ func TestCheckCompatible(t *testing.T) {
 		}
 	}
 }
+
+// Tests that the plug-in precompiles are activated at their blocks, with the
+// active sets built once per config when scheduled.
+func TestActivePrecompiles(t *testing.T) {
+	var (
+		a, b, c = common.Address{0x0a}, common.Address{0x0b}, common.Address{0x0c}
+		config  = &ChainConfig{Precompiles: []PrecompileConfig{
+			{Name: "b", Address: b, Block: big.NewInt(10)},
+			{Name: "a", Address: a, Block: big.NewInt(5)},
+			{Name: "c", Address: c, Block: big.NewInt(10)},
+			{Name: "disabled", Address: common.Address{0x0d}},
+		}}
+	)
+	tests := []struct {
+		number int64
+		want   map[common.Address]string
+	}{
+		{0, nil},
+		{4, nil},
+		{5, map[common.Address]string{a: "a"}},
+		{9, map[common.Address]string{a: "a"}},
+		{10, map[common.Address]string{a: "a", b: "b", c: "c"}},
+		{1000, map[common.Address]string{a: "a", b: "b", c: "c"}},
+	}
+	// The precompiles are active whether the config was scheduled or not
+	for _, scheduled := range []bool{false, true} {
+		if scheduled {
+			config.SchedulePrecompiles()
+		}
+		for _, tt := range tests {
+			if have := config.Rules(big.NewInt(tt.number)).Precompiles; !reflect.DeepEqual(have, tt.want) {
+				t.Errorf("block %d, scheduled %v: active precompiles mismatch: have %v, want %v", tt.number, scheduled, have, tt.want)
+			}
+		}
+	}
+	if allocs := testing.AllocsPerRun(10, func() { config.activePrecompiles(big.NewInt(10)) }); allocs != 0 {
+		t.Errorf("active precompiles allocated: have %v allocs, want 0", allocs)
+	}
+	// Replacing the precompiles of the config ignores the stale schedule
+	config.Precompiles = []PrecompileConfig{{Name: "c", Address: c, Block: big.NewInt(0)}}
+	if have, want := config.Rules(big.NewInt(5)).Precompiles, map[common.Address]string{c: "c"}; !reflect.DeepEqual(have, want) {
+		t.Errorf("active precompiles mismatch after replacement: have %v, want %v", have, want)
+	}
+}
@@ -93,6 +93,8 @@ type Database struct {
 	roughPreimagesSize common.StorageSize
 	roughDirtiesSize   common.StorageSize
 
+	flushHook func(common.Hash) // Callback invoked before flushing a node to disk
+
 	lock sync.RWMutex
 }
 
@@ -316,6 +318,15 @@ func NewDatabaseWithConfig(diskdb ethdb.KeyValueStore, config *Config) *Database
 	return db
 }
 
+// SetFlushHook sets a callback which is invoked with the hash of every trie node
+// right before it's flushed from the dirty cache into the persistent database.
+//
+// Note, this method is not thread safe, the hook should be set before the
+// database is used.
+func (db *Database) SetFlushHook(hook func(common.Hash)) {
+	db.flushHook = hook
+}
+
 // DiskDB retrieves the persistent storage backing the trie database.
 func (db *Database) DiskDB() ethdb.KeyValueStore {
 	return db.diskdb
@@ -640,6 +651,9 @@ func (db *Database) Cap(limit common.StorageSize) error {
 		for size > limit && oldest != (common.Hash{}) {
 			// Fetch the oldest referenced node and push into the batch
 			node := db.dirties[oldest]
+			if db.flushHook != nil {
+				db.flushHook(oldest)
+			}
 			rawdb.WriteTrieNode(batch, oldest, node.rlp())
 
 			// If we exceeded the ideal batch size, commit and reset
@@ -797,6 +811,9 @@ func (db *Database) commit(hash common.Hash, batch ethdb.Batch, uncacher *cleane
 		return err
 	}
 	// If we've reached an optimal batch size, commit and start over
+	if db.flushHook != nil {
+		db.flushHook(hash)
+	}
 	rawdb.WriteTrieNode(batch, hash, node.rlp())
 	if callback != nil {
 		callback(hash)